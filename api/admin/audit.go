@@ -0,0 +1,136 @@
+package admin
+
+import (
+	"bufio"
+	"encoding/json"
+	"log"
+	"time"
+	"zmd5/db/dbModel"
+	"zmd5/repository"
+	"zmd5/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// AuditLogRequest 审计日志查询参数
+type AuditLogRequest struct {
+	Page     int `query:"page"`
+	PageSize int `query:"pageSize"`
+	// 操作者用户名
+	Actor string `query:"actor"`
+	// 操作名称，同时匹配以其为前缀的操作，如 user 匹配 user.disable
+	Action string `query:"action"`
+	// 操作对象包含的关键字
+	Target string `query:"target"`
+	// 结果：success/failure
+	Result    string `query:"result"`
+	StartDate string `query:"startDate"`
+	EndDate   string `query:"endDate"`
+}
+
+// Filter 将请求参数转换为审计日志过滤条件
+func (req *AuditLogRequest) Filter() (repository.AuditLogFilter, *fiber.Error) {
+	since, until, err := utils.ParseDateRange(req.StartDate, req.EndDate)
+	if err != nil {
+		return repository.AuditLogFilter{}, fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	filter := repository.AuditLogFilter{
+		ActorName: req.Actor,
+		Action:    req.Action,
+		Target:    req.Target,
+		Since:     since,
+		Until:     until,
+	}
+	switch req.Result {
+	case "":
+	case "success", "failure":
+		success := req.Result == "success"
+		filter.Success = &success
+	default:
+		return repository.AuditLogFilter{}, fiber.NewError(fiber.StatusBadRequest, "无效的结果: "+req.Result)
+	}
+	return filter, nil
+}
+
+// AuditLogs 分页查询审计日志，按时间倒序
+func AuditLogs(c *fiber.Ctx) error {
+	req := new(AuditLogRequest)
+	if err := c.QueryParser(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "请求参数错误",
+		})
+	}
+	if req.Page <= 0 {
+		req.Page = 1
+	}
+	if req.PageSize <= 0 || req.PageSize > 100 {
+		req.PageSize = 20
+	}
+	filter, ferr := req.Filter()
+	if ferr != nil {
+		return errorResponse(c, ferr)
+	}
+
+	records, total, err := store.AuditLogs.List(filter, (req.Page-1)*req.PageSize, req.PageSize)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "获取审计日志失败",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "获取审计日志成功",
+		"data": fiber.Map{
+			"records":  records,
+			"total":    total,
+			"page":     req.Page,
+			"pageSize": req.PageSize,
+		},
+	})
+}
+
+// 导出审计日志时每批读取的记录数
+const auditExportBatchSize = 1000
+
+// ExportAuditLogs 按过滤条件流式导出审计日志，格式为JSON Lines，按时间正序
+func ExportAuditLogs(c *fiber.Ctx) error {
+	req := new(AuditLogRequest)
+	if err := c.QueryParser(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "请求参数错误",
+		})
+	}
+	filter, ferr := req.Filter()
+	if ferr != nil {
+		return errorResponse(c, ferr)
+	}
+
+	c.Set(fiber.HeaderContentType, "application/x-ndjson")
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="audit-`+time.Now().Format("20060102-150405")+`.jsonl"`)
+
+	// 响应体以流的形式写出，导出大量日志时不会占用过多内存
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		encoder := json.NewEncoder(w)
+		count := 0
+		err := store.AuditLogs.Each(filter, auditExportBatchSize, func(logs []dbModel.AuditLog) error {
+			for i := range logs {
+				if err := encoder.Encode(&logs[i]); err != nil {
+					return err
+				}
+			}
+			count += len(logs)
+			return w.Flush()
+		})
+		if err != nil {
+			log.Printf("导出审计日志失败（已导出%d条）: %v", count, err)
+			return
+		}
+		log.Printf("导出审计日志完成，共%d条记录", count)
+	})
+
+	return nil
+}
@@ -1,16 +1,16 @@
 package admin
 
 import (
-	"crypto/md5"
-	"encoding/hex"
-	"zmd5/db"
 	"zmd5/db/dbModel"
+	"zmd5/utils"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 type EncryptRequest struct {
 	Plaintexts []string `json:"plaintexts"`
+	// 计算哈希时使用的明文编码列表（utf8/gbk/utf16le），为空时默认为utf8
+	Encodings []string `json:"encodings"`
 }
 
 // Encrypt 批量处理明文并存储MD5值
@@ -28,47 +28,54 @@ func Encrypt(c *fiber.Ctx) error {
 		})
 	}
 
-	// 从请求中获取所有明文
-	plaintexts := req.Plaintexts
+	encodings, err := utils.NormalizeEncodings(req.Encodings)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// 按编码计算所有明文的MD5值
+	userID, _ := c.Locals("userID").(uint)
+	candidates := buildEncodedRecords(req.Plaintexts, encodings, dbModel.Provenance{
+		Source: dbModel.SourceAdminBatch,
+		UserID: userID,
+	})
+	md5s := make([]string, 0, len(candidates))
+	for _, record := range candidates {
+		md5s = append(md5s, record.MD5)
+	}
 
-	// 查询已存在的明文
-	var existingRecords []dbModel.Md5
-	if err := db.PG.Where("plaintext IN ?", plaintexts).Find(&existingRecords).Error; err != nil {
+	// 查询已存在的MD5值（同一明文在不同编码下的哈希可能不同，因此以MD5去重）
+	existingMD5s, err := store.Plaintexts.Existing(md5s)
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "查询数据库失败",
 		})
 	}
 
-	// 创建已存在明文的映射，方便快速查找
-	existingPlaintextMap := make(map[string]bool)
-	for _, record := range existingRecords {
-		existingPlaintextMap[record.Plaintext] = true
+	// 已存在的记录被再次提交，标记为多来源
+	store.Plaintexts.MarkReproduced(existingMD5s, 0)
+
+	// 创建已存在MD5的映射，方便快速查找
+	existingMD5Map := make(map[string]bool)
+	for _, m := range existingMD5s {
+		existingMD5Map[m] = true
 	}
 
-	// 只处理不存在的明文
+	// 只处理不存在的记录
 	var md5Records []dbModel.Md5
 	var skippedCount int
 
-	for _, plaintext := range plaintexts {
-		// 检查明文是否已存在
-		if existingPlaintextMap[plaintext] {
+	for _, record := range candidates {
+		// 检查MD5是否已存在
+		if existingMD5Map[record.MD5] {
 			skippedCount++
 			continue
 		}
+		existingMD5Map[record.MD5] = true
 
-		// 计算32位MD5
-		hasher := md5.New()
-		hasher.Write([]byte(plaintext))
-		md5Str := hex.EncodeToString(hasher.Sum(nil))
-
-		// 16位MD5是32位MD5的中间16位
-		md5_16 := md5Str[8:24]
-
-		md5Records = append(md5Records, dbModel.Md5{
-			Plaintext: plaintext,
-			MD5:       md5Str,
-			MD5_16:    md5_16,
-		})
+		md5Records = append(md5Records, record)
 	}
 
 	// 如果没有需要新增的记录，直接返回
@@ -80,8 +87,9 @@ func Encrypt(c *fiber.Ctx) error {
 		})
 	}
 
-	// 批量插入记录
-	if err := db.PG.Create(&md5Records).Error; err != nil {
+	// 批量插入记录，并发写入导致的冲突记录会被跳过
+	added, err := store.Plaintexts.Insert(md5Records, 200)
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "数据保存失败",
 		})
@@ -89,8 +97,31 @@ func Encrypt(c *fiber.Ctx) error {
 
 	return c.JSON(fiber.Map{
 		"message": "成功处理并保存MD5记录",
-		"skipped": skippedCount,
-		"added":   len(md5Records),
+		"skipped": skippedCount + len(md5Records) - int(added),
+		"added":   added,
 		"data":    md5Records,
 	})
 }
+
+// buildEncodedRecords 按编码列表为每个明文生成带来源信息的MD5记录
+// 明文无法用某种编码表示时跳过该编码
+func buildEncodedRecords(plaintexts []string, encodings []string, provenance dbModel.Provenance) []dbModel.Md5 {
+	records := make([]dbModel.Md5, 0, len(plaintexts)*len(encodings))
+	for _, plaintext := range plaintexts {
+		for _, encoding := range encodings {
+			md5Str, err := utils.CalculateMD5WithEncoding(plaintext, encoding)
+			if err != nil {
+				continue
+			}
+
+			records = append(records, dbModel.Md5{
+				Plaintext:  plaintext,
+				MD5:        md5Str,
+				MD5_16:     md5Str[8:24], // 16位MD5是32位MD5的中间16位
+				Encoding:   encoding,
+				Provenance: provenance,
+			})
+		}
+	}
+	return records
+}
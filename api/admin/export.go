@@ -0,0 +1,87 @@
+package admin
+
+import (
+	"bufio"
+	"context"
+	"log"
+	"zmd5/export"
+	"zmd5/jobs"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ExportRequest 定义导出请求参数
+type ExportRequest struct {
+	Format string `query:"format"`
+	Md5FilterRequest
+}
+
+// Export 流式导出明文库
+// 支持 wordlist、potfile、csv 和 ndjson（gzip压缩）格式
+func Export(c *fiber.Ctx) error {
+	req := new(ExportRequest)
+	if err := c.QueryParser(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "请求参数错误",
+		})
+	}
+
+	if req.Format == "" {
+		req.Format = export.FormatWordlist
+	}
+	if !export.ValidFormat(req.Format) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "不支持的导出格式",
+		})
+	}
+
+	filter, err := req.Filter()
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	}
+
+	c.Set(fiber.HeaderContentType, export.ContentType(req.Format))
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="`+export.FileName(req.Format)+`"`)
+
+	opts := export.Options{
+		Format: req.Format,
+		Filter: filter,
+	}
+
+	// 响应体以流的形式写出，导出大量数据时不会占用过多内存
+	// 客户端断开（写入失败）或服务关闭时取消导出，停止扫描明文库
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		ctx, cancel := context.WithCancel(jobs.ShutdownContext())
+		defer cancel()
+		count, err := export.Export(ctx, &streamWriter{w: w, cancel: cancel}, opts)
+		if err != nil {
+			log.Printf("导出明文库失败（已导出%d条）: %v", count, err)
+			return
+		}
+		log.Printf("导出明文库完成，共%d条记录", count)
+	})
+
+	return nil
+}
+
+// streamWriter 将导出数据写入响应流，每次写入后立即发送，发送失败时取消导出
+type streamWriter struct {
+	w      *bufio.Writer
+	cancel context.CancelFunc
+}
+
+func (s *streamWriter) Write(p []byte) (int, error) {
+	n, err := s.w.Write(p)
+	if err == nil {
+		err = s.w.Flush()
+	}
+	if err != nil {
+		s.cancel()
+	}
+	return n, err
+}
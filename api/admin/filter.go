@@ -0,0 +1,50 @@
+package admin
+
+import (
+	"zmd5/db"
+	"zmd5/utils"
+)
+
+// Md5FilterRequest 明文库过滤条件的请求参数，支持查询字符串和JSON请求体
+type Md5FilterRequest struct {
+	Search      string `query:"search" json:"search"`
+	Type        string `query:"type" json:"type"`
+	StartDate   string `query:"startDate" json:"startDate"`
+	EndDate     string `query:"endDate" json:"endDate"`
+	MinLength   int    `query:"minLength" json:"minLength"`
+	MaxLength   int    `query:"maxLength" json:"maxLength"`
+	Encoding    string `query:"encoding" json:"encoding"`
+	Source      string `query:"source" json:"source"`
+	ImportJobID uint   `query:"importJobId" json:"importJobId"`
+	UserID      uint   `query:"userId" json:"userId"`
+}
+
+// Filter 将请求参数转换为明文库过滤条件
+func (req *Md5FilterRequest) Filter() (db.Md5Filter, error) {
+	startDate, endDate, err := utils.ParseDateRange(req.StartDate, req.EndDate)
+	if err != nil {
+		return db.Md5Filter{}, err
+	}
+
+	filter := db.Md5Filter{
+		Search:      req.Search,
+		SearchType:  req.Type,
+		StartDate:   startDate,
+		EndDate:     endDate,
+		MinLength:   req.MinLength,
+		MaxLength:   req.MaxLength,
+		Source:      req.Source,
+		ImportJobID: req.ImportJobID,
+		UserID:      req.UserID,
+	}
+
+	if req.Encoding != "" {
+		encoding, err := utils.NormalizeEncoding(req.Encoding)
+		if err != nil {
+			return db.Md5Filter{}, err
+		}
+		filter.Encoding = encoding
+	}
+
+	return filter, nil
+}
@@ -0,0 +1,221 @@
+package admin
+
+import (
+	"context"
+	"zmd5/db"
+	"zmd5/db/dbModel"
+	"zmd5/jobs"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// ImportJobs 获取文件导入任务列表（支持分页）
+func ImportJobs(c *fiber.Ctx) error {
+	page := c.QueryInt("page", 1)
+	pageSize := c.QueryInt("pageSize", 20)
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	query := db.PG.Model(&dbModel.ImportJob{})
+	if status := c.QueryInt("status", 0); status > 0 {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "获取导入任务总数失败",
+		})
+	}
+
+	var jobs []dbModel.ImportJob
+	if err := query.Order("id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&jobs).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "获取导入任务失败",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "获取导入任务成功",
+		"data": fiber.Map{
+			"total":    total,
+			"records":  jobs,
+			"page":     page,
+			"pageSize": pageSize,
+		},
+	})
+}
+
+// ImportJobStatus 获取指定导入任务的状态和进度
+func ImportJobStatus(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "无效的导入任务ID",
+		})
+	}
+
+	var importJob dbModel.ImportJob
+	if err := db.PG.First(&importJob, id).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": "找不到指定的导入任务",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "获取导入任务成功",
+		"data":    importJob,
+	})
+}
+
+// 导入回滚每批次处理的行数
+const rollbackBatchSize = 5000
+
+// RollbackImportJob 回滚指定导入任务，删除该任务新增的所有明文记录
+// 删除在后台分批执行，被其他来源重复提交过的记录只解除关联不删除
+func RollbackImportJob(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "无效的导入任务ID",
+		})
+	}
+
+	var importJob dbModel.ImportJob
+	if err := db.PG.First(&importJob, id).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": "找不到指定的导入任务",
+		})
+	}
+
+	switch importJob.Status {
+	case dbModel.ImportProcessing:
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"status":  "error",
+			"message": "导入任务仍在处理中，请等待完成后再回滚",
+		})
+	case dbModel.ImportRollingBack, dbModel.ImportRolledBack:
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"status":  "error",
+			"message": "导入任务已回滚或正在回滚",
+		})
+	}
+
+	// 先标记为回滚中，避免重复发起
+	result := db.PG.Model(&dbModel.ImportJob{}).
+		Where("id = ? AND status = ?", importJob.ID, importJob.Status).
+		Update("status", dbModel.ImportRollingBack)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"status":  "error",
+			"message": "导入任务状态已变化，请刷新后重试",
+		})
+	}
+
+	userID, _ := c.Locals("userID").(uint)
+	previousStatus := importJob.Status
+	job, err := jobs.Start(jobs.KindImportRollback, userID, fiber.Map{"import_job_id": importJob.ID},
+		func(ctx context.Context, progress *jobs.Progress) error {
+			err := rollbackImport(ctx, progress, importJob.ID)
+			status := dbModel.ImportRolledBack
+			if err != nil {
+				// 回滚未完成时恢复原状态，允许再次发起
+				status = previousStatus
+			}
+			db.PG.Model(&dbModel.ImportJob{}).Where("id = ?", importJob.ID).Update("status", status)
+			return err
+		})
+	if err != nil {
+		db.PG.Model(&dbModel.ImportJob{}).Where("id = ?", importJob.ID).Update("status", previousStatus)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "创建回滚任务失败",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "回滚任务已启动",
+		"data":    job,
+	})
+}
+
+// rollbackImport 分批删除导入任务产生的明文记录
+func rollbackImport(ctx context.Context, progress *jobs.Progress, importJobID uint) error {
+	var total int64
+	if err := db.PG.Model(&dbModel.Md5{}).Where("import_job_id = ?", importJobID).Count(&total).Error; err != nil {
+		return err
+	}
+	progress.SetTotal(total)
+
+	var deleted, detached int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var rows []dbModel.Md5
+		if err := db.PG.Model(&dbModel.Md5{}).Select("id", "source_count").
+			Where("import_job_id = ?", importJobID).
+			Order("id ASC").
+			Limit(rollbackBatchSize).
+			Find(&rows).Error; err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			break
+		}
+
+		var deleteIDs, detachIDs []uint
+		for _, row := range rows {
+			if row.SourceCount > 1 {
+				detachIDs = append(detachIDs, row.ID)
+			} else {
+				deleteIDs = append(deleteIDs, row.ID)
+			}
+		}
+
+		err := db.PG.Transaction(func(tx *gorm.DB) error {
+			if len(deleteIDs) > 0 {
+				// 回滚的是错误数据，直接物理删除
+				if err := tx.Unscoped().Where("id IN ?", deleteIDs).Delete(&dbModel.Md5{}).Error; err != nil {
+					return err
+				}
+			}
+			if len(detachIDs) > 0 {
+				// 其他来源也提交过的记录保留，只解除与该导入任务的关联
+				if err := tx.Model(&dbModel.Md5{}).Where("id IN ?", detachIDs).UpdateColumns(map[string]interface{}{
+					"import_job_id": 0,
+					"filename":      "",
+					"source_count":  gorm.Expr("source_count - 1"),
+				}).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		deleted += int64(len(deleteIDs))
+		detached += int64(len(detachIDs))
+		progress.Add(int64(len(rows)))
+		progress.SetResult(fiber.Map{"deleted": deleted, "kept": detached})
+	}
+
+	return nil
+}
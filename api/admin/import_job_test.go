@@ -0,0 +1,71 @@
+package admin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"zmd5/api/md5"
+	"zmd5/db"
+	"zmd5/db/dbModel"
+	"zmd5/jobs"
+	"zmd5/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestRollbackImportKeepsEncryptedPlaintext(t *testing.T) {
+	s := setupImportTest(t)
+	md5.Init(s)
+
+	job, err := ImportReader(strings.NewReader("alpha\nbeta\n"), "words.txt", []string{"utf8", "gbk"}, 1)
+	if err != nil {
+		t.Fatalf("导入失败: %v", err)
+	}
+
+	// 其他用户通过加密接口提交了一次导入过的明文
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("user_id", uint(2))
+		return c.Next()
+	})
+	app.Post("/md5/encrypt", md5.Encrypt)
+	req := httptest.NewRequest(http.MethodPost, "/md5/encrypt", strings.NewReader(`{"text":"alpha","encodings":["utf8","gbk"]}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req, -1)
+	if err != nil || resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("加密失败: %v", err)
+	}
+
+	if err := jobs.Run(jobs.KindImportRollback, 1, nil, func(ctx context.Context, progress *jobs.Progress) error {
+		return rollbackImport(ctx, progress, job.ID)
+	}); err != nil {
+		t.Fatalf("回滚失败: %v", err)
+	}
+
+	find := func(plaintext string) (dbModel.Md5, bool) {
+		var rows []dbModel.Md5
+		digest := db.HashesToDigests([]string{utils.CalculateMD5(plaintext)})[0]
+		if err := db.PG.Unscoped().Where("digest = ?", digest).Find(&rows).Error; err != nil {
+			t.Fatalf("查询明文失败: %v", err)
+		}
+		if len(rows) == 0 {
+			return dbModel.Md5{}, false
+		}
+		return rows[0], true
+	}
+
+	// 只由本次导入提交的明文被删除
+	if _, ok := find("beta"); ok {
+		t.Fatal("只由导入提交的明文应被删除")
+	}
+	// 加密提交过的明文保留，解除与导入任务的关联后只剩一个来源
+	alpha, ok := find("alpha")
+	if !ok {
+		t.Fatal("加密提交过的明文不应被删除")
+	}
+	if alpha.ImportJobID != 0 || alpha.SourceCount != 1 {
+		t.Fatalf("回滚后 import_job_id = %d, source_count = %d, 期望 0, 1", alpha.ImportJobID, alpha.SourceCount)
+	}
+}
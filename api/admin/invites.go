@@ -0,0 +1,186 @@
+package admin
+
+import (
+	"errors"
+	"time"
+	"zmd5/api/auth"
+	"zmd5/db/dbModel"
+	"zmd5/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// 邀请码默认有效期（天）
+const defaultInviteDays = 7
+
+// CreateInviteRequest 创建邀请码请求
+type CreateInviteRequest struct {
+	// 使用邀请码注册的用户的角色，为空时为普通用户
+	Role string `json:"role"`
+	// 最多可以注册的用户数，默认1
+	MaxUses int `json:"maxUses"`
+	// 有效期（天），默认7天，为负数时不过期
+	ExpiresInDays int    `json:"expiresInDays"`
+	Note          string `json:"note"`
+}
+
+// InviteListRequest 邀请码列表请求参数
+type InviteListRequest struct {
+	Page     int `query:"page"`
+	PageSize int `query:"pageSize"`
+}
+
+// ListInvites 分页查询注册邀请码
+func ListInvites(c *fiber.Ctx) error {
+	req := new(InviteListRequest)
+	if err := c.QueryParser(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "请求参数错误",
+		})
+	}
+	if req.Page <= 0 {
+		req.Page = 1
+	}
+	if req.PageSize <= 0 || req.PageSize > 100 {
+		req.PageSize = 20
+	}
+
+	records, total, err := store.InviteCodes.List((req.Page-1)*req.PageSize, req.PageSize)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "获取邀请码失败",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "获取邀请码成功",
+		"data": fiber.Map{
+			"records":  records,
+			"total":    total,
+			"page":     req.Page,
+			"pageSize": req.PageSize,
+		},
+	})
+}
+
+// CreateInvite 创建注册邀请码，邀请码只在响应中返回一次
+// 管理员邀请码只能由管理员创建，其他角色的权限不能超出创建者的权限
+func CreateInvite(c *fiber.Ctx) error {
+	var req CreateInviteRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  "error",
+				"message": "请求参数错误",
+			})
+		}
+	}
+	if req.Role == "" {
+		req.Role = auth.RoleUser
+	}
+	if !auth.ValidRole(req.Role) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "无效的用户角色: " + req.Role,
+		})
+	}
+	// 通过邀请码注册的用户同样不能获得超出创建者权限的角色
+	if ferr := guardRole(c, req.Role); ferr != nil {
+		return errorResponse(c, ferr)
+	}
+	if req.MaxUses == 0 {
+		req.MaxUses = 1
+	}
+	if req.MaxUses < 0 || req.MaxUses > 1000 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "最大使用次数必须在1-1000之间",
+		})
+	}
+	if len(req.Note) > 255 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "备注不能超过255个字节",
+		})
+	}
+
+	code, prefix, err := utils.GenerateInviteCode()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "生成邀请码失败",
+		})
+	}
+	createdBy, _ := c.Locals("userID").(uint)
+	invite := dbModel.InviteCode{
+		CreatedBy: createdBy,
+		Prefix:    prefix,
+		CodeHash:  utils.HashInviteCode(code),
+		Role:      req.Role,
+		MaxUses:   req.MaxUses,
+		Note:      req.Note,
+	}
+	if req.ExpiresInDays == 0 {
+		req.ExpiresInDays = defaultInviteDays
+	}
+	if req.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		invite.ExpiresAt = &expiresAt
+	}
+	if err := store.InviteCodes.Create(&invite); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "创建邀请码失败",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"status":  "success",
+		"message": "创建邀请码成功，邀请码只显示一次，请妥善保存",
+		"data": fiber.Map{
+			"invite": invite,
+			"code":   code,
+		},
+	})
+}
+
+// RevokeInvite 撤销邀请码，已注册的用户不受影响
+func RevokeInvite(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "无效的邀请码ID",
+		})
+	}
+
+	revoked, err := store.InviteCodes.Revoke(uint(id), time.Now())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "撤销邀请码失败",
+		})
+	}
+	if !revoked {
+		// 区分邀请码不存在和已撤销
+		if _, err := store.InviteCodes.FindByID(uint(id)); errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"status":  "error",
+				"message": "邀请码不存在",
+			})
+		}
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "邀请码已撤销",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "撤销邀请码成功",
+	})
+}
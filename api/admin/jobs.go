@@ -0,0 +1,104 @@
+package admin
+
+import (
+	"zmd5/db"
+	"zmd5/db/dbModel"
+	"zmd5/jobs"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// BackgroundJobs 获取后台任务列表（支持分页和类型、状态筛选）
+func BackgroundJobs(c *fiber.Ctx) error {
+	page := c.QueryInt("page", 1)
+	pageSize := c.QueryInt("pageSize", 20)
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	query := db.PG.Model(&dbModel.BackgroundJob{})
+	if kind := c.Query("kind"); kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+	if status := c.QueryInt("status", 0); status > 0 {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "获取后台任务总数失败",
+		})
+	}
+
+	var records []dbModel.BackgroundJob
+	if err := query.Order("id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&records).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "获取后台任务失败",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "获取后台任务成功",
+		"data": fiber.Map{
+			"total":    total,
+			"records":  records,
+			"page":     page,
+			"pageSize": pageSize,
+		},
+	})
+}
+
+// BackgroundJobStatus 获取单个后台任务的进度
+func BackgroundJobStatus(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "无效的任务ID",
+		})
+	}
+
+	var job dbModel.BackgroundJob
+	if err := db.PG.First(&job, id).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": "找不到指定的后台任务",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "获取后台任务成功",
+		"data":    job,
+	})
+}
+
+// CancelBackgroundJob 取消运行中的后台任务
+func CancelBackgroundJob(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "无效的任务ID",
+		})
+	}
+
+	if !jobs.Cancel(uint(id)) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": "任务不存在或已结束",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "已发送取消信号",
+	})
+}
@@ -0,0 +1,150 @@
+package admin
+
+import (
+	"errors"
+	"time"
+	"zmd5/api/auth"
+	"zmd5/db/dbModel"
+	"zmd5/loginguard"
+	"zmd5/repository"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// LoginAttemptListRequest 登录尝试列表请求参数
+type LoginAttemptListRequest struct {
+	Page     int    `query:"page"`
+	PageSize int    `query:"pageSize"`
+	Username string `query:"username"`
+	IP       string `query:"ip"`
+	// 结果：success/bad_credentials/throttled/disabled/locked/pending_approval/reset_required/2fa_required/bad_2fa_code
+	Result string `query:"result"`
+}
+
+// LoginAttempts 分页查询登录尝试审计记录
+func LoginAttempts(c *fiber.Ctx) error {
+	req := new(LoginAttemptListRequest)
+	if err := c.QueryParser(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "请求参数错误",
+		})
+	}
+	if req.Page <= 0 {
+		req.Page = 1
+	}
+	if req.PageSize <= 0 || req.PageSize > 100 {
+		req.PageSize = 20
+	}
+
+	switch req.Result {
+	case "", dbModel.LoginSucceeded, dbModel.LoginBadCredentials, dbModel.LoginThrottled,
+		dbModel.LoginDisabled, dbModel.LoginLocked, dbModel.LoginPendingApproval, dbModel.LoginResetRequired,
+		dbModel.LoginTwoFactor, dbModel.LoginBadTwoFactor:
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "无效的登录结果: " + req.Result,
+		})
+	}
+
+	filter := repository.LoginAttemptFilter{Username: req.Username, IP: req.IP, Result: req.Result}
+	records, total, err := store.LoginAttempts.List(filter, (req.Page-1)*req.PageSize, req.PageSize)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "获取登录记录失败",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "获取登录记录成功",
+		"data": fiber.Map{
+			"records":  records,
+			"total":    total,
+			"page":     req.Page,
+			"pageSize": req.PageSize,
+		},
+	})
+}
+
+// LoginLockInfo 用户名或IP的登录失败记录
+type LoginLockInfo struct {
+	loginguard.Entry
+	// 当前是否拒绝登录
+	Blocked bool `json:"blocked"`
+	// 距离允许再次尝试的秒数
+	RetryAfter int `json:"retryAfter"`
+}
+
+// LoginLocks 获取当前的登录失败记录，正在限制登录的排在前面
+// 记录保存在服务进程内，服务重启后清空（连续失败导致的账户锁定另外保存在用户表中）
+func LoginLocks(c *fiber.Ctx) error {
+	now := time.Now()
+	entries := auth.LoginGuard().Entries()
+	list := make([]LoginLockInfo, len(entries))
+	for i, entry := range entries {
+		list[i] = LoginLockInfo{Entry: entry, Blocked: entry.Blocked(now)}
+		if list[i].Blocked {
+			list[i].RetryAfter = int(entry.BlockedUntil.Sub(now).Seconds()) + 1
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "获取登录限制成功",
+		"data":    list,
+	})
+}
+
+// ClearLoginLockRequest 清除登录限制请求
+type ClearLoginLockRequest struct {
+	// user 或 ip
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+// ClearLoginLock 清除用户名或IP的登录失败记录，清除用户名时同时解除因连续失败导致的账户锁定
+func ClearLoginLock(c *fiber.Ctx) error {
+	var req ClearLoginLockRequest
+	if err := c.BodyParser(&req); err != nil || req.Value == "" ||
+		(req.Kind != loginguard.KindUser && req.Kind != loginguard.KindIP) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "请求参数错误，kind 只能为 user 或 ip",
+		})
+	}
+
+	cleared := auth.LoginGuard().Clear(req.Kind, req.Value)
+	if req.Kind == loginguard.KindUser {
+		user, err := store.Users.FindByUsername(req.Value)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"status":  "error",
+				"message": "获取用户失败",
+			})
+		}
+		if user != nil && user.Locked(time.Now()) {
+			if err := store.Users.Update(user.ID, map[string]interface{}{"locked_until": nil}); err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"status":  "error",
+					"message": "解除账户锁定失败",
+				})
+			}
+			cleared = true
+		}
+	}
+	if !cleared {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": "没有该用户名或IP的登录限制",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "清除登录限制成功",
+	})
+}
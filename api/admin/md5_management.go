@@ -1,18 +1,21 @@
 package admin
 
 import (
+	"context"
+	"fmt"
 	"zmd5/db"
 	"zmd5/db/dbModel"
+	"zmd5/jobs"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 // MD5ManagementRequest 定义分页请求参数
 type MD5ManagementRequest struct {
-	Page     int    `query:"page"`
-	PageSize int    `query:"pageSize"`
-	Search   string `query:"search"`
-	Type     string `query:"type"`
+	Page     int `query:"page"`
+	PageSize int `query:"pageSize"`
+	// 搜索和来源过滤条件，可用于定位某次导入产生的记录
+	Md5FilterRequest
 }
 
 // MD5ManagementResponse 定义响应结构
@@ -42,37 +45,19 @@ func MD5Management(c *fiber.Ctx) error {
 		req.PageSize = 20 // 默认每页20条
 	}
 
-	// 构建查询条件
-	query := db.PG.Model(&dbModel.Md5{})
-
-	// 如果有搜索条件，添加搜索过滤
-	if req.Search != "" {
-		switch req.Type {
-		case "plaintext":
-			query = query.Where("plaintext LIKE ?", "%"+req.Search+"%")
-		case "md5":
-			query = query.Where("md5 LIKE ? OR md5_16 LIKE ?", "%"+req.Search+"%", "%"+req.Search+"%")
-		default:
-			// 默认搜索所有字段
-			query = query.Where("plaintext LIKE ? OR md5 LIKE ? OR md5_16 LIKE ?",
-				"%"+req.Search+"%", "%"+req.Search+"%", "%"+req.Search+"%")
-		}
-	}
-
-	// 获取总记录数
-	var total int64
-	if err := query.Count(&total).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+	// 如果有搜索或来源条件，添加过滤
+	filter, err := req.Filter()
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"status":  "error",
-			"message": "获取记录总数失败",
+			"message": err.Error(),
 		})
 	}
 
-	// 获取分页数据
-	var records []dbModel.Md5
+	// 获取分页数据和总记录数
 	offset := (req.Page - 1) * req.PageSize
-
-	if err := query.Offset(offset).Limit(req.PageSize).Order("id DESC").Find(&records).Error; err != nil {
+	records, total, err := store.Plaintexts.List(filter, offset, req.PageSize)
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
 			"message": "获取MD5记录失败",
@@ -96,17 +81,17 @@ func MD5Management(c *fiber.Ctx) error {
 
 // DeleteMD5Record 删除指定ID的MD5记录
 func DeleteMD5Record(c *fiber.Ctx) error {
-	id := c.Params("id")
-	if id == "" {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"status":  "error",
 			"message": "请提供记录ID",
 		})
 	}
 
-	// 查找并删除记录
-	result := db.PG.Delete(&dbModel.Md5{}, id)
-	if result.Error != nil {
+	// 查找并删除记录，物理删除以免软删除的记录占用唯一索引
+	deleted, err := store.Plaintexts.DeleteByIDs([]uint{uint(id)})
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
 			"message": "删除MD5记录失败",
@@ -114,7 +99,7 @@ func DeleteMD5Record(c *fiber.Ctx) error {
 	}
 
 	// 如果没有找到记录
-	if result.RowsAffected == 0 {
+	if deleted == 0 {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"status":  "error",
 			"message": "找不到指定ID的记录",
@@ -126,3 +111,207 @@ func DeleteMD5Record(c *fiber.Ctx) error {
 		"message": "成功删除MD5记录",
 	})
 }
+
+const (
+	// 单次按ID批量删除的最大数量
+	maxBatchDeleteIDs = 10000
+	// 按条件删除时，匹配数量超过该值则转为后台任务执行
+	syncDeleteLimit = 5000
+	// 后台删除每批次处理的行数
+	deleteBatchSize = 5000
+)
+
+// BatchDeleteRequest 按ID列表批量删除请求
+type BatchDeleteRequest struct {
+	IDs []uint `json:"ids"`
+}
+
+// BatchDeleteMD5Records 按ID列表批量删除MD5记录
+func BatchDeleteMD5Records(c *fiber.Ctx) error {
+	var req BatchDeleteRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "请求参数错误",
+		})
+	}
+
+	if len(req.IDs) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "请提供要删除的记录ID",
+		})
+	}
+	if len(req.IDs) > maxBatchDeleteIDs {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": fmt.Sprintf("单次最多删除%d条记录，请使用按条件删除", maxBatchDeleteIDs),
+		})
+	}
+
+	deleted, err := store.Plaintexts.DeleteByIDs(req.IDs)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "批量删除MD5记录失败",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "批量删除MD5记录成功",
+		"data": fiber.Map{
+			"deleted": deleted,
+		},
+	})
+}
+
+// DeleteByFilterRequest 按条件删除请求
+type DeleteByFilterRequest struct {
+	Md5FilterRequest
+	// 仅统计匹配数量，不执行删除
+	DryRun bool `json:"dryRun"`
+}
+
+// DeleteMD5RecordsByFilter 删除所有匹配过滤条件的MD5记录
+// dryRun为true时只返回匹配数量；匹配数量较大时转为后台任务分批删除
+func DeleteMD5RecordsByFilter(c *fiber.Ctx) error {
+	var req DeleteByFilterRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "请求参数错误",
+		})
+	}
+
+	filter, err := req.Filter()
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	}
+
+	// 防止误操作清空整个明文库
+	if filter.IsEmpty() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "请至少提供一个过滤条件",
+		})
+	}
+
+	matched, err := store.Plaintexts.Count(filter)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "统计匹配记录失败",
+		})
+	}
+
+	if req.DryRun {
+		return c.JSON(fiber.Map{
+			"status":  "success",
+			"message": "统计匹配记录成功",
+			"data": fiber.Map{
+				"matched": matched,
+				"dryRun":  true,
+			},
+		})
+	}
+
+	// 匹配数量较少时直接删除
+	if matched <= syncDeleteLimit {
+		deleted, err := store.Plaintexts.DeleteByFilter(filter, 0)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"status":  "error",
+				"message": "删除MD5记录失败",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":  "success",
+			"message": "删除MD5记录成功",
+			"data": fiber.Map{
+				"matched": matched,
+				"deleted": deleted,
+			},
+		})
+	}
+
+	// 匹配数量较大时启动后台任务分批删除
+	userID, _ := c.Locals("userID").(uint)
+	job, err := jobs.Start(jobs.KindMd5BulkDelete, userID, req.Md5FilterRequest,
+		func(ctx context.Context, progress *jobs.Progress) error {
+			return deleteByFilter(ctx, progress, filter, matched)
+		})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "创建删除任务失败",
+		})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"status":  "success",
+		"message": "匹配记录较多，已转为后台任务删除",
+		"data": fiber.Map{
+			"matched": matched,
+			"job":     job,
+		},
+	})
+}
+
+// deleteByFilter 分批删除所有匹配过滤条件的记录
+func deleteByFilter(ctx context.Context, progress *jobs.Progress, filter db.Md5Filter, total int64) error {
+	progress.SetTotal(total)
+
+	var deleted int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		n, err := store.Plaintexts.DeleteByFilter(filter, deleteBatchSize)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			break
+		}
+
+		deleted += n
+		progress.Add(n)
+		progress.SetResult(fiber.Map{"deleted": deleted})
+	}
+
+	return nil
+}
+
+// DedupMD5Records 启动明文库去重任务
+// 服务运行时唯一索引已由迁移创建，该任务只清理软删除记录和回填明文摘要；历史重复数据需通过 `zmd5 dedup` 清理
+func DedupMD5Records(c *fiber.Ctx) error {
+	if jobs.IsRunning(jobs.KindMd5Dedup) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"status":  "error",
+			"message": "去重任务正在运行中",
+		})
+	}
+
+	userID, _ := c.Locals("userID").(uint)
+	job, err := jobs.Start(jobs.KindMd5Dedup, userID, nil, func(ctx context.Context, progress *jobs.Progress) error {
+		return db.DedupMd5(ctx, progress)
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "创建去重任务失败",
+		})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"status":  "success",
+		"message": "去重任务已启动",
+		"data":    job,
+	})
+}
@@ -0,0 +1,188 @@
+package admin
+
+import (
+	"errors"
+	"sort"
+	"zmd5/api/auth"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RoleInfo 角色及其权限
+type RoleInfo struct {
+	Role        string   `json:"role"`
+	Permissions []string `json:"permissions"`
+	// 内置角色不能删除，管理员角色的权限不能修改
+	Builtin bool `json:"builtin"`
+	// 使用该角色的用户数量
+	Users int64 `json:"users"`
+	// 该角色的用户必须开启两步验证
+	RequireTwoFactor bool `json:"requireTwoFactor"`
+}
+
+// SetRoleTwoFactorRequest 设置角色两步验证要求请求
+type SetRoleTwoFactorRequest struct {
+	Required bool `json:"required"`
+}
+
+// SetRolePermissionsRequest 设置角色权限请求
+type SetRolePermissionsRequest struct {
+	Permissions []string `json:"permissions"`
+}
+
+// ListPermissions 获取所有管理权限及说明
+func ListPermissions(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "获取权限列表成功",
+		"data":    auth.Permissions,
+	})
+}
+
+// ListRoles 获取所有角色及其权限
+func ListRoles(c *fiber.Ctx) error {
+	roles := auth.RolePermissionList()
+	names := make([]string, 0, len(roles))
+	for role := range roles {
+		names = append(names, role)
+	}
+	sort.Strings(names)
+
+	list := make([]RoleInfo, 0, len(names))
+	for _, role := range names {
+		count, err := store.Users.CountByRole(role)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"status":  "error",
+				"message": "获取角色列表失败",
+			})
+		}
+		list = append(list, RoleInfo{
+			Role:             role,
+			Permissions:      roles[role],
+			Builtin:          auth.IsBuiltinRole(role),
+			Users:            count,
+			RequireTwoFactor: auth.RequiresTwoFactor(role),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "获取角色列表成功",
+		"data":    list,
+	})
+}
+
+// SetRolePermissions 设置角色的权限，角色不存在时创建自定义角色
+// 只能修改权限范围不超过自己的角色，且只能授予自己拥有的权限
+func SetRolePermissions(c *fiber.Ctx) error {
+	role := c.Params("role")
+
+	var req SetRolePermissionsRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "请求参数错误",
+		})
+	}
+	if ferr := guardRole(c, role); ferr != nil {
+		return errorResponse(c, ferr)
+	}
+	callerRole, _ := c.Locals("role").(string)
+	for _, permission := range req.Permissions {
+		if !auth.HasPermission(callerRole, permission) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"status":  "error",
+				"message": "不能授予自己没有的权限: " + permission,
+			})
+		}
+	}
+
+	if err := auth.SetRolePermissions(role, req.Permissions); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "设置角色权限成功",
+		"data": RoleInfo{
+			Role:             role,
+			Permissions:      auth.RolePermissionList()[role],
+			Builtin:          auth.IsBuiltinRole(role),
+			RequireTwoFactor: auth.RequiresTwoFactor(role),
+		},
+	})
+}
+
+// DeleteRole 删除自定义角色
+func DeleteRole(c *fiber.Ctx) error {
+	if ferr := guardRole(c, c.Params("role")); ferr != nil {
+		return errorResponse(c, ferr)
+	}
+	err := auth.DeleteRole(c.Params("role"))
+	if errors.Is(err, auth.ErrRoleNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	}
+	if errors.Is(err, auth.ErrRoleInUse) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "删除角色成功",
+	})
+}
+
+// SetRoleTwoFactor 设置角色的用户是否必须开启两步验证
+func SetRoleTwoFactor(c *fiber.Ctx) error {
+	role := c.Params("role")
+
+	var req SetRoleTwoFactorRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "请求参数错误",
+		})
+	}
+	if ferr := guardRole(c, role); ferr != nil {
+		return errorResponse(c, ferr)
+	}
+
+	err := auth.SetRoleRequireTwoFactor(role, req.Required)
+	if errors.Is(err, auth.ErrRoleNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "设置两步验证要求失败",
+		})
+	}
+
+	message := "已取消该角色的两步验证要求"
+	if req.Required {
+		message = "该角色的用户下次登录时必须完成两步验证"
+	}
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": message,
+	})
+}
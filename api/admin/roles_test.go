@@ -0,0 +1,53 @@
+package admin
+
+import (
+	"net/http"
+	"testing"
+	"zmd5/api/auth"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestRoleManagerCannotEscalate(t *testing.T) {
+	app, _ := setupUsersTest(t)
+
+	cases := []struct {
+		name         string
+		method, path string
+		body         string
+		want         int
+	}{
+		{"给自己的角色增加权限", http.MethodPut, "/roles/" + roleRoleManager, `{"permissions":["roles:manage","users:manage"]}`, fiber.StatusForbidden},
+		{"创建权限更多的角色", http.MethodPut, "/roles/escalated", `{"permissions":["roles:manage","audit:read"]}`, fiber.StatusForbidden},
+		{"修改权限更多的角色", http.MethodPut, "/roles/" + auth.RoleOperator, `{"permissions":["roles:read"]}`, fiber.StatusForbidden},
+		{"修改管理员角色", http.MethodPut, "/roles/" + auth.RoleAdmin, `{"permissions":["roles:read"]}`, fiber.StatusForbidden},
+		{"取消管理员的两步验证要求", http.MethodPut, "/roles/" + auth.RoleAdmin + "/two-factor", `{"required":false}`, fiber.StatusForbidden},
+		{"删除权限更多的角色", http.MethodDelete, "/roles/" + roleUserManager, ``, fiber.StatusForbidden},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := doRequest(t, app, "rolemgr", tc.method, tc.path, tc.body); got != tc.want {
+				t.Fatalf("状态码 = %d, 期望 %d", got, tc.want)
+			}
+		})
+	}
+	if auth.HasPermission(roleRoleManager, auth.PermUsersManage) || auth.HasPermission(auth.RoleOperator, auth.PermRolesRead) {
+		t.Fatal("角色权限被修改")
+	}
+
+	// 权限范围内的操作不受影响
+	if got := doRequest(t, app, "rolemgr", http.MethodPut, "/roles/reader", `{"permissions":["roles:read"]}`); got != fiber.StatusOK {
+		t.Fatalf("创建权限更少的角色: 状态码 = %d", got)
+	}
+	if got := doRequest(t, app, "rolemgr", http.MethodPut, "/roles/reader/two-factor", `{"required":true}`); got != fiber.StatusOK {
+		t.Fatalf("设置两步验证要求: 状态码 = %d", got)
+	}
+	if got := doRequest(t, app, "rolemgr", http.MethodDelete, "/roles/reader", ``); got != fiber.StatusOK {
+		t.Fatalf("删除权限更少的角色: 状态码 = %d", got)
+	}
+
+	// 管理员可以授予任意权限
+	if got := doRequest(t, app, "admin", http.MethodPut, "/roles/escalated", `{"permissions":["roles:manage","audit:read"]}`); got != fiber.StatusOK {
+		t.Fatalf("管理员创建角色: 状态码 = %d", got)
+	}
+}
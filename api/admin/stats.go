@@ -3,7 +3,6 @@ package admin
 import (
 	"time"
 	"zmd5/db"
-	"zmd5/db/dbModel"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -17,34 +16,27 @@ import (
 // @Success 200 {object} map[string]interface{}
 // @Router /api/admin/stats [get]
 func Stats(c *fiber.Ctx) error {
-	// 获取数据库连接
-	database := db.PG
-
 	// 用户统计
-	var totalUsers int64
-	database.Model(&dbModel.User{}).Count(&totalUsers)
+	totalUsers, _ := store.Users.Count(time.Time{})
 
 	// 活跃用户（过去7天有更新的用户）
-	var activeUsers int64
 	sevenDaysAgo := time.Now().AddDate(0, 0, -7)
-	database.Model(&dbModel.User{}).Where("updated_at > ?", sevenDaysAgo).Count(&activeUsers)
+	activeUsers, _ := store.Users.Count(sevenDaysAgo)
 
 	// MD5记录统计
-	var md5Records int64
-	database.Model(&dbModel.Md5{}).Count(&md5Records)
+	md5Records, _ := store.Plaintexts.Count(db.Md5Filter{})
 
 	// 今日新增记录
-	var todayRecords int64
-	today := time.Now().Format("2006-01-02")
-	database.Model(&dbModel.Md5{}).Where("DATE(created_at) = ?", today).Count(&todayRecords)
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	todayRecords, _ := store.Plaintexts.Count(db.Md5Filter{StartDate: &today})
 
 	// 获取系统状态（这里可以根据实际情况判断系统状态）
 	systemStatus := "正常"
 
 	// 获取服务器信息
-	// 这里简单返回PostgreSQL数据库版本作为示例
-	var dbVersion string
-	database.Raw("SELECT version()").Scan(&dbVersion)
+	// 这里简单返回数据库版本作为示例
+	dbVersion := db.Version()
 
 	stats := fiber.Map{
 		"total_users":    totalUsers,
@@ -53,6 +45,7 @@ func Stats(c *fiber.Ctx) error {
 		"today_records":  todayRecords,
 		"system_status":  systemStatus,
 		"database_info":  dbVersion,
+		"digest_filter":  db.GetDigestFilterStats(),
 		"last_refreshed": time.Now().Format("2006-01-02 15:04:05"),
 	}
 
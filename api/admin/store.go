@@ -0,0 +1,11 @@
+package admin
+
+import "zmd5/repository"
+
+// store 处理器使用的存储，由 Init 注入
+var store *repository.Store
+
+// Init 注入处理器使用的存储
+func Init(s *repository.Store) {
+	store = s
+}
@@ -2,29 +2,42 @@ package admin
 
 import (
 	"bufio"
-	"crypto/md5"
-	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
+	"zmd5/config"
 	"zmd5/db"
 	"zmd5/db/dbModel"
+	"zmd5/jobs"
+	"zmd5/metrics"
+	"zmd5/repository"
+	"zmd5/utils"
 
 	"context"
 
 	"github.com/gofiber/fiber/v2"
 	"golang.org/x/sync/errgroup"
 	"golang.org/x/sync/semaphore"
+	"gorm.io/gorm"
 )
 
-const (
-	batchSize  = 1000  // 每批处理的数据量
-	maxWorkers = 5     // 最大工作协程数
-	chunkSize  = 10000 // 文件分块处理大小
-)
+// uploadConfig 文件导入的批量大小和并发数，由 SetUploadConfig 根据配置设置
+var uploadConfig = config.UploadConfig{
+	BatchSize:  1000,  // 每批处理的数据量
+	MaxWorkers: 5,     // 最大工作协程数
+	ChunkSize:  10000, // 文件分块处理大小
+}
+
+// SetUploadConfig 设置文件导入的批量大小和并发数
+func SetUploadConfig(cfg config.UploadConfig) {
+	uploadConfig = cfg
+}
 
 // Upload 处理文件上传和批量导入
 func Upload(c *fiber.Ctx) error {
@@ -37,6 +50,19 @@ func Upload(c *fiber.Ctx) error {
 		})
 	}
 
+	// 解析明文编码列表，多个编码用逗号分隔，为空时默认为utf8
+	var encodingNames []string
+	if value := c.FormValue("encodings"); value != "" {
+		encodingNames = strings.Split(value, ",")
+	}
+	encodings, err := utils.NormalizeEncodings(encodingNames)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+
 	// 创建临时目录
 	tempDir := "temp_uploads"
 	if err := os.MkdirAll(tempDir, 0755); err != nil {
@@ -59,38 +85,142 @@ func Upload(c *fiber.Ctx) error {
 		})
 	}
 
-	// 启动后台处理协程
-	go processFile(tempFileName)
+	// 创建导入任务记录，用于追踪来源和进度
+	userID, _ := c.Locals("userID").(uint)
+	job, err := createImportJob(userID, file.Filename, tempFileName, encodings)
+	if err != nil {
+		os.Remove(tempFileName)
+		log.Printf("创建导入任务失败: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "创建导入任务失败，请稍后重试",
+		})
+	}
+
+	// 启动后台处理协程，服务关闭时保存检查点
+	jobs.Go(func() { processFile(tempFileName, encodings, job) })
 
 	return c.JSON(fiber.Map{
 		"success": true,
 		"message": "文件上传成功，正在后台处理",
+		"job_id":  job.ID,
 	})
 }
 
-// processFile 处理上传的文件
-func processFile(filePath string) {
+// ImportReader 同步导入明文列表，每行一个明文或以逗号分隔的多个明文，返回完成后的导入任务
+// 供命令行直接导入使用，导入过程与文件上传相同，同样可以按导入任务回滚
+func ImportReader(r io.Reader, filename string, encodings []string, userID uint) (*dbModel.ImportJob, error) {
+	job, err := createImportJob(userID, filename, "", encodings)
+	if err != nil {
+		return nil, err
+	}
+
+	err = importRecords(r, encodings, job)
+	finishImportJob(job.ID, err)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.PG.First(job, job.ID).Error; err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// createImportJob 创建导入任务记录，filePath 为上传的临时文件，服务重启后据此继续导入
+func createImportJob(userID uint, filename, filePath string, encodings []string) (*dbModel.ImportJob, error) {
+	job := dbModel.ImportJob{
+		UserID:    userID,
+		Filename:  filename,
+		Encodings: strings.Join(encodings, ","),
+		Status:    dbModel.ImportProcessing,
+		FilePath:  filePath,
+	}
+	if err := db.PG.Create(&job).Error; err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// processFile 处理上传的文件，按encodings中的每种编码计算明文的MD5
+// 服务关闭时保留临时文件和已处理的行数，下次启动由 ResumeImports 继续
+func processFile(filePath string, encodings []string, job *dbModel.ImportJob) {
+	interrupted := false
 	defer func() {
 		// 处理完成后删除临时文件
-		os.Remove(filePath)
+		if !interrupted {
+			os.Remove(filePath)
+		}
 	}()
 
 	file, err := os.Open(filePath)
 	if err != nil {
 		fmt.Printf("打开文件失败: %v\n", err)
+		finishImportJob(job.ID, err)
 		return
 	}
 	defer file.Close()
 
+	err = importRecords(file, encodings, job)
+	if errors.Is(err, jobs.ErrShutdown) {
+		interrupted = true
+		log.Printf("导入任务 #%d 已保存检查点，下次启动时继续", job.ID)
+		return
+	}
+	if err != nil {
+		fmt.Printf("处理文件时出错: %v\n", err)
+	}
+	finishImportJob(job.ID, err)
+}
+
+// ResumeImports 继续上次服务关闭或异常退出时中断的文件上传导入，从保存的行数之后继续
+// 临时文件已不存在的任务标记为失败
+func ResumeImports() {
+	var pending []dbModel.ImportJob
+	if err := db.PG.Where("status = ? AND file_path <> ?", dbModel.ImportProcessing, "").Find(&pending).Error; err != nil {
+		log.Printf("加载中断的导入任务失败: %v", err)
+		return
+	}
+
+	resumed := 0
+	for i := range pending {
+		job := &pending[i]
+		if _, err := os.Stat(job.FilePath); err != nil {
+			finishImportJob(job.ID, fmt.Errorf("服务重启后找不到上传的文件: %v", err))
+			continue
+		}
+		encodings := strings.Split(job.Encodings, ",")
+		jobs.Go(func() { processFile(job.FilePath, encodings, job) })
+		resumed++
+	}
+
+	if resumed > 0 {
+		log.Printf("已恢复%d个中断的导入任务", resumed)
+	}
+}
+
+// importRecords 读取明文并分块并发写入明文库
+func importRecords(r io.Reader, encodings []string, job *dbModel.ImportJob) error {
+	metrics.ImportTasks.Inc()
+	defer metrics.ImportTasks.Dec()
+
+	// 导入的每条记录都带上该任务的来源信息
+	provenance := dbModel.Provenance{
+		Source:      dbModel.SourceUpload,
+		UserID:      job.UserID,
+		ImportJobID: job.ID,
+		Filename:    job.Filename,
+	}
+
 	// 创建上下文和工作组
 	ctx := context.Background()
 	g, ctx := errgroup.WithContext(ctx)
 
 	// 创建信号量限制并发
-	sem := semaphore.NewWeighted(int64(maxWorkers))
+	sem := semaphore.NewWeighted(int64(uploadConfig.MaxWorkers))
 
 	// 创建读取器和扫描器
-	reader := bufio.NewReader(file)
+	reader := bufio.NewReader(r)
 	scanner := bufio.NewScanner(reader)
 
 	// 使用更大的缓冲区
@@ -100,9 +230,27 @@ func processFile(filePath string) {
 
 	var chunkID int
 	var records []dbModel.Md5
+	checkpoint := &importCheckpoint{jobID: job.ID}
+	// 已读取的行数，数据块写入完成和服务关闭时作为检查点保存
+	var lineNumber int64
+	interrupted := false
 
 	// 处理每一行数据
+scan:
 	for scanner.Scan() {
+		lineNumber++
+		// 跳过上次服务关闭前已导入的行
+		if lineNumber <= job.ResumeLine {
+			continue
+		}
+
+		// 服务关闭时停止读取，已读取的行写入完成后保存检查点
+		if jobs.ShuttingDown() {
+			lineNumber--
+			interrupted = true
+			break
+		}
+
 		line := scanner.Text()
 		// 尝试按逗号分割
 		parts := strings.Split(line, ",")
@@ -111,48 +259,50 @@ func processFile(filePath string) {
 			parts = []string{line}
 		}
 
-		for _, part := range parts {
+		for i, part := range parts {
 			part = strings.TrimSpace(part)
 			if part == "" {
 				continue
 			}
 
-			md5Hash := calculateMD5(part)
-			md5Record := dbModel.Md5{
-				Plaintext: part,
-				MD5:       md5Hash,
-				MD5_16:    md5Hash[8:24], // 16位MD5
-			}
-
-			records = append(records, md5Record)
+			records = append(records, buildEncodedRecords([]string{part}, encodings, provenance)...)
 
 			// 当记录达到块大小时，启动一个工作协程处理这个块
-			if len(records) >= chunkSize {
+			if len(records) >= uploadConfig.ChunkSize {
 				// 复制当前记录集以避免竞争条件
 				recordsToProcess := make([]dbModel.Md5, len(records))
 				copy(recordsToProcess, records)
 				currentChunkID := chunkID
+				// 块在行中间结束时，该行剩余的明文属于下一个块，检查点只记到上一行
+				endLine := lineNumber
+				if i < len(parts)-1 {
+					endLine--
+				}
 
-				// 等待获取信号量
+				// 等待获取信号量，已有数据块失败时上下文被取消，停止读取
 				if err := sem.Acquire(ctx, 1); err != nil {
 					fmt.Printf("无法获取信号量: %v\n", err)
-					continue
+					break scan
 				}
 
+				checkpoint.add(endLine)
 				g.Go(func() error {
 					defer sem.Release(1)
-					return processChunk(recordsToProcess, currentChunkID)
+					if err := processChunk(recordsToProcess, currentChunkID, job.ID); err != nil {
+						return err
+					}
+					return checkpoint.done(currentChunkID)
 				})
 
 				// 重置记录集和增加块ID
-				records = make([]dbModel.Md5, 0, chunkSize)
+				records = make([]dbModel.Md5, 0, uploadConfig.ChunkSize)
 				chunkID++
 			}
 		}
 	}
 
 	// 处理剩余的记录
-	if len(records) > 0 {
+	if len(records) > 0 && ctx.Err() == nil {
 		recordsToProcess := make([]dbModel.Md5, len(records))
 		copy(recordsToProcess, records)
 		currentChunkID := chunkID
@@ -160,97 +310,126 @@ func processFile(filePath string) {
 		if err := sem.Acquire(ctx, 1); err != nil {
 			fmt.Printf("无法获取信号量: %v\n", err)
 		} else {
+			checkpoint.add(lineNumber)
 			g.Go(func() error {
 				defer sem.Release(1)
-				return processChunk(recordsToProcess, currentChunkID)
+				if err := processChunk(recordsToProcess, currentChunkID, job.ID); err != nil {
+					return err
+				}
+				return checkpoint.done(currentChunkID)
 			})
 		}
 	}
 
 	// 等待所有处理完成
 	if err := g.Wait(); err != nil {
-		fmt.Printf("处理文件时出错: %v\n", err)
+		return err
+	}
+	if interrupted {
+		if err := db.PG.Model(&dbModel.ImportJob{}).Where("id = ?", job.ID).Update("resume_line", lineNumber).Error; err != nil {
+			return fmt.Errorf("保存导入检查点失败: %v", err)
+		}
+		return jobs.ErrShutdown
 	}
+	return scanner.Err()
+}
+
+// importCheckpoint 记录各数据块结束的行数，数据块写入完成后保存检查点
+// 数据块并发写入、完成顺序不定，检查点只推进到连续完成的最后一个块，服务异常退出后从该行之后继续
+type importCheckpoint struct {
+	mu       sync.Mutex
+	jobID    uint
+	endLines []int64
+	finished []bool
+	// 下一个未完成的块
+	next int
 }
 
-// processChunk 处理一个数据块，使用事务和批处理
-func processChunk(records []dbModel.Md5, chunkID int) error {
+// add 按块ID顺序登记数据块结束的行数
+func (c *importCheckpoint) add(endLine int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.endLines = append(c.endLines, endLine)
+	c.finished = append(c.finished, false)
+}
+
+// done 标记数据块写入完成，之前的块都已完成时保存检查点
+func (c *importCheckpoint) done(chunkID int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.finished[chunkID] = true
+	start := c.next
+	for c.next < len(c.finished) && c.finished[c.next] {
+		c.next++
+	}
+	if c.next == start {
+		return nil
+	}
+	if err := db.PG.Model(&dbModel.ImportJob{}).Where("id = ?", c.jobID).Update("resume_line", c.endLines[c.next-1]).Error; err != nil {
+		return fmt.Errorf("保存导入检查点失败: %v", err)
+	}
+	return nil
+}
+
+// processChunk 处理一个数据块，使用事务和批处理，并更新导入任务进度
+func processChunk(records []dbModel.Md5, chunkID int, jobID uint) error {
 	startTime := time.Now()
 	fmt.Printf("开始处理块 #%d, 包含 %d 条记录\n", chunkID, len(records))
 
 	// 将大块分成小批次处理
-	for i := 0; i < len(records); i += batchSize {
-		end := i + batchSize
+	for i := 0; i < len(records); i += uploadConfig.BatchSize {
+		end := i + uploadConfig.BatchSize
 		if end > len(records) {
 			end = len(records)
 		}
 
 		batch := records[i:end]
-		if err := processBatch(batch); err != nil {
-			fmt.Printf("处理批次失败 (块 #%d, 批次 %d-%d): %v\n", chunkID, i, end, err)
+		added, err := processBatch(batch)
+		if err != nil {
+			// 任一批次失败时终止导入，导入任务标记为失败
+			return fmt.Errorf("处理批次失败 (块 #%d, 批次 %d-%d): %v", chunkID, i, end, err)
 		}
+		addImportJobProgress(jobID, int64(len(batch)), int64(added))
 	}
 
 	fmt.Printf("完成处理块 #%d, 耗时: %v\n", chunkID, time.Since(startTime))
 	return nil
 }
 
-// processBatch 处理单个批次，使用事务
-func processBatch(batch []dbModel.Md5) error {
-	// 开始事务
-	tx := db.PG.Begin()
-	if tx.Error != nil {
-		return fmt.Errorf("无法开始事务: %v", tx.Error)
+// processBatch 处理单个批次，使用事务，返回新增的记录数
+func processBatch(batch []dbModel.Md5) (int, error) {
+	var inserted int64
+	err := store.Plaintexts.Transaction(func(tx repository.PlaintextRepository) error {
+		var err error
+		inserted, err = insertBatch(tx, batch)
+		return err
+	})
+	if err != nil {
+		return 0, err
 	}
+	return int(inserted), nil
+}
 
-	// 确保事务结束
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
-		}
-	}()
-
-	// 提取明文和MD5值，用于查询
-	plaintexts := make([]string, 0, len(batch))
+// insertBatch 在事务中过滤已存在的记录并插入新记录
+func insertBatch(tx repository.PlaintextRepository, batch []dbModel.Md5) (int64, error) {
+	// 提取MD5值，用于查询
+	// 同一明文在不同编码下会产生不同的哈希，因此只按MD5去重
 	md5s := make([]string, 0, len(batch))
-	plaintextMap := make(map[string]bool)
 	md5Map := make(map[string]bool)
 
 	// 使用map去重，减少查询负担
 	for _, record := range batch {
-		if !plaintextMap[record.Plaintext] {
-			plaintexts = append(plaintexts, record.Plaintext)
-			plaintextMap[record.Plaintext] = true
-		}
 		if !md5Map[record.MD5] {
 			md5s = append(md5s, record.MD5)
 			md5Map[record.MD5] = true
 		}
 	}
 
-	// 分批次查询已存在的明文记录，减少一次查询的数据量
+	// 分批次查询已存在的MD5记录，减少一次查询的数据量
 	const queryBatchSize = 200
 	existingMap := make(map[string]bool)
 
-	// 查询明文
-	for i := 0; i < len(plaintexts); i += queryBatchSize {
-		end := i + queryBatchSize
-		if end > len(plaintexts) {
-			end = len(plaintexts)
-		}
-
-		var existingPlaintexts []string
-		if err := tx.Model(&dbModel.Md5{}).Where("plaintext IN ?", plaintexts[i:end]).
-			Pluck("plaintext", &existingPlaintexts).Error; err != nil {
-			tx.Rollback()
-			return fmt.Errorf("查询明文失败: %v", err)
-		}
-
-		for _, p := range existingPlaintexts {
-			existingMap[p] = true
-		}
-	}
-
 	// 查询MD5
 	for i := 0; i < len(md5s); i += queryBatchSize {
 		end := i + queryBatchSize
@@ -258,46 +437,59 @@ func processBatch(batch []dbModel.Md5) error {
 			end = len(md5s)
 		}
 
-		var existingMD5s []string
-		if err := tx.Model(&dbModel.Md5{}).Where("md5 IN ?", md5s[i:end]).
-			Pluck("md5", &existingMD5s).Error; err != nil {
-			tx.Rollback()
-			return fmt.Errorf("查询MD5失败: %v", err)
+		existingMD5s, err := tx.Existing(md5s[i:end])
+		if err != nil {
+			return 0, fmt.Errorf("查询MD5失败: %v", err)
 		}
 
 		for _, m := range existingMD5s {
 			existingMap[m] = true
 		}
+
+		// 已存在的记录被其他来源再次提交，标记为多来源，回滚本次导入时不会删除
+		if err := tx.MarkReproduced(existingMD5s, batch[0].ImportJobID); err != nil {
+			return 0, fmt.Errorf("标记重复记录失败: %v", err)
+		}
 	}
 
 	// 过滤出不存在的记录
 	var newRecords []dbModel.Md5
 	for _, record := range batch {
-		if !existingMap[record.Plaintext] && !existingMap[record.MD5] {
+		if !existingMap[record.MD5] {
 			newRecords = append(newRecords, record)
+			// 避免同一批次内重复插入
+			existingMap[record.MD5] = true
 		}
 	}
 
-	// 批量保存新记录
-	if len(newRecords) > 0 {
-		// 使用较小的批量插入大小，避免过大的事务
-		if err := tx.CreateInBatches(newRecords, 200).Error; err != nil {
-			tx.Rollback()
-			return fmt.Errorf("批量保存失败: %v", err)
-		}
+	// 批量保存新记录，使用较小的批量插入大小，避免过大的事务
+	// 其他并发导入已写入的记录会因唯一索引冲突被跳过
+	inserted, err := tx.Insert(newRecords, 200)
+	if err != nil {
+		return 0, fmt.Errorf("批量保存失败: %v", err)
 	}
 
-	// 提交事务
-	if err := tx.Commit().Error; err != nil {
-		return fmt.Errorf("提交事务失败: %v", err)
-	}
+	return inserted, nil
+}
 
-	return nil
+// addImportJobProgress 累加导入任务的处理数量和新增数量
+func addImportJobProgress(jobID uint, processed, added int64) {
+	metrics.ImportedRecords.Add(uint64(processed))
+	metrics.ImportAddedRecords.Add(uint64(added))
+	db.PG.Model(&dbModel.ImportJob{}).Where("id = ?", jobID).UpdateColumns(map[string]interface{}{
+		"processed": gorm.Expr("processed + ?", processed),
+		"added":     gorm.Expr("added + ?", added),
+	})
 }
 
-// calculateMD5 计算字符串的MD5值
-func calculateMD5(text string) string {
-	hash := md5.New()
-	hash.Write([]byte(text))
-	return hex.EncodeToString(hash.Sum(nil))
+// finishImportJob 将导入任务标记为完成或失败
+func finishImportJob(jobID uint, err error) {
+	updates := map[string]interface{}{
+		"status": dbModel.ImportCompleted,
+	}
+	if err != nil {
+		updates["status"] = dbModel.ImportFailed
+		updates["error"] = err.Error()
+	}
+	db.PG.Model(&dbModel.ImportJob{}).Where("id = ?", jobID).Updates(updates)
 }
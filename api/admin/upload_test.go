@@ -0,0 +1,111 @@
+package admin
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"zmd5/config"
+	"zmd5/db"
+	"zmd5/db/dbModel"
+	"zmd5/repository"
+)
+
+// setupImportTest 使用临时SQLite数据库，返回注入处理器的存储
+func setupImportTest(t *testing.T) *repository.Store {
+	t.Helper()
+	conn, err := db.Open(config.DatabaseConfig{Driver: db.DriverSQLite, DSN: filepath.Join(t.TempDir(), "test.db")})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := conn.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	db.PG = conn
+	if _, err := db.Migrate(0); err != nil {
+		t.Fatalf("执行迁移失败: %v", err)
+	}
+	s := repository.New(conn)
+	Init(s)
+	return s
+}
+
+func TestImportFailsWhenBatchFails(t *testing.T) {
+	setupImportTest(t)
+	// 删除明文表使写入失败
+	if err := db.PG.Migrator().DropTable(&dbModel.Md5{}); err != nil {
+		t.Fatalf("删除明文表失败: %v", err)
+	}
+
+	if _, err := ImportReader(strings.NewReader("alpha\nbeta\n"), "broken.txt", []string{"utf8"}, 1); err == nil {
+		t.Fatal("写入失败时导入应返回错误")
+	}
+
+	var job dbModel.ImportJob
+	if err := db.PG.Where("filename = ?", "broken.txt").First(&job).Error; err != nil {
+		t.Fatalf("查询导入任务失败: %v", err)
+	}
+	if job.Status != dbModel.ImportFailed {
+		t.Fatalf("导入任务状态 = %d, 期望失败", job.Status)
+	}
+	if job.Error == "" {
+		t.Fatal("导入任务未记录失败原因")
+	}
+}
+
+func TestImportCheckpointAdvancesOverFinishedChunks(t *testing.T) {
+	setupImportTest(t)
+	job, err := createImportJob(1, "words.txt", "", []string{"utf8"})
+	if err != nil {
+		t.Fatalf("创建导入任务失败: %v", err)
+	}
+	resumeLine := func() int64 {
+		var current dbModel.ImportJob
+		if err := db.PG.First(&current, job.ID).Error; err != nil {
+			t.Fatalf("查询导入任务失败: %v", err)
+		}
+		return current.ResumeLine
+	}
+
+	checkpoint := &importCheckpoint{jobID: job.ID}
+	for _, endLine := range []int64{3, 5, 8} {
+		checkpoint.add(endLine)
+	}
+
+	// 之前的块未完成时不推进检查点
+	if err := checkpoint.done(1); err != nil {
+		t.Fatalf("保存检查点失败: %v", err)
+	}
+	if got := resumeLine(); got != 0 {
+		t.Fatalf("检查点 = %d, 期望 0", got)
+	}
+	if err := checkpoint.done(0); err != nil {
+		t.Fatalf("保存检查点失败: %v", err)
+	}
+	if got := resumeLine(); got != 5 {
+		t.Fatalf("检查点 = %d, 期望 5", got)
+	}
+	if err := checkpoint.done(2); err != nil {
+		t.Fatalf("保存检查点失败: %v", err)
+	}
+	if got := resumeLine(); got != 8 {
+		t.Fatalf("检查点 = %d, 期望 8", got)
+	}
+}
+
+func TestImportSavesCheckpointPerChunk(t *testing.T) {
+	setupImportTest(t)
+	previous := uploadConfig
+	t.Cleanup(func() { uploadConfig = previous })
+	uploadConfig = config.UploadConfig{BatchSize: 1, MaxWorkers: 2, ChunkSize: 2}
+
+	// 数据块在第二行中间结束，全部写入后检查点为最后一行
+	job, err := ImportReader(strings.NewReader("a\nb,c,d\ne\n"), "words.txt", []string{"utf8"}, 1)
+	if err != nil {
+		t.Fatalf("导入失败: %v", err)
+	}
+	if job.ResumeLine != 3 || job.Added != 5 {
+		t.Fatalf("导入完成后检查点 = %d, 新增 = %d, 期望 3, 5", job.ResumeLine, job.Added)
+	}
+}
@@ -0,0 +1,626 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"zmd5/api/auth"
+	"zmd5/db/dbModel"
+	"zmd5/loginguard"
+	"zmd5/repository"
+	"zmd5/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// CreateUserRequest 管理员创建用户请求
+type CreateUserRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// 用户角色（user/operator/auditor/admin 或自定义角色），为空时为普通用户
+	Role string `json:"role"`
+}
+
+// CreateUser 管理员创建用户
+func CreateUser(c *fiber.Ctx) error {
+	var req CreateUserRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "请求参数错误",
+		})
+	}
+	if req.Role == "" {
+		req.Role = auth.RoleUser
+	}
+	if ferr := guardRole(c, req.Role); ferr != nil {
+		return errorResponse(c, ferr)
+	}
+
+	user, err := auth.CreateUser(req.Username, req.Password, req.Role)
+	if errors.Is(err, auth.ErrUserExists) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"status":  "success",
+		"message": "创建用户成功",
+		"data": fiber.Map{
+			"id":       user.ID,
+			"username": user.Username,
+			"role":     user.Role,
+		},
+	})
+}
+
+// 用户详情中按日统计活动的天数
+const userActivityDays = 30
+
+// UserListRequest 用户列表请求参数
+type UserListRequest struct {
+	Page     int `query:"page"`
+	PageSize int `query:"pageSize"`
+	// 用户名包含的关键字
+	Search string `query:"search"`
+	Role   string `query:"role"`
+	// 账户状态：active/disabled/locked/reset_required/pending
+	Status string `query:"status"`
+}
+
+// UserInfo 用户信息及活动概要
+type UserInfo struct {
+	ID                uint       `json:"id"`
+	Username          string     `json:"username"`
+	Role              string     `json:"role"`
+	Disabled          bool       `json:"disabled"`
+	Locked            bool       `json:"locked"`
+	LockedUntil       *time.Time `json:"lockedUntil"`
+	MustResetPassword bool       `json:"mustResetPassword"`
+	PendingApproval   bool       `json:"pendingApproval"`
+	PrivateMode       bool       `json:"privateMode"`
+	TwoFactorEnabled  bool       `json:"twoFactorEnabled"`
+	CreatedAt         time.Time  `json:"createdAt"`
+	LastLoginAt       *time.Time `json:"lastLoginAt"`
+	// 加解密记录总数
+	RecordCount    int64      `json:"recordCount"`
+	LastActivityAt *time.Time `json:"lastActivityAt"`
+}
+
+func newUserInfo(user *dbModel.User, summary repository.ActivitySummary) UserInfo {
+	info := UserInfo{
+		ID:                user.ID,
+		Username:          user.Username,
+		Role:              user.Role,
+		Disabled:          user.Disabled,
+		Locked:            user.Locked(time.Now()),
+		MustResetPassword: user.MustResetPassword,
+		PendingApproval:   user.PendingApproval,
+		PrivateMode:       user.PrivateMode,
+		TwoFactorEnabled:  user.TOTPEnabled,
+		CreatedAt:         user.CreatedAt,
+		LastLoginAt:       user.LastLoginAt,
+		RecordCount:       summary.Total,
+	}
+	if info.Locked {
+		info.LockedUntil = user.LockedUntil
+	}
+	if summary.Total > 0 {
+		info.LastActivityAt = &summary.LastActivityAt
+	}
+	return info
+}
+
+// ListUsers 分页查询用户，支持按用户名搜索、按角色和账户状态过滤
+func ListUsers(c *fiber.Ctx) error {
+	req := new(UserListRequest)
+	if err := c.QueryParser(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "请求参数错误",
+		})
+	}
+	if req.Page <= 0 {
+		req.Page = 1
+	}
+	if req.PageSize <= 0 || req.PageSize > 100 {
+		req.PageSize = 20
+	}
+	switch req.Status {
+	case "", repository.UserStatusActive, repository.UserStatusDisabled,
+		repository.UserStatusLocked, repository.UserStatusResetRequired, repository.UserStatusPending:
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": fmt.Sprintf("无效的账户状态: %s", req.Status),
+		})
+	}
+
+	filter := repository.UserFilter{
+		Search: strings.TrimSpace(req.Search),
+		Role:   req.Role,
+		Status: req.Status,
+	}
+	users, total, err := store.Users.List(filter, (req.Page-1)*req.PageSize, req.PageSize)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "获取用户列表失败",
+		})
+	}
+
+	ids := make([]uint, len(users))
+	for i := range users {
+		ids[i] = users[i].ID
+	}
+	summaries, err := store.Records.ActivitySummaries(ids)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "获取用户活动失败",
+		})
+	}
+
+	records := make([]UserInfo, len(users))
+	for i := range users {
+		records[i] = newUserInfo(&users[i], summaries[users[i].ID])
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "获取用户列表成功",
+		"data": fiber.Map{
+			"records":  records,
+			"total":    total,
+			"page":     req.Page,
+			"pageSize": req.PageSize,
+		},
+	})
+}
+
+// GetUser 获取用户详情及最近30天的活动统计
+func GetUser(c *fiber.Ctx) error {
+	user, ferr := findUser(c)
+	if ferr != nil {
+		return errorResponse(c, ferr)
+	}
+
+	since := time.Now().UTC().AddDate(0, 0, -userActivityDays+1).Truncate(24 * time.Hour)
+	activity, err := store.Records.Activity(user.ID, since)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "获取用户活动失败",
+		})
+	}
+
+	var summary repository.ActivitySummary
+	if activity.LastActivityAt != nil {
+		summary = repository.ActivitySummary{Total: activity.Total, LastActivityAt: *activity.LastActivityAt}
+	}
+	byStatus := make(map[string]int64, len(activity.DecryptsByStatus))
+	for status, count := range activity.DecryptsByStatus {
+		byStatus[decryptStatusName(status)] = count
+	}
+	daily := make([]fiber.Map, len(activity.Daily))
+	for i, day := range activity.Daily {
+		daily[i] = fiber.Map{"date": day.Date, "count": day.Count}
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "获取用户详情成功",
+		"data": fiber.Map{
+			"user":        newUserInfo(user, summary),
+			"permissions": auth.RolePermissionList()[user.Role],
+			"activity": fiber.Map{
+				"total":            activity.Total,
+				"encrypts":         activity.Encrypts,
+				"decrypts":         activity.Decrypts,
+				"decryptsByStatus": byStatus,
+				"firstActivityAt":  activity.FirstActivityAt,
+				"lastActivityAt":   activity.LastActivityAt,
+				"days":             userActivityDays,
+				"daily":            daily,
+			},
+		},
+	})
+}
+
+// decryptStatusName 解密状态的名称
+func decryptStatusName(status int) string {
+	switch status {
+	case dbModel.DecryptNotStarted:
+		return "not_started"
+	case dbModel.DecryptInProgress:
+		return "in_progress"
+	case dbModel.DecryptSuccess:
+		return "success"
+	case dbModel.DecryptFailed:
+		return "failed"
+	}
+	return strconv.Itoa(status)
+}
+
+// UpdateUserRequest 修改用户请求
+type UpdateUserRequest struct {
+	Role string `json:"role"`
+}
+
+// UpdateUser 修改用户角色，角色变更后用户需要重新登录
+// 不能修改自己的角色，只能在自己拥有的权限范围内修改
+func UpdateUser(c *fiber.Ctx) error {
+	user, ferr := findUser(c)
+	if ferr != nil {
+		return errorResponse(c, ferr)
+	}
+
+	var req UpdateUserRequest
+	if err := c.BodyParser(&req); err != nil || req.Role == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "请求参数错误",
+		})
+	}
+	if !auth.ValidRole(req.Role) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": fmt.Sprintf("无效的用户角色: %s", req.Role),
+		})
+	}
+	if currentID, _ := c.Locals("userID").(uint); currentID == user.ID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "不能修改自己的角色",
+		})
+	}
+	if req.Role == user.Role {
+		return c.JSON(fiber.Map{
+			"status":  "success",
+			"message": "用户角色未变化",
+		})
+	}
+	for _, role := range []string{user.Role, req.Role} {
+		if ferr := guardRole(c, role); ferr != nil {
+			return errorResponse(c, ferr)
+		}
+	}
+	if user.Role == auth.RoleAdmin {
+		if ferr := guardAdmin(c, user, "修改角色"); ferr != nil {
+			return errorResponse(c, ferr)
+		}
+	}
+
+	if err := store.Users.Update(user.ID, map[string]interface{}{"role": req.Role}); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "修改用户角色失败",
+		})
+	}
+	// 角色变更后旧令牌中的角色信息已过期，要求重新登录
+	if err := auth.RevokeSessions(user.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "撤销用户会话失败",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "修改用户角色成功",
+	})
+}
+
+// DisableUser 禁用用户，用户的所有会话立即失效，API密钥也不能继续使用
+func DisableUser(c *fiber.Ctx) error {
+	user, ferr := findUser(c)
+	if ferr != nil {
+		return errorResponse(c, ferr)
+	}
+	if ferr := guardRole(c, user.Role); ferr != nil {
+		return errorResponse(c, ferr)
+	}
+	if ferr := guardAdmin(c, user, "禁用"); ferr != nil {
+		return errorResponse(c, ferr)
+	}
+	return setUserFields(c, user, map[string]interface{}{"disabled": true}, true, "禁用用户")
+}
+
+// EnableUser 启用被禁用的用户
+func EnableUser(c *fiber.Ctx) error {
+	user, ferr := findUser(c)
+	if ferr != nil {
+		return errorResponse(c, ferr)
+	}
+	if ferr := guardRole(c, user.Role); ferr != nil {
+		return errorResponse(c, ferr)
+	}
+	return setUserFields(c, user, map[string]interface{}{"disabled": false}, false, "启用用户")
+}
+
+// ApproveUser 审核通过注册的用户，通过后用户可以登录
+func ApproveUser(c *fiber.Ctx) error {
+	user, ferr := findUser(c)
+	if ferr != nil {
+		return errorResponse(c, ferr)
+	}
+	if !user.PendingApproval {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "该用户不在待审核状态",
+		})
+	}
+	if ferr := guardRole(c, user.Role); ferr != nil {
+		return errorResponse(c, ferr)
+	}
+	return setUserFields(c, user, map[string]interface{}{"pending_approval": false}, false, "审核通过")
+}
+
+// RejectUser 拒绝注册申请，永久删除待审核的用户，用户名可以重新注册
+func RejectUser(c *fiber.Ctx) error {
+	user, ferr := findUser(c)
+	if ferr != nil {
+		return errorResponse(c, ferr)
+	}
+	if !user.PendingApproval {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "只能拒绝待审核的用户",
+		})
+	}
+	if ferr := guardRole(c, user.Role); ferr != nil {
+		return errorResponse(c, ferr)
+	}
+
+	if err := store.Users.Delete(user.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "拒绝注册失败",
+		})
+	}
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "已拒绝注册申请",
+	})
+}
+
+// LockUserRequest 锁定用户请求
+type LockUserRequest struct {
+	// 锁定时长（分钟）
+	Minutes int `json:"minutes"`
+}
+
+// LockUser 在指定时长内锁定用户，到期后自动解锁
+func LockUser(c *fiber.Ctx) error {
+	user, ferr := findUser(c)
+	if ferr != nil {
+		return errorResponse(c, ferr)
+	}
+
+	var req LockUserRequest
+	if err := c.BodyParser(&req); err != nil || req.Minutes <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "锁定时长必须大于0分钟",
+		})
+	}
+	if ferr := guardRole(c, user.Role); ferr != nil {
+		return errorResponse(c, ferr)
+	}
+	if ferr := guardAdmin(c, user, "锁定"); ferr != nil {
+		return errorResponse(c, ferr)
+	}
+
+	lockedUntil := time.Now().Add(time.Duration(req.Minutes) * time.Minute)
+	return setUserFields(c, user, map[string]interface{}{"locked_until": lockedUntil}, true, "锁定用户")
+}
+
+// UnlockUser 解除用户锁定
+func UnlockUser(c *fiber.Ctx) error {
+	user, ferr := findUser(c)
+	if ferr != nil {
+		return errorResponse(c, ferr)
+	}
+	if ferr := guardRole(c, user.Role); ferr != nil {
+		return errorResponse(c, ferr)
+	}
+	// 同时清除登录失败记录，否则用户仍需等待退避时间
+	auth.LoginGuard().Clear(loginguard.KindUser, user.Username)
+	return setUserFields(c, user, map[string]interface{}{"locked_until": nil}, false, "解锁用户")
+}
+
+// ResetPasswordRequest 重置密码请求
+type ResetPasswordRequest struct {
+	// 临时密码，为空时自动生成
+	Password string `json:"password"`
+}
+
+// ResetUserPassword 重置用户密码，用户的所有会话立即失效，下次登录前必须修改密码
+// 未指定临时密码时自动生成，生成的密码只在响应中返回一次
+func ResetUserPassword(c *fiber.Ctx) error {
+	user, ferr := findUser(c)
+	if ferr != nil {
+		return errorResponse(c, ferr)
+	}
+	if ferr := guardRole(c, user.Role); ferr != nil {
+		return errorResponse(c, ferr)
+	}
+	if ferr := guardAdmin(c, user, "重置密码"); ferr != nil {
+		return errorResponse(c, ferr)
+	}
+
+	var req ResetPasswordRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  "error",
+				"message": "请求参数错误",
+			})
+		}
+	}
+
+	generated := req.Password == ""
+	if !generated {
+		if err := auth.ValidatePassword(user.Username, req.Password); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  "error",
+				"message": err.Error(),
+			})
+		}
+	}
+	if generated {
+		var err error
+		req.Password, err = utils.GenerateRandomPlaintext(16, utils.CharsetAlphaDigits)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"status":  "error",
+				"message": "生成临时密码失败",
+			})
+		}
+	}
+
+	if err := auth.SetPassword(user.ID, req.Password, true); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "重置密码失败",
+		})
+	}
+
+	data := fiber.Map{"mustResetPassword": true}
+	if generated {
+		data["password"] = req.Password
+	}
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "重置密码成功，用户下次登录前需要修改密码",
+		"data":    data,
+	})
+}
+
+// ResetUserTwoFactor 为丢失验证设备的用户关闭两步验证，用户的所有会话立即失效
+// 角色要求两步验证时，用户下次登录需要重新完成设置
+func ResetUserTwoFactor(c *fiber.Ctx) error {
+	user, ferr := findUser(c)
+	if ferr != nil {
+		return errorResponse(c, ferr)
+	}
+	if !user.TOTPEnabled {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "该用户未开启两步验证",
+		})
+	}
+	if ferr := guardRole(c, user.Role); ferr != nil {
+		return errorResponse(c, ferr)
+	}
+	if ferr := guardAdmin(c, user, "重置两步验证"); ferr != nil {
+		return errorResponse(c, ferr)
+	}
+
+	if err := auth.ResetTwoFactor(user.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "重置两步验证失败",
+		})
+	}
+	if err := auth.RevokeSessions(user.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "撤销用户会话失败",
+		})
+	}
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "重置两步验证成功",
+	})
+}
+
+// findUser 按路径参数中的ID查找用户
+func findUser(c *fiber.Ctx) (*dbModel.User, *fiber.Error) {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "无效的用户ID")
+	}
+	user, err := store.Users.FindByID(uint(id))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fiber.NewError(fiber.StatusNotFound, "用户不存在")
+	}
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "获取用户失败")
+	}
+	return user, nil
+}
+
+// guardRole 禁止授予超出当前用户权限的角色，以及管理拥有这类角色的用户，管理员账户只能由管理员管理
+func guardRole(c *fiber.Ctx, role string) *fiber.Error {
+	callerRole, _ := c.Locals("role").(string)
+	if auth.CanManageRole(callerRole, role) {
+		return nil
+	}
+	if role == auth.RoleAdmin {
+		return fiber.NewError(fiber.StatusForbidden, "只有管理员可以授予管理员角色或管理管理员账户")
+	}
+	return fiber.NewError(fiber.StatusForbidden, fmt.Sprintf("角色 %s 拥有当前账户没有的权限", role))
+}
+
+// guardAdmin 禁止管理员对自己执行操作，以及使系统失去最后一个可用的管理员
+func guardAdmin(c *fiber.Ctx, user *dbModel.User, action string) *fiber.Error {
+	if currentID, _ := c.Locals("userID").(uint); currentID == user.ID {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("不能%s自己的账户", action))
+	}
+	if user.Role != auth.RoleAdmin || !user.Active(time.Now()) {
+		return nil
+	}
+	_, active, err := store.Users.List(repository.UserFilter{
+		Role:   auth.RoleAdmin,
+		Status: repository.UserStatusActive,
+	}, 0, 1)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "获取管理员数量失败")
+	}
+	if active <= 1 {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("不能%s最后一个可用的管理员", action))
+	}
+	return nil
+}
+
+// errorResponse 按错误的状态码返回错误信息
+func errorResponse(c *fiber.Ctx, ferr *fiber.Error) error {
+	return c.Status(ferr.Code).JSON(fiber.Map{
+		"status":  "error",
+		"message": ferr.Message,
+	})
+}
+
+// setUserFields 更新用户字段，revoke 为 true 时撤销用户的所有会话
+func setUserFields(c *fiber.Ctx, user *dbModel.User, fields map[string]interface{}, revoke bool, action string) error {
+	if err := store.Users.Update(user.ID, fields); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": action + "失败",
+		})
+	}
+	if revoke {
+		if err := auth.RevokeSessions(user.ID); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"status":  "error",
+				"message": "撤销用户会话失败",
+			})
+		}
+	}
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": action + "成功",
+	})
+}
@@ -0,0 +1,176 @@
+package admin
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"zmd5/api/auth"
+	"zmd5/config"
+	"zmd5/db"
+	"zmd5/db/dbModel"
+	"zmd5/repository"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// 测试中只有用户管理权限和角色管理权限的自定义角色
+const (
+	roleUserManager = "user_manager"
+	roleRoleManager = "role_manager"
+)
+
+// setupUsersTest 使用临时SQLite数据库创建测试用户，返回以 X-Test-User 头指定当前用户的测试应用
+func setupUsersTest(t *testing.T) (*fiber.App, map[string]*dbModel.User) {
+	t.Helper()
+	conn, err := db.Open(config.DatabaseConfig{Driver: db.DriverSQLite, DSN: filepath.Join(t.TempDir(), "test.db")})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := conn.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	db.PG = conn
+	if _, err := db.Migrate(0); err != nil {
+		t.Fatalf("执行迁移失败: %v", err)
+	}
+	s := repository.New(conn)
+	Init(s)
+	auth.Init(s)
+	if err := auth.SetRolePermissions(roleUserManager, []string{auth.PermUsersRead, auth.PermUsersManage}); err != nil {
+		t.Fatalf("创建角色失败: %v", err)
+	}
+	if err := auth.SetRolePermissions(roleRoleManager, []string{auth.PermRolesRead, auth.PermRolesManage}); err != nil {
+		t.Fatalf("创建角色失败: %v", err)
+	}
+
+	users := map[string]*dbModel.User{}
+	for _, u := range []struct{ name, role string }{
+		{"admin", auth.RoleAdmin},
+		{"admin2", auth.RoleAdmin},
+		{"manager", roleUserManager},
+		{"rolemgr", roleRoleManager},
+		{"operator", auth.RoleOperator},
+		{"member", auth.RoleUser},
+	} {
+		user := &dbModel.User{Username: u.name, Password: "-", Role: u.role, TOTPEnabled: true}
+		if err := conn.Create(user).Error; err != nil {
+			t.Fatalf("创建用户失败: %v", err)
+		}
+		users[u.name] = user
+	}
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		user := users[c.Get("X-Test-User")]
+		c.Locals("userID", user.ID)
+		c.Locals("role", user.Role)
+		return c.Next()
+	})
+	app.Post("/users", CreateUser)
+	app.Patch("/users/:id", UpdateUser)
+	app.Post("/users/:id/disable", DisableUser)
+	app.Post("/users/:id/reset-password", ResetUserPassword)
+	app.Post("/users/:id/two-factor/reset", ResetUserTwoFactor)
+	app.Post("/invites", CreateInvite)
+	app.Put("/roles/:role", SetRolePermissions)
+	app.Delete("/roles/:role", DeleteRole)
+	app.Put("/roles/:role/two-factor", SetRoleTwoFactor)
+	return app, users
+}
+
+func doRequest(t *testing.T, app *fiber.App, caller, method, path, body string) int {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Test-User", caller)
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	return resp.StatusCode
+}
+
+func TestUserManagerCannotEscalate(t *testing.T) {
+	app, users := setupUsersTest(t)
+	userPath := func(name, action string) string {
+		return fmt.Sprintf("/users/%d%s", users[name].ID, action)
+	}
+
+	cases := []struct {
+		name         string
+		method, path string
+		body         string
+		want         int
+	}{
+		{"创建管理员", http.MethodPost, "/users", `{"username":"evil","password":"Evil-pass-1234","role":"admin"}`, fiber.StatusForbidden},
+		{"创建权限更多的角色", http.MethodPost, "/users", `{"username":"evil","password":"Evil-pass-1234","role":"operator"}`, fiber.StatusForbidden},
+		{"修改自己的角色", http.MethodPatch, userPath("manager", ""), `{"role":"admin"}`, fiber.StatusBadRequest},
+		{"授予管理员角色", http.MethodPatch, userPath("member", ""), `{"role":"admin"}`, fiber.StatusForbidden},
+		{"授予权限更多的角色", http.MethodPatch, userPath("member", ""), `{"role":"operator"}`, fiber.StatusForbidden},
+		{"修改管理员的角色", http.MethodPatch, userPath("admin", ""), `{"role":"user"}`, fiber.StatusForbidden},
+		{"修改权限更多的用户的角色", http.MethodPatch, userPath("operator", ""), `{"role":"user"}`, fiber.StatusForbidden},
+		{"禁用管理员", http.MethodPost, userPath("admin", "/disable"), ``, fiber.StatusForbidden},
+		{"重置管理员密码", http.MethodPost, userPath("admin", "/reset-password"), ``, fiber.StatusForbidden},
+		{"重置管理员两步验证", http.MethodPost, userPath("admin", "/two-factor/reset"), ``, fiber.StatusForbidden},
+		{"创建管理员邀请码", http.MethodPost, "/invites", `{"role":"admin"}`, fiber.StatusForbidden},
+		{"创建权限更多的角色的邀请码", http.MethodPost, "/invites", `{"role":"operator"}`, fiber.StatusForbidden},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := doRequest(t, app, "manager", tc.method, tc.path, tc.body); got != tc.want {
+				t.Fatalf("状态码 = %d, 期望 %d", got, tc.want)
+			}
+		})
+	}
+
+	// 权限范围内的操作不受影响
+	if got := doRequest(t, app, "manager", http.MethodPost, "/users", `{"username":"newbie","password":"Newbie-pass-1234"}`); got != fiber.StatusCreated {
+		t.Fatalf("创建普通用户: 状态码 = %d", got)
+	}
+	if got := doRequest(t, app, "manager", http.MethodPost, userPath("member", "/reset-password"), ``); got != fiber.StatusOK {
+		t.Fatalf("重置普通用户密码: 状态码 = %d", got)
+	}
+	if got := doRequest(t, app, "manager", http.MethodPost, "/invites", `{}`); got != fiber.StatusCreated {
+		t.Fatalf("创建普通用户邀请码: 状态码 = %d", got)
+	}
+
+	var admin dbModel.User
+	db.PG.First(&admin, users["admin"].ID)
+	if admin.Role != auth.RoleAdmin || admin.Disabled || admin.MustResetPassword || !admin.TOTPEnabled {
+		t.Fatalf("管理员账户被修改: %+v", admin)
+	}
+}
+
+func TestAdminManagesAdmins(t *testing.T) {
+	app, users := setupUsersTest(t)
+	userPath := func(name, action string) string {
+		return fmt.Sprintf("/users/%d%s", users[name].ID, action)
+	}
+
+	if got := doRequest(t, app, "admin", http.MethodPatch, userPath("admin", ""), `{"role":"user"}`); got != fiber.StatusBadRequest {
+		t.Fatalf("修改自己的角色: 状态码 = %d", got)
+	}
+	if got := doRequest(t, app, "admin", http.MethodPost, userPath("admin", "/reset-password"), ``); got != fiber.StatusBadRequest {
+		t.Fatalf("重置自己的密码: 状态码 = %d", got)
+	}
+	if got := doRequest(t, app, "admin", http.MethodPost, userPath("admin", "/two-factor/reset"), ``); got != fiber.StatusBadRequest {
+		t.Fatalf("重置自己的两步验证: 状态码 = %d", got)
+	}
+	if got := doRequest(t, app, "admin", http.MethodPost, userPath("admin2", "/reset-password"), ``); got != fiber.StatusOK {
+		t.Fatalf("重置其他管理员的密码: 状态码 = %d", got)
+	}
+	if got := doRequest(t, app, "admin", http.MethodPost, userPath("admin2", "/two-factor/reset"), ``); got != fiber.StatusOK {
+		t.Fatalf("重置其他管理员的两步验证: 状态码 = %d", got)
+	}
+	if got := doRequest(t, app, "admin", http.MethodPatch, userPath("member", ""), `{"role":"admin"}`); got != fiber.StatusOK {
+		t.Fatalf("授予管理员角色: 状态码 = %d", got)
+	}
+	if got := doRequest(t, app, "admin", http.MethodPost, "/invites", `{"role":"admin"}`); got != fiber.StatusCreated {
+		t.Fatalf("创建管理员邀请码: 状态码 = %d", got)
+	}
+}
@@ -1,13 +1,25 @@
 package auth
 
 import (
-	"zmd5/db"
+	"errors"
+	"fmt"
+	"time"
+	"zmd5/config"
 	"zmd5/db/dbModel"
+	"zmd5/repository"
 	"zmd5/utils"
 
 	"github.com/gofiber/fiber/v2"
 )
 
+// store 处理器使用的存储，由 Init 注入
+var store *repository.Store
+
+// Init 注入处理器使用的存储
+func Init(s *repository.Store) {
+	store = s
+}
+
 // LoginRequest 登录请求结构
 type LoginRequest struct {
 	Username string `json:"username"`
@@ -18,14 +30,30 @@ type LoginRequest struct {
 type RegisterRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
+	// 邀请码，注册方式为 invite 时必填
+	InviteCode string `json:"inviteCode"`
 }
 
 // LoginResponse 登录响应结构
 type LoginResponse struct {
 	Code    int    `json:"code"`
 	Message string `json:"message"`
-	Token   string `json:"token,omitempty"`
-	User    *User  `json:"user,omitempty"`
+	// 访问令牌，有效期较短，过期后使用刷新令牌换取新的访问令牌
+	Token        string `json:"token,omitempty"`
+	RefreshToken string `json:"refreshToken,omitempty"`
+	// 访问令牌有效期（秒）
+	ExpiresIn int64 `json:"expiresIn,omitempty"`
+	User      *User `json:"user,omitempty"`
+	// 管理员重置了密码，需要先调用 /api/auth/password 修改密码
+	PasswordResetRequired bool `json:"passwordResetRequired,omitempty"`
+	// 需要两步验证：使用 PreAuthToken 调用 /api/auth/2fa/verify 完成登录
+	TwoFactorRequired bool `json:"twoFactorRequired,omitempty"`
+	// 角色要求两步验证但尚未开启：使用 PreAuthToken 调用 /api/auth/2fa/setup 和 /api/auth/2fa/enable 完成设置
+	TwoFactorSetupRequired bool `json:"twoFactorSetupRequired,omitempty"`
+	// 预认证令牌，只能用于完成两步验证
+	PreAuthToken string `json:"preAuthToken,omitempty"`
+	// 注册成功但需要等待管理员审核，审核通过前不能登录
+	ApprovalPending bool `json:"approvalPending,omitempty"`
 }
 
 // User 用户信息
@@ -33,6 +61,19 @@ type User struct {
 	ID       uint   `json:"id"`
 	Username string `json:"username"`
 	Role     string `json:"role"`
+	// 角色拥有的管理权限，前端据此显示管理后台入口
+	Permissions      []string `json:"permissions,omitempty"`
+	TwoFactorEnabled bool     `json:"twoFactorEnabled"`
+}
+
+func newUserInfo(user *dbModel.User) *User {
+	return &User{
+		ID:               user.ID,
+		Username:         user.Username,
+		Role:             user.Role,
+		Permissions:      RolePermissionList()[user.Role],
+		TwoFactorEnabled: user.TOTPEnabled,
+	}
 }
 
 // Login 处理用户登录
@@ -53,52 +94,37 @@ func Login(c *fiber.Ctx) error {
 		})
 	}
 
-	// 查询用户
-	var user dbModel.User
-	result := db.PG.Where("username = ?", request.Username).First(&user)
-	if result.Error != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(LoginResponse{
-			Code:    fiber.StatusUnauthorized,
-			Message: "用户名或密码错误",
-		})
+	// 检查登录失败限制，验证用户名、密码和账户状态
+	user, ferr := verifyPassword(c, request.Username, request.Password)
+	if ferr != nil {
+		return loginError(c, ferr)
 	}
-
-	// 验证密码
-	if !utils.CheckPasswordHash(request.Password, user.Password) {
-		return c.Status(fiber.StatusUnauthorized).JSON(LoginResponse{
-			Code:    fiber.StatusUnauthorized,
-			Message: "用户名或密码错误",
+	// 角色要求两步验证但尚未设置时先完成设置，之后才能使用验证码修改密码
+	if user.MustResetPassword && (user.TOTPEnabled || !RequiresTwoFactor(user.Role)) {
+		recordAttempt(c, user.Username, user, dbModel.LoginResetRequired)
+		guard.Succeed(user.Username)
+		return c.Status(fiber.StatusForbidden).JSON(LoginResponse{
+			Code:                  fiber.StatusForbidden,
+			Message:               "管理员已重置密码，请先修改密码",
+			PasswordResetRequired: true,
 		})
 	}
 
-	// 生成JWT令牌
-	token, err := utils.GenerateToken(user.ID, user.Username, user.Role)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(LoginResponse{
-			Code:    fiber.StatusInternalServerError,
-			Message: "生成token失败",
-		})
-	}
+	// 清理已过期的刷新令牌
+	store.RefreshTokens.DeleteExpired(time.Now())
 
-	// 更新用户token
-	user.Token = token
-	db.PG.Save(&user)
-
-	// 登录成功，返回用户信息和token
-	return c.Status(fiber.StatusOK).JSON(LoginResponse{
-		Code:    fiber.StatusOK,
-		Message: "登录成功",
-		Token:   token,
-		User: &User{
-			ID:       user.ID,
-			Username: user.Username,
-			Role:     user.Role,
-		},
-	})
+	return completeLogin(c, user, fiber.StatusOK, "登录成功")
 }
 
-// Register 处理用户注册
+// Register 处理用户注册，按注册方式检查邀请码或等待管理员审核
 func Register(c *fiber.Ctx) error {
+	if registration.Mode == config.RegistrationClosed {
+		return c.Status(fiber.StatusForbidden).JSON(LoginResponse{
+			Code:    fiber.StatusForbidden,
+			Message: "系统已关闭注册，请联系管理员创建账户",
+		})
+	}
+
 	var request RegisterRequest
 	if err := c.BodyParser(&request); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(LoginResponse{
@@ -115,63 +141,260 @@ func Register(c *fiber.Ctx) error {
 		})
 	}
 
-	// 检查用户名是否已存在
-	var existingUser dbModel.User
-	result := db.PG.Where("username = ?", request.Username).First(&existingUser)
-	if result.Error == nil {
-		return c.Status(fiber.StatusConflict).JSON(LoginResponse{
-			Code:    fiber.StatusConflict,
-			Message: "用户名已存在",
-		})
+	if err := validateAccount(request.Username, request.Password); err != nil {
+		return registerError(c, err)
 	}
 
-	// 加密密码
-	hashedPassword, err := utils.EncryptPassword(request.Password)
+	// 默认为普通用户角色，使用邀请码注册时为邀请码指定的角色
+	role := RoleUser
+	var invite *dbModel.InviteCode
+	if registration.Mode == config.RegistrationInvite {
+		if request.InviteCode == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(LoginResponse{
+				Code:    fiber.StatusBadRequest,
+				Message: "需要邀请码才能注册",
+			})
+		}
+		// 先检查用户名，避免用户名已存在时白白消耗邀请码
+		if _, err := store.Users.FindByUsername(request.Username); err == nil {
+			return registerError(c, ErrUserExists)
+		}
+		var ok bool
+		var err error
+		invite, ok, err = store.InviteCodes.Consume(utils.HashInviteCode(request.InviteCode), time.Now())
+		if err != nil {
+			return registerError(c, err)
+		}
+		if !ok {
+			return c.Status(fiber.StatusBadRequest).JSON(LoginResponse{
+				Code:    fiber.StatusBadRequest,
+				Message: "邀请码无效、已过期或已用完",
+			})
+		}
+		if invite.Role != "" {
+			role = invite.Role
+		}
+	}
+
+	pending := registration.Mode == config.RegistrationApproval
+	newUser, err := createUser(request.Username, request.Password, role, pending)
 	if err != nil {
+		if invite != nil {
+			store.InviteCodes.Release(invite.ID)
+		}
+		return registerError(c, err)
+	}
+
+	if pending {
+		return c.Status(fiber.StatusAccepted).JSON(LoginResponse{
+			Code:            fiber.StatusAccepted,
+			Message:         "注册成功，请等待管理员审核后登录",
+			ApprovalPending: true,
+		})
+	}
+	return completeLogin(c, newUser, fiber.StatusCreated, "注册成功")
+}
+
+// checkAccount 检查账户是否等待审核、被禁用或锁定
+func checkAccount(user *dbModel.User) error {
+	if user.PendingApproval {
+		return ErrAccountPending
+	}
+	if user.Disabled {
+		return ErrAccountDisabled
+	}
+	if user.Locked(time.Now()) {
+		return fmt.Errorf("%w，请在 %s 后重试", ErrAccountLocked, user.LockedUntil.Format("2006-01-02 15:04:05"))
+	}
+	return nil
+}
+
+// ChangePasswordRequest 修改密码请求结构
+type ChangePasswordRequest struct {
+	Username    string `json:"username"`
+	Password    string `json:"password"`
+	NewPassword string `json:"newPassword"`
+	// 已开启两步验证时需要提供验证码或恢复码，已登录时可以使用认证头中的访问令牌代替
+	Code string `json:"code"`
+}
+
+// ChangePassword 使用旧密码修改密码，管理员重置密码后用户也通过该接口设置新密码
+// 修改成功后用户的其他会话全部失效，并为当前请求创建新会话
+func ChangePassword(c *fiber.Ctx) error {
+	var request ChangePasswordRequest
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(LoginResponse{
+			Code:    fiber.StatusBadRequest,
+			Message: "无效的请求参数",
+		})
+	}
+	if request.Username == "" || request.Password == "" || request.NewPassword == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(LoginResponse{
+			Code:    fiber.StatusBadRequest,
+			Message: "用户名、旧密码和新密码不能为空",
+		})
+	}
+	if request.NewPassword == request.Password {
+		return c.Status(fiber.StatusBadRequest).JSON(LoginResponse{
+			Code:    fiber.StatusBadRequest,
+			Message: "新密码不能与旧密码相同",
+		})
+	}
+
+	user, ferr := verifyPassword(c, request.Username, request.Password)
+	if ferr != nil {
+		return loginError(c, ferr)
+	}
+	if err := ValidatePassword(user.Username, request.NewPassword); err != nil {
+		return registerError(c, err)
+	}
+	// 仅凭密码不能修改需要两步验证的账户的密码
+	verified, ferr := passwordChangeSecondFactor(c, user, request.Code)
+	if ferr != nil {
+		return loginError(c, ferr)
+	}
+
+	if err := SetPassword(user.ID, request.NewPassword, false); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(LoginResponse{
 			Code:    fiber.StatusInternalServerError,
-			Message: "密码加密失败",
+			Message: "修改密码失败",
 		})
 	}
 
-	// 创建新用户
-	newUser := dbModel.User{
-		Username: request.Username,
-		Password: hashedPassword,
-		Role:     "user", // 默认为普通用户角色
+	// 重新读取用户以获得新的令牌版本
+	user, err := store.Users.FindByID(user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(LoginResponse{
+			Code:    fiber.StatusInternalServerError,
+			Message: "修改密码失败",
+		})
 	}
-
-	if err := db.PG.Create(&newUser).Error; err != nil {
+	if !verified {
+		return completeLogin(c, user, fiber.StatusOK, "修改密码成功")
+	}
+	// 本次请求已完成两步验证，直接创建会话
+	response, err := loginSession(c, user)
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(LoginResponse{
 			Code:    fiber.StatusInternalServerError,
-			Message: "用户创建失败",
+			Message: "生成token失败",
 		})
 	}
+	response.Code = fiber.StatusOK
+	response.Message = "修改密码成功"
+	return c.Status(fiber.StatusOK).JSON(response)
+}
+
+// completeLogin 密码验证通过后完成登录：需要两步验证时返回预认证令牌，否则创建会话并返回令牌
+func completeLogin(c *fiber.Ctx, user *dbModel.User, status int, message string) error {
+	if user.TOTPEnabled || RequiresTwoFactor(user.Role) {
+		return twoFactorChallenge(c, user)
+	}
 
-	// 生成JWT令牌
-	token, err := utils.GenerateToken(newUser.ID, newUser.Username, newUser.Role)
+	response, err := loginSession(c, user)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(LoginResponse{
 			Code:    fiber.StatusInternalServerError,
 			Message: "生成token失败",
 		})
 	}
+	response.Code = status
+	response.Message = message
+	return c.Status(status).JSON(response)
+}
+
+// loginSession 创建会话，签发访问令牌和刷新令牌，并记录登录成功
+func loginSession(c *fiber.Ctx, user *dbModel.User) (*LoginResponse, error) {
+	pair, err := issueSession(c, user)
+	if err != nil {
+		return nil, err
+	}
+	store.Users.Update(user.ID, map[string]interface{}{"last_login_at": time.Now()})
+	loginSucceeded(c, user)
+
+	return &LoginResponse{
+		Token:        pair.AccessToken,
+		RefreshToken: pair.RefreshToken,
+		ExpiresIn:    pair.ExpiresIn,
+		User:         newUserInfo(user),
+	}, nil
+}
 
-	// 更新用户token
-	newUser.Token = token
-	db.PG.Save(&newUser)
-
-	// 注册成功
-	return c.Status(fiber.StatusCreated).JSON(LoginResponse{
-		Code:    fiber.StatusCreated,
-		Message: "注册成功",
-		Token:   token,
-		User: &User{
-			ID:       newUser.ID,
-			Username: newUser.Username,
-			Role:     newUser.Role,
-		},
+// SetPassword 设置用户密码并使用户的所有会话失效
+// mustReset 为 true 时用户下次登录前必须修改密码（管理员重置密码时使用）
+func SetPassword(userID uint, password string, mustReset bool) error {
+	hashedPassword, err := utils.EncryptPassword(password)
+	if err != nil {
+		return fmt.Errorf("密码加密失败: %v", err)
+	}
+	err = store.Users.Update(userID, map[string]interface{}{
+		"password":            hashedPassword,
+		"must_reset_password": mustReset,
 	})
+	if err != nil {
+		return err
+	}
+	return RevokeSessions(userID)
+}
+
+// 用户角色
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+var (
+	// ErrUserExists 用户名已存在
+	ErrUserExists = errors.New("用户名已存在")
+	// ErrAccountDisabled 账户已被禁用
+	ErrAccountDisabled = errors.New("账户已被禁用")
+	// ErrAccountLocked 账户已被锁定
+	ErrAccountLocked = errors.New("账户已被锁定")
+	// ErrAccountPending 注册的账户等待管理员审核
+	ErrAccountPending = errors.New("账户正在等待管理员审核")
+	// ErrInvalidRole 角色不存在
+	ErrInvalidRole = errors.New("无效的用户角色")
+)
+
+// CreateUser 创建用户，用户名和密码需要符合要求，密码加密后保存
+func CreateUser(username, password, role string) (*dbModel.User, error) {
+	if username == "" || password == "" {
+		return nil, errors.New("用户名和密码不能为空")
+	}
+	if err := validateAccount(username, password); err != nil {
+		return nil, err
+	}
+	return createUser(username, password, role, false)
+}
+
+// createUser 创建用户，调用方负责检查用户名和密码
+// pending 为 true 时账户需要管理员审核通过后才能登录
+func createUser(username, password, role string, pending bool) (*dbModel.User, error) {
+	if !ValidRole(role) {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidRole, role)
+	}
+
+	// 检查用户名是否已存在
+	if _, err := store.Users.FindByUsername(username); err == nil {
+		return nil, ErrUserExists
+	}
+
+	// 加密密码
+	hashedPassword, err := utils.EncryptPassword(password)
+	if err != nil {
+		return nil, fmt.Errorf("密码加密失败: %v", err)
+	}
+
+	user := dbModel.User{
+		Username:        username,
+		Password:        hashedPassword,
+		Role:            role,
+		PendingApproval: pending,
+	}
+	if err := store.Users.Create(&user); err != nil {
+		return nil, err
+	}
+	return &user, nil
 }
 
 // StatusResponse 状态检查响应结构
@@ -195,16 +418,8 @@ func Status(c *fiber.Ctx) error {
 		})
 	}
 
-	// 提取token
-	tokenString := ""
-	if len(authHeader) > 7 && authHeader[:7] == "Bearer " {
-		tokenString = authHeader[7:]
-	} else {
-		tokenString = authHeader // 兼容直接传入token的情况
-	}
-
 	// 验证token
-	userID, username, role, err := utils.ValidateToken(tokenString)
+	user, err := VerifyAccessToken(bearerToken(c))
 	if err != nil {
 		return c.Status(fiber.StatusOK).JSON(StatusResponse{
 			Status:  fiber.StatusOK,
@@ -218,11 +433,7 @@ func Status(c *fiber.Ctx) error {
 		Status:  fiber.StatusOK,
 		Message: "已登录",
 		IsAuth:  true,
-		User: &User{
-			ID:       userID,
-			Username: username,
-			Role:     role,
-		},
+		User:    newUserInfo(user),
 	})
 }
 
@@ -232,46 +443,49 @@ type LogoutResponse struct {
 	Message string `json:"message"`
 }
 
-// Logout 处理用户退出登录
+// LogoutRequest 退出登录请求结构
+type LogoutRequest struct {
+	// 访问令牌已过期时可以只提供刷新令牌
+	RefreshToken string `json:"refreshToken"`
+}
+
+// Logout 处理用户退出登录，撤销当前会话的刷新令牌，该会话已签发的访问令牌随即失效
 func Logout(c *fiber.Ctx) error {
-	// 从请求头中获取认证token
-	authHeader := c.Get("Authorization")
-	if authHeader == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(LogoutResponse{
-			Status:  fiber.StatusBadRequest,
-			Message: "未提供认证token",
-		})
+	var request LogoutRequest
+	c.BodyParser(&request)
+
+	// 优先使用刷新令牌确定会话
+	familyID := ""
+	if request.RefreshToken != "" {
+		if record, err := store.RefreshTokens.FindByHash(utils.HashRefreshToken(request.RefreshToken)); err == nil {
+			familyID = record.FamilyID
+		}
 	}
 
-	// 提取token
-	tokenString := ""
-	if len(authHeader) > 7 && authHeader[:7] == "Bearer " {
-		tokenString = authHeader[7:]
-	} else {
-		tokenString = authHeader
+	// 其次使用认证头中的访问令牌
+	if familyID == "" {
+		authHeader := c.Get("Authorization")
+		if authHeader == "" && request.RefreshToken == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(LogoutResponse{
+				Status:  fiber.StatusBadRequest,
+				Message: "未提供认证token",
+			})
+		}
+
+		if claims, err := utils.ParseToken(bearerToken(c)); err == nil {
+			familyID = claims.SessionID
+		}
 	}
 
-	// 验证token
-	userID, _, _, err := utils.ValidateToken(tokenString)
-	if err != nil {
+	if familyID == "" {
 		return c.Status(fiber.StatusUnauthorized).JSON(LogoutResponse{
 			Status:  fiber.StatusUnauthorized,
 			Message: "无效的token或会话已过期",
 		})
 	}
 
-	// 查找用户并清除token
-	var user dbModel.User
-	if err := db.PG.First(&user, userID).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(LogoutResponse{
-			Status:  fiber.StatusInternalServerError,
-			Message: "用户不存在",
-		})
-	}
-
-	// 清除用户token
-	user.Token = ""
-	if err := db.PG.Save(&user).Error; err != nil {
+	// 撤销会话
+	if err := store.RefreshTokens.RevokeFamily(familyID, time.Now()); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(LogoutResponse{
 			Status:  fiber.StatusInternalServerError,
 			Message: "退出登录失败",
@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+	"zmd5/config"
+	"zmd5/db/dbModel"
+	"zmd5/loginguard"
+	"zmd5/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// 登录尝试审计记录的保留时间
+const loginAttemptRetention = 90 * 24 * time.Hour
+
+// guard 登录失败限制，默认值与 config.Default 一致
+var guard = newLoginGuard(config.Default().Login, loginguard.NewMemoryStore())
+
+// SetLoginConfig 设置登录失败限制策略
+func SetLoginConfig(cfg config.LoginConfig) {
+	guard = newLoginGuard(cfg, loginguard.NewMemoryStore())
+}
+
+// LoginGuard 返回登录失败限制，用于管理员查看和清除限制
+func LoginGuard() *loginguard.Guard {
+	return guard
+}
+
+func newLoginGuard(cfg config.LoginConfig, s loginguard.Store) *loginguard.Guard {
+	user := loginguard.Policy{
+		BackoffAfter:    cfg.BackoffAfter,
+		LockoutAfter:    cfg.LockoutAfter,
+		BaseDelay:       time.Second,
+		MaxDelay:        5 * time.Minute,
+		LockoutDuration: cfg.LockoutDuration,
+		Window:          time.Hour,
+	}
+	// 同一IP可能有多个用户（如NAT），次数限制更宽松
+	ip := user
+	ip.BackoffAfter = cfg.IPLockoutAfter / 2
+	ip.LockoutAfter = cfg.IPLockoutAfter
+	return loginguard.New(s, user, ip)
+}
+
+// verifyPassword 检查登录失败限制并验证用户名和密码，失败时记录登录尝试并返回错误
+// 账户状态在密码正确后才检查，避免泄露账户是否存在
+func verifyPassword(c *fiber.Ctx, username, password string) (*dbModel.User, *fiber.Error) {
+	attempt, ferr := checkThrottle(c, username)
+	if ferr != nil {
+		return nil, ferr
+	}
+
+	user, err := store.Users.FindByUsername(username)
+	if err != nil {
+		loginFailed(c, attempt, username, nil, dbModel.LoginBadCredentials)
+		return nil, fiber.NewError(fiber.StatusUnauthorized, "用户名或密码错误")
+	}
+	if !utils.CheckPasswordHash(password, user.Password) {
+		loginFailed(c, attempt, username, user, dbModel.LoginBadCredentials)
+		return nil, fiber.NewError(fiber.StatusUnauthorized, "用户名或密码错误")
+	}
+	attempt.Pass()
+
+	if err := checkAccount(user); err != nil {
+		result := dbModel.LoginLocked
+		if user.PendingApproval {
+			result = dbModel.LoginPendingApproval
+		} else if user.Disabled {
+			result = dbModel.LoginDisabled
+		}
+		recordAttempt(c, username, user, result)
+		return nil, fiber.NewError(fiber.StatusForbidden, err.Error())
+	}
+	return user, nil
+}
+
+// checkThrottle 用户名或IP失败次数过多时记录登录尝试并返回错误，否则预先计入一次失败
+// 紧接着验证密码或验证码，验证通过时调用 Attempt.Pass 撤销，失败时调用 loginFailed
+func checkThrottle(c *fiber.Ctx, username string) (*loginguard.Attempt, *fiber.Error) {
+	attempt, blocked := guard.Begin(username, c.IP())
+	if blocked == nil {
+		return attempt, nil
+	}
+	recordAttempt(c, username, nil, dbModel.LoginThrottled)
+	retryAfter := int(time.Until(blocked.BlockedUntil).Seconds()) + 1
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(retryAfter))
+	return nil, fiber.NewError(fiber.StatusTooManyRequests, fmt.Sprintf("登录失败次数过多，请在%d秒后重试", retryAfter))
+}
+
+// loginFailed 记录一次密码或两步验证码错误，用户名达到锁定次数时同时锁定账户，服务重启后锁定仍然有效
+// 失败次数已由 checkThrottle 计入
+func loginFailed(c *fiber.Ctx, attempt *loginguard.Attempt, username string, user *dbModel.User, result string) {
+	entry := attempt.User()
+	recordAttempt(c, username, user, result)
+
+	if user == nil || !entry.Lockout || (user.LockedUntil != nil && !user.LockedUntil.Before(entry.BlockedUntil)) {
+		return
+	}
+	log.Printf("用户 %s 连续登录失败%d次，锁定至 %s（最后来源 %s）", username, entry.Failures,
+		entry.BlockedUntil.Format("2006-01-02 15:04:05"), c.IP())
+	if err := store.Users.Update(user.ID, map[string]interface{}{"locked_until": entry.BlockedUntil}); err != nil {
+		log.Printf("锁定用户 %s 失败: %v", username, err)
+	}
+}
+
+// loginSucceeded 登录成功后清除用户名的失败记录
+func loginSucceeded(c *fiber.Ctx, user *dbModel.User) {
+	guard.Succeed(user.Username)
+	recordAttempt(c, user.Username, user, dbModel.LoginSucceeded)
+}
+
+// recordAttempt 写入登录尝试审计记录，并清理超过保留时间的记录
+func recordAttempt(c *fiber.Ctx, username string, user *dbModel.User, result string) {
+	if len(username) > 64 {
+		username = username[:64]
+	}
+	userAgent := c.Get(fiber.HeaderUserAgent)
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+	attempt := dbModel.LoginAttempt{
+		Username:  username,
+		IP:        c.IP(),
+		UserAgent: userAgent,
+		Success:   result == dbModel.LoginSucceeded,
+		Result:    result,
+	}
+	if user != nil {
+		attempt.UserID = user.ID
+	}
+	if err := store.LoginAttempts.Create(&attempt); err != nil {
+		log.Printf("记录登录尝试失败: %v", err)
+	}
+	if attempt.Success {
+		store.LoginAttempts.DeleteBefore(time.Now().Add(-loginAttemptRetention))
+	}
+}
+
+// loginError 返回登录错误响应
+func loginError(c *fiber.Ctx, ferr *fiber.Error) error {
+	return c.Status(ferr.Code).JSON(LoginResponse{
+		Code:    ferr.Code,
+		Message: ferr.Message,
+	})
+}
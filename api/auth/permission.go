@@ -0,0 +1,295 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 管理权限，角色与权限的对应关系保存在 role_permissions 表中，可由管理员调整
+const (
+	PermStatsRead     = "stats:read"
+	PermMd5Read       = "md5:read"
+	PermMd5Import     = "md5:import"
+	PermMd5Delete     = "md5:delete"
+	PermJobsRead      = "jobs:read"
+	PermJobsManage    = "jobs:manage"
+	PermRainbowRead   = "rainbow:read"
+	PermRainbowWrite  = "rainbow:write"
+	PermRainbowDelete = "rainbow:delete"
+	PermTasksRead     = "tasks:read"
+	PermTasksManage   = "tasks:manage"
+	PermUsersRead     = "users:read"
+	PermUsersManage   = "users:manage"
+	PermRolesRead     = "roles:read"
+	PermRolesManage   = "roles:manage"
+	PermAuditRead     = "audit:read"
+)
+
+// Permission 权限及其说明
+type Permission struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// Permissions 所有管理权限
+var Permissions = []Permission{
+	{PermStatsRead, "查看系统统计信息"},
+	{PermMd5Read, "查看和导出明文库"},
+	{PermMd5Import, "生成和导入明文，查看导入任务"},
+	{PermMd5Delete, "删除明文记录、回滚导入任务和去重"},
+	{PermJobsRead, "查看后台任务"},
+	{PermJobsManage, "取消后台任务"},
+	{PermRainbowRead, "查看彩虹表"},
+	{PermRainbowWrite, "生成、校验和添加彩虹表条目"},
+	{PermRainbowDelete, "删除彩虹表条目"},
+	{PermTasksRead, "查看解密任务"},
+	{PermTasksManage, "取消解密任务"},
+	{PermUsersRead, "查看用户列表、活动概况和邀请码"},
+	{PermUsersManage, "创建用户，修改角色，禁用、锁定用户，重置密码，审核注册和管理邀请码"},
+	{PermRolesRead, "查看角色权限"},
+	{PermRolesManage, "修改角色权限"},
+	{PermAuditRead, "查看和导出审计日志"},
+}
+
+// 内置角色，管理员始终拥有全部权限，其余角色的权限可以调整
+const (
+	RoleOperator = "operator"
+	RoleAuditor  = "auditor"
+)
+
+// BuiltinRoles 内置角色，不能删除
+var BuiltinRoles = []string{RoleAdmin, RoleOperator, RoleAuditor, RoleUser}
+
+// 角色权限缓存的有效期，多实例部署时其他实例修改的权限在该时间内生效
+const permissionCacheTTL = time.Minute
+
+var (
+	// ErrRoleNotFound 角色不存在
+	ErrRoleNotFound = errors.New("角色不存在")
+	// ErrRoleInUse 角色仍有用户使用
+	ErrRoleInUse = errors.New("角色仍在使用中")
+)
+
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,31}$`)
+
+// permissionCache 角色权限缓存，避免每个请求都查询数据库
+var permissionCache struct {
+	sync.RWMutex
+	roles map[string]map[string]bool
+	// 必须开启两步验证的角色
+	twoFactor map[string]bool
+	loadedAt  time.Time
+}
+
+// rolePermissions 返回角色权限映射，缓存过期时重新加载；加载失败时沿用旧缓存
+func rolePermissions() map[string]map[string]bool {
+	permissionCache.RLock()
+	roles, loadedAt := permissionCache.roles, permissionCache.loadedAt
+	permissionCache.RUnlock()
+	if roles != nil && time.Since(loadedAt) < permissionCacheTTL {
+		return roles
+	}
+
+	if err := ReloadPermissions(); err != nil {
+		log.Printf("加载角色权限失败: %v", err)
+		return roles
+	}
+	permissionCache.RLock()
+	defer permissionCache.RUnlock()
+	return permissionCache.roles
+}
+
+// ReloadPermissions 从数据库重新加载角色权限
+func ReloadPermissions() error {
+	rows, err := store.Roles.All()
+	if err != nil {
+		return err
+	}
+	roles := make(map[string]map[string]bool)
+	for _, row := range rows {
+		if roles[row.Role] == nil {
+			roles[row.Role] = make(map[string]bool)
+		}
+		roles[row.Role][row.Permission] = true
+	}
+	settings, err := store.Roles.Settings()
+	if err != nil {
+		return err
+	}
+	twoFactor := make(map[string]bool)
+	for _, setting := range settings {
+		twoFactor[setting.Role] = setting.RequireTwoFactor
+	}
+
+	permissionCache.Lock()
+	permissionCache.roles = roles
+	permissionCache.twoFactor = twoFactor
+	permissionCache.loadedAt = time.Now()
+	permissionCache.Unlock()
+	return nil
+}
+
+// HasPermission 角色是否拥有权限
+func HasPermission(role, permission string) bool {
+	if role == RoleAdmin {
+		return true
+	}
+	return rolePermissions()[role][permission]
+}
+
+// HasAnyPermission 角色是否拥有任意管理权限，用于判断能否进入管理后台
+func HasAnyPermission(role string) bool {
+	if role == RoleAdmin {
+		return true
+	}
+	return len(rolePermissions()[role]) > 0
+}
+
+// CanManageRole 调用者能否授予该角色或管理该角色的用户
+// 管理员角色只能由管理员授予和管理；其他角色的权限必须是调用者权限的子集，
+// 避免通过创建用户、修改角色、重置密码等操作获得自己没有的权限
+func CanManageRole(callerRole, role string) bool {
+	if callerRole == RoleAdmin {
+		return true
+	}
+	if role == RoleAdmin {
+		return false
+	}
+	for perm := range rolePermissions()[role] {
+		if !HasPermission(callerRole, perm) {
+			return false
+		}
+	}
+	return true
+}
+
+// RolePermissionList 返回各角色的权限列表（包括没有任何权限的内置角色），权限按名称排序
+func RolePermissionList() map[string][]string {
+	result := make(map[string][]string)
+	for _, role := range BuiltinRoles {
+		result[role] = []string{}
+	}
+	for role, perms := range rolePermissions() {
+		list := make([]string, 0, len(perms))
+		for perm := range perms {
+			list = append(list, perm)
+		}
+		sort.Strings(list)
+		result[role] = list
+	}
+	all := make([]string, 0, len(Permissions))
+	for _, perm := range Permissions {
+		all = append(all, perm.Name)
+	}
+	result[RoleAdmin] = all
+	return result
+}
+
+// RequiresTwoFactor 角色是否必须开启两步验证
+func RequiresTwoFactor(role string) bool {
+	rolePermissions()
+	permissionCache.RLock()
+	defer permissionCache.RUnlock()
+	return permissionCache.twoFactor[role]
+}
+
+// SetRoleRequireTwoFactor 设置角色是否必须开启两步验证
+// 已登录的会话不受影响，该角色未开启两步验证的用户下次登录时需要先完成设置
+func SetRoleRequireTwoFactor(role string, required bool) error {
+	if !ValidRole(role) {
+		return ErrRoleNotFound
+	}
+	if err := store.Roles.SetRequireTwoFactor(role, required); err != nil {
+		return err
+	}
+	return ReloadPermissions()
+}
+
+// ValidRole 角色是否存在（内置角色或已配置权限的自定义角色）
+func ValidRole(role string) bool {
+	if IsBuiltinRole(role) {
+		return true
+	}
+	_, ok := rolePermissions()[role]
+	return ok
+}
+
+// IsBuiltinRole 是否为内置角色
+func IsBuiltinRole(role string) bool {
+	for _, builtin := range BuiltinRoles {
+		if role == builtin {
+			return true
+		}
+	}
+	return false
+}
+
+// SetRolePermissions 设置角色的权限，角色不存在时创建自定义角色
+func SetRolePermissions(role string, permissions []string) error {
+	if role == RoleAdmin {
+		return fmt.Errorf("管理员角色始终拥有全部权限，不能修改")
+	}
+	if !roleNamePattern.MatchString(role) {
+		return fmt.Errorf("角色名只能包含小写字母、数字、下划线和连字符，以字母开头，不超过32个字符")
+	}
+
+	seen := make(map[string]bool)
+	var list []string
+	for _, perm := range permissions {
+		if !knownPermission(perm) {
+			return fmt.Errorf("无效的权限: %s", perm)
+		}
+		if !seen[perm] {
+			seen[perm] = true
+			list = append(list, perm)
+		}
+	}
+	// 自定义角色至少需要一个权限，否则无法与不存在的角色区分
+	if len(list) == 0 && !IsBuiltinRole(role) {
+		return fmt.Errorf("自定义角色至少需要一个权限")
+	}
+
+	if err := store.Roles.Replace(role, list); err != nil {
+		return err
+	}
+	return ReloadPermissions()
+}
+
+// DeleteRole 删除自定义角色，仍有用户使用该角色时不能删除
+func DeleteRole(role string) error {
+	if IsBuiltinRole(role) {
+		return fmt.Errorf("内置角色不能删除")
+	}
+	if _, ok := rolePermissions()[role]; !ok {
+		return ErrRoleNotFound
+	}
+	count, err := store.Users.CountByRole(role)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("%w: 仍有%d个用户使用该角色", ErrRoleInUse, count)
+	}
+
+	if err := store.Roles.Replace(role, nil); err != nil {
+		return err
+	}
+	if err := store.Roles.SetRequireTwoFactor(role, false); err != nil {
+		return err
+	}
+	return ReloadPermissions()
+}
+
+func knownPermission(name string) bool {
+	for _, perm := range Permissions {
+		if perm.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+// seedPermissions 直接写入角色权限缓存，避免依赖数据库
+func seedPermissions(t *testing.T, roles map[string][]string) {
+	t.Helper()
+	cache := make(map[string]map[string]bool)
+	for role, perms := range roles {
+		cache[role] = make(map[string]bool)
+		for _, perm := range perms {
+			cache[role][perm] = true
+		}
+	}
+	permissionCache.Lock()
+	permissionCache.roles, permissionCache.twoFactor, permissionCache.loadedAt = cache, map[string]bool{}, time.Now()
+	permissionCache.Unlock()
+	t.Cleanup(func() {
+		permissionCache.Lock()
+		permissionCache.roles, permissionCache.twoFactor, permissionCache.loadedAt = nil, nil, time.Time{}
+		permissionCache.Unlock()
+	})
+}
+
+func TestHasPermission(t *testing.T) {
+	seedPermissions(t, map[string][]string{
+		RoleOperator: {PermMd5Read, PermMd5Import},
+	})
+
+	if !HasPermission(RoleAdmin, PermRolesManage) || !HasAnyPermission(RoleAdmin) {
+		t.Fatal("管理员应拥有全部权限")
+	}
+	if !HasPermission(RoleOperator, PermMd5Import) || HasPermission(RoleOperator, PermMd5Delete) {
+		t.Fatal("操作员权限与配置不一致")
+	}
+	if HasPermission(RoleUser, PermMd5Read) || HasAnyPermission(RoleUser) {
+		t.Fatal("普通用户不应拥有管理权限")
+	}
+	if HasPermission("missing", PermMd5Read) || HasAnyPermission("missing") {
+		t.Fatal("不存在的角色不应拥有权限")
+	}
+}
+
+func TestCanManageRole(t *testing.T) {
+	seedPermissions(t, map[string][]string{
+		RoleOperator:   {PermMd5Read, PermMd5Import, PermUsersRead, PermUsersManage},
+		RoleAuditor:    {PermAuditRead},
+		"user_manager": {PermUsersRead, PermUsersManage},
+		"reader":       {PermUsersRead},
+	})
+
+	cases := []struct {
+		caller, role string
+		want         bool
+	}{
+		{RoleAdmin, RoleAdmin, true},
+		{RoleAdmin, RoleOperator, true},
+		{RoleOperator, RoleAdmin, false},
+		{"user_manager", RoleAdmin, false},
+		{"user_manager", RoleOperator, false},
+		{"user_manager", RoleAuditor, false},
+		{"user_manager", "user_manager", true},
+		{"user_manager", "reader", true},
+		{"user_manager", RoleUser, true},
+		{RoleOperator, "user_manager", true},
+		{"reader", "user_manager", false},
+	}
+	for _, tc := range cases {
+		if got := CanManageRole(tc.caller, tc.role); got != tc.want {
+			t.Errorf("CanManageRole(%q, %q) = %v, 期望 %v", tc.caller, tc.role, got, tc.want)
+		}
+	}
+}
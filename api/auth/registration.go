@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+	"zmd5/config"
+	"zmd5/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// bcrypt 只使用密码的前72个字节，超出部分会被忽略
+const maxPasswordBytes = 72
+
+var (
+	// passwordPolicy 密码策略，默认值与 config.Default 一致
+	passwordPolicy = config.Default().Password
+	// registration 注册配置，默认值与 config.Default 一致
+	registration = config.Default().Registration
+)
+
+// SetPasswordConfig 设置密码策略
+func SetPasswordConfig(cfg config.PasswordConfig) {
+	passwordPolicy = cfg
+}
+
+// SetRegistrationConfig 设置注册方式
+func SetRegistrationConfig(cfg config.RegistrationConfig) {
+	registration = cfg
+}
+
+var (
+	// ErrInvalidUsername 用户名不符合要求
+	ErrInvalidUsername = errors.New("用户名不符合要求")
+	// ErrWeakPassword 密码不符合密码策略
+	ErrWeakPassword = errors.New("密码不符合要求")
+)
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{2,31}$`)
+
+// ValidateUsername 检查用户名：3-32个字符，只能包含字母、数字、下划线、点和连字符，以字母或数字开头
+func ValidateUsername(username string) error {
+	if !usernamePattern.MatchString(username) {
+		return fmt.Errorf("%w：只能包含字母、数字、下划线、点和连字符，以字母或数字开头，长度为3-32个字符", ErrInvalidUsername)
+	}
+	return nil
+}
+
+// ValidatePassword 按密码策略检查密码
+// 开启 check_plaintexts 时拒绝明文库中已收录的密码：这些密码的MD5可以被本服务直接解密
+func ValidatePassword(username, password string) error {
+	if utf8.RuneCountInString(password) < passwordPolicy.MinLength {
+		return fmt.Errorf("%w：长度至少为%d个字符", ErrWeakPassword, passwordPolicy.MinLength)
+	}
+	if len(password) > maxPasswordBytes {
+		return fmt.Errorf("%w：长度不能超过%d个字节", ErrWeakPassword, maxPasswordBytes)
+	}
+	if strings.EqualFold(password, username) {
+		return fmt.Errorf("%w：不能与用户名相同", ErrWeakPassword)
+	}
+	if passwordPolicy.CheckPlaintexts {
+		_, err := store.Plaintexts.FindByHash(utils.CalculateMD5(password))
+		if err == nil {
+			return fmt.Errorf("%w：该密码已收录在明文库中，可以被直接破解", ErrWeakPassword)
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("检查密码失败: %v", err)
+		}
+	}
+	return nil
+}
+
+// validateAccount 检查新账户的用户名和密码
+func validateAccount(username, password string) error {
+	if err := ValidateUsername(username); err != nil {
+		return err
+	}
+	return ValidatePassword(username, password)
+}
+
+// RegistrationInfoResponse 注册方式和密码要求，前端据此显示注册表单
+type RegistrationInfoResponse struct {
+	Code int `json:"code"`
+	// 注册方式：open/invite/approval/closed
+	Mode              string `json:"mode"`
+	PasswordMinLength int    `json:"passwordMinLength"`
+}
+
+// RegistrationInfo 返回注册方式和密码要求
+func RegistrationInfo(c *fiber.Ctx) error {
+	return c.JSON(RegistrationInfoResponse{
+		Code:              fiber.StatusOK,
+		Mode:              registration.Mode,
+		PasswordMinLength: passwordPolicy.MinLength,
+	})
+}
+
+// registerError 返回创建用户失败的响应
+func registerError(c *fiber.Ctx, err error) error {
+	status, message := fiber.StatusInternalServerError, "用户创建失败"
+	switch {
+	case errors.Is(err, ErrUserExists):
+		status, message = fiber.StatusConflict, err.Error()
+	case errors.Is(err, ErrInvalidUsername), errors.Is(err, ErrWeakPassword), errors.Is(err, ErrInvalidRole):
+		status, message = fiber.StatusBadRequest, err.Error()
+	}
+	return c.Status(status).JSON(LoginResponse{
+		Code:    status,
+		Message: message,
+	})
+}
@@ -0,0 +1,211 @@
+package auth
+
+import (
+	"errors"
+	"log"
+	"time"
+	"zmd5/db/dbModel"
+	"zmd5/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// 已轮换的刷新令牌在该时间内再次使用时视为并发刷新（如多个标签页同时刷新），只拒绝请求而不撤销会话
+const refreshReuseGrace = 30 * time.Second
+
+var (
+	// ErrSessionRevoked 访问令牌所属的会话已退出登录，或用户已退出所有会话
+	ErrSessionRevoked = errors.New("会话已失效，请重新登录")
+	// ErrInvalidRefreshToken 刷新令牌不存在、已过期或已被使用
+	ErrInvalidRefreshToken = errors.New("无效的刷新令牌或刷新令牌已过期")
+)
+
+// TokenPair 登录或刷新后签发的令牌
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	// 访问令牌有效期（秒）
+	ExpiresIn int64
+}
+
+// VerifyAccessToken 验证访问令牌的签名和有效期，并检查所属会话未被撤销
+// 返回用户的当前信息，角色变更无需等待令牌过期即可生效
+func VerifyAccessToken(token string) (*dbModel.User, error) {
+	claims, err := utils.ParseToken(token)
+	if err != nil {
+		return nil, err
+	}
+	// 引入刷新令牌之前签发的令牌没有会话ID，无法撤销，要求重新登录；预认证令牌也没有会话ID
+	if claims.SessionID == "" || claims.Purpose != "" {
+		return nil, ErrSessionRevoked
+	}
+
+	user, err := store.Users.FindByID(claims.UserID)
+	if err != nil {
+		return nil, ErrSessionRevoked
+	}
+	if user.TokenVersion != claims.TokenVersion {
+		return nil, ErrSessionRevoked
+	}
+	if err := checkAccount(user); err != nil {
+		return nil, err
+	}
+	active, err := store.RefreshTokens.FamilyActive(claims.SessionID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if !active {
+		return nil, ErrSessionRevoked
+	}
+	return user, nil
+}
+
+// issueSession 为登录用户创建新会话，签发访问令牌和刷新令牌
+func issueSession(c *fiber.Ctx, user *dbModel.User) (*TokenPair, error) {
+	familyID, err := utils.GenerateSessionID()
+	if err != nil {
+		return nil, err
+	}
+	return issueTokens(c, user, familyID, nil)
+}
+
+// issueTokens 签发访问令牌和刷新令牌，previous 不为空时轮换该刷新令牌
+func issueTokens(c *fiber.Ctx, user *dbModel.User, familyID string, previous *dbModel.RefreshToken) (*TokenPair, error) {
+	refresh, err := utils.GenerateRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	userAgent := c.Get("User-Agent")
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+	record := dbModel.RefreshToken{
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		TokenHash: utils.HashRefreshToken(refresh),
+		ExpiresAt: now.Add(utils.RefreshTokenExpiration()),
+		UserAgent: userAgent,
+		IP:        c.IP(),
+	}
+	if previous == nil {
+		err = store.RefreshTokens.Create(&record)
+	} else {
+		var rotated bool
+		rotated, err = store.RefreshTokens.Rotate(previous, &record, now)
+		if err == nil && !rotated {
+			// 并发刷新时另一个请求已经轮换了该令牌
+			err = ErrInvalidRefreshToken
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	access, err := utils.GenerateToken(user.ID, user.Username, user.Role, familyID, user.TokenVersion)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenPair{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		ExpiresIn:    int64(utils.TokenExpiration() / time.Second),
+	}, nil
+}
+
+// rotateSession 使用刷新令牌换取新的令牌，旧刷新令牌随即失效
+// 已轮换的刷新令牌被再次使用说明令牌可能已泄露，撤销整个会话
+func rotateSession(c *fiber.Ctx, refresh string) (*TokenPair, *dbModel.User, error) {
+	record, err := store.RefreshTokens.FindByHash(utils.HashRefreshToken(refresh))
+	if err != nil {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+
+	now := time.Now()
+	if record.RevokedAt != nil {
+		if now.Sub(*record.RevokedAt) > refreshReuseGrace {
+			log.Printf("用户 %d 的会话 %s 重复使用了已轮换的刷新令牌，撤销该会话", record.UserID, record.FamilyID)
+			store.RefreshTokens.RevokeFamily(record.FamilyID, now)
+		}
+		return nil, nil, ErrInvalidRefreshToken
+	}
+	if !record.Active(now) {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+
+	user, err := store.Users.FindByID(record.UserID)
+	if err != nil || !user.Active(now) || user.MustResetPassword {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+	pair, err := issueTokens(c, user, record.FamilyID, record)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pair, user, nil
+}
+
+// RefreshRequest 刷新令牌请求结构
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+// Refresh 使用刷新令牌换取新的访问令牌和刷新令牌
+func Refresh(c *fiber.Ctx) error {
+	var request RefreshRequest
+	if err := c.BodyParser(&request); err != nil || request.RefreshToken == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(LoginResponse{
+			Code:    fiber.StatusBadRequest,
+			Message: "未提供刷新令牌",
+		})
+	}
+
+	pair, user, err := rotateSession(c, request.RefreshToken)
+	if errors.Is(err, ErrInvalidRefreshToken) {
+		return c.Status(fiber.StatusUnauthorized).JSON(LoginResponse{
+			Code:    fiber.StatusUnauthorized,
+			Message: err.Error(),
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(LoginResponse{
+			Code:    fiber.StatusInternalServerError,
+			Message: "刷新令牌失败",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(LoginResponse{
+		Code:         fiber.StatusOK,
+		Message:      "刷新成功",
+		Token:        pair.AccessToken,
+		RefreshToken: pair.RefreshToken,
+		ExpiresIn:    pair.ExpiresIn,
+		User:         newUserInfo(user),
+	})
+}
+
+// LogoutAll 退出当前用户的所有会话，已签发的访问令牌和刷新令牌全部失效
+// API密钥不受影响，需要单独撤销
+func LogoutAll(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uint)
+
+	if err := RevokeSessions(userID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(LogoutResponse{
+			Status:  fiber.StatusInternalServerError,
+			Message: "退出所有会话失败",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(LogoutResponse{
+		Status:  fiber.StatusOK,
+		Message: "已退出所有会话",
+	})
+}
+
+// RevokeSessions 使用户的所有会话失效：递增令牌版本并撤销全部刷新令牌
+func RevokeSessions(userID uint) error {
+	if err := store.Users.IncrementTokenVersion(userID); err != nil {
+		return err
+	}
+	return store.RefreshTokens.RevokeUser(userID, time.Now())
+}
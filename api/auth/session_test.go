@@ -0,0 +1,229 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"zmd5/config"
+	"zmd5/db"
+	"zmd5/db/dbModel"
+	"zmd5/repository"
+	"zmd5/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// testTOTPSecret 测试用户的TOTP密钥
+const testTOTPSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// testPassword 测试用户的密码
+const testPassword = "Old-password-2024"
+
+// setupAuthTest 使用临时SQLite数据库作为存储，并重置登录失败限制
+func setupAuthTest(t *testing.T) {
+	t.Helper()
+	conn, err := db.Open(config.DatabaseConfig{Driver: db.DriverSQLite, DSN: filepath.Join(t.TempDir(), "test.db")})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := conn.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	db.PG = conn
+	if _, err := db.Migrate(0); err != nil {
+		t.Fatalf("执行迁移失败: %v", err)
+	}
+	Init(repository.New(conn))
+	if err := ReloadPermissions(); err != nil {
+		t.Fatalf("加载角色权限失败: %v", err)
+	}
+	SetLoginConfig(config.Default().Login)
+}
+
+// createTestUser 创建密码为 testPassword 的用户，totp 为true时开启两步验证并生成恢复码
+func createTestUser(t *testing.T, username, role string, totp bool) (*dbModel.User, []string) {
+	t.Helper()
+	hash, err := utils.EncryptPassword(testPassword)
+	if err != nil {
+		t.Fatalf("加密密码失败: %v", err)
+	}
+	user := &dbModel.User{Username: username, Password: hash, Role: role}
+	if totp {
+		user.TOTPSecret, user.TOTPEnabled = testTOTPSecret, true
+	}
+	if err := db.PG.Create(user).Error; err != nil {
+		t.Fatalf("创建用户失败: %v", err)
+	}
+	if !totp {
+		return user, nil
+	}
+	codes, err := newRecoveryCodes(user.ID)
+	if err != nil {
+		t.Fatalf("生成恢复码失败: %v", err)
+	}
+	return user, codes
+}
+
+// postJSON 调用处理器并解析响应
+func postJSON(t *testing.T, handler fiber.Handler, body interface{}) (int, LoginResponse) {
+	t.Helper()
+	app := fiber.New()
+	app.Post("/", handler)
+	data, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(string(data)))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	var response LoginResponse
+	json.NewDecoder(resp.Body).Decode(&response)
+	return resp.StatusCode, response
+}
+
+// loginTestUser 创建用户并登录，返回登录响应
+func loginTestUser(t *testing.T, username string) LoginResponse {
+	t.Helper()
+	createTestUser(t, username, RoleUser, false)
+	status, response := postJSON(t, Login, LoginRequest{Username: username, Password: testPassword})
+	if status != fiber.StatusOK || response.Token == "" || response.RefreshToken == "" {
+		t.Fatalf("登录失败: 状态码 = %d, %s", status, response.Message)
+	}
+	return response
+}
+
+func refresh(t *testing.T, token string) (int, LoginResponse) {
+	t.Helper()
+	return postJSON(t, Refresh, RefreshRequest{RefreshToken: token})
+}
+
+// ageRevokedToken 将已轮换的刷新令牌的撤销时间提前到宽限期之前
+func ageRevokedToken(t *testing.T, token string) {
+	t.Helper()
+	err := db.PG.Model(&dbModel.RefreshToken{}).Where("token_hash = ?", utils.HashRefreshToken(token)).
+		UpdateColumn("revoked_at", time.Now().Add(-refreshReuseGrace-time.Second)).Error
+	if err != nil {
+		t.Fatalf("更新刷新令牌失败: %v", err)
+	}
+}
+
+func TestRefreshRotation(t *testing.T) {
+	setupAuthTest(t)
+	login := loginTestUser(t, "alice")
+
+	status, rotated := refresh(t, login.RefreshToken)
+	if status != fiber.StatusOK || rotated.RefreshToken == "" || rotated.RefreshToken == login.RefreshToken {
+		t.Fatalf("刷新失败: 状态码 = %d, %s", status, rotated.Message)
+	}
+	if _, err := VerifyAccessToken(rotated.Token); err != nil {
+		t.Fatalf("新的访问令牌无效: %v", err)
+	}
+
+	// 宽限期内重复使用旧令牌（并发刷新）只拒绝请求，不撤销会话
+	if status, _ := refresh(t, login.RefreshToken); status != fiber.StatusUnauthorized {
+		t.Fatalf("重复使用已轮换的令牌: 状态码 = %d", status)
+	}
+	if _, err := VerifyAccessToken(rotated.Token); err != nil {
+		t.Fatalf("宽限期内的重复使用不应撤销会话: %v", err)
+	}
+	if status, _ := refresh(t, rotated.RefreshToken); status != fiber.StatusOK {
+		t.Fatalf("宽限期内的重复使用不应撤销会话: 状态码 = %d", status)
+	}
+
+	if status, _ := refresh(t, "not-a-token"); status != fiber.StatusUnauthorized {
+		t.Fatalf("无效的令牌: 状态码 = %d", status)
+	}
+}
+
+func TestRefreshReuseRevokesSession(t *testing.T) {
+	setupAuthTest(t)
+	login := loginTestUser(t, "alice")
+	other := loginTestUser(t, "bob")
+
+	_, rotated := refresh(t, login.RefreshToken)
+	ageRevokedToken(t, login.RefreshToken)
+
+	// 超过宽限期后重复使用已轮换的令牌，说明令牌可能已泄露，撤销整个会话
+	if status, _ := refresh(t, login.RefreshToken); status != fiber.StatusUnauthorized {
+		t.Fatalf("重复使用已轮换的令牌: 状态码 = %d", status)
+	}
+	if status, _ := refresh(t, rotated.RefreshToken); status != fiber.StatusUnauthorized {
+		t.Fatalf("会话撤销后最新的刷新令牌仍可使用: 状态码 = %d", status)
+	}
+	if _, err := VerifyAccessToken(rotated.Token); err != ErrSessionRevoked {
+		t.Fatalf("会话撤销后访问令牌仍然有效: %v", err)
+	}
+
+	// 其他会话不受影响
+	if _, err := VerifyAccessToken(other.Token); err != nil {
+		t.Fatalf("其他用户的会话被撤销: %v", err)
+	}
+	if status, _ := refresh(t, other.RefreshToken); status != fiber.StatusOK {
+		t.Fatalf("其他用户的会话被撤销: 状态码 = %d", status)
+	}
+}
+
+func TestConcurrentRefresh(t *testing.T) {
+	setupAuthTest(t)
+	login := loginTestUser(t, "alice")
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	succeeded := 0
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if status, _ := refresh(t, login.RefreshToken); status == fiber.StatusOK {
+				mu.Lock()
+				succeeded++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if succeeded != 1 {
+		t.Fatalf("同一刷新令牌有 %d 个并发请求刷新成功, 期望 1 个", succeeded)
+	}
+}
+
+func TestRevokeSessions(t *testing.T) {
+	setupAuthTest(t)
+	login := loginTestUser(t, "alice")
+	var user dbModel.User
+	db.PG.Where("username = ?", "alice").First(&user)
+
+	if err := RevokeSessions(user.ID); err != nil {
+		t.Fatalf("退出所有会话失败: %v", err)
+	}
+	if _, err := VerifyAccessToken(login.Token); err != ErrSessionRevoked {
+		t.Fatalf("退出所有会话后访问令牌仍然有效: %v", err)
+	}
+	if status, _ := refresh(t, login.RefreshToken); status != fiber.StatusUnauthorized {
+		t.Fatalf("退出所有会话后刷新令牌仍可使用: 状态码 = %d", status)
+	}
+}
+
+func TestRefreshRejectsExpiredAndResetAccounts(t *testing.T) {
+	setupAuthTest(t)
+	login := loginTestUser(t, "alice")
+	db.PG.Model(&dbModel.RefreshToken{}).Where("token_hash = ?", utils.HashRefreshToken(login.RefreshToken)).
+		UpdateColumn("expires_at", time.Now().Add(-time.Second))
+	if status, _ := refresh(t, login.RefreshToken); status != fiber.StatusUnauthorized {
+		t.Fatalf("过期的刷新令牌: 状态码 = %d", status)
+	}
+
+	// 管理员重置密码后需要先修改密码
+	login = loginTestUser(t, "bob")
+	db.PG.Model(&dbModel.User{}).Where("username = ?", "bob").UpdateColumn("must_reset_password", true)
+	if status, _ := refresh(t, login.RefreshToken); status != fiber.StatusUnauthorized {
+		t.Fatalf("需要修改密码的账户: 状态码 = %d", status)
+	}
+}
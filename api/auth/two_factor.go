@@ -0,0 +1,493 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"zmd5/db/dbModel"
+	"zmd5/loginguard"
+	"zmd5/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// 预认证令牌有效期，需要在该时间内完成两步验证
+	preAuthExpiration = 5 * time.Minute
+	// 每次生成的恢复码数量
+	recoveryCodeCount = 10
+	// 验证器应用中显示的服务名称
+	totpIssuer = "ZMd5"
+)
+
+// TwoFactorRequest 两步验证请求
+type TwoFactorRequest struct {
+	// 登录返回的预认证令牌，已登录时可以不提供而使用认证头中的访问令牌
+	PreAuthToken string `json:"preAuthToken"`
+	// 验证器应用中的6位验证码，或一次性恢复码
+	Code string `json:"code"`
+	// 关闭两步验证时需要确认密码
+	Password string `json:"password"`
+}
+
+// TwoFactorResponse 两步验证设置响应，通过预认证令牌完成设置时同时包含登录令牌
+type TwoFactorResponse struct {
+	LoginResponse
+	// TOTP密钥（Base32），无法扫码时手动输入
+	Secret string `json:"secret,omitempty"`
+	// 验证器应用扫码使用的 otpauth:// 地址
+	URI string `json:"uri,omitempty"`
+	// 一次性恢复码，只在生成时返回
+	RecoveryCodes []string `json:"recoveryCodes,omitempty"`
+}
+
+// bearerToken 提取认证头中的令牌，兼容不带 Bearer 前缀的情况
+func bearerToken(c *fiber.Ctx) string {
+	header := c.Get(fiber.HeaderAuthorization)
+	if len(header) > 7 && header[:7] == "Bearer " {
+		return header[7:]
+	}
+	return header
+}
+
+// twoFactorChallenge 密码验证通过但需要两步验证时，返回预认证令牌
+func twoFactorChallenge(c *fiber.Ctx, user *dbModel.User) error {
+	token, err := utils.GeneratePreAuthToken(user.ID, user.Username, user.TokenVersion, preAuthExpiration)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(LoginResponse{
+			Code:    fiber.StatusInternalServerError,
+			Message: "生成token失败",
+		})
+	}
+	recordAttempt(c, user.Username, user, dbModel.LoginTwoFactor)
+
+	response := LoginResponse{
+		Code:         fiber.StatusOK,
+		PreAuthToken: token,
+	}
+	if user.TOTPEnabled {
+		response.Message = "请输入两步验证码"
+		response.TwoFactorRequired = true
+	} else {
+		response.Message = "账户所属角色要求开启两步验证，请先完成设置"
+		response.TwoFactorSetupRequired = true
+	}
+	return c.Status(fiber.StatusOK).JSON(response)
+}
+
+// preAuthUser 验证预认证令牌并返回用户，修改密码或退出所有会话后预认证令牌同样失效
+func preAuthUser(token string) (*dbModel.User, *fiber.Error) {
+	claims, err := utils.ParsePreAuthToken(token)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusUnauthorized, "无效的预认证令牌或预认证令牌已过期，请重新登录")
+	}
+	user, err := store.Users.FindByID(claims.UserID)
+	if err != nil || user.TokenVersion != claims.TokenVersion {
+		return nil, fiber.NewError(fiber.StatusUnauthorized, "无效的预认证令牌或预认证令牌已过期，请重新登录")
+	}
+	if err := checkAccount(user); err != nil {
+		return nil, fiber.NewError(fiber.StatusForbidden, err.Error())
+	}
+	return user, nil
+}
+
+// twoFactorUser 返回设置两步验证的用户：提供预认证令牌时使用预认证令牌，否则使用认证头中的访问令牌
+func twoFactorUser(c *fiber.Ctx, preAuthToken string) (*dbModel.User, bool, *fiber.Error) {
+	if preAuthToken != "" {
+		user, ferr := preAuthUser(preAuthToken)
+		return user, true, ferr
+	}
+	user, err := VerifyAccessToken(bearerToken(c))
+	if err != nil {
+		return nil, false, fiber.NewError(fiber.StatusUnauthorized, "请先登录")
+	}
+	return user, false, nil
+}
+
+// verifySecondFactor 校验验证码或恢复码，返回是否通过以及是否使用了恢复码
+func verifySecondFactor(user *dbModel.User, code string) (bool, bool, error) {
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return false, false, nil
+	}
+	now := time.Now()
+	if len(code) == utils.TOTPDigits {
+		step, ok := utils.VerifyTOTP(user.TOTPSecret, code, now)
+		if !ok {
+			return false, false, nil
+		}
+		// 同一验证码只能使用一次
+		used, err := store.Users.UseTOTPStep(user.ID, step)
+		return used, false, err
+	}
+	// 恢复码使用bcrypt摘要，无法按摘要查找，逐个比对未使用的恢复码
+	codes, err := store.RecoveryCodes.Unused(user.ID)
+	if err != nil {
+		return false, false, err
+	}
+	for _, recovery := range codes {
+		if utils.CheckRecoveryCode(code, recovery.CodeHash) {
+			used, err := store.RecoveryCodes.MarkUsed(recovery.ID, now)
+			return used, used, err
+		}
+	}
+	return false, false, nil
+}
+
+// passwordChangeSecondFactor 修改密码前确认第二因素，返回本次请求是否完成了两步验证
+// 已开启两步验证时需要验证码或恢复码；请求带有该用户的有效会话时也视为已验证，
+// 需要两步验证的用户只有完成验证后才能获得会话
+func passwordChangeSecondFactor(c *fiber.Ctx, user *dbModel.User, code string) (bool, *fiber.Error) {
+	if !user.TOTPEnabled && !RequiresTwoFactor(user.Role) {
+		return false, nil
+	}
+	if session, err := VerifyAccessToken(bearerToken(c)); err == nil && session.ID == user.ID {
+		return true, nil
+	}
+	if !user.TOTPEnabled {
+		return false, fiber.NewError(fiber.StatusForbidden, "账户所属角色要求开启两步验证，请先登录完成设置后再修改密码")
+	}
+	if strings.TrimSpace(code) == "" {
+		return false, fiber.NewError(fiber.StatusUnauthorized, "已开启两步验证，请提供验证码或恢复码")
+	}
+
+	attempt, ferr := checkThrottle(c, user.Username)
+	if ferr != nil {
+		return false, ferr
+	}
+	ok, _, err := verifySecondFactor(user, code)
+	if err != nil {
+		attempt.Pass()
+		return false, fiber.NewError(fiber.StatusInternalServerError, "验证失败")
+	}
+	if !ok {
+		loginFailed(c, attempt, user.Username, user, dbModel.LoginBadTwoFactor)
+		return false, fiber.NewError(fiber.StatusUnauthorized, "验证码错误或已使用")
+	}
+	attempt.Pass()
+	return true, nil
+}
+
+// newRecoveryCodes 生成并保存新的恢复码，之前的恢复码全部失效
+func newRecoveryCodes(userID uint) ([]string, error) {
+	codes, err := utils.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		if hashes[i], err = utils.HashRecoveryCode(code); err != nil {
+			return nil, err
+		}
+	}
+	if err := store.RecoveryCodes.Replace(userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// VerifyTwoFactor 使用预认证令牌和验证码（或恢复码）完成登录
+// 验证码错误与密码错误一样计入登录失败次数
+func VerifyTwoFactor(c *fiber.Ctx) error {
+	var request TwoFactorRequest
+	if err := c.BodyParser(&request); err != nil || request.PreAuthToken == "" || request.Code == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(LoginResponse{
+			Code:    fiber.StatusBadRequest,
+			Message: "预认证令牌和验证码不能为空",
+		})
+	}
+
+	user, ferr := preAuthUser(request.PreAuthToken)
+	if ferr != nil {
+		return loginError(c, ferr)
+	}
+	if !user.TOTPEnabled {
+		return c.Status(fiber.StatusBadRequest).JSON(LoginResponse{
+			Code:    fiber.StatusBadRequest,
+			Message: "尚未开启两步验证，请先完成设置",
+		})
+	}
+	attempt, ferr := checkThrottle(c, user.Username)
+	if ferr != nil {
+		return loginError(c, ferr)
+	}
+
+	ok, recovery, err := verifySecondFactor(user, request.Code)
+	if err != nil {
+		attempt.Pass()
+		return c.Status(fiber.StatusInternalServerError).JSON(LoginResponse{
+			Code:    fiber.StatusInternalServerError,
+			Message: "验证失败",
+		})
+	}
+	if !ok {
+		loginFailed(c, attempt, user.Username, user, dbModel.LoginBadTwoFactor)
+		return c.Status(fiber.StatusUnauthorized).JSON(LoginResponse{
+			Code:    fiber.StatusUnauthorized,
+			Message: "验证码错误或已使用",
+		})
+	}
+	attempt.Pass()
+
+	response, err := loginSession(c, user)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(LoginResponse{
+			Code:    fiber.StatusInternalServerError,
+			Message: "生成token失败",
+		})
+	}
+	response.Code = fiber.StatusOK
+	response.Message = "登录成功"
+	if recovery {
+		remaining, _ := store.RecoveryCodes.CountUnused(user.ID)
+		response.Message = fmt.Sprintf("登录成功，已使用一个恢复码，剩余%d个", remaining)
+	}
+	return c.Status(fiber.StatusOK).JSON(response)
+}
+
+// SetupTwoFactor 生成新的TOTP密钥，需要调用 EnableTwoFactor 验证后才会开启
+func SetupTwoFactor(c *fiber.Ctx) error {
+	var request TwoFactorRequest
+	c.BodyParser(&request)
+
+	user, _, ferr := twoFactorUser(c, request.PreAuthToken)
+	if ferr != nil {
+		return loginError(c, ferr)
+	}
+	if user.TOTPEnabled {
+		return c.Status(fiber.StatusConflict).JSON(LoginResponse{
+			Code:    fiber.StatusConflict,
+			Message: "已开启两步验证，如需更换设备请先关闭两步验证",
+		})
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(LoginResponse{
+			Code:    fiber.StatusInternalServerError,
+			Message: "生成两步验证密钥失败",
+		})
+	}
+	if err := store.Users.Update(user.ID, map[string]interface{}{"totp_secret": secret}); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(LoginResponse{
+			Code:    fiber.StatusInternalServerError,
+			Message: "保存两步验证密钥失败",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(TwoFactorResponse{
+		LoginResponse: LoginResponse{
+			Code:    fiber.StatusOK,
+			Message: "请使用验证器应用扫描二维码，并输入验证码完成设置",
+		},
+		Secret: secret,
+		URI:    utils.TOTPURI(totpIssuer, user.Username, secret),
+	})
+}
+
+// EnableTwoFactor 验证验证码后开启两步验证并生成恢复码
+// 使用预认证令牌（角色要求两步验证的首次登录）时同时完成登录
+func EnableTwoFactor(c *fiber.Ctx) error {
+	var request TwoFactorRequest
+	if err := c.BodyParser(&request); err != nil || request.Code == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(LoginResponse{
+			Code:    fiber.StatusBadRequest,
+			Message: "验证码不能为空",
+		})
+	}
+
+	user, viaPreAuth, ferr := twoFactorUser(c, request.PreAuthToken)
+	if ferr != nil {
+		return loginError(c, ferr)
+	}
+	if user.TOTPEnabled {
+		return c.Status(fiber.StatusConflict).JSON(LoginResponse{
+			Code:    fiber.StatusConflict,
+			Message: "已开启两步验证",
+		})
+	}
+	if user.TOTPSecret == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(LoginResponse{
+			Code:    fiber.StatusBadRequest,
+			Message: "请先获取两步验证密钥",
+		})
+	}
+
+	// 使用预认证令牌时验证码错误计入登录失败次数
+	var attempt *loginguard.Attempt
+	if viaPreAuth {
+		if attempt, ferr = checkThrottle(c, user.Username); ferr != nil {
+			return loginError(c, ferr)
+		}
+	}
+	step, ok := utils.VerifyTOTP(user.TOTPSecret, request.Code, time.Now())
+	if !ok {
+		if attempt != nil {
+			loginFailed(c, attempt, user.Username, user, dbModel.LoginBadTwoFactor)
+		}
+		return c.Status(fiber.StatusUnauthorized).JSON(LoginResponse{
+			Code:    fiber.StatusUnauthorized,
+			Message: "验证码错误，请检查设备时间是否准确",
+		})
+	}
+	if attempt != nil {
+		attempt.Pass()
+	}
+
+	err := store.Users.Update(user.ID, map[string]interface{}{"totp_enabled": true, "totp_last_step": step})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(LoginResponse{
+			Code:    fiber.StatusInternalServerError,
+			Message: "开启两步验证失败",
+		})
+	}
+	user.TOTPEnabled = true
+	codes, err := newRecoveryCodes(user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(LoginResponse{
+			Code:    fiber.StatusInternalServerError,
+			Message: "生成恢复码失败",
+		})
+	}
+
+	response := TwoFactorResponse{RecoveryCodes: codes}
+	if viaPreAuth && user.MustResetPassword {
+		// 管理员重置密码后需要先修改密码，使用验证码修改密码后才能登录
+		response.Code = fiber.StatusOK
+		response.Message = "已开启两步验证，请妥善保存恢复码，并使用验证码修改密码"
+		response.PasswordResetRequired = true
+		return c.Status(fiber.StatusOK).JSON(response)
+	}
+	if viaPreAuth {
+		session, err := loginSession(c, user)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(LoginResponse{
+				Code:    fiber.StatusInternalServerError,
+				Message: "生成token失败",
+			})
+		}
+		response.LoginResponse = *session
+	}
+	response.Code = fiber.StatusOK
+	response.Message = "已开启两步验证，请妥善保存恢复码，每个恢复码只能使用一次"
+	return c.Status(fiber.StatusOK).JSON(response)
+}
+
+// DisableTwoFactor 关闭当前用户的两步验证，需要确认密码和验证码，角色要求两步验证时不能关闭
+func DisableTwoFactor(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uint)
+
+	var request TwoFactorRequest
+	if err := c.BodyParser(&request); err != nil || request.Password == "" || request.Code == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(LoginResponse{
+			Code:    fiber.StatusBadRequest,
+			Message: "密码和验证码不能为空",
+		})
+	}
+
+	user, err := store.Users.FindByID(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(LoginResponse{
+			Code:    fiber.StatusInternalServerError,
+			Message: "获取用户失败",
+		})
+	}
+	if !user.TOTPEnabled {
+		return c.Status(fiber.StatusBadRequest).JSON(LoginResponse{
+			Code:    fiber.StatusBadRequest,
+			Message: "尚未开启两步验证",
+		})
+	}
+	if RequiresTwoFactor(user.Role) {
+		return c.Status(fiber.StatusForbidden).JSON(LoginResponse{
+			Code:    fiber.StatusForbidden,
+			Message: "账户所属角色要求开启两步验证，不能关闭",
+		})
+	}
+	if !utils.CheckPasswordHash(request.Password, user.Password) {
+		return c.Status(fiber.StatusUnauthorized).JSON(LoginResponse{
+			Code:    fiber.StatusUnauthorized,
+			Message: "密码错误",
+		})
+	}
+	ok, _, err := verifySecondFactor(user, request.Code)
+	if err != nil || !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(LoginResponse{
+			Code:    fiber.StatusUnauthorized,
+			Message: "验证码错误或已使用",
+		})
+	}
+
+	if err := ResetTwoFactor(user.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(LoginResponse{
+			Code:    fiber.StatusInternalServerError,
+			Message: "关闭两步验证失败",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(LoginResponse{
+		Code:    fiber.StatusOK,
+		Message: "已关闭两步验证",
+	})
+}
+
+// RegenerateRecoveryCodes 重新生成当前用户的恢复码，之前的恢复码全部失效
+func RegenerateRecoveryCodes(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uint)
+
+	var request TwoFactorRequest
+	if err := c.BodyParser(&request); err != nil || request.Code == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(LoginResponse{
+			Code:    fiber.StatusBadRequest,
+			Message: "验证码不能为空",
+		})
+	}
+
+	user, err := store.Users.FindByID(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(LoginResponse{
+			Code:    fiber.StatusInternalServerError,
+			Message: "获取用户失败",
+		})
+	}
+	if !user.TOTPEnabled {
+		return c.Status(fiber.StatusBadRequest).JSON(LoginResponse{
+			Code:    fiber.StatusBadRequest,
+			Message: "尚未开启两步验证",
+		})
+	}
+	ok, _, err := verifySecondFactor(user, request.Code)
+	if err != nil || !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(LoginResponse{
+			Code:    fiber.StatusUnauthorized,
+			Message: "验证码错误或已使用",
+		})
+	}
+
+	codes, err := newRecoveryCodes(user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(LoginResponse{
+			Code:    fiber.StatusInternalServerError,
+			Message: "生成恢复码失败",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(TwoFactorResponse{
+		LoginResponse: LoginResponse{
+			Code:    fiber.StatusOK,
+			Message: "已重新生成恢复码，之前的恢复码已失效",
+		},
+		RecoveryCodes: codes,
+	})
+}
+
+// ResetTwoFactor 关闭用户的两步验证并删除恢复码，用于用户关闭或管理员为丢失设备的用户重置
+func ResetTwoFactor(userID uint) error {
+	err := store.Users.Update(userID, map[string]interface{}{
+		"totp_enabled":   false,
+		"totp_secret":    "",
+		"totp_last_step": 0,
+	})
+	if err != nil {
+		return err
+	}
+	return store.RecoveryCodes.DeleteByUser(userID)
+}
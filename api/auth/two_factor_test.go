@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"zmd5/db"
+	"zmd5/db/dbModel"
+	"zmd5/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func currentTOTP(t *testing.T) string {
+	t.Helper()
+	code, err := utils.TOTPCode(testTOTPSecret, utils.TOTPStep(time.Now()))
+	if err != nil {
+		t.Fatalf("计算验证码失败: %v", err)
+	}
+	return code
+}
+
+func TestVerifySecondFactorReplay(t *testing.T) {
+	setupAuthTest(t)
+	user, codes := createTestUser(t, "alice", RoleUser, true)
+
+	code := currentTOTP(t)
+	if ok, recovery, err := verifySecondFactor(user, code); err != nil || !ok || recovery {
+		t.Fatalf("首次使用验证码: ok=%v recovery=%v err=%v", ok, recovery, err)
+	}
+	if ok, _, _ := verifySecondFactor(user, code); ok {
+		t.Fatal("同一验证码不能重复使用")
+	}
+	// 已使用时间步之前的验证码同样被拒绝
+	previous, _ := utils.TOTPCode(testTOTPSecret, utils.TOTPStep(time.Now())-1)
+	if ok, _, _ := verifySecondFactor(user, previous); ok {
+		t.Fatal("早于已使用时间步的验证码不能使用")
+	}
+
+	if ok, recovery, err := verifySecondFactor(user, strings.ToUpper(codes[3])); err != nil || !ok || !recovery {
+		t.Fatalf("使用恢复码: ok=%v recovery=%v err=%v", ok, recovery, err)
+	}
+	if ok, _, _ := verifySecondFactor(user, codes[3]); ok {
+		t.Fatal("同一恢复码不能重复使用")
+	}
+	if remaining, _ := store.RecoveryCodes.CountUnused(user.ID); remaining != int64(len(codes)-1) {
+		t.Fatalf("剩余恢复码 %d 个, 期望 %d 个", remaining, len(codes)-1)
+	}
+	if ok, _, _ := verifySecondFactor(user, "aaaaa-aaaaa"); ok {
+		t.Fatal("无效的恢复码不应通过")
+	}
+}
+
+func changePassword(t *testing.T, body ChangePasswordRequest, token string) (int, LoginResponse) {
+	t.Helper()
+	app := fiber.New()
+	app.Post("/password", ChangePassword)
+	data, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPost, "/password", strings.NewReader(string(data)))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+	}
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	var response LoginResponse
+	json.NewDecoder(resp.Body).Decode(&response)
+	return resp.StatusCode, response
+}
+
+func TestChangePasswordRequiresSecondFactor(t *testing.T) {
+	setupAuthTest(t)
+	_, codes := createTestUser(t, "alice", RoleUser, true)
+	request := ChangePasswordRequest{Username: "alice", Password: testPassword, NewPassword: "New-password-2024"}
+
+	if status, _ := changePassword(t, request, ""); status != fiber.StatusUnauthorized {
+		t.Fatalf("未提供验证码: 状态码 = %d", status)
+	}
+	request.Code = "000000"
+	if status, _ := changePassword(t, request, ""); status != fiber.StatusUnauthorized {
+		t.Fatalf("验证码错误: 状态码 = %d", status)
+	}
+	request.Code = codes[0]
+	status, response := changePassword(t, request, "")
+	if status != fiber.StatusOK || response.Token == "" {
+		t.Fatalf("使用恢复码修改密码: 状态码 = %d, %s", status, response.Message)
+	}
+
+	// 已完成两步验证的会话可以代替验证码
+	request = ChangePasswordRequest{Username: "alice", Password: "New-password-2024", NewPassword: "Third-password-2024"}
+	if status, _ := changePassword(t, request, response.Token); status != fiber.StatusOK {
+		t.Fatalf("使用会话修改密码: 状态码 = %d", status)
+	}
+}
+
+func TestChangePasswordRoleRequiresTwoFactor(t *testing.T) {
+	setupAuthTest(t)
+	if err := SetRoleRequireTwoFactor(RoleOperator, true); err != nil {
+		t.Fatalf("设置两步验证要求失败: %v", err)
+	}
+	createTestUser(t, "bob", RoleOperator, false)
+	createTestUser(t, "carol", RoleUser, false)
+
+	request := ChangePasswordRequest{Username: "bob", Password: testPassword, NewPassword: "New-password-2024"}
+	if status, _ := changePassword(t, request, ""); status != fiber.StatusForbidden {
+		t.Fatalf("角色要求两步验证但尚未设置: 状态码 = %d", status)
+	}
+	var bob dbModel.User
+	db.PG.Where("username = ?", "bob").First(&bob)
+	if !utils.CheckPasswordHash(testPassword, bob.Password) {
+		t.Fatal("未完成两步验证时密码被修改")
+	}
+
+	// 不需要两步验证的用户不受影响
+	request.Username = "carol"
+	if status, response := changePassword(t, request, ""); status != fiber.StatusOK || response.Token == "" {
+		t.Fatalf("修改普通用户密码: 状态码 = %d", status)
+	}
+}
@@ -5,18 +5,34 @@ import (
 	"encoding/hex"
 	"fmt"
 	"strings"
-	"zmd5/db"
+	"time"
 	"zmd5/db/dbModel"
+	"zmd5/metrics"
+	"zmd5/repository"
+	"zmd5/utils"
 
 	"github.com/gofiber/fiber/v2"
 )
 
+// store 处理器使用的存储，由 Init 注入
+var store *repository.Store
+
+// Init 注入处理器使用的存储
+func Init(s *repository.Store) {
+	store = s
+}
+
 type MD5Request struct {
 	Text string `json:"text"`
+	// 计算哈希时使用的明文编码列表（utf8/gbk/utf16le），为空时默认为utf8
+	Encodings []string `json:"encodings"`
+	// 隐私模式：加密的明文不写入明文库，历史记录只保存哈希；用户在设置中开启隐私模式时始终生效
+	Private bool `json:"private"`
 }
 
 type MD5HashData struct {
 	Original    string `json:"original,omitempty"`
+	Encoding    string `json:"encoding,omitempty"`    // 明文编码
 	Hash32      string `json:"hash32,omitempty"`      // 32位小写
 	Hash32Upper string `json:"hash32Upper,omitempty"` // 32位大写
 	Hash16      string `json:"hash16,omitempty"`      // 16位小写
@@ -27,9 +43,41 @@ type MD5HashData struct {
 }
 
 type MD5Response struct {
-	Success bool         `json:"success"`
-	Message string       `json:"message,omitempty"`
-	Data    *MD5HashData `json:"data,omitempty"`
+	Success  bool           `json:"success"`
+	Message  string         `json:"message,omitempty"`
+	Data     *MD5HashData   `json:"data,omitempty"`
+	Variants []*MD5HashData `json:"variants,omitempty"` // 各编码下的哈希结果
+	Private  bool           `json:"private,omitempty"`  // 本次请求使用了隐私模式
+}
+
+// privateMode 请求是否使用隐私模式：请求中指定了隐私模式，或登录用户在设置中开启了隐私模式
+// 用户的设置由认证中间件在验证令牌时读取
+func privateMode(c *fiber.Ctx, requested bool) bool {
+	enabled, _ := c.Locals("privateMode").(bool)
+	return requested || enabled
+}
+
+// newHashData 根据明文、编码和编码后的字节计算所有格式的哈希值
+func newHashData(original string, encoding string, data []byte) *MD5HashData {
+	hash := md5.Sum(data)
+	hashString := hex.EncodeToString(hash[:])
+	hashStringUpper := strings.ToUpper(hashString)
+
+	// 生成128位二进制字符串
+	var hash128 strings.Builder
+	for _, b := range hash {
+		hash128.WriteString(fmt.Sprintf("%08b", b))
+	}
+
+	return &MD5HashData{
+		Original:    original,
+		Encoding:    encoding,
+		Hash32:      hashString,
+		Hash32Upper: hashStringUpper,
+		Hash16:      hashString[8:24],
+		Hash16Upper: hashStringUpper[8:24],
+		Hash128:     hash128.String(),
+	}
 }
 
 // Encrypt 处理MD5加密请求
@@ -49,43 +97,51 @@ func Encrypt(c *fiber.Ctx) error {
 		})
 	}
 
-	// 计算MD5哈希
-	hash := md5.Sum([]byte(req.Text))
-	hashString := hex.EncodeToString(hash[:])
-	hashStringUpper := strings.ToUpper(hashString)
+	encodings, err := utils.NormalizeEncodings(req.Encodings)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": err.Error(),
+		})
+	}
 
-	// 生成128位二进制字符串
-	var hash128 strings.Builder
-	for _, b := range hash {
-		hash128.WriteString(strings.Replace(strings.Replace(
-			fmt.Sprintf("%08b", b), " ", "0", -1), "\n", "", -1))
+	// 按每种编码计算MD5哈希，无法用该编码表示的明文跳过
+	var variants []*MD5HashData
+	for _, encoding := range encodings {
+		data, err := utils.EncodeText(req.Text, encoding)
+		if err != nil {
+			continue
+		}
+		variants = append(variants, newHashData(req.Text, encoding, data))
+	}
+
+	if len(variants) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "明文无法使用指定的编码表示",
+		})
+	}
+
+	// 检查用户是否登录，未登录时来源用户ID为0
+	userID := c.Locals("user_id")
+	var submitterID uint
+	if userID != nil {
+		submitterID = userID.(uint)
 	}
+	private := privateMode(c, req.Private)
 
 	response := MD5Response{
 		Success: true,
-		Data: &MD5HashData{
-			Original:    req.Text,
-			Hash32:      hashString,
-			Hash32Upper: hashStringUpper,
-			Hash16:      hashString[8:24],
-			Hash16Upper: hashStringUpper[8:24],
-			Hash128:     hash128.String(),
-		},
-	}
-
-	// 查询是否已存在相同的MD5值
-	var existingMd5 dbModel.Md5
-	result := db.PG.Where("md5 = ? OR md5_16 = ?", response.Data.Hash32, response.Data.Hash16).First(&existingMd5)
-
-	// 如果记录不存在,则创建新记录
-	if result.Error != nil {
-		var md5 = dbModel.Md5{
-			Plaintext: req.Text,
-			MD5:       response.Data.Hash32,
-			MD5_16:    response.Data.Hash16,
-		}
+		Data:    variants[0],
+		Private: private,
+	}
+	if len(variants) > 1 {
+		response.Variants = variants
+	}
 
-		if err := db.PG.Create(&md5).Error; err != nil {
+	// 隐私模式下只计算哈希，不写入明文库
+	if !private {
+		if err := savePlaintexts(req.Text, variants, submitterID); err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"success": false,
 				"message": "保存记录失败",
@@ -93,28 +149,75 @@ func Encrypt(c *fiber.Ctx) error {
 		}
 	}
 
-	// 保存操作记录到数据库
-	// 检查用户是否登录
-	userID := c.Locals("user_id")
+	// 保存操作记录到数据库，每种编码的哈希各保存一条，隐私模式下只保存哈希
 	if userID != nil {
-		record := dbModel.MD5Record{
-			PlainText: req.Text,
-			UserID:    userID.(uint),        // 直接使用 uint 类型
-			Hash:      response.Data.Hash32, // 使用32位小写作为标准存储格式
-			Type:      1,                    // 加密
+		plaintext := req.Text
+		if private {
+			plaintext = ""
 		}
+		for _, variant := range variants {
+			record := dbModel.MD5Record{
+				PlainText: plaintext,
+				UserID:    userID.(uint),  // 直接使用 uint 类型
+				Hash:      variant.Hash32, // 使用32位小写作为标准存储格式
+				Type:      1,              // 加密
+			}
 
-		if err := db.PG.Create(&record).Error; err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"success": false,
-				"message": "保存记录失败",
-			})
+			if err := store.Records.Create(&record); err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"success": false,
+					"message": "保存记录失败",
+				})
+			}
 		}
 	}
 
 	return c.JSON(response)
 }
 
+// savePlaintexts 将用户加密的明文按各编码的哈希写入明文库
+// ASCII明文在多种编码下的哈希相同，只写入一次
+func savePlaintexts(text string, variants []*MD5HashData, submitterID uint) error {
+	seen := make(map[string]bool, len(variants))
+	for _, variant := range variants {
+		if seen[variant.Hash32] {
+			continue
+		}
+		seen[variant.Hash32] = true
+
+		var md5 = dbModel.Md5{
+			Plaintext: text,
+			MD5:       variant.Hash32,
+			MD5_16:    variant.Hash16,
+			Encoding:  variant.Encoding,
+			Provenance: dbModel.Provenance{
+				Source: dbModel.SourceUserEncrypt,
+				UserID: submitterID,
+			},
+		}
+
+		// 已存在相同的MD5值时跳过插入，由唯一索引保证并发安全
+		inserted, err := store.Plaintexts.Insert([]dbModel.Md5{md5}, 1)
+		if err != nil {
+			return err
+		}
+		if inserted > 0 {
+			continue
+		}
+		// 已存在的记录被其他来源再次提交时标记为多来源，同一用户（或匿名用户）重复加密不计入
+		existing, err := store.Plaintexts.FindByHash(md5.MD5)
+		if err != nil {
+			return err
+		}
+		if existing.Source != md5.Source || existing.UserID != submitterID {
+			if err := store.Plaintexts.MarkReproduced([]string{md5.MD5}, 0); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 // Decrypt 处理MD5解密请求
 func Decrypt(c *fiber.Ctx) error {
 	var req MD5Request
@@ -134,16 +237,15 @@ func Decrypt(c *fiber.Ctx) error {
 
 	// 检查输入的哈希值长度
 	inputHash := strings.ToLower(req.Text)
-	var md5Record dbModel.Md5
+	var md5Record *dbModel.Md5
 	var err error
 
 	switch len(inputHash) {
-	case 32:
-		// 32位MD5
-		err = db.PG.Where("LOWER(md5) = ?", inputHash).First(&md5Record).Error
-	case 16:
-		// 16位MD5
-		err = db.PG.Where("LOWER(md5_16) = ?", inputHash).First(&md5Record).Error
+	case 32, 16:
+		// 32位MD5按完整摘要查询，16位MD5按摘要中间8字节查询
+		start := time.Now()
+		md5Record, err = store.Plaintexts.FindByHash(inputHash)
+		metrics.LookupDuration.ObserveSince(start)
 	default:
 		return c.JSON(MD5Response{
 			Success: false,
@@ -155,6 +257,7 @@ func Decrypt(c *fiber.Ctx) error {
 	}
 
 	if err != nil {
+		metrics.LookupMisses.Inc()
 		return c.JSON(MD5Response{
 			Success: false,
 			Message: "未找到对应的原文",
@@ -164,29 +267,42 @@ func Decrypt(c *fiber.Ctx) error {
 		})
 	}
 
-	// 计算所有格式的哈希值
-	hash := md5.Sum([]byte(md5Record.Plaintext))
-	hashString := hex.EncodeToString(hash[:])
-	hashStringUpper := strings.ToUpper(hashString)
+	metrics.LookupHits.Inc()
 
-	var hash128 strings.Builder
-	for _, b := range hash {
-		hash128.WriteString(strings.Replace(strings.Replace(
-			fmt.Sprintf("%08b", b), " ", "0", -1), "\n", "", -1))
+	userID := c.Locals("user_id")
+	private := privateMode(c, req.Private)
+
+	// 记录命中次数，失败不影响返回结果；隐私模式下不记录
+	if !private {
+		store.Plaintexts.RecordHit(md5Record.ID)
 	}
 
-	// 保存解密记录
-	userID := c.Locals("user_id")
+	// 按记录的编码计算所有格式的哈希值
+	encoding := md5Record.Encoding
+	if encoding == "" {
+		encoding = utils.EncodingUTF8
+	}
+	data, err := utils.EncodeText(md5Record.Plaintext, encoding)
+	if err != nil {
+		data = []byte(md5Record.Plaintext)
+	}
+	hashData := newHashData(md5Record.Plaintext, encoding, data)
+
+	// 保存解密记录，隐私模式下只保存哈希
 	if userID != nil {
+		plaintext := md5Record.Plaintext
+		if private {
+			plaintext = ""
+		}
 		record := dbModel.MD5Record{
-			PlainText: md5Record.Plaintext,
+			PlainText: plaintext,
 			UserID:    userID.(uint), // 直接使用 uint 类型
 			Hash:      inputHash,
 			Status:    2,
 			Type:      2, // 解密
 		}
 
-		if err := db.PG.Create(&record).Error; err != nil {
+		if err := store.Records.Create(&record); err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"success": false,
 				"message": "保存记录失败",
@@ -196,13 +312,7 @@ func Decrypt(c *fiber.Ctx) error {
 
 	return c.JSON(MD5Response{
 		Success: true,
-		Data: &MD5HashData{
-			Original:    md5Record.Plaintext,
-			Hash32:      hashString,
-			Hash32Upper: hashStringUpper,
-			Hash16:      hashString[8:24],
-			Hash16Upper: hashStringUpper[8:24],
-			Hash128:     hash128.String(),
-		},
+		Data:    hashData,
+		Private: private,
 	})
 }
@@ -0,0 +1,102 @@
+package md5
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"zmd5/config"
+	"zmd5/db"
+	"zmd5/db/dbModel"
+	"zmd5/repository"
+	"zmd5/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// setupMd5Test 使用临时SQLite数据库，返回以 X-Test-User 头指定登录用户ID的测试应用（为空时匿名）
+func setupMd5Test(t *testing.T) *fiber.App {
+	t.Helper()
+	conn, err := db.Open(config.DatabaseConfig{Driver: db.DriverSQLite, DSN: filepath.Join(t.TempDir(), "test.db")})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := conn.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	db.PG = conn
+	if _, err := db.Migrate(0); err != nil {
+		t.Fatalf("执行迁移失败: %v", err)
+	}
+	Init(repository.New(conn))
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		if id, err := strconv.Atoi(c.Get("X-Test-User")); err == nil {
+			c.Locals("user_id", uint(id))
+		}
+		return c.Next()
+	})
+	app.Post("/encrypt", Encrypt)
+	return app
+}
+
+func encrypt(t *testing.T, app *fiber.App, user, body string) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/encrypt", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Test-User", user)
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("加密失败: 状态码 = %d", resp.StatusCode)
+	}
+}
+
+func sourceCount(t *testing.T, plaintext string) int {
+	t.Helper()
+	var record dbModel.Md5
+	if err := db.PG.Where("digest = ?", db.HashesToDigests([]string{utils.CalculateMD5(plaintext)})[0]).First(&record).Error; err != nil {
+		t.Fatalf("查询明文失败: %v", err)
+	}
+	return record.SourceCount
+}
+
+func TestEncryptSourceCount(t *testing.T) {
+	app := setupMd5Test(t)
+
+	// ASCII明文在utf8和gbk下的哈希相同，只写入一条记录且不计为多来源
+	encrypt(t, app, "1", `{"text":"password","encodings":["utf8","gbk"]}`)
+	var count int64
+	db.PG.Model(&dbModel.Md5{}).Count(&count)
+	if count != 1 {
+		t.Fatalf("明文库记录数 = %d, 期望 1", count)
+	}
+	if got := sourceCount(t, "password"); got != 1 {
+		t.Fatalf("一次加密后来源次数 = %d, 期望 1", got)
+	}
+
+	// 同一用户重复加密不计入
+	encrypt(t, app, "1", `{"text":"password"}`)
+	if got := sourceCount(t, "password"); got != 1 {
+		t.Fatalf("同一用户重复加密后来源次数 = %d, 期望 1", got)
+	}
+	// 其他用户加密计入
+	encrypt(t, app, "2", `{"text":"password"}`)
+	if got := sourceCount(t, "password"); got != 2 {
+		t.Fatalf("其他用户加密后来源次数 = %d, 期望 2", got)
+	}
+
+	// 匿名用户重复加密不计入
+	encrypt(t, app, "", `{"text":"anonymous"}`)
+	encrypt(t, app, "", `{"text":"anonymous"}`)
+	if got := sourceCount(t, "anonymous"); got != 1 {
+		t.Fatalf("匿名用户重复加密后来源次数 = %d, 期望 1", got)
+	}
+}
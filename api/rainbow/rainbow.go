@@ -7,14 +7,23 @@ import (
 	"strings"
 	"sync"
 	"time"
-	"zmd5/db"
 	"zmd5/db/dbModel"
+	"zmd5/jobs"
+	"zmd5/metrics"
+	"zmd5/repository"
 	"zmd5/utils"
 
 	"github.com/gofiber/fiber/v2"
-	"gorm.io/gorm"
 )
 
+// store 处理器使用的存储，由 Init 注入
+var store *repository.Store
+
+// Init 注入处理器使用的存储
+func Init(s *repository.Store) {
+	store = s
+}
+
 // RainbowTableRequest 创建彩虹表请求
 type RainbowTableRequest struct {
 	Count           int    `json:"count"`             // 生成链的数量
@@ -44,6 +53,7 @@ type RainbowTableSearchResponse struct {
 	Success   bool   `json:"success"`
 	Message   string `json:"message,omitempty"`
 	Plaintext string `json:"plaintext,omitempty"` // 找到的明文
+	Encoding  string `json:"encoding,omitempty"`  // 命中明文的编码
 	TaskID    uint   `json:"task_id,omitempty"`   // 任务ID，用于查询进度
 }
 
@@ -69,6 +79,10 @@ type TaskProgress struct {
 	TotalTables       int    `json:"total_tables"`       // 总彩虹表数量
 	ChainsSearched    int    `json:"chains_searched"`    // 已搜索的链数量
 	ReductionAttempts int    `json:"reduction_attempts"` // 规约函数应用次数
+	// 服务关闭时保存的检查点，重启后从该链的该位置继续搜索
+	ChainID       uint   `json:"-"` // 正在遍历的彩虹链ID，为0时从头搜索
+	ChainPosition int    `json:"-"` // 链中下一个要尝试的位置
+	CurrentHash   string `json:"-"` // 该位置对应的哈希
 }
 
 // 使用map存储任务进度，以任务ID为键
@@ -121,8 +135,7 @@ func syncTaskProgressToDB(progress *TaskProgress, forceUpdate bool) {
 		// 如果任务还在进行中且进度变化不大（小于阈值），不更新数据库
 		if progress.Status == dbModel.DecryptInProgress {
 			// 获取当前数据库中的进度
-			var record dbModel.MD5Record
-			if err := db.PG.Select("progress").Where("id = ?", progress.TaskID).First(&record).Error; err == nil {
+			if record, err := store.Records.FindByID(progress.TaskID); err == nil {
 				// 如果进度变化小于阈值，不更新
 				if abs(progress.Progress-record.Progress) < significantProgressThreshold {
 					return
@@ -135,44 +148,66 @@ func syncTaskProgressToDB(progress *TaskProgress, forceUpdate bool) {
 	lastDBUpdateMap[progress.TaskID] = time.Now()
 
 	// 更新MD5Record表中的基本信息
-	updates := dbModel.MD5Record{
-		Progress:      progress.Progress,
-		DecryptStatus: progress.Status,
+	updates := map[string]interface{}{
+		"progress":       progress.Progress,
+		"decrypt_status": progress.Status,
 	}
 
 	// 如果有明文结果，也更新
 	if progress.PlainText != "" {
-		updates.PlainText = progress.PlainText
+		updates["plain_text"] = progress.PlainText
 	}
 
 	// 更新数据库
-	db.PG.Model(&dbModel.MD5Record{}).Where("id = ?", progress.TaskID).Updates(updates)
+	store.Records.Update(progress.TaskID, updates)
 
 	// 只有任务结束或重要进度变更时才更新详细信息表
 	if forceUpdate || progress.Status != dbModel.DecryptInProgress || progress.Progress == 100 {
-		// 存储详细的任务进度信息到任务进度表
-		var taskProgressRecord dbModel.TaskProgressRecord
-		result := db.PG.Where("task_id = ?", progress.TaskID).First(&taskProgressRecord)
-
-		if result.Error != nil {
-			// 不存在记录，创建新记录
-			taskProgressRecord = dbModel.TaskProgressRecord{
-				TaskID:            progress.TaskID,
-				TablesSearched:    progress.TablesSearched,
-				TotalTables:       progress.TotalTables,
-				ChainsSearched:    progress.ChainsSearched,
-				ReductionAttempts: progress.ReductionAttempts,
-			}
-			db.PG.Create(&taskProgressRecord)
-		} else {
-			// 更新现有记录
-			db.PG.Model(&taskProgressRecord).Updates(dbModel.TaskProgressRecord{
-				TablesSearched:    progress.TablesSearched,
-				TotalTables:       progress.TotalTables,
-				ChainsSearched:    progress.ChainsSearched,
-				ReductionAttempts: progress.ReductionAttempts,
-			})
-		}
+		// 存储详细的任务进度信息到任务进度表，不存在时创建
+		store.Tasks.SaveProgress(&dbModel.TaskProgressRecord{
+			TaskID:            progress.TaskID,
+			TablesSearched:    progress.TablesSearched,
+			TotalTables:       progress.TotalTables,
+			ChainsSearched:    progress.ChainsSearched,
+			ReductionAttempts: progress.ReductionAttempts,
+			ChainID:           progress.ChainID,
+			ChainPosition:     progress.ChainPosition,
+			CurrentHash:       progress.CurrentHash,
+		})
+	}
+}
+
+// checkpointTask 服务关闭时记录解密任务的检查点并立即写入数据库
+func checkpointTask(taskID uint, chainID uint, position int, hash string) {
+	taskProgressMutex.Lock()
+	defer taskProgressMutex.Unlock()
+
+	if progress, exists := taskProgressMap[taskID]; exists {
+		progress.ChainID = chainID
+		progress.ChainPosition = position
+		progress.CurrentHash = hash
+		syncTaskProgressToDB(progress, true)
+	}
+}
+
+// taskCheckpoint 返回任务上次保存的检查点，没有检查点时chainID为0
+func taskCheckpoint(taskID uint) (chainID uint, position int, hash string) {
+	taskProgressMutex.RLock()
+	defer taskProgressMutex.RUnlock()
+
+	if progress, exists := taskProgressMap[taskID]; exists && progress.CurrentHash != "" {
+		return progress.ChainID, progress.ChainPosition, progress.CurrentHash
+	}
+	return 0, 0, ""
+}
+
+// FlushTaskProgress 将内存中所有未完成任务的进度写入数据库，服务关闭时调用
+func FlushTaskProgress() {
+	taskProgressMutex.Lock()
+	defer taskProgressMutex.Unlock()
+
+	for _, progress := range taskProgressMap {
+		syncTaskProgressToDB(progress, true)
 	}
 }
 
@@ -254,10 +289,12 @@ func removeTaskProgress(taskID uint) {
 
 // InitTaskProgress 从数据库加载未完成的任务
 func InitTaskProgress() {
-	var unfinishedTasks []dbModel.MD5Record
-
 	// 查询所有未完成的解密任务（状态为进行中）
-	db.PG.Where("decrypt_status = ?", dbModel.DecryptInProgress).Find(&unfinishedTasks)
+	unfinishedTasks, err := store.Records.FindInProgress()
+	if err != nil {
+		log.Printf("加载未完成的解密任务失败: %v", err)
+		return
+	}
 
 	for _, task := range unfinishedTasks {
 		// 为每个未完成任务创建内存中的进度记录
@@ -271,79 +308,91 @@ func InitTaskProgress() {
 		}
 
 		// 尝试加载详细进度信息
-		var detailProgress dbModel.TaskProgressRecord
-		if db.PG.Where("task_id = ?", task.ID).First(&detailProgress).Error == nil {
+		if detailProgress, err := store.Tasks.FindProgress(task.ID); err == nil {
 			taskProgress.TablesSearched = detailProgress.TablesSearched
 			taskProgress.TotalTables = detailProgress.TotalTables
 			taskProgress.ChainsSearched = detailProgress.ChainsSearched
 			taskProgress.ReductionAttempts = detailProgress.ReductionAttempts
+			taskProgress.ChainID = detailProgress.ChainID
+			taskProgress.ChainPosition = detailProgress.ChainPosition
+			taskProgress.CurrentHash = detailProgress.CurrentHash
 		}
 
 		// 存入内存
 		taskProgressMap[task.ID] = taskProgress
 
-		// 恢复任务处理
-		go func(hashToDecrypt string, recID uint) {
-			plaintext := searchWithRainbowTable(hashToDecrypt, recID)
-
-			// 如果找到了明文，更新记录
-			if plaintext != "" && recID > 0 {
-				// 更新解密记录
-				db.PG.Model(&dbModel.MD5Record{}).Where("id = ?", recID).Updates(dbModel.MD5Record{
-					PlainText:     plaintext,
-					Status:        1, // 成功
-					DecryptStatus: dbModel.DecryptSuccess,
-				})
+		// 恢复任务处理，有检查点时从检查点继续
+		hash, id, userID := task.Hash, task.ID, task.UserID
+		jobs.Go(func() { runDecryptTask(hash, id, userID) })
+	}
 
-				// 更新内存中的任务进度
-				updateTaskProgress(recID, func(progress *TaskProgress) {
-					progress.Progress = 100
-					progress.Status = dbModel.DecryptSuccess
-					progress.PlainText = plaintext
-				})
+	log.Printf("已从数据库恢复%d个未完成的解密任务", len(unfinishedTasks))
+}
 
-				// 任务完成后删除任务进度记录
-				removeTaskProgress(recID)
+// runDecryptTask 执行彩虹表解密任务并将结果写回解密记录
+// 找到明文时同时保存到MD5库中，来源标记为彩虹表破解
+// 服务关闭时任务保持进行中状态，检查点已保存，下次启动时由 InitTaskProgress 继续
+func runDecryptTask(hashToDecrypt string, recID uint, userID uint) {
+	metrics.RainbowDecryptTasks.Inc()
+	defer metrics.RainbowDecryptTasks.Dec()
+
+	plaintext, interrupted := searchWithRainbowTable(hashToDecrypt, recID)
+	if interrupted {
+		return
+	}
+
+	// 如果找到了明文，更新记录
+	if plaintext != "" && recID > 0 {
+		// 更新解密记录
+		store.Records.Update(recID, map[string]interface{}{
+			"plain_text":     plaintext,
+			"status":         1, // 成功
+			"decrypt_status": dbModel.DecryptSuccess,
+		})
 
-				// 同时保存到MD5库中供后续使用
-				var md5 = dbModel.Md5{
-					Plaintext: plaintext,
-					MD5:       hashToDecrypt,
-				}
-				db.PG.Create(&md5)
-			} else if recID > 0 {
-				// 更新为解密失败
-				db.PG.Model(&dbModel.MD5Record{}).Where("id = ?", recID).Updates(dbModel.MD5Record{
-					Status:        2, // 失败
-					DecryptStatus: dbModel.DecryptFailed,
-				})
+		// 更新内存中的任务进度
+		updateTaskProgress(recID, func(progress *TaskProgress) {
+			progress.Progress = 100
+			progress.Status = dbModel.DecryptSuccess
+			progress.PlainText = plaintext
+		})
 
-				// 更新内存中的任务进度
-				updateTaskProgress(recID, func(progress *TaskProgress) {
-					progress.Progress = 100
-					progress.Status = dbModel.DecryptFailed
-				})
+		// 任务完成后删除任务进度记录
+		removeTaskProgress(recID)
+
+		// 同时保存到MD5库中供后续使用
+		hash := utils.CalculateMD5(plaintext)
+		var md5 = dbModel.Md5{
+			Plaintext: plaintext,
+			MD5:       hash,
+			MD5_16:    hash[8:24],
+			Encoding:  utils.EncodingUTF8, // 彩虹表链基于UTF-8明文生成
+			Provenance: dbModel.Provenance{
+				Source: dbModel.SourceRainbow,
+				UserID: userID,
+			},
+		}
+		store.Plaintexts.Insert([]dbModel.Md5{md5}, 1)
+	} else if recID > 0 {
+		// 更新为解密失败
+		store.Records.Update(recID, map[string]interface{}{
+			"status":         2, // 失败
+			"decrypt_status": dbModel.DecryptFailed,
+		})
 
-				// 任务完成后删除任务进度记录
-				removeTaskProgress(recID)
-			}
-		}(task.Hash, task.ID)
-	}
+		// 更新内存中的任务进度
+		updateTaskProgress(recID, func(progress *TaskProgress) {
+			progress.Progress = 100
+			progress.Status = dbModel.DecryptFailed
+		})
 
-	log.Printf("已从数据库恢复%d个未完成的解密任务", len(unfinishedTasks))
+		// 任务完成后删除任务进度记录
+		removeTaskProgress(recID)
+	}
 }
 
 // Generate 生成彩虹表
 func Generate(c *fiber.Ctx) error {
-	// 检查用户是否为管理员
-	userRole := c.Locals("role")
-	if userRole == nil || userRole.(string) != "admin" {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-			"success": false,
-			"message": "只有管理员可以生成彩虹表",
-		})
-	}
-
 	var req RainbowTableRequest
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -352,6 +401,21 @@ func Generate(c *fiber.Ctx) error {
 		})
 	}
 
+	successCount := GenerateChains(req)
+
+	// 查询总数
+	totalCount, _ := store.RainbowChains.Count()
+
+	return c.JSON(RainbowTableResponse{
+		Success:    true,
+		Message:    "彩虹表生成完成",
+		Generated:  successCount,
+		TotalCount: totalCount,
+	})
+}
+
+// GenerateChains 按请求参数生成彩虹链并保存，返回成功生成的链数量
+func GenerateChains(req RainbowTableRequest) int {
 	// 验证请求参数
 	if req.Count <= 0 {
 		req.Count = 10 // 默认生成10条链
@@ -398,22 +462,80 @@ func Generate(c *fiber.Ctx) error {
 			CharsetRange:      req.CharsetRange,
 		}
 
-		if err := db.PG.Create(&rainbowTable).Error; err != nil {
+		if err := store.RainbowChains.Create(&rainbowTable); err != nil {
 			continue
 		}
 
 		successCount++
 	}
 
-	// 查询总数
-	var totalCount int64
-	db.PG.Model(&dbModel.RainbowTable{}).Count(&totalCount)
+	return successCount
+}
 
-	return c.JSON(RainbowTableResponse{
-		Success:    true,
-		Message:    "彩虹表生成完成",
-		Generated:  successCount,
-		TotalCount: totalCount,
+// VerifyResult 彩虹链校验结果
+type VerifyResult struct {
+	Checked    int    `json:"checked"`     // 校验的链数量
+	Valid      int    `json:"valid"`       // 终止哈希正确的链数量
+	InvalidIDs []uint `json:"invalid_ids"` // 终止哈希与重新计算结果不一致的链ID
+}
+
+// VerifyChains 按保存的参数重新计算彩虹链，检查终止哈希是否一致
+// limit 大于0时只校验最新的 limit 条链
+func VerifyChains(limit int) (*VerifyResult, error) {
+	var chains []dbModel.RainbowTable
+	var err error
+	if limit > 0 {
+		chains, _, err = store.RainbowChains.List(0, limit)
+	} else {
+		chains, err = store.RainbowChains.All()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := &VerifyResult{InvalidIDs: []uint{}}
+	for _, chain := range chains {
+		charset := utils.GetCharset(chain.CharsetType, chain.CharsetRange)
+		result.Checked++
+		if utils.VerifyChain(chain.StartPlaintext, chain.EndHash, chain.ChainLength, chain.ReductionFunction,
+			chain.MinLength, chain.MaxLength, charset) {
+			result.Valid++
+		} else {
+			result.InvalidIDs = append(result.InvalidIDs, chain.ID)
+		}
+	}
+	return result, nil
+}
+
+// VerifyRequest 彩虹链校验请求
+type VerifyRequest struct {
+	Limit int `json:"limit"` // 只校验最新的若干条链，0表示校验全部
+}
+
+// Verify 校验彩虹链的终止哈希
+func Verify(c *fiber.Ctx) error {
+	var req VerifyRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": "无效的请求数据",
+			})
+		}
+	}
+
+	result, err := VerifyChains(req.Limit)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "读取彩虹表失败",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "彩虹表校验完成",
+		"data":    result,
 	})
 }
 
@@ -437,15 +559,12 @@ func Search(c *fiber.Ctx) error {
 	// 检查用户身份，记录解密任务
 	userID := c.Locals("userID")
 	var recordID uint = 0
+	var submitterID uint = 0
 
 	if userID != nil {
 		// 检查用户是否有正在运行的任务
-		var runningTaskCount int64
-		if err := db.PG.Model(&dbModel.MD5Record{}).
-			Where("user_id = ? AND decrypt_status = ? AND type = 2",
-				userID.(uint),
-				dbModel.DecryptInProgress).
-			Count(&runningTaskCount).Error; err != nil {
+		runningTaskCount, err := store.Records.CountInProgress(userID.(uint))
+		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"success": false,
 				"message": "检查任务状态失败",
@@ -470,7 +589,7 @@ func Search(c *fiber.Ctx) error {
 			Progress:      0,                         // 初始进度为0
 		}
 
-		if err := db.PG.Create(&record).Error; err != nil {
+		if err := store.Records.Create(&record); err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"success": false,
 				"message": "创建解密记录失败",
@@ -478,6 +597,7 @@ func Search(c *fiber.Ctx) error {
 		}
 
 		recordID = record.ID
+		submitterID = userID.(uint)
 
 		// 创建内存中的任务进度记录
 		taskProgress := &TaskProgress{
@@ -496,7 +616,6 @@ func Search(c *fiber.Ctx) error {
 	}
 
 	// 先快速检查数据库中是否已存在该哈希值的明文
-	var existingMd5 dbModel.Md5
 	var found bool = false
 
 	// 判断哈希值长度并使用相应的查询条件
@@ -508,23 +627,16 @@ func Search(c *fiber.Ctx) error {
 		})
 	}
 
-	var result *gorm.DB
-	lowerHash := strings.ToLower(req.MD5Hash)
-	if hashLen == 32 {
-		result = db.PG.Where("LOWER(md5) = ?", lowerHash).First(&existingMd5)
-	} else {
-		result = db.PG.Where("LOWER(md5_16) = ?", lowerHash).First(&existingMd5)
-	}
-
-	if result.Error == nil {
+	if existingMd5, err := store.Plaintexts.FindByHash(req.MD5Hash); err == nil {
 		// 找到了现有的记录
 		found = true
+		store.Plaintexts.RecordHit(existingMd5.ID)
 		if recordID > 0 {
 			// 更新用户操作记录
-			db.PG.Model(&dbModel.MD5Record{}).Where("id = ?", recordID).Updates(dbModel.MD5Record{
-				PlainText:     existingMd5.Plaintext,
-				Status:        1, // 成功
-				DecryptStatus: dbModel.DecryptSuccess,
+			store.Records.Update(recordID, map[string]interface{}{
+				"plain_text":     existingMd5.Plaintext,
+				"status":         1, // 成功
+				"decrypt_status": dbModel.DecryptSuccess,
 			})
 
 			// 更新内存中的任务进度
@@ -542,58 +654,14 @@ func Search(c *fiber.Ctx) error {
 			Success:   true,
 			Message:   "找到匹配的明文",
 			Plaintext: existingMd5.Plaintext,
+			Encoding:  existingMd5.Encoding,
 		})
 	}
 
 	// 如果快速查询没有找到结果，则启动异步处理
 	if !found {
 		// 启动异步处理，避免长时间阻塞请求
-		go func(hashToDecrypt string, recID uint) {
-			// 使用彩虹表查找
-			plaintext := searchWithRainbowTable(hashToDecrypt, recID)
-
-			// 如果找到了明文，更新记录
-			if plaintext != "" && recID > 0 {
-				// 更新解密记录
-				db.PG.Model(&dbModel.MD5Record{}).Where("id = ?", recID).Updates(dbModel.MD5Record{
-					PlainText:     plaintext,
-					Status:        1, // 成功
-					DecryptStatus: dbModel.DecryptSuccess,
-				})
-
-				// 更新内存中的任务进度
-				updateTaskProgress(recID, func(progress *TaskProgress) {
-					progress.Progress = 100
-					progress.Status = dbModel.DecryptSuccess
-					progress.PlainText = plaintext
-				})
-
-				// 任务完成后删除任务进度记录
-				removeTaskProgress(recID)
-
-				// 同时保存到MD5库中供后续使用
-				var md5 = dbModel.Md5{
-					Plaintext: plaintext,
-					MD5:       hashToDecrypt,
-				}
-				db.PG.Create(&md5)
-			} else if recID > 0 {
-				// 更新为解密失败
-				db.PG.Model(&dbModel.MD5Record{}).Where("id = ?", recID).Updates(dbModel.MD5Record{
-					Status:        2, // 失败
-					DecryptStatus: dbModel.DecryptFailed,
-				})
-
-				// 更新内存中的任务进度
-				updateTaskProgress(recID, func(progress *TaskProgress) {
-					progress.Progress = 100
-					progress.Status = dbModel.DecryptFailed
-				})
-
-				// 任务完成后删除任务进度记录
-				removeTaskProgress(recID)
-			}
-		}(req.MD5Hash, recordID)
+		jobs.Go(func() { runDecryptTask(req.MD5Hash, recordID, submitterID) })
 
 		// 立即返回响应，让用户知道解密任务已经启动
 		return c.JSON(RainbowTableSearchResponse{
@@ -612,9 +680,18 @@ func Search(c *fiber.Ctx) error {
 }
 
 // searchWithRainbowTable 使用彩虹表搜索哈希值对应的明文
-func searchWithRainbowTable(hashToSearch string, recordID uint) string {
-	// 如果recordID有效，更新任务进度为10%
+// 服务关闭时保存检查点并返回true，任务有检查点时跳过直接匹配和已遍历的链
+func searchWithRainbowTable(hashToSearch string, recordID uint) (string, bool) {
+	var resumeChainID uint
+	var resumePosition int
+	var resumeHash string
 	if recordID > 0 {
+		resumeChainID, resumePosition, resumeHash = taskCheckpoint(recordID)
+	}
+	resuming := resumeChainID > 0
+
+	// 如果recordID有效，更新任务进度为10%
+	if recordID > 0 && !resuming {
 		// 原数据库更新
 		// db.PG.Model(&dbModel.MD5Record{}).Where("id = ?", recordID).Update("progress", 10)
 
@@ -626,22 +703,26 @@ func searchWithRainbowTable(hashToSearch string, recordID uint) string {
 
 	// 检查任务是否已被取消
 	if recordID > 0 && isTaskCancelled(recordID) {
-		return ""
+		return "", false
 	}
 
-	// 首先在数据库中查找哈希值匹配的终端哈希
+	// 首先在数据库中查找哈希值匹配的终端哈希，从检查点继续时已完成这一步
 	var tables []dbModel.RainbowTable
-	if err := db.PG.Where("end_hash = ?", hashToSearch).Find(&tables).Error; err != nil {
-		return ""
+	var err error
+	if !resuming {
+		tables, err = store.RainbowChains.FindByEndHash(hashToSearch)
+		if err != nil {
+			return "", false
+		}
 	}
 
 	// 检查任务是否已被取消
 	if recordID > 0 && isTaskCancelled(recordID) {
-		return ""
+		return "", false
 	}
 
 	// 如果recordID有效，更新任务进度为20%
-	if recordID > 0 {
+	if recordID > 0 && !resuming {
 		// 原数据库更新
 		// db.PG.Model(&dbModel.MD5Record{}).Where("id = ?", recordID).Update("progress", 20)
 
@@ -656,7 +737,7 @@ func searchWithRainbowTable(hashToSearch string, recordID uint) string {
 	for tableIndex, table := range tables {
 		// 检查任务是否已被取消
 		if recordID > 0 && isTaskCancelled(recordID) {
-			return ""
+			return "", false
 		}
 
 		// 更新查找的表数量
@@ -686,7 +767,7 @@ func searchWithRainbowTable(hashToSearch string, recordID uint) string {
 				// 任务完成后删除任务进度记录
 				removeTaskProgress(recordID)
 			}
-			return plaintext
+			return plaintext, false
 		}
 
 		// 更新已搜索的链数
@@ -699,22 +780,22 @@ func searchWithRainbowTable(hashToSearch string, recordID uint) string {
 
 	// 检查任务是否已被取消
 	if recordID > 0 && isTaskCancelled(recordID) {
-		return ""
+		return "", false
 	}
 
 	// 如果没有找到直接匹配，遍历所有彩虹表
-	var allTables []dbModel.RainbowTable
-	if err := db.PG.Find(&allTables).Error; err != nil {
-		return ""
+	allTables, err := store.RainbowChains.All()
+	if err != nil {
+		return "", false
 	}
 
 	// 检查任务是否已被取消
 	if recordID > 0 && isTaskCancelled(recordID) {
-		return ""
+		return "", false
 	}
 
 	// 更新总表数和进度为30%
-	if recordID > 0 {
+	if recordID > 0 && !resuming {
 		// 原数据库更新
 		// db.PG.Model(&dbModel.MD5Record{}).Where("id = ?", recordID).Update("progress", 30)
 
@@ -737,9 +818,14 @@ func searchWithRainbowTable(hashToSearch string, recordID uint) string {
 
 	// 对每个表进行查找
 	for tableIndex, table := range allTables {
+		// 跳过检查点之前已遍历的链
+		if table.ID < resumeChainID {
+			continue
+		}
+
 		// 检查任务是否已被取消
 		if recordID > 0 && isTaskCancelled(recordID) {
-			return ""
+			return "", false
 		}
 
 		// 更新进度（从30%到90%）和已搜索表数
@@ -761,18 +847,31 @@ func searchWithRainbowTable(hashToSearch string, recordID uint) string {
 
 		charset := utils.GetCharset(table.CharsetType, table.CharsetRange)
 
-		// 从目标哈希开始，尝试重建链
+		// 从目标哈希开始，尝试重建链；从检查点继续时从保存的位置和哈希开始
 		currentHash := hashToSearch
+		position := 0
+		if table.ID == resumeChainID {
+			currentHash, position = resumeHash, resumePosition
+		}
 		var potentialPlaintext string
 
 		// 尝试每个可能的位置
-		for i := 0; i < table.ChainLength-1; i++ {
+		for i := position; i < table.ChainLength-1; i++ {
 			// 检查任务是否已被取消
 			if recordID > 0 && isTaskCancelled(recordID) {
-				return ""
+				return "", false
+			}
+
+			// 服务关闭时保存当前位置，重启后从这里继续
+			if jobs.ShuttingDown() {
+				if recordID > 0 {
+					checkpointTask(recordID, table.ID, i, currentHash)
+				}
+				return "", true
 			}
 
 			// 更新规约函数尝试次数
+			metrics.ReductionSteps.Inc()
 			if recordID > 0 {
 				updateTaskProgress(recordID, func(progress *TaskProgress) {
 					progress.ReductionAttempts++
@@ -809,7 +908,7 @@ func searchWithRainbowTable(hashToSearch string, recordID uint) string {
 						// 任务完成后删除任务进度记录
 						removeTaskProgress(recordID)
 					}
-					return potentialPlaintext
+					return potentialPlaintext, false
 				}
 
 				// 继续搜索链中其他可能的位置
@@ -817,10 +916,11 @@ func searchWithRainbowTable(hashToSearch string, recordID uint) string {
 				for j := i; j < table.ChainLength-1; j++ {
 					// 检查任务是否已被取消
 					if recordID > 0 && isTaskCancelled(recordID) {
-						return ""
+						return "", false
 					}
 
 					// 更新规约函数尝试次数
+					metrics.ReductionSteps.Inc()
 					if recordID > 0 {
 						updateTaskProgress(recordID, func(progress *TaskProgress) {
 							progress.ReductionAttempts++
@@ -845,7 +945,7 @@ func searchWithRainbowTable(hashToSearch string, recordID uint) string {
 							// 任务完成后删除任务进度记录
 							removeTaskProgress(recordID)
 						}
-						return currentPlaintext
+						return currentPlaintext, false
 					}
 					// 继续链的下一步
 					currentPlaintext = utils.ReductionFunction(currentHash, j, table.ReductionFunction,
@@ -867,7 +967,7 @@ func searchWithRainbowTable(hashToSearch string, recordID uint) string {
 
 	// 检查任务是否已被取消
 	if recordID > 0 && isTaskCancelled(recordID) {
-		return ""
+		return "", false
 	}
 
 	// 如果recordID有效，更新任务进度为100%（即使失败也是完成了）
@@ -884,19 +984,14 @@ func searchWithRainbowTable(hashToSearch string, recordID uint) string {
 		// 任务完成后删除任务进度记录
 		removeTaskProgress(recordID)
 	}
-	return ""
+	return "", false
 }
 
 // GetStats 获取彩虹表统计信息
 func GetStats(c *fiber.Ctx) error {
-	var stats struct {
-		TotalChains        int64
-		TotalCharsets      int64
-		AverageChainLength float64
-	}
-
-	// 查询总链数
-	if err := db.PG.Model(&dbModel.RainbowTable{}).Count(&stats.TotalChains).Error; err != nil {
+	// 查询总链数、字符集类型数量和平均链长度
+	stats, err := store.RainbowChains.Stats()
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"success": false,
 			"message": "获取统计信息失败",
@@ -914,22 +1009,6 @@ func GetStats(c *fiber.Ctx) error {
 		})
 	}
 
-	// 查询不同字符集类型数量
-	if err := db.PG.Model(&dbModel.RainbowTable{}).Distinct("charset_type").Count(&stats.TotalCharsets).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"success": false,
-			"message": "获取统计信息失败",
-		})
-	}
-
-	// 查询平均链长度
-	if err := db.PG.Model(&dbModel.RainbowTable{}).Select("AVG(chain_length) as average_chain_length").Scan(&stats.AverageChainLength).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"success": false,
-			"message": "获取统计信息失败",
-		})
-	}
-
 	// 估算覆盖率 (这是一个非常粗略的估计，实际覆盖率计算非常复杂)
 	coverageEstimate := float64(stats.TotalChains) * stats.AverageChainLength / 1000000000 * 100
 	if coverageEstimate > 100 {
@@ -947,32 +1026,14 @@ func GetStats(c *fiber.Ctx) error {
 
 // RainbowManagement 获取彩虹表管理数据
 func RainbowManagement(c *fiber.Ctx) error {
-	// 检查用户是否为管理员
-	userRole := c.Locals("role")
-	if userRole == nil || userRole.(string) != "admin" {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-			"success": false,
-			"message": "只有管理员可以管理彩虹表",
-		})
-	}
-
 	// 获取分页参数
 	page := c.QueryInt("page", 1)
 	limit := c.QueryInt("limit", 20)
 	offset := (page - 1) * limit
 
-	// 查询总记录数
-	var total int64
-	if err := db.PG.Model(&dbModel.RainbowTable{}).Count(&total).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"success": false,
-			"message": "获取彩虹表总数失败",
-		})
-	}
-
-	// 查询彩虹表数据
-	var entries []dbModel.RainbowTable
-	if err := db.PG.Offset(offset).Limit(limit).Order("id DESC").Find(&entries).Error; err != nil {
+	// 查询彩虹表数据和总记录数
+	entries, total, err := store.RainbowChains.List(offset, limit)
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"success": false,
 			"message": "获取彩虹表数据失败",
@@ -1011,15 +1072,6 @@ func RainbowManagement(c *fiber.Ctx) error {
 
 // AddRainbowTableEntry 添加新的彩虹表条目
 func AddRainbowTableEntry(c *fiber.Ctx) error {
-	// 检查用户是否为管理员
-	userRole := c.Locals("role")
-	if userRole == nil || userRole.(string) != "admin" {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-			"success": false,
-			"message": "只有管理员可以添加彩虹表条目",
-		})
-	}
-
 	// 解析请求数据
 	type AddRainbowRequest struct {
 		Hash              string `json:"hash"`
@@ -1043,6 +1095,15 @@ func AddRainbowTableEntry(c *fiber.Ctx) error {
 		})
 	}
 
+	// 16位哈希只能由明文计算出完整的32位MD5，两者必须一致
+	if req.Plaintext != "" && req.Hash != "" && req.HashType == "MD5_16" &&
+		!strings.EqualFold(utils.CalculateMD5(req.Plaintext)[8:24], req.Hash) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "16位哈希与明文不匹配",
+		})
+	}
+
 	// 验证必要参数
 	if req.StartPlaintext == "" {
 		// 如果未提供起始明文，生成一个随机明文
@@ -1084,7 +1145,7 @@ func AddRainbowTableEntry(c *fiber.Ctx) error {
 		CharsetRange:      req.CharsetRange,
 	}
 
-	if err := db.PG.Create(&rainbowTable).Error; err != nil {
+	if err := store.RainbowChains.Create(&rainbowTable); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"success": false,
 			"message": "创建彩虹表条目失败",
@@ -1093,16 +1154,22 @@ func AddRainbowTableEntry(c *fiber.Ctx) error {
 
 	// 如果提供了明文和哈希值，同时创建MD5记录
 	if req.Plaintext != "" && req.Hash != "" && req.HashType != "" {
+		userID, _ := c.Locals("userID").(uint)
 		md5Record := dbModel.Md5{
 			Plaintext: req.Plaintext,
 			MD5:       req.Hash,
+			Provenance: dbModel.Provenance{
+				Source: dbModel.SourceAdminBatch,
+				UserID: userID,
+			},
 		}
-		// 如果是16位MD5，设置MD5_16字段
+		// 如果是16位MD5，由明文计算32位MD5写入明文库
 		if req.HashType == "MD5_16" {
-			md5Record.MD5_16 = req.Hash
+			md5Record.MD5 = utils.CalculateMD5(req.Plaintext)
+			md5Record.MD5_16 = md5Record.MD5[8:24]
 		}
 
-		if err := db.PG.Create(&md5Record).Error; err != nil {
+		if _, err := store.Plaintexts.Insert([]dbModel.Md5{md5Record}, 1); err != nil {
 			// 记录错误但不中断流程
 			fmt.Println("创建MD5记录失败:", err)
 		}
@@ -1134,15 +1201,6 @@ func AddRainbowTableEntry(c *fiber.Ctx) error {
 
 // DeleteRainbowTableEntry 删除彩虹表条目
 func DeleteRainbowTableEntry(c *fiber.Ctx) error {
-	// 检查用户是否为管理员
-	userRole := c.Locals("role")
-	if userRole == nil || userRole.(string) != "admin" {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-			"success": false,
-			"message": "只有管理员可以删除彩虹表条目",
-		})
-	}
-
 	// 获取ID参数
 	id, err := c.ParamsInt("id")
 	if err != nil {
@@ -1153,15 +1211,15 @@ func DeleteRainbowTableEntry(c *fiber.Ctx) error {
 	}
 
 	// 查找并删除条目
-	result := db.PG.Delete(&dbModel.RainbowTable{}, id)
-	if result.Error != nil {
+	deleted, err := store.RainbowChains.Delete(uint(id))
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"success": false,
 			"message": "删除彩虹表条目失败",
 		})
 	}
 
-	if result.RowsAffected == 0 {
+	if !deleted {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"success": false,
 			"message": "找不到指定的彩虹表条目",
@@ -1271,8 +1329,8 @@ func GetTaskStatus(c *fiber.Ctx) error {
 	}
 
 	// 如果内存中没有找到任务进度，则尝试从数据库中查询
-	var record dbModel.MD5Record
-	if err := db.PG.First(&record, taskID).Error; err != nil {
+	record, err := store.Records.FindByID(taskIDUint)
+	if err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"success": false,
 			"message": "未找到指定任务",
@@ -1289,9 +1347,8 @@ func GetTaskStatus(c *fiber.Ctx) error {
 	}
 
 	// 尝试获取任务的详细进度信息
-	var detailProgress dbModel.TaskProgressRecord
 	var tablesSearched, totalTables, chainsSearched, reductionAttempts int
-	if db.PG.Where("task_id = ?", taskIDUint).First(&detailProgress).Error == nil {
+	if detailProgress, err := store.Tasks.FindProgress(taskIDUint); err == nil {
 		tablesSearched = detailProgress.TablesSearched
 		totalTables = detailProgress.TotalTables
 		chainsSearched = detailProgress.ChainsSearched
@@ -1392,8 +1449,8 @@ func FinishTask(c *fiber.Ctx) error {
 	}
 
 	// 首先从数据库中查询任务记录，确认它存在
-	var record dbModel.MD5Record
-	if err := db.PG.First(&record, taskIDUint).Error; err != nil {
+	record, err := store.Records.FindByID(taskIDUint)
+	if err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"success": false,
 			"message": "未找到指定任务",
@@ -1422,7 +1479,7 @@ func FinishTask(c *fiber.Ctx) error {
 		"progress":       100, // 设置进度为100%表示任务已完成
 	}
 
-	if err := db.PG.Model(&dbModel.MD5Record{}).Where("id = ?", taskIDUint).Updates(updates).Error; err != nil {
+	if err := store.Records.Update(taskIDUint, updates); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"success": false,
 			"message": "更新任务状态失败",
@@ -1498,29 +1555,9 @@ func TaskManagement(c *fiber.Ctx) error {
 		req.PageSize = 10
 	}
 
-	// 构建查询
-	query := db.PG.Model(&dbModel.MD5Record{})
-
-	// 如果指定了状态，添加状态筛选
-	if req.Status > 0 {
-		query = query.Where("decrypt_status = ?", req.Status)
-	}
-
-	// 获取总记录数
-	var total int64
-	if err := query.Count(&total).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(TaskManagementResponse{
-			Success: false,
-			Message: "获取任务总数失败",
-		})
-	}
-
-	// 获取分页数据
-	var records []dbModel.MD5Record
-	if err := query.Order("created_at DESC").
-		Offset((req.Page - 1) * req.PageSize).
-		Limit(req.PageSize).
-		Find(&records).Error; err != nil {
+	// 获取分页数据和总记录数，指定了状态时按状态筛选
+	records, total, err := store.Records.ListTasks(req.Status, (req.Page-1)*req.PageSize, req.PageSize)
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(TaskManagementResponse{
 			Success: false,
 			Message: "获取任务列表失败",
@@ -1575,8 +1612,7 @@ func TaskManagement(c *fiber.Ctx) error {
 		}
 
 		// 获取任务详细信息
-		var detail dbModel.TaskProgressRecord
-		if err := db.PG.Where("task_id = ?", record.ID).First(&detail).Error; err == nil {
+		if detail, err := store.Tasks.FindProgress(record.ID); err == nil {
 			task.TablesSearched = detail.TablesSearched
 			task.TotalTables = detail.TotalTables
 			task.ChainsSearched = detail.ChainsSearched
@@ -1644,8 +1680,8 @@ func CancelTask(c *fiber.Ctx) error {
 	}
 
 	// 首先从数据库中查询任务记录，确认它存在
-	var record dbModel.MD5Record
-	if err := db.PG.First(&record, taskIDUint).Error; err != nil {
+	record, err := store.Records.FindByID(taskIDUint)
+	if err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"success": false,
 			"message": "未找到指定任务",
@@ -1669,7 +1705,7 @@ func CancelTask(c *fiber.Ctx) error {
 		"progress":       100, // 设置进度为100%表示任务已完成
 	}
 
-	if err := db.PG.Model(&dbModel.MD5Record{}).Where("id = ?", taskIDUint).Updates(updates).Error; err != nil {
+	if err := store.Records.Update(taskIDUint, updates); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"success": false,
 			"message": "更新任务状态失败",
@@ -0,0 +1,84 @@
+package system
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"strings"
+	"time"
+	"zmd5/config"
+	"zmd5/db"
+	"zmd5/metrics"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// 就绪检查中连接数据库的超时时间
+const readyTimeout = 2 * time.Second
+
+// metricsConfig 监控指标配置，默认值与 config.Default 一致
+var metricsConfig = config.Default().Metrics
+
+// SetMetricsConfig 设置监控指标配置
+func SetMetricsConfig(cfg config.MetricsConfig) {
+	metricsConfig = cfg
+}
+
+// Healthz 存活检查，进程能够处理请求时返回200
+func Healthz(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"status": "ok",
+	})
+}
+
+// Readyz 就绪检查，数据库可以连接且迁移均已执行时返回200，否则返回503，负载均衡据此摘除实例
+func Readyz(c *fiber.Ctx) error {
+	ready := true
+	checks := fiber.Map{}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), readyTimeout)
+	defer cancel()
+	if err := db.Ping(ctx); err != nil {
+		ready = false
+		checks["database"] = err.Error()
+	} else {
+		checks["database"] = "ok"
+	}
+
+	if pending, err := db.PendingMigrations(); err != nil {
+		ready = false
+		checks["migrations"] = err.Error()
+	} else if pending > 0 {
+		ready = false
+		checks["migrations"] = fmt.Sprintf("%d个迁移未执行", pending)
+	} else {
+		checks["migrations"] = "ok"
+	}
+
+	if !ready {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"status": "unavailable",
+			"checks": checks,
+		})
+	}
+	return c.JSON(fiber.Map{
+		"status": "ok",
+		"checks": checks,
+	})
+}
+
+// Metrics 以 Prometheus 文本格式输出监控指标，配置了令牌时需要在 Authorization 头中提供
+func Metrics(c *fiber.Ctx) error {
+	if metricsConfig.Token != "" {
+		token := strings.TrimPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(metricsConfig.Token)) != 1 {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"status":  "error",
+				"message": "无效的监控令牌",
+			})
+		}
+	}
+
+	c.Set(fiber.HeaderContentType, metrics.ContentType)
+	return metrics.Write(c)
+}
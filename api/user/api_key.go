@@ -0,0 +1,232 @@
+package user
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"zmd5/api/auth"
+	"zmd5/db/dbModel"
+	"zmd5/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// 每个用户最多可以拥有的有效API密钥数量
+const maxActiveAPIKeys = 20
+
+// CreateAPIKeyRequest 创建API密钥请求
+type CreateAPIKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// 有效天数，0表示不过期
+	ExpiresInDays int `json:"expiresInDays"`
+}
+
+// APIKeyInfo API密钥信息，不包含密钥本身
+type APIKeyInfo struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	RevokedAt  *time.Time `json:"revokedAt"`
+	Active     bool       `json:"active"`
+}
+
+func newAPIKeyInfo(key *dbModel.APIKey) APIKeyInfo {
+	scopes := key.ScopeList()
+	if scopes == nil {
+		scopes = []string{}
+	}
+	return APIKeyInfo{
+		ID:         key.ID,
+		Name:       key.Name,
+		Prefix:     key.Prefix,
+		Scopes:     scopes,
+		CreatedAt:  key.CreatedAt,
+		LastUsedAt: key.LastUsedAt,
+		ExpiresAt:  key.ExpiresAt,
+		RevokedAt:  key.RevokedAt,
+		Active:     key.Active(time.Now()),
+	}
+}
+
+// ListAPIKeys 获取当前用户的API密钥列表
+func ListAPIKeys(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uint)
+
+	keys, err := store.APIKeys.ListByUser(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"code": fiber.StatusInternalServerError,
+			"msg":  "获取API密钥失败",
+		})
+	}
+
+	infos := make([]APIKeyInfo, len(keys))
+	for i := range keys {
+		infos[i] = newAPIKeyInfo(&keys[i])
+	}
+
+	return c.JSON(fiber.Map{
+		"code": 200,
+		"data": infos,
+		"msg":  "获取API密钥成功",
+	})
+}
+
+// CreateAPIKey 为当前用户创建API密钥，完整密钥只在响应中返回一次
+func CreateAPIKey(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uint)
+	role, _ := c.Locals("role").(string)
+
+	var req CreateAPIKeyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"code": fiber.StatusBadRequest,
+			"msg":  "请求参数错误",
+		})
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 64 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"code": fiber.StatusBadRequest,
+			"msg":  "密钥名称不能为空且不能超过64个字符",
+		})
+	}
+	scopes, err := normalizeScopes(req.Scopes, role)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"code": fiber.StatusBadRequest,
+			"msg":  err.Error(),
+		})
+	}
+	if req.ExpiresInDays < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"code": fiber.StatusBadRequest,
+			"msg":  "有效天数不能为负数",
+		})
+	}
+
+	// 限制有效密钥数量
+	keys, err := store.APIKeys.ListByUser(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"code": fiber.StatusInternalServerError,
+			"msg":  "创建API密钥失败",
+		})
+	}
+	active := 0
+	for i := range keys {
+		if keys[i].Active(time.Now()) {
+			active++
+		}
+	}
+	if active >= maxActiveAPIKeys {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"code": fiber.StatusBadRequest,
+			"msg":  fmt.Sprintf("最多只能拥有%d个有效的API密钥，请先撤销不再使用的密钥", maxActiveAPIKeys),
+		})
+	}
+
+	secret, prefix, err := utils.GenerateAPIKey()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"code": fiber.StatusInternalServerError,
+			"msg":  "生成API密钥失败",
+		})
+	}
+
+	key := dbModel.APIKey{
+		UserID:  userID,
+		Name:    req.Name,
+		Prefix:  prefix,
+		KeyHash: utils.HashAPIKey(secret),
+		Scopes:  strings.Join(scopes, ","),
+	}
+	if req.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		key.ExpiresAt = &expiresAt
+	}
+	if err := store.APIKeys.Create(&key); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"code": fiber.StatusInternalServerError,
+			"msg":  "创建API密钥失败",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"code": fiber.StatusCreated,
+		"data": fiber.Map{
+			"key":    secret,
+			"apiKey": newAPIKeyInfo(&key),
+		},
+		"msg": "创建API密钥成功，请妥善保存密钥，关闭后将无法再次查看",
+	})
+}
+
+// RevokeAPIKey 撤销当前用户的API密钥
+func RevokeAPIKey(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uint)
+
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"code": fiber.StatusBadRequest,
+			"msg":  "无效的密钥ID",
+		})
+	}
+
+	revoked, err := store.APIKeys.Revoke(uint(id), userID, time.Now())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"code": fiber.StatusInternalServerError,
+			"msg":  "撤销API密钥失败",
+		})
+	}
+	if !revoked {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"code": fiber.StatusNotFound,
+			"msg":  "找不到指定的API密钥或密钥已撤销",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"code": 200,
+		"msg":  "撤销API密钥成功",
+	})
+}
+
+// normalizeScopes 校验并去重授权范围，admin:import 要求角色拥有导入权限
+func normalizeScopes(scopes []string, role string) ([]string, error) {
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("请至少选择一个授权范围（%s）", strings.Join(dbModel.APIKeyScopes, "、"))
+	}
+
+	seen := make(map[string]bool)
+	var result []string
+	for _, scope := range scopes {
+		scope = strings.TrimSpace(scope)
+		valid := false
+		for _, known := range dbModel.APIKeyScopes {
+			if scope == known {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return nil, fmt.Errorf("无效的授权范围: %s", scope)
+		}
+		if scope == dbModel.ScopeAdminImport && !auth.HasPermission(role, auth.PermMd5Import) {
+			return nil, fmt.Errorf("没有 %s 权限，不能创建 %s 授权范围的密钥", auth.PermMd5Import, scope)
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			result = append(result, scope)
+		}
+	}
+	return result, nil
+}
@@ -1,12 +1,22 @@
 package user
 
 import (
-	"zmd5/db"
-	"zmd5/db/dbModel"
+	"context"
+	"log"
+	"time"
+	"zmd5/repository"
 
 	"github.com/gofiber/fiber/v2"
 )
 
+// store 处理器使用的存储，由 Init 注入
+var store *repository.Store
+
+// Init 注入处理器使用的存储
+func Init(s *repository.Store) {
+	store = s
+}
+
 // HistoryResponse 定义历史记录响应结构
 type HistoryResponse struct {
 	Total    int64           `json:"total"`    // 总记录数
@@ -44,19 +54,8 @@ func GetHistory(c *fiber.Ctx) error {
 	// 计算偏移量
 	offset := (page - 1) * pageSize
 
-	var total int64
-	var records []dbModel.MD5Record
-
-	// 获取总记录数
-	db.PG.Model(&dbModel.MD5Record{}).Where("user_id = ?", userID).Count(&total)
-
-	// 查询记录
-	db.PG.Model(&dbModel.MD5Record{}).
-		Where("user_id = ?", userID).
-		Order("created_at DESC").
-		Offset(offset).
-		Limit(pageSize).
-		Find(&records)
+	// 查询记录和总记录数
+	records, total, _ := store.Records.ListByUser(userID, offset, pageSize)
 
 	// 转换为响应格式
 	historyRecords := make([]HistoryRecord, len(records))
@@ -92,3 +91,31 @@ func getTypeString(typeNum int) string {
 	}
 	return "decrypt"
 }
+
+// 清除过期历史明文的间隔
+const historyRetentionInterval = time.Hour
+
+// StartHistoryRetention 在后台定期清除超过保留时间的历史记录中的明文，只保留哈希，retention为0时不清除
+func StartHistoryRetention(ctx context.Context, retention time.Duration) {
+	if retention <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(historyRetentionInterval)
+		defer ticker.Stop()
+		for {
+			cleared, err := store.Records.ClearPlaintexts(time.Now().Add(-retention))
+			if err != nil {
+				log.Printf("清除过期的历史明文失败: %v", err)
+			} else if cleared > 0 {
+				log.Printf("已清除%d条超过保留时间的历史明文", cleared)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
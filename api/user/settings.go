@@ -0,0 +1,64 @@
+package user
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+// Settings 用户个人设置
+type Settings struct {
+	// 隐私模式：加密的明文不写入明文库，历史记录只保存哈希
+	PrivateMode bool `json:"privateMode"`
+}
+
+// UpdateSettingsRequest 修改个人设置请求，未提供的字段保持不变
+type UpdateSettingsRequest struct {
+	PrivateMode *bool `json:"privateMode"`
+}
+
+// GetSettings 获取当前用户的个人设置
+func GetSettings(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uint)
+
+	user, err := store.Users.FindByID(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"code": fiber.StatusInternalServerError,
+			"msg":  "获取个人设置失败",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"code": 200,
+		"data": Settings{PrivateMode: user.PrivateMode},
+		"msg":  "获取个人设置成功",
+	})
+}
+
+// UpdateSettings 修改当前用户的个人设置
+// 开启隐私模式只影响之后的请求，已保存的明文和历史记录不会被删除
+func UpdateSettings(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uint)
+
+	var req UpdateSettingsRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"code": fiber.StatusBadRequest,
+			"msg":  "请求参数错误",
+		})
+	}
+
+	fields := make(map[string]interface{})
+	if req.PrivateMode != nil {
+		fields["private_mode"] = *req.PrivateMode
+	}
+	if len(fields) > 0 {
+		if err := store.Users.Update(userID, fields); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"code": fiber.StatusInternalServerError,
+				"msg":  "修改个人设置失败",
+			})
+		}
+	}
+
+	return GetSettings(c)
+}
@@ -0,0 +1,194 @@
+package bloom
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"hash/fnv"
+	"io"
+	"math"
+	"math/bits"
+	"sync/atomic"
+)
+
+// snapshotMagic 快照文件头标识，格式变化时递增版本号
+const snapshotMagic = "ZMBF0002"
+
+// MaxBits 快照允许的最大位数（8GiB），防止损坏的文件头导致分配过多内存
+const MaxBits = 1 << 36
+
+// snapshotChunkWords 读取快照时每块的字数
+const snapshotChunkWords = 1 << 16
+
+// ErrInvalidSnapshot 快照文件格式错误
+var ErrInvalidSnapshot = errors.New("无效的布隆过滤器快照")
+
+// Filter 支持并发读写的布隆过滤器
+// 只会产生假阳性（判断存在但实际不存在），不会产生假阴性，元素无法删除
+type Filter struct {
+	bits  []uint64
+	m     uint64 // 位数
+	k     uint64 // 哈希函数个数
+	count atomic.Uint64
+}
+
+// New 按预期元素数量和目标假阳性率创建过滤器
+func New(capacity uint64, fpRate float64) *Filter {
+	if capacity == 0 {
+		capacity = 1
+	}
+	if fpRate <= 0 || fpRate >= 1 {
+		fpRate = 0.01
+	}
+	m := uint64(math.Ceil(-float64(capacity) * math.Log(fpRate) / (math.Ln2 * math.Ln2)))
+	k := uint64(math.Round(float64(m) / float64(capacity) * math.Ln2))
+	return newFilter(m, k)
+}
+
+func newFilter(m, k uint64) *Filter {
+	if k == 0 {
+		k = 1
+	}
+	words := (m + 63) / 64
+	if words == 0 {
+		words = 1
+	}
+	return &Filter{bits: make([]uint64, words), m: words * 64, k: k}
+}
+
+// hashes 使用双重哈希从一个64位FNV哈希派生出k个位置
+func hashes(key []byte) (uint64, uint64) {
+	h := fnv.New64a()
+	h.Write(key)
+	h1 := h.Sum64()
+	// splitmix64 混合得到第二个哈希
+	h2 := h1 + 0x9e3779b97f4a7c15
+	h2 = (h2 ^ (h2 >> 30)) * 0xbf58476d1ce4e5b9
+	h2 = (h2 ^ (h2 >> 27)) * 0x94d049bb133111eb
+	h2 ^= h2 >> 31
+	return h1, h2 | 1
+}
+
+// Add 添加元素
+func (f *Filter) Add(key []byte) {
+	h1, h2 := hashes(key)
+	for i := uint64(0); i < f.k; i++ {
+		pos := (h1 + i*h2) % f.m
+		atomic.OrUint64(&f.bits[pos/64], 1<<(pos%64))
+	}
+	f.count.Add(1)
+}
+
+// Test 判断元素是否可能存在，返回false表示一定不存在
+func (f *Filter) Test(key []byte) bool {
+	h1, h2 := hashes(key)
+	for i := uint64(0); i < f.k; i++ {
+		pos := (h1 + i*h2) % f.m
+		if atomic.LoadUint64(&f.bits[pos/64])&(1<<(pos%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Count 返回已添加的元素次数（重复添加会重复计数）
+func (f *Filter) Count() uint64 {
+	return f.count.Load()
+}
+
+// Bits 返回过滤器的位数
+func (f *Filter) Bits() uint64 {
+	return f.m
+}
+
+// Hashes 返回哈希函数个数
+func (f *Filter) Hashes() uint64 {
+	return f.k
+}
+
+// SizeBytes 返回位数组占用的内存字节数
+func (f *Filter) SizeBytes() uint64 {
+	return uint64(len(f.bits)) * 8
+}
+
+// FillRatio 返回已置位的比例
+func (f *Filter) FillRatio() float64 {
+	var set int
+	for i := range f.bits {
+		set += bits.OnesCount64(atomic.LoadUint64(&f.bits[i]))
+	}
+	return float64(set) / float64(f.m)
+}
+
+// FalsePositiveRate 根据当前置位比例估算假阳性率
+func (f *Filter) FalsePositiveRate() float64 {
+	return math.Pow(f.FillRatio(), float64(f.k))
+}
+
+// WriteTo 将过滤器写出为快照，extra为调用方附带的元数据（如数据库写入状态）
+// 快照末尾附带CRC32校验和，读取时可以发现文件损坏
+func (f *Filter) WriteTo(w io.Writer, extra uint64) error {
+	bw := bufio.NewWriter(w)
+	sum := crc32.NewIEEE()
+	out := io.MultiWriter(bw, sum)
+	if _, err := io.WriteString(out, snapshotMagic); err != nil {
+		return err
+	}
+	header := []uint64{f.m, f.k, f.count.Load(), extra}
+	if err := binary.Write(out, binary.LittleEndian, header); err != nil {
+		return err
+	}
+	buf := make([]byte, 8)
+	for i := range f.bits {
+		binary.LittleEndian.PutUint64(buf, atomic.LoadUint64(&f.bits[i]))
+		if _, err := out.Write(buf); err != nil {
+			return err
+		}
+	}
+	if err := binary.Write(bw, binary.LittleEndian, sum.Sum32()); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// ReadFrom 从快照读取过滤器，返回过滤器和写出时附带的元数据
+// 位数组按块读取，文件被截断时不会按文件头中的位数一次性分配内存
+func ReadFrom(r io.Reader) (*Filter, uint64, error) {
+	sum := crc32.NewIEEE()
+	br := io.TeeReader(bufio.NewReader(r), sum)
+	magic := make([]byte, len(snapshotMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != snapshotMagic {
+		return nil, 0, ErrInvalidSnapshot
+	}
+	header := make([]uint64, 4)
+	if err := binary.Read(br, binary.LittleEndian, header); err != nil {
+		return nil, 0, ErrInvalidSnapshot
+	}
+	m, k := header[0], header[1]
+	if m == 0 || m%64 != 0 || m > MaxBits || k == 0 || k > 64 {
+		return nil, 0, ErrInvalidSnapshot
+	}
+
+	words := m / 64
+	bits := make([]uint64, 0, min(words, snapshotChunkWords))
+	chunk := make([]uint64, snapshotChunkWords)
+	for remaining := words; remaining > 0; {
+		n := min(remaining, snapshotChunkWords)
+		if err := binary.Read(br, binary.LittleEndian, chunk[:n]); err != nil {
+			return nil, 0, ErrInvalidSnapshot
+		}
+		bits = append(bits, chunk[:n]...)
+		remaining -= n
+	}
+
+	expected := sum.Sum32()
+	var checksum uint32
+	if err := binary.Read(br, binary.LittleEndian, &checksum); err != nil || checksum != expected {
+		return nil, 0, ErrInvalidSnapshot
+	}
+
+	f := &Filter{bits: bits, m: m, k: k}
+	f.count.Store(header[2])
+	return f, header[3], nil
+}
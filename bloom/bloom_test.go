@@ -0,0 +1,144 @@
+package bloom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func testKeys(n int) [][]byte {
+	keys := make([][]byte, n)
+	for i := range keys {
+		keys[i] = []byte(fmt.Sprintf("key-%d", i))
+	}
+	return keys
+}
+
+func TestNoFalseNegatives(t *testing.T) {
+	f := New(1000, 0.01)
+	keys := testKeys(1000)
+	for _, key := range keys {
+		f.Add(key)
+	}
+	for _, key := range keys {
+		if !f.Test(key) {
+			t.Fatalf("已添加的元素 %s 被判断为不存在", key)
+		}
+	}
+	if f.Count() != 1000 {
+		t.Fatalf("Count() = %d, 期望 1000", f.Count())
+	}
+}
+
+func TestFalsePositiveRate(t *testing.T) {
+	f := New(10000, 0.01)
+	for _, key := range testKeys(10000) {
+		f.Add(key)
+	}
+	positives := 0
+	for i := 0; i < 10000; i++ {
+		if f.Test([]byte(fmt.Sprintf("other-%d", i))) {
+			positives++
+		}
+	}
+	// 目标假阳性率1%，留出足够余量避免偶然失败
+	if rate := float64(positives) / 10000; rate > 0.03 {
+		t.Fatalf("假阳性率 %.4f 超出预期", rate)
+	}
+}
+
+func snapshot(t *testing.T, f *Filter, extra uint64) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := f.WriteTo(&buf, extra); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	f := New(5000, 0.001)
+	keys := testKeys(5000)
+	for _, key := range keys {
+		f.Add(key)
+	}
+
+	restored, extra, err := ReadFrom(bytes.NewReader(snapshot(t, f, 42)))
+	if err != nil {
+		t.Fatalf("ReadFrom: %v", err)
+	}
+	if extra != 42 {
+		t.Fatalf("extra = %d, 期望 42", extra)
+	}
+	if restored.Bits() != f.Bits() || restored.Hashes() != f.Hashes() || restored.Count() != f.Count() {
+		t.Fatalf("恢复的参数不一致: bits=%d hashes=%d count=%d", restored.Bits(), restored.Hashes(), restored.Count())
+	}
+	for _, key := range keys {
+		if !restored.Test(key) {
+			t.Fatalf("恢复后元素 %s 被判断为不存在", key)
+		}
+	}
+	// 恢复的过滤器可以继续写入
+	restored.Add([]byte("new"))
+	if !restored.Test([]byte("new")) {
+		t.Fatal("恢复后新增的元素被判断为不存在")
+	}
+}
+
+func TestSnapshotLargerThanChunk(t *testing.T) {
+	f := newFilter(snapshotChunkWords*64*2+640, 3)
+	f.Add([]byte("a"))
+	restored, _, err := ReadFrom(bytes.NewReader(snapshot(t, f, 0)))
+	if err != nil {
+		t.Fatalf("ReadFrom: %v", err)
+	}
+	if restored.Bits() != f.Bits() || !restored.Test([]byte("a")) {
+		t.Fatal("跨多个读取块的快照恢复不一致")
+	}
+}
+
+func TestSnapshotCorruption(t *testing.T) {
+	f := New(1000, 0.01)
+	for _, key := range testKeys(1000) {
+		f.Add(key)
+	}
+	data := snapshot(t, f, 7)
+	headerEnd := len(snapshotMagic) + 4*8
+
+	withHeader := func(index int, value uint64) []byte {
+		corrupted := append([]byte(nil), data...)
+		binary.LittleEndian.PutUint64(corrupted[len(snapshotMagic)+index*8:], value)
+		return corrupted
+	}
+	flip := func(offset int) []byte {
+		corrupted := append([]byte(nil), data...)
+		corrupted[offset] ^= 0x01
+		return corrupted
+	}
+
+	cases := map[string][]byte{
+		"空文件":       nil,
+		"文件头标识错误":   append([]byte("ZMBF0001"), data[len(snapshotMagic):]...),
+		"文件头截断":     data[:headerEnd-3],
+		"位数组截断":     data[:headerEnd+100],
+		"缺少校验和":     data[:len(data)-4],
+		"位数为0":      withHeader(0, 0),
+		"位数不是64的倍数": withHeader(0, 100),
+		"位数超出上限":    withHeader(0, MaxBits+64),
+		"位数远大于文件":   withHeader(0, 1<<35),
+		"哈希函数个数为0":  withHeader(1, 0),
+		"哈希函数个数过多":  withHeader(1, 65),
+		"元数据被修改":    withHeader(3, 8),
+		"位数组被修改":    flip(headerEnd + 10),
+		"校验和被修改":    flip(len(data) - 1),
+	}
+	for name, corrupted := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, _, err := ReadFrom(bytes.NewReader(corrupted)); !errors.Is(err, ErrInvalidSnapshot) {
+				t.Fatalf("期望 ErrInvalidSnapshot, 实际为 %v", err)
+			}
+		})
+	}
+}
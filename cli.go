@@ -0,0 +1,488 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+	"zmd5/api/admin"
+	"zmd5/api/auth"
+	"zmd5/api/rainbow"
+	"zmd5/client"
+	"zmd5/config"
+	"zmd5/db"
+	"zmd5/export"
+	"zmd5/jobs"
+	"zmd5/repository"
+	"zmd5/utils"
+)
+
+const usage = `用法: zmd5 [全局参数] <命令> [命令参数]
+
+命令:
+  serve                     启动HTTP服务（不带命令时默认执行）
+  lookup <hash...>          查询哈希对应的明文，未提供哈希或为 - 时从标准输入逐行读取
+  import <file>             导入明文列表，file 为 - 时从标准输入读取
+  export                    导出明文库
+  rainbow generate          生成彩虹链
+  rainbow verify            校验彩虹链的终止哈希
+  user create <username>    创建用户
+  migrate [up|rollback|status]
+                            管理数据库表结构迁移
+  dedup                     清理明文库重复数据并创建唯一索引
+  convert-digests           将旧版本的十六进制MD5列转换为二进制摘要
+  transfer                  将当前存储的全部数据复制到另一个空数据库（如离线SQLite与PostgreSQL之间）
+
+全局参数需放在命令之前，设置 -server（或 ZMD5_SERVER）后 lookup、import、export、rainbow、user
+命令通过HTTP API访问远程服务，-token（或 ZMD5_TOKEN）为登录令牌；其余命令只能直接访问存储。
+`
+
+// errUsage 命令参数错误，输出用法说明
+var errUsage = errors.New("命令参数错误，执行 zmd5 help 查看用法")
+
+// runCommand 执行命令行子命令
+func runCommand(cfg *config.Config, args []string) error {
+	// Ctrl+C 时取消正在执行的命令
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	switch args[0] {
+	case "serve":
+		return serveCommand(ctx, cfg)
+	case "lookup", "import", "export", "rainbow", "user":
+		c, err := newClient(cfg)
+		if err != nil {
+			return err
+		}
+		return runClientCommand(ctx, c, args)
+	case "migrate", "dedup", "convert-digests", "transfer":
+		if cfg.Client.IsRemote() {
+			return fmt.Errorf("%s 命令只能直接访问存储，请取消 -server 或 ZMD5_SERVER 设置", args[0])
+		}
+		// 迁移和去重命令自行管理表结构，数据迁移只读取源数据库，其余命令需要先准备好表结构
+		setup := args[0] == "convert-digests"
+		if err := openStorage(cfg, setup); err != nil {
+			return err
+		}
+		switch args[0] {
+		case "migrate":
+			return migrateCommand(args[1:])
+		case "dedup":
+			return dedupCommand()
+		case "transfer":
+			return transferCommand(ctx, cfg, args[1:])
+		default:
+			return convertDigestsCommand()
+		}
+	case "help", "-h", "-help", "--help":
+		fmt.Print(usage)
+		return nil
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		return fmt.Errorf("未知的命令: %s", args[0])
+	}
+}
+
+// openStorage 连接配置的存储，setup 为 true 时同时执行迁移并初始化管理员账户
+func openStorage(cfg *config.Config, setup bool) error {
+	db.InitDB(cfg.Database)
+	if !setup {
+		return nil
+	}
+	return db.Setup(cfg.Database.AutoMigrate, cfg.Admin)
+}
+
+// newClient 根据配置创建远程客户端或直接访问存储的客户端
+func newClient(cfg *config.Config) (client.Client, error) {
+	if cfg.Client.IsRemote() {
+		return client.NewRemote(cfg.Client.Server, cfg.Client.Token), nil
+	}
+	if err := openStorage(cfg, true); err != nil {
+		return nil, err
+	}
+	return client.NewLocal(repository.New(db.PG)), nil
+}
+
+// runClientCommand 执行可以远程运行的子命令
+func runClientCommand(ctx context.Context, c client.Client, args []string) error {
+	switch args[0] {
+	case "lookup":
+		return lookupCommand(ctx, c, args[1:])
+	case "import":
+		return importCommand(ctx, c, args[1:])
+	case "export":
+		return exportCommand(ctx, c, args[1:])
+	case "rainbow":
+		if len(args) < 2 {
+			return errUsage
+		}
+		switch args[1] {
+		case "generate":
+			return rainbowGenerateCommand(ctx, c, args[2:])
+		case "verify":
+			return rainbowVerifyCommand(ctx, c, args[2:])
+		}
+	case "user":
+		if len(args) >= 2 && args[1] == "create" {
+			return userCreateCommand(ctx, c, args[2:])
+		}
+	}
+	return errUsage
+}
+
+// lookupCommand 查询哈希对应的明文
+// 找到的结果以 hash:明文 的形式输出到标准输出，未找到和无效的哈希输出到标准错误
+// 用法: zmd5 lookup [-json] <hash...>，或 cat hashes.txt | zmd5 lookup
+func lookupCommand(ctx context.Context, c client.Client, args []string) error {
+	fs := flag.NewFlagSet("lookup", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "以NDJSON格式输出所有查询结果")
+	fs.Parse(args)
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	encoder := json.NewEncoder(out)
+
+	var found, missed int
+	lookup := func(hash string) error {
+		hash = strings.TrimSpace(hash)
+		if hash == "" {
+			return nil
+		}
+		result, err := c.Lookup(ctx, hash)
+		if err != nil {
+			return err
+		}
+
+		if result.Found {
+			found++
+		} else {
+			missed++
+		}
+		switch {
+		case *asJSON:
+			return encoder.Encode(result)
+		case result.Found:
+			_, err := fmt.Fprintf(out, "%s:%s\n", result.Hash, result.Plaintext)
+			return err
+		case result.Error != "":
+			fmt.Fprintf(os.Stderr, "%s: %s\n", result.Hash, result.Error)
+		default:
+			fmt.Fprintf(os.Stderr, "%s: 未找到\n", result.Hash)
+		}
+		return nil
+	}
+
+	hashes := fs.Args()
+	if len(hashes) == 0 || (len(hashes) == 1 && hashes[0] == "-") {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			if err := lookup(scanner.Text()); err != nil {
+				return err
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+	} else {
+		for _, hash := range hashes {
+			if err := lookup(hash); err != nil {
+				return err
+			}
+		}
+	}
+
+	out.Flush()
+	log.Printf("查询完成，找到%d条，未找到%d条", found, missed)
+	return nil
+}
+
+// importCommand 导入明文列表
+// 用法: zmd5 import [-encodings utf8,gbk] words.txt
+func importCommand(ctx context.Context, c client.Client, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	encodingList := fs.String("encodings", "", "计算哈希时使用的明文编码，多个用逗号分隔，默认utf8")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errUsage
+	}
+
+	var encodingNames []string
+	if *encodingList != "" {
+		encodingNames = strings.Split(*encodingList, ",")
+	}
+	encodings, err := utils.NormalizeEncodings(encodingNames)
+	if err != nil {
+		return err
+	}
+
+	var r io.Reader = os.Stdin
+	filename := "stdin"
+	if path := fs.Arg(0); path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("打开文件失败: %v", err)
+		}
+		defer file.Close()
+		r = file
+		filename = filepath.Base(path)
+	}
+
+	job, err := c.Import(ctx, r, filename, encodings)
+	if err != nil {
+		return err
+	}
+	log.Printf("导入完成（导入任务ID: %d），处理%d条，新增%d条", job.ID, job.Processed, job.Added)
+	return nil
+}
+
+// exportCommand 将明文库导出到文件或标准输出
+// 用法: zmd5 export -format potfile -o out.potfile -start 2024-01-01 -min-length 6
+func exportCommand(ctx context.Context, c client.Client, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	format := fs.String("format", export.FormatWordlist, "导出格式: wordlist/potfile/csv/ndjson")
+	output := fs.String("o", "", "输出文件路径，为空时输出到标准输出")
+	var filter admin.Md5FilterRequest
+	fs.StringVar(&filter.Search, "search", "", "模糊搜索关键字")
+	fs.StringVar(&filter.Type, "type", "", "搜索字段: plaintext/md5，为空时搜索所有字段")
+	fs.StringVar(&filter.StartDate, "start", "", "创建时间下界（2006-01-02 或 RFC3339）")
+	fs.StringVar(&filter.EndDate, "end", "", "创建时间上界（2006-01-02 或 RFC3339）")
+	fs.IntVar(&filter.MinLength, "min-length", 0, "明文最小长度")
+	fs.IntVar(&filter.MaxLength, "max-length", 0, "明文最大长度")
+	fs.StringVar(&filter.Encoding, "encoding", "", "明文编码: utf8/gbk/utf16le")
+	fs.StringVar(&filter.Source, "source", "", "来源类型: user_encrypt/admin_batch/upload/rainbow")
+	fs.UintVar(&filter.ImportJobID, "import-job", 0, "导入任务ID")
+	fs.Parse(args)
+
+	if !export.ValidFormat(*format) {
+		return fmt.Errorf("不支持的导出格式: %s", *format)
+	}
+	// 提前校验过滤条件，避免创建输出文件后才发现参数错误
+	if _, err := filter.Filter(); err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("创建输出文件失败: %v", err)
+		}
+		defer file.Close()
+		w = file
+	}
+
+	if err := c.Export(ctx, w, *format, filter); err != nil {
+		return fmt.Errorf("导出失败: %v", err)
+	}
+	return nil
+}
+
+// rainbowGenerateCommand 生成彩虹链
+// 用法: zmd5 rainbow generate -count 1000 -chain-length 1000 -min-length 4 -max-length 6
+func rainbowGenerateCommand(ctx context.Context, c client.Client, args []string) error {
+	fs := flag.NewFlagSet("rainbow generate", flag.ExitOnError)
+	var req rainbow.RainbowTableRequest
+	fs.IntVar(&req.Count, "count", 10, "生成链的数量")
+	fs.IntVar(&req.ChainLength, "chain-length", 1000, "链长度")
+	fs.IntVar(&req.ReductionFuncID, "reduction", 0, "规约函数ID")
+	fs.IntVar(&req.CharsetType, "charset", 0, "字符集类型")
+	fs.StringVar(&req.CharsetRange, "charset-range", "", "自定义字符集")
+	fs.IntVar(&req.MinLength, "min-length", 3, "明文最小长度")
+	fs.IntVar(&req.MaxLength, "max-length", 8, "明文最大长度")
+	fs.Parse(args)
+
+	generated, total, err := c.GenerateRainbow(ctx, req)
+	if err != nil {
+		return err
+	}
+	log.Printf("彩虹表生成完成，新增%d条链，共%d条链", generated, total)
+	return nil
+}
+
+// rainbowVerifyCommand 校验彩虹链，存在终止哈希不一致的链时返回错误
+// 用法: zmd5 rainbow verify [-limit 1000]
+func rainbowVerifyCommand(ctx context.Context, c client.Client, args []string) error {
+	fs := flag.NewFlagSet("rainbow verify", flag.ExitOnError)
+	limit := fs.Int("limit", 0, "只校验最新的若干条链，0表示校验全部")
+	fs.Parse(args)
+
+	result, err := c.VerifyRainbow(ctx, *limit)
+	if err != nil {
+		return err
+	}
+	for _, id := range result.InvalidIDs {
+		fmt.Printf("链 %d 的终止哈希不一致\n", id)
+	}
+	log.Printf("彩虹表校验完成，校验%d条链，正确%d条，错误%d条", result.Checked, result.Valid, len(result.InvalidIDs))
+	if len(result.InvalidIDs) > 0 {
+		return fmt.Errorf("存在%d条终止哈希不一致的链", len(result.InvalidIDs))
+	}
+	return nil
+}
+
+// userCreateCommand 创建用户，未提供 -password 时从标准输入读取一行作为密码
+// 用法: zmd5 user create [-role admin] [-password xxx] <username>
+func userCreateCommand(ctx context.Context, c client.Client, args []string) error {
+	fs := flag.NewFlagSet("user create", flag.ExitOnError)
+	role := fs.String("role", auth.RoleUser, "用户角色: user/operator/auditor/admin 或自定义角色")
+	password := fs.String("password", "", "用户密码，为空时从标准输入读取")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errUsage
+	}
+
+	if *password == "" {
+		fmt.Fprint(os.Stderr, "密码: ")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return fmt.Errorf("读取密码失败: %v", err)
+		}
+		*password = strings.TrimRight(line, "\r\n")
+	}
+
+	user, err := c.CreateUser(ctx, fs.Arg(0), *password, *role)
+	if err != nil {
+		return err
+	}
+	log.Printf("已创建用户 %s（ID: %d，角色: %s）", user.Username, user.ID, user.Role)
+	return nil
+}
+
+// transferCommand 将当前配置的存储中的全部数据复制到目标数据库
+// 用法: zmd5 -offline transfer -to-driver postgres -to-dsn "host=..."（离线数据导入PostgreSQL）
+// 或:   zmd5 transfer -to-driver sqlite -to-dsn field.db（将PostgreSQL数据导出为离线数据库）
+func transferCommand(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("transfer", flag.ExitOnError)
+	var target config.DatabaseConfig
+	fs.StringVar(&target.Driver, "to-driver", "", "目标存储后端: postgres/sqlite")
+	fs.StringVar(&target.DSN, "to-dsn", "", "目标数据库连接串")
+	batchSize := fs.Int("batch", 1000, "每批次复制的行数")
+	fs.Parse(args)
+	if target.Driver == "" || target.DSN == "" {
+		return errUsage
+	}
+	if target.Driver == cfg.Database.Driver && target.DSN == cfg.Database.DSN {
+		return errors.New("目标数据库不能与当前存储相同")
+	}
+
+	dst, err := db.Open(target)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("开始将 %s 存储的数据复制到 %s", cfg.Database.Driver, target.Driver)
+	if err := db.Transfer(ctx, db.PG, dst, *batchSize, &logProgress{}); err != nil {
+		return err
+	}
+	log.Printf("数据迁移完成")
+	return nil
+}
+
+// logProgress 将长时间运行的命令的进度定期输出到日志
+type logProgress struct {
+	total  int64
+	done   int64
+	logged time.Time
+}
+
+func (p *logProgress) SetTotal(total int64) {
+	p.total = total
+}
+
+func (p *logProgress) Add(n int64) {
+	p.done += n
+	if time.Since(p.logged) >= 5*time.Second || p.done >= p.total {
+		log.Printf("进度: %d/%d", p.done, p.total)
+		p.logged = time.Now()
+	}
+}
+
+// dedupCommand 清理明文库中的重复数据并创建唯一索引
+// 存在重复数据时创建唯一索引的迁移会失败，因此先执行之前的迁移，去重完成后再执行该迁移
+func dedupCommand() error {
+	if _, err := db.Migrate(db.Md5UniqueIndexesVersion - 1); err != nil {
+		return err
+	}
+	err := jobs.Run(jobs.KindMd5Dedup, 0, nil, func(ctx context.Context, progress *jobs.Progress) error {
+		return db.DedupMd5(ctx, progress)
+	})
+	if err != nil {
+		return err
+	}
+	_, err = db.Migrate(db.Md5UniqueIndexesVersion)
+	return err
+}
+
+// convertDigestsCommand 将明文库旧的十六进制MD5列转换为二进制摘要
+func convertDigestsCommand() error {
+	return jobs.Run(jobs.KindDigestConvert, 0, nil, func(ctx context.Context, progress *jobs.Progress) error {
+		return db.ConvertMd5Digests(ctx, progress)
+	})
+}
+
+// migrateCommand 管理数据库表结构迁移
+// 用法: zmd5 migrate [-to 版本]、zmd5 migrate rollback [-steps 1]、zmd5 migrate status
+func migrateCommand(args []string) error {
+	action := "up"
+	if len(args) > 0 && args[0] != "" && args[0][0] != '-' {
+		action, args = args[0], args[1:]
+	}
+
+	switch action {
+	case "up":
+		fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+		to := fs.Int64("to", 0, "只执行到指定版本，0表示执行所有迁移")
+		fs.Parse(args)
+
+		count, err := db.Migrate(*to)
+		if err != nil {
+			return err
+		}
+		log.Printf("迁移完成，共执行%d个迁移", count)
+		return nil
+	case "rollback":
+		fs := flag.NewFlagSet("migrate rollback", flag.ExitOnError)
+		steps := fs.Int("steps", 1, "回滚的迁移数量")
+		fs.Parse(args)
+
+		count, err := db.Rollback(*steps)
+		if err != nil {
+			return err
+		}
+		log.Printf("回滚完成，共回滚%d个迁移", count)
+		return nil
+	case "status":
+		statuses, err := db.MigrationStatuses()
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "版本\t名称\t状态\t执行时间")
+		for _, status := range statuses {
+			state, appliedAt := "未执行", ""
+			if status.Applied {
+				state = "已执行"
+				appliedAt = status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			if status.Unknown {
+				state = "未知（程序中不存在）"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", status.Version, status.Name, state, appliedAt)
+		}
+		return w.Flush()
+	default:
+		return fmt.Errorf("未知的迁移命令: %s", action)
+	}
+}
@@ -0,0 +1,37 @@
+package client
+
+import (
+	"context"
+	"io"
+	"zmd5/api/admin"
+	"zmd5/api/auth"
+	"zmd5/api/rainbow"
+	"zmd5/db/dbModel"
+)
+
+// Client 命令行子命令使用的操作
+// Local 直接访问本地配置的存储，Remote 通过HTTP API访问远程服务，两者行为保持一致
+type Client interface {
+	// Lookup 查询哈希对应的明文，哈希无效或未找到时通过结果返回而不是报错
+	Lookup(ctx context.Context, hash string) (*LookupResult, error)
+	// Import 导入明文列表，每行一个明文或以逗号分隔的多个明文，返回完成后的导入任务
+	Import(ctx context.Context, r io.Reader, filename string, encodings []string) (*dbModel.ImportJob, error)
+	// Export 按过滤条件导出明文库
+	Export(ctx context.Context, w io.Writer, format string, filter admin.Md5FilterRequest) error
+	// GenerateRainbow 生成彩虹链，返回成功生成的链数量和总链数
+	GenerateRainbow(ctx context.Context, req rainbow.RainbowTableRequest) (int, int64, error)
+	// VerifyRainbow 校验彩虹链的终止哈希，limit 大于0时只校验最新的若干条链
+	VerifyRainbow(ctx context.Context, limit int) (*rainbow.VerifyResult, error)
+	// CreateUser 创建用户
+	CreateUser(ctx context.Context, username, password, role string) (*auth.User, error)
+}
+
+// LookupResult 哈希查询结果
+type LookupResult struct {
+	Hash      string `json:"hash"`
+	Found     bool   `json:"found"`
+	Plaintext string `json:"plaintext,omitempty"`
+	Encoding  string `json:"encoding,omitempty"`
+	// 哈希无效等无法查询的原因
+	Error string `json:"error,omitempty"`
+}
@@ -0,0 +1,94 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"strings"
+	"zmd5/api/admin"
+	"zmd5/api/auth"
+	"zmd5/api/rainbow"
+	"zmd5/db"
+	"zmd5/db/dbModel"
+	"zmd5/export"
+	"zmd5/repository"
+
+	"gorm.io/gorm"
+)
+
+// Local 直接访问存储的客户端
+type Local struct {
+	store *repository.Store
+}
+
+// NewLocal 创建直接访问存储的客户端，同时将存储注入复用的处理器逻辑
+func NewLocal(store *repository.Store) *Local {
+	admin.Init(store)
+	auth.Init(store)
+	rainbow.Init(store)
+	return &Local{store: store}
+}
+
+func (l *Local) Lookup(ctx context.Context, hash string) (*LookupResult, error) {
+	hash = strings.ToLower(strings.TrimSpace(hash))
+	result := &LookupResult{Hash: hash}
+
+	record, err := l.store.Plaintexts.FindByHash(hash)
+	switch {
+	case errors.Is(err, db.ErrInvalidHash):
+		result.Error = "无效的MD5哈希值长度,应为16位或32位"
+		return result, nil
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return result, nil
+	case err != nil:
+		return nil, err
+	}
+
+	// 与接口查询一致，记录命中次数
+	l.store.Plaintexts.RecordHit(record.ID)
+
+	result.Found = true
+	result.Plaintext = record.Plaintext
+	result.Encoding = record.Encoding
+	return result, nil
+}
+
+func (l *Local) Import(ctx context.Context, r io.Reader, filename string, encodings []string) (*dbModel.ImportJob, error) {
+	return admin.ImportReader(r, filename, encodings, 0)
+}
+
+func (l *Local) Export(ctx context.Context, w io.Writer, format string, filter admin.Md5FilterRequest) error {
+	md5Filter, err := filter.Filter()
+	if err != nil {
+		return err
+	}
+
+	count, err := export.Export(ctx, w, export.Options{
+		Format: format,
+		Filter: md5Filter,
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("导出完成，共%d条记录", count)
+	return nil
+}
+
+func (l *Local) GenerateRainbow(ctx context.Context, req rainbow.RainbowTableRequest) (int, int64, error) {
+	generated := rainbow.GenerateChains(req)
+	total, err := l.store.RainbowChains.Count()
+	return generated, total, err
+}
+
+func (l *Local) VerifyRainbow(ctx context.Context, limit int) (*rainbow.VerifyResult, error) {
+	return rainbow.VerifyChains(limit)
+}
+
+func (l *Local) CreateUser(ctx context.Context, username, password, role string) (*auth.User, error) {
+	user, err := auth.CreateUser(username, password, role)
+	if err != nil {
+		return nil, err
+	}
+	return &auth.User{ID: user.ID, Username: user.Username, Role: user.Role}, nil
+}
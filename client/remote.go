@@ -0,0 +1,288 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"zmd5/api/admin"
+	"zmd5/api/auth"
+	"zmd5/api/rainbow"
+	"zmd5/db"
+	"zmd5/db/dbModel"
+)
+
+// 查询导入任务进度的间隔
+const importPollInterval = time.Second
+
+// Remote 通过HTTP API访问远程服务的客户端
+type Remote struct {
+	server string
+	token  string
+	http   *http.Client
+}
+
+// NewRemote 创建访问远程服务的客户端，token 为登录令牌
+func NewRemote(server, token string) *Remote {
+	return &Remote{
+		server: strings.TrimRight(server, "/"),
+		token:  token,
+		http:   &http.Client{},
+	}
+}
+
+// newRequest 创建带认证头的请求
+func (r *Remote) newRequest(ctx context.Context, method, path string, body io.Reader, contentType string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, r.server+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if r.token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.token)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	return req, nil
+}
+
+// send 发送请求，状态码表示失败时返回包含服务端错误信息的错误，调用方负责关闭响应体
+func (r *Remote) send(req *http.Request) (*http.Response, error) {
+	resp, err := r.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		defer resp.Body.Close()
+		return nil, fmt.Errorf("请求 %s 失败（%d）: %s", req.URL.Path, resp.StatusCode, errorMessage(resp.Body))
+	}
+	return resp, nil
+}
+
+// doJSON 发送JSON请求并将响应解析到out
+func (r *Remote) doJSON(ctx context.Context, method, path string, in interface{}, out interface{}) error {
+	var body io.Reader
+	contentType := ""
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+		contentType = "application/json"
+	}
+
+	req, err := r.newRequest(ctx, method, path, body, contentType)
+	if err != nil {
+		return err
+	}
+	resp, err := r.send(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("解析 %s 的响应失败: %v", path, err)
+	}
+	return nil
+}
+
+// errorMessage 从错误响应中提取服务端返回的错误信息
+func errorMessage(body io.Reader) string {
+	data, _ := io.ReadAll(io.LimitReader(body, 4096))
+	var resp struct {
+		Message string `json:"message"`
+		Error   string `json:"error"`
+	}
+	if json.Unmarshal(data, &resp) == nil {
+		if resp.Message != "" {
+			return resp.Message
+		}
+		if resp.Error != "" {
+			return resp.Error
+		}
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func (r *Remote) Lookup(ctx context.Context, hash string) (*LookupResult, error) {
+	hash = strings.ToLower(strings.TrimSpace(hash))
+	result := &LookupResult{Hash: hash}
+
+	// 先在本地校验哈希格式，服务端对无效哈希和未找到返回的结构相同
+	if _, err := db.ParseHash(hash); err != nil {
+		result.Error = "无效的MD5哈希值长度,应为16位或32位"
+		return result, nil
+	}
+
+	var resp struct {
+		Success bool   `json:"success"`
+		Message string `json:"message"`
+		Data    struct {
+			Original string `json:"original"`
+			Encoding string `json:"encoding"`
+		} `json:"data"`
+	}
+	if err := r.doJSON(ctx, http.MethodPost, "/api/md5/decrypt", map[string]string{"text": hash}, &resp); err != nil {
+		return nil, err
+	}
+
+	if resp.Success {
+		result.Found = true
+		result.Plaintext = resp.Data.Original
+		result.Encoding = resp.Data.Encoding
+	}
+	return result, nil
+}
+
+func (r *Remote) Import(ctx context.Context, src io.Reader, filename string, encodings []string) (*dbModel.ImportJob, error) {
+	// 以流的方式上传文件，避免将大文件读入内存
+	pr, pw := io.Pipe()
+	form := multipart.NewWriter(pw)
+	go func() {
+		err := form.WriteField("encodings", strings.Join(encodings, ","))
+		if err == nil {
+			var part io.Writer
+			if part, err = form.CreateFormFile("file", filename); err == nil {
+				if _, err = io.Copy(part, src); err == nil {
+					err = form.Close()
+				}
+			}
+		}
+		pw.CloseWithError(err)
+	}()
+
+	req, err := r.newRequest(ctx, http.MethodPost, "/api/admin/md5/upload", pr, form.FormDataContentType())
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.send(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var upload struct {
+		Success bool   `json:"success"`
+		JobID   uint   `json:"job_id"`
+		Error   string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&upload); err != nil {
+		return nil, fmt.Errorf("解析上传响应失败: %v", err)
+	}
+	if !upload.Success {
+		return nil, fmt.Errorf("上传失败: %s", upload.Error)
+	}
+
+	// 服务端在后台导入，轮询直到导入任务结束
+	ticker := time.NewTicker(importPollInterval)
+	defer ticker.Stop()
+	for {
+		var status struct {
+			Data dbModel.ImportJob `json:"data"`
+		}
+		if err := r.doJSON(ctx, http.MethodGet, "/api/admin/import/jobs/"+strconv.FormatUint(uint64(upload.JobID), 10), nil, &status); err != nil {
+			return nil, err
+		}
+		switch status.Data.Status {
+		case dbModel.ImportProcessing:
+		case dbModel.ImportFailed:
+			return nil, fmt.Errorf("导入任务%d失败: %s", upload.JobID, status.Data.Error)
+		default:
+			return &status.Data, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Remote) Export(ctx context.Context, w io.Writer, format string, filter admin.Md5FilterRequest) error {
+	query := url.Values{}
+	query.Set("format", format)
+	setQuery(query, "search", filter.Search)
+	setQuery(query, "type", filter.Type)
+	setQuery(query, "startDate", filter.StartDate)
+	setQuery(query, "endDate", filter.EndDate)
+	setQuery(query, "encoding", filter.Encoding)
+	setQuery(query, "source", filter.Source)
+	if filter.MinLength > 0 {
+		query.Set("minLength", strconv.Itoa(filter.MinLength))
+	}
+	if filter.MaxLength > 0 {
+		query.Set("maxLength", strconv.Itoa(filter.MaxLength))
+	}
+	if filter.ImportJobID > 0 {
+		query.Set("importJobId", strconv.FormatUint(uint64(filter.ImportJobID), 10))
+	}
+	if filter.UserID > 0 {
+		query.Set("userId", strconv.FormatUint(uint64(filter.UserID), 10))
+	}
+
+	req, err := r.newRequest(ctx, http.MethodGet, "/api/admin/md5/export?"+query.Encode(), nil, "")
+	if err != nil {
+		return err
+	}
+	resp, err := r.send(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+func setQuery(query url.Values, key, value string) {
+	if value != "" {
+		query.Set(key, value)
+	}
+}
+
+func (r *Remote) GenerateRainbow(ctx context.Context, req rainbow.RainbowTableRequest) (int, int64, error) {
+	var resp rainbow.RainbowTableResponse
+	if err := r.doJSON(ctx, http.MethodPost, "/api/admin/rainbow/generate", req, &resp); err != nil {
+		return 0, 0, err
+	}
+	if !resp.Success {
+		return 0, 0, fmt.Errorf("生成彩虹表失败: %s", resp.Message)
+	}
+	return resp.Generated, resp.TotalCount, nil
+}
+
+func (r *Remote) VerifyRainbow(ctx context.Context, limit int) (*rainbow.VerifyResult, error) {
+	var resp struct {
+		Success bool                 `json:"success"`
+		Message string               `json:"message"`
+		Data    rainbow.VerifyResult `json:"data"`
+	}
+	if err := r.doJSON(ctx, http.MethodPost, "/api/admin/rainbow/verify", rainbow.VerifyRequest{Limit: limit}, &resp); err != nil {
+		return nil, err
+	}
+	if !resp.Success {
+		return nil, fmt.Errorf("校验彩虹表失败: %s", resp.Message)
+	}
+	return &resp.Data, nil
+}
+
+func (r *Remote) CreateUser(ctx context.Context, username, password, role string) (*auth.User, error) {
+	var resp struct {
+		Data auth.User `json:"data"`
+	}
+	req := admin.CreateUserRequest{Username: username, Password: password, Role: role}
+	if err := r.doJSON(ctx, http.MethodPost, "/api/admin/users", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.Data, nil
+}
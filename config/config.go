@@ -0,0 +1,614 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"gopkg.in/yaml.v3"
+)
+
+// 运行环境
+const (
+	EnvDevelopment = "development"
+	EnvProduction  = "production"
+)
+
+// 默认值，生产环境不允许使用其中的密钥类配置（见 CheckProductionSecrets）
+// 默认连接串不含密码，本地开发库的密码通过 PGPASSWORD 环境变量提供
+const (
+	DefaultJWTSecret     = "zmd5_secret_key"
+	DefaultAdminUsername = "clown"
+	DefaultPostgresDSN   = "host=localhost user=zero dbname=zmd5base port=5431 sslmode=disable TimeZone=Asia/Shanghai"
+	DefaultSQLiteDSN     = "zmd5.db"
+	DefaultConfigFile    = "config.yaml"
+)
+
+// 生产环境密钥类配置的最小长度
+const (
+	MinJWTSecretLength = 32 // JWT签名密钥
+	MinPasswordLength  = 12 // 管理员密码和数据库密码
+)
+
+// placeholderSecrets 示例配置中的占位值，生产环境不允许使用
+var placeholderSecrets = []string{"change-me", "changeme", "secret", "password"}
+
+// Config 应用配置
+// 加载顺序：默认值 < 配置文件 < 环境变量 < 命令行参数，后者覆盖前者
+type Config struct {
+	// 运行环境（development/production），环境变量 APP_ENV
+	Env string `yaml:"env"`
+	// 离线模式：使用嵌入式SQLite存储，服务只监听本机地址，无需数据库服务，环境变量 ZMD5_OFFLINE
+	Offline      bool               `yaml:"offline"`
+	Server       ServerConfig       `yaml:"server"`
+	Database     DatabaseConfig     `yaml:"database"`
+	JWT          JWTConfig          `yaml:"jwt"`
+	Login        LoginConfig        `yaml:"login"`
+	Password     PasswordConfig     `yaml:"password"`
+	Registration RegistrationConfig `yaml:"registration"`
+	RateLimit    RateLimitConfig    `yaml:"rate_limit"`
+	Privacy      PrivacyConfig      `yaml:"privacy"`
+	Metrics      MetricsConfig      `yaml:"metrics"`
+	Admin        AdminConfig        `yaml:"admin"`
+	Upload       UploadConfig       `yaml:"upload"`
+	DigestFilter DigestFilterConfig `yaml:"digest_filter"`
+	Client       ClientConfig       `yaml:"client"`
+}
+
+// ServerConfig HTTP服务配置
+type ServerConfig struct {
+	// 监听地址，为空时监听所有地址，离线模式下默认为127.0.0.1，环境变量 HOST
+	Host string `yaml:"host"`
+	// 监听端口，环境变量 PORT，默认9700
+	Port int `yaml:"port"`
+	// 允许跨域的来源，多个用逗号分隔，环境变量 CORS_ORIGIN
+	CORSOrigin string `yaml:"cors_origin"`
+	// 收到退出信号后等待请求处理完成和后台任务保存检查点的最长时间，环境变量 SHUTDOWN_TIMEOUT，默认30s
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	// 反向代理传递客户端地址的请求头（如 X-Real-IP），为空时使用连接的来源地址，环境变量 PROXY_HEADER
+	// 代理必须覆盖而不是追加该请求头，否则客户端可以伪造地址
+	ProxyHeader string `yaml:"proxy_header"`
+	// 可信的反向代理地址或网段，只有来自这些地址的请求才读取 ProxyHeader，
+	// 登录失败限制和限流按客户端地址计数，环境变量 TRUSTED_PROXIES（逗号分隔）
+	TrustedProxies []string `yaml:"trusted_proxies"`
+}
+
+// DatabaseConfig 存储后端配置
+type DatabaseConfig struct {
+	// 存储后端（postgres/sqlite），环境变量 DB_DRIVER
+	Driver string `yaml:"driver"`
+	// 连接串，为空时使用对应后端的默认值，环境变量 DB_DSN
+	DSN string `yaml:"dsn"`
+	// 启动服务时自动执行未执行的迁移，环境变量 DB_AUTO_MIGRATE，默认true
+	// 关闭后需要先执行 `zmd5 migrate`，否则服务拒绝启动
+	AutoMigrate bool `yaml:"auto_migrate"`
+}
+
+// JWTConfig 令牌配置
+type JWTConfig struct {
+	// 签名密钥，环境变量 JWT_SECRET
+	Secret string `yaml:"secret"`
+	// 访问令牌有效期，环境变量 JWT_EXPIRATION，默认15m
+	Expiration time.Duration `yaml:"expiration"`
+	// 刷新令牌有效期，即登录会话在不活动时的最长保持时间，环境变量 JWT_REFRESH_EXPIRATION，默认720h
+	RefreshExpiration time.Duration `yaml:"refresh_expiration"`
+}
+
+// LoginConfig 登录失败限制配置
+// 同一用户名连续失败 backoff_after 次后每次失败需要等待的时间翻倍，连续失败 lockout_after 次后锁定账户
+// 同一IP连续失败 ip_lockout_after 次后锁定该IP，一半次数后开始退避等待
+type LoginConfig struct {
+	// 环境变量 LOGIN_BACKOFF_AFTER，默认3
+	BackoffAfter int `yaml:"backoff_after"`
+	// 环境变量 LOGIN_LOCKOUT_AFTER，默认10
+	LockoutAfter int `yaml:"lockout_after"`
+	// 锁定时长，环境变量 LOGIN_LOCKOUT_DURATION，默认15m
+	LockoutDuration time.Duration `yaml:"lockout_duration"`
+	// 环境变量 LOGIN_IP_LOCKOUT_AFTER，默认50
+	IPLockoutAfter int `yaml:"ip_lockout_after"`
+}
+
+// PasswordConfig 密码策略，用于注册、创建用户、修改密码和管理员设置密码，不影响默认管理员账户
+type PasswordConfig struct {
+	// 最小长度，环境变量 PASSWORD_MIN_LENGTH，默认8
+	MinLength int `yaml:"min_length"`
+	// 拒绝明文库中已收录的密码（本服务即可直接解密），环境变量 PASSWORD_CHECK_PLAINTEXTS，默认true
+	CheckPlaintexts bool `yaml:"check_plaintexts"`
+}
+
+// 注册方式
+const (
+	// RegistrationOpen 任何人都可以注册
+	RegistrationOpen = "open"
+	// RegistrationInvite 注册时需要提供管理员创建的邀请码
+	RegistrationInvite = "invite"
+	// RegistrationApproval 注册后需要管理员审核通过才能登录
+	RegistrationApproval = "approval"
+	// RegistrationClosed 关闭注册，只能由管理员创建用户
+	RegistrationClosed = "closed"
+)
+
+// RegistrationConfig 用户注册配置
+type RegistrationConfig struct {
+	// 注册方式（open/invite/approval/closed），环境变量 REGISTRATION_MODE，默认open
+	Mode string `yaml:"mode"`
+}
+
+// RateLimitConfig 明文查询和加密接口的限流配置
+// 使用令牌桶算法，按API密钥、登录用户或来源IP分别计数，匿名用户、登录用户和管理员使用不同的限制
+type RateLimitConfig struct {
+	// 环境变量 RATE_LIMIT_ENABLED，默认true
+	Enabled bool `yaml:"enabled"`
+	// 匿名用户（按IP计数），环境变量 RATE_LIMIT_ANONYMOUS 设置每分钟请求数，默认30，突发10
+	Anonymous RateLimitTier `yaml:"anonymous"`
+	// 登录用户（按用户或API密钥计数），环境变量 RATE_LIMIT_USER，默认300，突发50
+	User RateLimitTier `yaml:"user"`
+	// 管理员，环境变量 RATE_LIMIT_ADMIN，默认1200，突发200
+	Admin RateLimitTier `yaml:"admin"`
+}
+
+// RateLimitTier 令牌桶参数
+type RateLimitTier struct {
+	// 每分钟允许的请求数，为0时不限制
+	PerMinute int `yaml:"per_minute"`
+	// 允许的突发请求数（令牌桶容量）
+	Burst int `yaml:"burst"`
+}
+
+// PrivacyConfig 用户提交的明文的保存策略
+// 用户可以在请求中或个人设置中开启隐私模式，隐私模式下加密的明文不写入明文库，历史记录只保存哈希
+type PrivacyConfig struct {
+	// 历史记录中明文的保留时间，超过后清除明文只保留哈希，为0时永久保留，环境变量 HISTORY_PLAINTEXT_RETENTION，默认0
+	HistoryPlaintextRetention time.Duration `yaml:"history_plaintext_retention"`
+}
+
+// MetricsConfig 监控指标配置
+// /healthz 和 /readyz 不需要认证，/metrics 以 Prometheus 文本格式输出指标
+type MetricsConfig struct {
+	// 访问 /metrics 需要的令牌，以 Authorization: Bearer <token> 传递，为空时不需要认证，环境变量 METRICS_TOKEN
+	Token string `yaml:"token"`
+}
+
+// AdminConfig 默认管理员账户配置，仅在数据库中不存在管理员时用于创建账户
+type AdminConfig struct {
+	// 环境变量 ADMIN_USERNAME
+	Username string `yaml:"username"`
+	// 环境变量 ADMIN_PASSWORD
+	Password string `yaml:"password"`
+}
+
+// UploadConfig 文件导入配置
+type UploadConfig struct {
+	// 每个事务写入的记录数，环境变量 UPLOAD_BATCH_SIZE，默认1000
+	BatchSize int `yaml:"batch_size"`
+	// 并发写入的协程数，环境变量 UPLOAD_MAX_WORKERS，默认5
+	MaxWorkers int `yaml:"max_workers"`
+	// 每个工作协程处理的记录数，环境变量 UPLOAD_CHUNK_SIZE，默认10000
+	ChunkSize int `yaml:"chunk_size"`
+}
+
+// DigestFilterConfig 明文库摘要过滤器配置
+type DigestFilterConfig struct {
+	// 快照文件路径，为空时不保存快照，环境变量 DIGEST_FILTER_SNAPSHOT
+	Snapshot string `yaml:"snapshot"`
+}
+
+// ClientConfig 命令行客户端配置
+// 设置 Server 后命令行子命令通过HTTP API访问远程服务，否则直接访问本地配置的存储
+type ClientConfig struct {
+	// 远程服务地址，如 https://zmd5.example.com，环境变量 ZMD5_SERVER
+	Server string `yaml:"server"`
+	// 访问令牌，环境变量 ZMD5_TOKEN
+	// 登录令牌有效期较短，长期使用的脚本应使用API密钥
+	Token string `yaml:"token"`
+}
+
+// IsRemote 是否作为远程服务的客户端运行
+func (c ClientConfig) IsRemote() bool {
+	return c.Server != ""
+}
+
+// Default 返回默认配置
+func Default() *Config {
+	return &Config{
+		Env: EnvProduction,
+		Server: ServerConfig{
+			Port:            9700,
+			CORSOrigin:      "http://localhost:5173",
+			ShutdownTimeout: 30 * time.Second,
+		},
+		Database: DatabaseConfig{
+			Driver:      "postgres",
+			AutoMigrate: true,
+		},
+		JWT: JWTConfig{
+			Secret:            DefaultJWTSecret,
+			Expiration:        15 * time.Minute,
+			RefreshExpiration: 30 * 24 * time.Hour,
+		},
+		Login: LoginConfig{
+			BackoffAfter:    3,
+			LockoutAfter:    10,
+			LockoutDuration: 15 * time.Minute,
+			IPLockoutAfter:  50,
+		},
+		Password: PasswordConfig{
+			MinLength:       8,
+			CheckPlaintexts: true,
+		},
+		Registration: RegistrationConfig{
+			Mode: RegistrationOpen,
+		},
+		RateLimit: RateLimitConfig{
+			Enabled:   true,
+			Anonymous: RateLimitTier{PerMinute: 30, Burst: 10},
+			User:      RateLimitTier{PerMinute: 300, Burst: 50},
+			Admin:     RateLimitTier{PerMinute: 1200, Burst: 200},
+		},
+		Admin: AdminConfig{
+			Username: DefaultAdminUsername,
+		},
+		Upload: UploadConfig{
+			BatchSize:  1000,
+			MaxWorkers: 5,
+			ChunkSize:  10000,
+		},
+	}
+}
+
+// Load 按默认值、配置文件、环境变量、命令行参数的顺序加载配置并校验，返回配置和未解析的命令行参数（子命令）
+// 配置文件路径由 -config 参数或环境变量 ZMD5_CONFIG 指定，未指定时读取当前目录下存在的 config.yaml
+func Load(args []string) (*Config, []string, error) {
+	cfg := Default()
+
+	fs := flag.NewFlagSet("zmd5", flag.ContinueOnError)
+	configFile := fs.String("config", "", "配置文件路径（默认读取 config.yaml）")
+	env := fs.String("env", "", "运行环境: development/production")
+	offline := fs.Bool("offline", false, "离线模式：使用嵌入式SQLite存储并只监听本机地址")
+	port := fs.Int("port", 0, "监听端口")
+	driver := fs.String("db-driver", "", "存储后端: postgres/sqlite")
+	dsn := fs.String("db-dsn", "", "数据库连接串")
+	server := fs.String("server", "", "远程服务地址，设置后命令行子命令通过HTTP API执行")
+	token := fs.String("token", "", "访问远程服务的令牌")
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	// 配置文件
+	path := *configFile
+	if path == "" {
+		path = os.Getenv("ZMD5_CONFIG")
+	}
+	explicit := path != ""
+	if path == "" {
+		path = DefaultConfigFile
+	}
+	if err := cfg.loadFile(path); err != nil {
+		if explicit || !errors.Is(err, os.ErrNotExist) {
+			return nil, nil, err
+		}
+	}
+
+	// 环境变量
+	if err := cfg.loadEnv(); err != nil {
+		return nil, nil, err
+	}
+
+	// 命令行参数
+	if *env != "" {
+		cfg.Env = *env
+	}
+	if *offline {
+		cfg.Offline = true
+	}
+	if *port != 0 {
+		cfg.Server.Port = *port
+	}
+	if *driver != "" {
+		cfg.Database.Driver = *driver
+	}
+	if *dsn != "" {
+		cfg.Database.DSN = *dsn
+	}
+	if *server != "" {
+		cfg.Client.Server = *server
+	}
+	if *token != "" {
+		cfg.Client.Token = *token
+	}
+
+	// 离线模式固定使用嵌入式存储，未指定连接串时使用默认的数据库文件
+	if cfg.Offline {
+		if cfg.Database.Driver != "sqlite" {
+			cfg.Database.Driver = "sqlite"
+			cfg.Database.DSN = *dsn
+		}
+		if cfg.Server.Host == "" {
+			cfg.Server.Host = "127.0.0.1"
+		}
+	}
+
+	if cfg.Database.DSN == "" {
+		if cfg.Database.Driver == "sqlite" {
+			cfg.Database.DSN = DefaultSQLiteDSN
+		} else {
+			cfg.Database.DSN = DefaultPostgresDSN
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return cfg, fs.Args(), nil
+}
+
+// loadFile 读取YAML配置文件，文件中未出现的字段保持原值
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := yaml.Unmarshal(data, c); err != nil {
+		return fmt.Errorf("解析配置文件%s失败: %v", path, err)
+	}
+	return nil
+}
+
+// loadEnv 读取环境变量
+func (c *Config) loadEnv() error {
+	setString(&c.Env, "APP_ENV")
+	setString(&c.Server.Host, "HOST")
+	setString(&c.Server.CORSOrigin, "CORS_ORIGIN")
+	setString(&c.Server.ProxyHeader, "PROXY_HEADER")
+	setString(&c.Metrics.Token, "METRICS_TOKEN")
+	setString(&c.Database.Driver, "DB_DRIVER")
+	setString(&c.Database.DSN, "DB_DSN")
+	setString(&c.JWT.Secret, "JWT_SECRET")
+	setString(&c.Admin.Username, "ADMIN_USERNAME")
+	setString(&c.Admin.Password, "ADMIN_PASSWORD")
+	setString(&c.Registration.Mode, "REGISTRATION_MODE")
+	setString(&c.DigestFilter.Snapshot, "DIGEST_FILTER_SNAPSHOT")
+	setString(&c.Client.Server, "ZMD5_SERVER")
+	setString(&c.Client.Token, "ZMD5_TOKEN")
+
+	for name, target := range map[string]*int{
+		"PORT":                   &c.Server.Port,
+		"UPLOAD_BATCH_SIZE":      &c.Upload.BatchSize,
+		"UPLOAD_MAX_WORKERS":     &c.Upload.MaxWorkers,
+		"UPLOAD_CHUNK_SIZE":      &c.Upload.ChunkSize,
+		"LOGIN_BACKOFF_AFTER":    &c.Login.BackoffAfter,
+		"LOGIN_LOCKOUT_AFTER":    &c.Login.LockoutAfter,
+		"LOGIN_IP_LOCKOUT_AFTER": &c.Login.IPLockoutAfter,
+		"PASSWORD_MIN_LENGTH":    &c.Password.MinLength,
+		"RATE_LIMIT_ANONYMOUS":   &c.RateLimit.Anonymous.PerMinute,
+		"RATE_LIMIT_USER":        &c.RateLimit.User.PerMinute,
+		"RATE_LIMIT_ADMIN":       &c.RateLimit.Admin.PerMinute,
+	} {
+		if value := os.Getenv(name); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("环境变量%s不是有效的整数: %s", name, value)
+			}
+			*target = n
+		}
+	}
+
+	if value := os.Getenv("ZMD5_OFFLINE"); value != "" {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("环境变量ZMD5_OFFLINE不是有效的布尔值: %s", value)
+		}
+		c.Offline = b
+	}
+
+	if value := os.Getenv("PASSWORD_CHECK_PLAINTEXTS"); value != "" {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("环境变量PASSWORD_CHECK_PLAINTEXTS不是有效的布尔值: %s", value)
+		}
+		c.Password.CheckPlaintexts = b
+	}
+
+	if value := os.Getenv("RATE_LIMIT_ENABLED"); value != "" {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("环境变量RATE_LIMIT_ENABLED不是有效的布尔值: %s", value)
+		}
+		c.RateLimit.Enabled = b
+	}
+
+	if value := os.Getenv("DB_AUTO_MIGRATE"); value != "" {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("环境变量DB_AUTO_MIGRATE不是有效的布尔值: %s", value)
+		}
+		c.Database.AutoMigrate = b
+	}
+
+	if value := os.Getenv("JWT_EXPIRATION"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("环境变量JWT_EXPIRATION不是有效的时长: %s", value)
+		}
+		c.JWT.Expiration = d
+	}
+	if value := os.Getenv("JWT_REFRESH_EXPIRATION"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("环境变量JWT_REFRESH_EXPIRATION不是有效的时长: %s", value)
+		}
+		c.JWT.RefreshExpiration = d
+	}
+	if value := os.Getenv("TRUSTED_PROXIES"); value != "" {
+		c.Server.TrustedProxies = nil
+		for _, proxy := range strings.Split(value, ",") {
+			if proxy = strings.TrimSpace(proxy); proxy != "" {
+				c.Server.TrustedProxies = append(c.Server.TrustedProxies, proxy)
+			}
+		}
+	}
+	if value := os.Getenv("SHUTDOWN_TIMEOUT"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("环境变量SHUTDOWN_TIMEOUT不是有效的时长: %s", value)
+		}
+		c.Server.ShutdownTimeout = d
+	}
+	if value := os.Getenv("HISTORY_PLAINTEXT_RETENTION"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("环境变量HISTORY_PLAINTEXT_RETENTION不是有效的时长: %s", value)
+		}
+		c.Privacy.HistoryPlaintextRetention = d
+	}
+	if value := os.Getenv("LOGIN_LOCKOUT_DURATION"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("环境变量LOGIN_LOCKOUT_DURATION不是有效的时长: %s", value)
+		}
+		c.Login.LockoutDuration = d
+	}
+	return nil
+}
+
+func setString(target *string, name string) {
+	if value := os.Getenv(name); value != "" {
+		*target = value
+	}
+}
+
+// Validate 校验配置取值
+func (c *Config) Validate() error {
+	var problems []string
+	if c.Env != EnvDevelopment && c.Env != EnvProduction {
+		problems = append(problems, fmt.Sprintf("env 只能为 %s 或 %s", EnvDevelopment, EnvProduction))
+	}
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		problems = append(problems, "server.port 必须在1-65535之间")
+	}
+	if c.Database.Driver != "postgres" && c.Database.Driver != "sqlite" {
+		problems = append(problems, "database.driver 只能为 postgres 或 sqlite")
+	}
+	if c.JWT.Secret == "" {
+		problems = append(problems, "jwt.secret 不能为空")
+	}
+	if c.JWT.Expiration <= 0 {
+		problems = append(problems, "jwt.expiration 必须大于0")
+	}
+	if c.JWT.RefreshExpiration < c.JWT.Expiration {
+		problems = append(problems, "jwt.refresh_expiration 不能小于 jwt.expiration")
+	}
+	if c.Login.BackoffAfter <= 0 || c.Login.LockoutAfter < c.Login.BackoffAfter || c.Login.IPLockoutAfter < c.Login.LockoutAfter {
+		problems = append(problems, "login.backoff_after 必须大于0，且不能大于 login.lockout_after，login.ip_lockout_after 不能小于 login.lockout_after")
+	}
+	if c.Login.LockoutDuration <= 0 {
+		problems = append(problems, "login.lockout_duration 必须大于0")
+	}
+	// bcrypt 只使用密码的前72个字节
+	if c.Password.MinLength < 1 || c.Password.MinLength > 72 {
+		problems = append(problems, "password.min_length 必须在1-72之间")
+	}
+	switch c.Registration.Mode {
+	case RegistrationOpen, RegistrationInvite, RegistrationApproval, RegistrationClosed:
+	default:
+		problems = append(problems, "registration.mode 只能为 open、invite、approval 或 closed")
+	}
+	for _, tier := range []struct {
+		name string
+		RateLimitTier
+	}{
+		{"anonymous", c.RateLimit.Anonymous},
+		{"user", c.RateLimit.User},
+		{"admin", c.RateLimit.Admin},
+	} {
+		if tier.PerMinute < 0 || (tier.PerMinute > 0 && tier.Burst <= 0) {
+			problems = append(problems, fmt.Sprintf("rate_limit.%s.per_minute 不能小于0，限流时 rate_limit.%s.burst 必须大于0", tier.name, tier.name))
+		}
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		problems = append(problems, "server.shutdown_timeout 必须大于0")
+	}
+	// 不限制来源时任何客户端都可以通过该请求头伪造地址
+	if c.Server.ProxyHeader != "" && len(c.Server.TrustedProxies) == 0 {
+		problems = append(problems, "设置 server.proxy_header 时必须设置 server.trusted_proxies")
+	}
+	for _, proxy := range c.Server.TrustedProxies {
+		if net.ParseIP(proxy) == nil {
+			if _, _, err := net.ParseCIDR(proxy); err != nil {
+				problems = append(problems, fmt.Sprintf("server.trusted_proxies 中的 %s 不是有效的IP地址或网段", proxy))
+			}
+		}
+	}
+	if c.Privacy.HistoryPlaintextRetention < 0 {
+		problems = append(problems, "privacy.history_plaintext_retention 不能小于0")
+	}
+	if c.Admin.Username == "" {
+		problems = append(problems, "admin.username 不能为空")
+	}
+	if c.Upload.BatchSize <= 0 || c.Upload.MaxWorkers <= 0 || c.Upload.ChunkSize <= 0 {
+		problems = append(problems, "upload.batch_size、upload.max_workers 和 upload.chunk_size 必须大于0")
+	} else if c.Upload.ChunkSize < c.Upload.BatchSize {
+		problems = append(problems, "upload.chunk_size 不能小于 upload.batch_size")
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("配置无效: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// IsProduction 是否为生产环境
+func (c *Config) IsProduction() bool {
+	return c.Env == EnvProduction
+}
+
+// CheckProductionSecrets 生产环境下检查JWT密钥、管理员密码和数据库密码
+// 不允许为空、使用默认值或示例配置中的占位值，且长度不能小于最小长度
+func (c *Config) CheckProductionSecrets() error {
+	if !c.IsProduction() {
+		return nil
+	}
+
+	var problems []string
+	if problem := checkSecret(c.JWT.Secret, MinJWTSecretLength); problem != "" {
+		problems = append(problems, "jwt.secret（JWT_SECRET）"+problem)
+	}
+	if problem := checkSecret(c.Admin.Password, MinPasswordLength); problem != "" {
+		problems = append(problems, "admin.password（ADMIN_PASSWORD）"+problem)
+	}
+	if c.Database.Driver == "postgres" {
+		// 连接串中未设置密码时使用 PGPASSWORD 环境变量或密码文件中的密码
+		if pgConfig, err := pgconn.ParseConfig(c.Database.DSN); err != nil {
+			problems = append(problems, fmt.Sprintf("database.dsn（DB_DSN）无法解析: %v", err))
+		} else if problem := checkSecret(pgConfig.Password, MinPasswordLength); problem != "" {
+			problems = append(problems, "数据库密码（database.dsn、DB_DSN 或 PGPASSWORD）"+problem)
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("生产环境的密钥配置不安全: %s，请修改后再启动，或设置 APP_ENV=development", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// checkSecret 检查密钥是否可以在生产环境使用，不可以时返回原因
+func checkSecret(secret string, minLength int) string {
+	if secret == "" {
+		return "不能为空"
+	}
+	if secret == DefaultJWTSecret || slices.Contains(placeholderSecrets, strings.ToLower(secret)) {
+		return "不能使用默认值或示例值"
+	}
+	if utf8.RuneCountInString(secret) < minLength {
+		return fmt.Sprintf("长度至少为%d个字符", minLength)
+	}
+	return ""
+}
@@ -0,0 +1,64 @@
+package dbModel
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// APIKey 用户创建的长期API密钥，用于脚本和CI等无法保存密码的场景
+// 只保存密钥的SHA-256摘要，完整密钥仅在创建时返回一次
+type APIKey struct {
+	gorm.Model
+	UserID uint `json:"user_id" gorm:"index"`
+	// 密钥名称，便于用户区分用途
+	Name string `json:"name" gorm:"type:varchar(64)"`
+	// 密钥前缀，用于展示和识别，不足以还原密钥
+	Prefix string `json:"prefix" gorm:"type:varchar(16)"`
+	// 完整密钥的SHA-256摘要（十六进制）
+	KeyHash string `json:"-" gorm:"type:varchar(64);uniqueIndex"`
+	// 授权范围，多个用逗号分隔
+	Scopes     string     `json:"scopes" gorm:"type:varchar(255)"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	// 过期时间，为空表示不过期
+	ExpiresAt *time.Time `json:"expires_at"`
+	// 撤销时间，撤销后密钥立即失效，记录保留用于查看
+	RevokedAt *time.Time `json:"revoked_at"`
+}
+
+// API密钥授权范围
+const (
+	ScopeLookup      = "lookup"       // 查询和提交明文（/api/md5）
+	ScopeSubmitTask  = "submit-task"  // 提交和查询彩虹表解密任务（/api/rainbow）
+	ScopeAdminImport = "admin:import" // 管理员导入明文（上传文件、批量添加、查询导入任务），仅管理员可创建
+)
+
+// APIKeyScopes 所有可用的授权范围
+var APIKeyScopes = []string{ScopeLookup, ScopeSubmitTask, ScopeAdminImport}
+
+// ScopeList 返回授权范围列表
+func (k *APIKey) ScopeList() []string {
+	if k.Scopes == "" {
+		return nil
+	}
+	return strings.Split(k.Scopes, ",")
+}
+
+// HasScope 检查密钥是否拥有指定的授权范围
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.ScopeList() {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Active 检查密钥在指定时间是否有效（未撤销且未过期）
+func (k *APIKey) Active(now time.Time) bool {
+	if k.RevokedAt != nil {
+		return false
+	}
+	return k.ExpiresAt == nil || now.Before(*k.ExpiresAt)
+}
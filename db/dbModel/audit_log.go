@@ -0,0 +1,26 @@
+package dbModel
+
+import "time"
+
+// AuditLog 审计日志，记录管理操作和登录相关操作，只追加不修改
+type AuditLog struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+	// 操作者，未登录的请求（如登录、注册）为0，用户名取自请求参数
+	ActorID   uint   `json:"actor_id" gorm:"index"`
+	ActorName string `json:"actor_name" gorm:"type:varchar(64)"`
+	// 通过API密钥操作时为密钥ID
+	APIKeyID uint `json:"api_key_id"`
+	// 操作名称，如 md5.delete、user.disable、auth.login
+	Action string `json:"action" gorm:"type:varchar(64);index"`
+	// 操作对象，由路径参数组成，如 id=12
+	Target string `json:"target" gorm:"type:varchar(255)"`
+	// 请求参数（JSON），密码、验证码和令牌等字段已隐藏
+	Params string `json:"params" gorm:"type:text"`
+	IP     string `json:"ip" gorm:"type:varchar(64)"`
+	// 响应状态码
+	Status  int  `json:"status"`
+	Success bool `json:"success"`
+	// 响应中的提示信息
+	Message string `json:"message" gorm:"type:varchar(255)"`
+}
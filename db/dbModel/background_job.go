@@ -0,0 +1,32 @@
+package dbModel
+
+import "gorm.io/gorm"
+
+// BackgroundJob 记录一个后台任务（如导入回滚、批量删除）的执行状态
+type BackgroundJob struct {
+	gorm.Model
+	// 任务类型
+	Kind string `json:"kind" gorm:"type:varchar(32);index"`
+	// 发起任务的用户ID
+	UserID uint `json:"user_id" gorm:"index"`
+	// 任务参数（JSON）
+	Params string `json:"params" gorm:"type:text"`
+	// 任务状态（1:运行中, 2:已完成, 3:失败, 4:已取消）
+	Status int `json:"status" gorm:"type:int;default:1"`
+	// 需要处理的总数量
+	Total int64 `json:"total" gorm:"default:0"`
+	// 已处理数量
+	Processed int64 `json:"processed" gorm:"default:0"`
+	// 任务结果（JSON）
+	Result string `json:"result" gorm:"type:text"`
+	// 失败原因
+	Error string `json:"error" gorm:"type:text"`
+}
+
+// 后台任务状态常量
+const (
+	JobRunning   = 1 // 运行中
+	JobCompleted = 2 // 已完成
+	JobFailed    = 3 // 失败
+	JobCancelled = 4 // 已取消
+)
@@ -0,0 +1,34 @@
+package dbModel
+
+import "gorm.io/gorm"
+
+// ImportJob 记录一次文件上传导入任务
+type ImportJob struct {
+	gorm.Model
+	// 上传者用户ID
+	UserID uint `json:"user_id" gorm:"index"`
+	// 原始文件名
+	Filename string `json:"filename" gorm:"type:varchar(255)"`
+	// 使用的明文编码，多个编码用逗号分隔
+	Encodings string `json:"encodings" gorm:"type:varchar(64)"`
+	// 任务状态（1:处理中, 2:已完成, 3:失败, 4:回滚中, 5:已回滚）
+	Status int `json:"status" gorm:"type:int;default:1"`
+	// 已读取的明文数量
+	Processed int64 `json:"processed" gorm:"default:0"`
+	// 新增的记录数量
+	Added int64 `json:"added" gorm:"default:0"`
+	// 失败原因
+	Error string `json:"error" gorm:"type:text"`
+	// 服务关闭时保存的检查点：上传的临时文件和已处理的行数，重启后从下一行继续导入
+	FilePath   string `json:"-" gorm:"type:varchar(512)"`
+	ResumeLine int64  `json:"-" gorm:"not null;default:0"`
+}
+
+// 导入任务状态常量
+const (
+	ImportProcessing  = 1 // 处理中
+	ImportCompleted   = 2 // 已完成
+	ImportFailed      = 3 // 失败
+	ImportRollingBack = 4 // 回滚中
+	ImportRolledBack  = 5 // 已回滚
+)
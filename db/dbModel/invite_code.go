@@ -0,0 +1,27 @@
+package dbModel
+
+import "time"
+
+// InviteCode 注册邀请码，注册方式为 invite 时注册需要提供，只保存摘要
+type InviteCode struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"created_at"`
+	// 创建邀请码的管理员
+	CreatedBy uint `json:"created_by"`
+	// 邀请码前几位，用于在列表中识别邀请码
+	Prefix   string `json:"prefix" gorm:"type:varchar(16)"`
+	CodeHash string `json:"-" gorm:"type:varchar(64);uniqueIndex"`
+	// 使用该邀请码注册的用户的角色
+	Role    string `json:"role" gorm:"type:varchar(32)"`
+	MaxUses int    `json:"max_uses" gorm:"not null;default:1"`
+	Uses    int    `json:"uses" gorm:"not null;default:0"`
+	// 为空表示不过期
+	ExpiresAt *time.Time `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+	Note      string     `json:"note" gorm:"type:varchar(255)"`
+}
+
+// Usable 邀请码在指定时间是否可以使用（未撤销、未过期且未用完）
+func (i *InviteCode) Usable(now time.Time) bool {
+	return i.RevokedAt == nil && (i.ExpiresAt == nil || now.Before(*i.ExpiresAt)) && i.Uses < i.MaxUses
+}
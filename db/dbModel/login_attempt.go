@@ -0,0 +1,31 @@
+package dbModel
+
+import "time"
+
+// 登录尝试结果
+const (
+	LoginSucceeded       = "success"          // 登录成功
+	LoginBadCredentials  = "bad_credentials"  // 用户名或密码错误
+	LoginThrottled       = "throttled"        // 失败次数过多，被拒绝尝试
+	LoginDisabled        = "disabled"         // 账户已禁用
+	LoginLocked          = "locked"           // 账户已锁定
+	LoginPendingApproval = "pending_approval" // 账户等待管理员审核
+	LoginResetRequired   = "reset_required"   // 需要先修改密码
+	LoginTwoFactor       = "2fa_required"     // 密码正确，等待两步验证
+	LoginBadTwoFactor    = "bad_2fa_code"     // 两步验证码错误
+)
+
+// LoginAttempt 登录尝试审计记录，只追加不修改
+type LoginAttempt struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+	// 请求中的用户名，用户不存在时也会记录
+	Username string `json:"username" gorm:"type:varchar(64);index"`
+	// 用户存在时为用户ID，否则为0
+	UserID    uint   `json:"user_id"`
+	IP        string `json:"ip" gorm:"type:varchar(64);index"`
+	UserAgent string `json:"user_agent" gorm:"type:varchar(255)"`
+	Success   bool   `json:"success"`
+	// 结果，见 Login* 常量
+	Result string `json:"result" gorm:"type:varchar(32)"`
+}
@@ -1,15 +1,99 @@
 package dbModel
 
-import "gorm.io/gorm"
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type Md5 struct {
 	gorm.Model
 	// 明文
 	Plaintext string `json:"plaintext"`
-	// 32位md5
-	MD5 string `json:"md5" gorm:"index"`
-	// 16位md5
-	MD5_16 string `json:"md5_16"`
+	// 明文的SHA-256摘要，与编码一起建立唯一索引（见 db.Md5UniqueIndexesVersion 迁移）
+	PlaintextDigest string `json:"-" gorm:"type:varchar(64)"`
+	// 32位md5（十六进制），由Digest计算得到，不单独存储
+	MD5 string `json:"md5" gorm:"-"`
+	// 16位md5（十六进制），由Digest计算得到，不单独存储
+	MD5_16 string `json:"md5_16" gorm:"-"`
+	// 16字节二进制MD5摘要，唯一索引由 db.Md5UniqueIndexesVersion 迁移创建
+	Digest []byte `json:"-"`
+	// 摘要的中间8字节（即16位md5），用于16位哈希的索引查询
+	Digest16 []byte `json:"-" gorm:"index"`
+	// 计算哈希时明文使用的编码（utf8/gbk/utf16le）
+	Encoding string `json:"encoding" gorm:"type:varchar(16);default:utf8"`
+	// 来源信息，首次写入时间即CreatedAt
+	Provenance `gorm:"embedded"`
+	// 产生该记录的来源次数，大于1表示被其他来源重复提交过，导入回滚时不会删除
+	SourceCount int `json:"source_count" gorm:"default:1"`
+	// 命中次数
+	HitCount int64 `json:"hit_count" gorm:"default:0"`
+	// 最后命中时间
+	LastHitAt *time.Time `json:"last_hit_at"`
+}
+
+// BeforeCreate 写入前计算明文摘要，并将十六进制MD5转换为二进制摘要
+func (m *Md5) BeforeCreate(tx *gorm.DB) error {
+	if m.PlaintextDigest == "" {
+		m.PlaintextDigest = PlaintextDigest(m.Plaintext)
+	}
+	if len(m.Digest) == 0 {
+		digest, err := hex.DecodeString(m.MD5)
+		if err != nil || len(digest) != 16 {
+			return fmt.Errorf("无效的32位MD5: %s", m.MD5)
+		}
+		m.Digest = digest
+	}
+	m.Digest16 = m.Digest[4:12]
+	return nil
+}
+
+// AfterFind 查询后根据二进制摘要填充十六进制MD5
+func (m *Md5) AfterFind(tx *gorm.DB) error {
+	if len(m.Digest) == 16 {
+		m.MD5 = hex.EncodeToString(m.Digest)
+		m.MD5_16 = m.MD5[8:24]
+	}
+	return nil
+}
+
+// PlaintextDigest 计算明文的SHA-256摘要（十六进制）
+func PlaintextDigest(plaintext string) string {
+	sum := sha256.Sum256([]byte(plaintext))
+	return hex.EncodeToString(sum[:])
+}
+
+// 明文来源类型常量
+const (
+	SourceUserEncrypt = "user_encrypt" // 用户加密时提交
+	SourceAdminBatch  = "admin_batch"  // 管理员批量添加
+	SourceUpload      = "upload"       // 管理员文件上传导入
+	SourceRainbow     = "rainbow"      // 彩虹表破解成功
+)
+
+// Provenance 明文来源信息
+type Provenance struct {
+	// 来源类型
+	Source string `json:"source" gorm:"type:varchar(32);index"`
+	// 提交者用户ID（匿名用户为0）
+	UserID uint `json:"user_id" gorm:"index"`
+	// 导入任务ID（文件上传时有效）
+	ImportJobID uint `json:"import_job_id" gorm:"index"`
+	// 原始文件名（文件上传时有效）
+	Filename string `json:"filename" gorm:"type:varchar(255)"`
+}
+
+// Md5Writer 写入明文库的进程及其写入次数
+// 每次写入明文库的事务中累加所在进程的计数，服务据此判断摘要过滤器是否包含其他进程写入的记录
+type Md5Writer struct {
+	// 进程启动时随机生成的标识
+	Writer string `gorm:"primaryKey;type:varchar(32)"`
+	// 写入次数
+	Generation int64
+	UpdatedAt  time.Time
 }
 
 // MD5Record 存储MD5加密记录
@@ -44,6 +128,10 @@ type TaskProgressRecord struct {
 	TotalTables       int  `json:"total_tables"`                // 总彩虹表数量
 	ChainsSearched    int  `json:"chains_searched"`             // 已搜索的链数量
 	ReductionAttempts int  `json:"reduction_attempts"`          // 规约函数应用次数
+	// 服务关闭时保存的检查点：正在遍历的彩虹链ID、链中的位置和该位置的哈希，重启后从这里继续
+	ChainID       uint   `json:"chain_id" gorm:"not null;default:0"`
+	ChainPosition int    `json:"chain_position" gorm:"not null;default:0"`
+	CurrentHash   string `json:"current_hash" gorm:"type:varchar(32)"`
 }
 
 // RainbowTable 优化的彩虹表结构
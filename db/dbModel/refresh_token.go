@@ -0,0 +1,29 @@
+package dbModel
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RefreshToken 服务端保存的刷新令牌，每次刷新都会撤销旧令牌并签发新令牌（轮换）
+// 同一次登录产生的刷新令牌属于同一个会话（FamilyID），已撤销的令牌被再次使用时视为泄露，整个会话失效
+type RefreshToken struct {
+	gorm.Model
+	UserID uint `json:"user_id" gorm:"index"`
+	// 登录会话ID，同时写入访问令牌的 sid 声明
+	FamilyID string `json:"family_id" gorm:"type:varchar(32);index"`
+	// 刷新令牌的SHA-256摘要（十六进制）
+	TokenHash string    `json:"-" gorm:"type:varchar(64);uniqueIndex"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"index"`
+	// 撤销时间，刷新后或退出登录时设置
+	RevokedAt *time.Time `json:"revoked_at"`
+	// 登录时的客户端信息，便于用户识别会话
+	UserAgent string `json:"user_agent" gorm:"type:varchar(255)"`
+	IP        string `json:"ip" gorm:"type:varchar(64)"`
+}
+
+// Active 刷新令牌在指定时间是否可用
+func (t *RefreshToken) Active(now time.Time) bool {
+	return t.RevokedAt == nil && now.Before(t.ExpiresAt)
+}
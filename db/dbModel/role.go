@@ -0,0 +1,12 @@
+package dbModel
+
+import "time"
+
+// RolePermission 角色拥有的一项管理权限
+// 管理员角色始终拥有全部权限，不在表中保存；自定义角色以表中存在的记录为准
+type RolePermission struct {
+	ID         uint      `json:"id" gorm:"primarykey"`
+	Role       string    `json:"role" gorm:"type:varchar(32);uniqueIndex:idx_role_permissions_role_permission"`
+	Permission string    `json:"permission" gorm:"type:varchar(64);uniqueIndex:idx_role_permissions_role_permission"`
+	CreatedAt  time.Time `json:"created_at"`
+}
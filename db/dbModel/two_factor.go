@@ -0,0 +1,20 @@
+package dbModel
+
+import "time"
+
+// RecoveryCode 两步验证恢复码，每个恢复码只能使用一次，只保存摘要
+type RecoveryCode struct {
+	ID        uint       `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time  `json:"created_at"`
+	UserID    uint       `json:"user_id" gorm:"index"`
+	CodeHash  string     `json:"-" gorm:"type:varchar(64)"`
+	UsedAt    *time.Time `json:"used_at"`
+}
+
+// RoleSetting 角色的安全设置，没有记录的角色使用默认设置
+type RoleSetting struct {
+	Role string `json:"role" gorm:"type:varchar(32);primaryKey"`
+	// 该角色的用户必须开启两步验证才能登录
+	RequireTwoFactor bool      `json:"require_two_factor" gorm:"not null;default:false"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
@@ -1,11 +1,44 @@
 package dbModel
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type User struct {
 	gorm.Model
 	Username string `gorm:"unique"`
 	Password string `json:"-"`
 	Role     string `gorm:"default:user"`
-	Token    string
+	// 已废弃：不再保存登录令牌，保留列以兼容旧数据
+	Token string `json:"-"`
+	// 令牌版本，退出所有会话时递增，签发时版本不同的访问令牌全部失效
+	TokenVersion int `json:"-" gorm:"not null;default:0"`
+	// 账户被管理员禁用，禁用后不能登录，已登录的会话立即失效
+	Disabled bool `gorm:"not null;default:false"`
+	// 账户锁定截止时间，为空或已过期表示未锁定
+	LockedUntil *time.Time
+	// 下次登录前必须修改密码（管理员重置密码后设置）
+	MustResetPassword bool `gorm:"not null;default:false"`
+	LastLoginAt       *time.Time
+	// 注册方式为 approval 时注册的账户，管理员审核通过前不能登录
+	PendingApproval bool `gorm:"not null;default:false"`
+	// 隐私模式：加密的明文不写入明文库，历史记录只保存哈希
+	PrivateMode bool `gorm:"not null;default:false"`
+	// 两步验证（TOTP）密钥，Base32编码；设置过程中已生成但尚未验证时 TOTPEnabled 为 false
+	TOTPSecret  string `json:"-" gorm:"type:varchar(64)"`
+	TOTPEnabled bool   `gorm:"not null;default:false"`
+	// 最近一次使用的验证码时间步，同一验证码不能重复使用
+	TOTPLastStep int64 `json:"-" gorm:"not null;default:0"`
+}
+
+// Locked 账户在指定时间是否处于锁定状态
+func (u *User) Locked(now time.Time) bool {
+	return u.LockedUntil != nil && now.Before(*u.LockedUntil)
+}
+
+// Active 账户在指定时间是否可以使用（已审核、未禁用且未锁定）
+func (u *User) Active(now time.Time) bool {
+	return !u.PendingApproval && !u.Disabled && !u.Locked(now)
 }
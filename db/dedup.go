@@ -0,0 +1,223 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+	"zmd5/db/dbModel"
+
+	"gorm.io/gorm"
+)
+
+// 明文库唯一索引名称
+const (
+	md5UniqueIndex       = "uidx_md5_digest"
+	plaintextUniqueIndex = "uidx_md5_plaintext_digest_encoding"
+)
+
+// Md5UniqueIndexesVersion 创建明文库唯一索引的迁移版本
+const Md5UniqueIndexesVersion = 12
+
+// 去重时每批次处理的主键范围
+const dedupBatchSize = 10000
+
+// ProgressReporter 用于长时间运行的数据库维护操作上报进度
+type ProgressReporter interface {
+	SetTotal(total int64)
+	Add(n int64)
+}
+
+// createMd5UniqueIndexes 创建明文库的唯一索引，已有数据存在重复时报错，需要先执行 `zmd5 dedup`
+func createMd5UniqueIndexes(tx *gorm.DB) error {
+	for _, check := range []struct {
+		name    string
+		columns string
+		notNull string
+	}{
+		{"MD5", "digest", "digest IS NOT NULL"},
+		{"明文", "plaintext_digest, encoding", "plaintext_digest IS NOT NULL"},
+	} {
+		var duplicates int64
+		// 唯一索引不约束NULL值，只统计非NULL的重复
+		if err := tx.Raw("SELECT COUNT(*) FROM (SELECT 1 FROM md5 WHERE " + check.notNull + " GROUP BY " + check.columns +
+			" HAVING COUNT(*) > 1) d").Scan(&duplicates).Error; err != nil {
+			return err
+		}
+		if duplicates > 0 {
+			return fmt.Errorf("明文库存在%d组重复的%s，请先执行 `zmd5 dedup` 清理重复数据", duplicates, check.name)
+		}
+	}
+
+	if err := tx.Exec("CREATE UNIQUE INDEX IF NOT EXISTS " + md5UniqueIndex + " ON md5 (digest)").Error; err != nil {
+		return fmt.Errorf("创建MD5唯一索引失败: %v", err)
+	}
+	if err := tx.Exec("CREATE UNIQUE INDEX IF NOT EXISTS " + plaintextUniqueIndex + " ON md5 (plaintext_digest, encoding)").Error; err != nil {
+		return fmt.Errorf("创建明文唯一索引失败: %v", err)
+	}
+
+	// 唯一索引已覆盖MD5查询，删除旧十六进制md5列上的索引
+	for _, index := range []string{"idx_md5_md5", "uidx_md5_md5"} {
+		if err := tx.Exec("DROP INDEX IF EXISTS " + index).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dropMd5UniqueIndexes 删除明文库的唯一索引
+func dropMd5UniqueIndexes(tx *gorm.DB) error {
+	for _, index := range []string{md5UniqueIndex, plaintextUniqueIndex} {
+		if err := tx.Exec("DROP INDEX IF EXISTS " + index).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DedupMd5 清理明文库中的重复数据，完成后由迁移创建唯一索引
+// 依次执行：清除软删除的记录、回填明文摘要（同时合并相同明文的记录）、按MD5去重、按明文+编码去重
+// 每组重复保留最早的一条，并将其余记录的来源次数、命中次数和来源信息合并到保留的记录
+func DedupMd5(ctx context.Context, progress ProgressReporter) error {
+	var bounds struct {
+		MinID uint
+		MaxID uint
+	}
+	if err := PG.Unscoped().Model(&dbModel.Md5{}).Select("COALESCE(MIN(id), 0) AS min_id, COALESCE(MAX(id), 0) AS max_id").
+		Scan(&bounds).Error; err != nil {
+		return err
+	}
+
+	// 四个步骤各遍历一次主键范围
+	steps := []struct {
+		name string
+		run  func(start, end uint) error
+	}{
+		{"清除软删除记录", purgeSoftDeleted},
+		{"回填明文摘要", backfillPlaintextDigest},
+		{"按MD5去重", func(start, end uint) error {
+			return mergeDuplicates(start, end, "b.digest = md5.digest")
+		}},
+		{"按明文去重", func(start, end uint) error {
+			return mergeDuplicates(start, end, "b.plaintext_digest = md5.plaintext_digest AND b.encoding = md5.encoding")
+		}},
+	}
+
+	batches := int64(0)
+	if bounds.MaxID >= bounds.MinID && bounds.MaxID > 0 {
+		batches = int64((bounds.MaxID-bounds.MinID)/dedupBatchSize + 1)
+	}
+	progress.SetTotal(batches * int64(len(steps)))
+
+	for _, step := range steps {
+		log.Printf("明文库去重: 开始%s", step.name)
+		for start := bounds.MinID; batches > 0 && start <= bounds.MaxID; start += dedupBatchSize {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := step.run(start, start+dedupBatchSize-1); err != nil {
+				return fmt.Errorf("%s失败: %v", step.name, err)
+			}
+			progress.Add(1)
+		}
+	}
+	return nil
+}
+
+// purgeSoftDeleted 物理删除已软删除的记录，避免其占用唯一索引
+func purgeSoftDeleted(start, end uint) error {
+	return PG.Exec("DELETE FROM md5 WHERE id BETWEEN ? AND ? AND deleted_at IS NOT NULL", start, end).Error
+}
+
+// backfillPlaintextDigest 为缺少摘要的记录计算明文摘要
+// 明文唯一索引可能已存在，已有相同明文和编码的记录时直接合并到该记录，避免回填时违反唯一约束
+func backfillPlaintextDigest(start, end uint) error {
+	var rows []duplicateRow
+	if err := PG.Raw("SELECT id, plaintext, encoding, source_count, hit_count, last_hit_at, source, user_id, import_job_id, filename "+
+		"FROM md5 WHERE id BETWEEN ? AND ? AND (plaintext_digest IS NULL OR plaintext_digest = '') ORDER BY id", start, end).
+		Scan(&rows).Error; err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+
+	return PG.Transaction(func(tx *gorm.DB) error {
+		for _, row := range rows {
+			digest := dbModel.PlaintextDigest(row.Plaintext)
+			var keepID uint
+			if err := tx.Raw("SELECT COALESCE(MIN(id), 0) FROM md5 WHERE plaintext_digest = ? AND encoding = ?", digest, row.Encoding).
+				Scan(&keepID).Error; err != nil {
+				return err
+			}
+			if keepID == 0 {
+				if err := tx.Model(&dbModel.Md5{}).Where("id = ?", row.ID).UpdateColumn("plaintext_digest", digest).Error; err != nil {
+					return err
+				}
+				continue
+			}
+			row.KeepID = keepID
+			if err := mergeRow(tx, row); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// duplicateRow 待合并的重复记录，KeepID 为同组中最早的记录
+type duplicateRow struct {
+	ID          uint
+	KeepID      uint
+	SourceCount int
+	HitCount    int64
+	LastHitAt   *time.Time
+	dbModel.Provenance
+	// 回填明文摘要时用于计算摘要
+	Plaintext string
+	Encoding  string
+}
+
+// mergeDuplicates 将主键范围内存在更早重复记录的行合并到同组最早的记录后删除
+// 来源次数和命中次数累加，保证导入回滚时不会删除其他来源也提交过的记录；保留记录缺少的来源信息由重复记录补全
+func mergeDuplicates(start, end uint, match string) error {
+	var rows []duplicateRow
+	if err := PG.Raw("SELECT id, source_count, hit_count, last_hit_at, source, user_id, import_job_id, filename, "+
+		"(SELECT MIN(b.id) FROM md5 b WHERE "+match+") AS keep_id FROM md5 "+
+		"WHERE id BETWEEN ? AND ? AND EXISTS (SELECT 1 FROM md5 b WHERE "+match+" AND b.id < md5.id)", start, end).
+		Scan(&rows).Error; err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+
+	return PG.Transaction(func(tx *gorm.DB) error {
+		for _, row := range rows {
+			if err := mergeRow(tx, row); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// mergeRow 将重复记录的计数和来源信息合并到 KeepID 对应的记录后删除该记录
+func mergeRow(tx *gorm.DB, row duplicateRow) error {
+	updates := map[string]interface{}{
+		"source_count":  gorm.Expr("source_count + ?", row.SourceCount),
+		"hit_count":     gorm.Expr("hit_count + ?", row.HitCount),
+		"source":        gorm.Expr("CASE WHEN source IS NULL OR source = '' THEN ? ELSE source END", row.Source),
+		"user_id":       gorm.Expr("CASE WHEN user_id IS NULL OR user_id = 0 THEN ? ELSE user_id END", row.UserID),
+		"import_job_id": gorm.Expr("CASE WHEN import_job_id IS NULL OR import_job_id = 0 THEN ? ELSE import_job_id END", row.ImportJobID),
+		"filename":      gorm.Expr("CASE WHEN import_job_id IS NULL OR import_job_id = 0 THEN ? ELSE filename END", row.Filename),
+	}
+	if row.LastHitAt != nil {
+		updates["last_hit_at"] = gorm.Expr("CASE WHEN last_hit_at IS NULL OR last_hit_at < ? THEN ? ELSE last_hit_at END",
+			*row.LastHitAt, *row.LastHitAt)
+	}
+	if err := tx.Model(&dbModel.Md5{}).Where("id = ?", row.KeepID).UpdateColumns(updates).Error; err != nil {
+		return err
+	}
+	return tx.Unscoped().Delete(&dbModel.Md5{}, row.ID).Error
+}
@@ -0,0 +1,68 @@
+package db
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"zmd5/config"
+	"zmd5/db/dbModel"
+)
+
+// countingProgress 记录去重上报的进度
+type countingProgress struct{ total, done int64 }
+
+func (p *countingProgress) SetTotal(total int64) { p.total = total }
+func (p *countingProgress) Add(n int64)          { p.done += n }
+
+func TestDedupMergesLegacyPlaintextsBeforeBackfill(t *testing.T) {
+	conn, err := Open(config.DatabaseConfig{Driver: DriverSQLite, DSN: filepath.Join(t.TempDir(), "test.db")})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := conn.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	PG = conn
+	if _, err := Migrate(Md5UniqueIndexesVersion - 1); err != nil {
+		t.Fatalf("执行迁移失败: %v", err)
+	}
+
+	// 两条相同明文的旧记录都没有明文摘要，明文唯一索引已经存在
+	for _, source := range []string{dbModel.SourceUpload, dbModel.SourceUserEncrypt} {
+		if err := conn.Exec("INSERT INTO md5 (created_at, updated_at, plaintext, digest, digest16, encoding, source, source_count, hit_count) "+
+			"VALUES (CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, 'utf8', ?, 1, 1)",
+			"legacy", digestOf("legacy"), digestOf("legacy")[4:12], source).Error; err != nil {
+			t.Fatalf("写入旧记录失败: %v", err)
+		}
+	}
+	if err := conn.Exec("CREATE UNIQUE INDEX " + plaintextUniqueIndex + " ON md5 (plaintext_digest, encoding)").Error; err != nil {
+		t.Fatalf("创建明文唯一索引失败: %v", err)
+	}
+
+	progress := &countingProgress{}
+	if err := DedupMd5(context.Background(), progress); err != nil {
+		t.Fatalf("去重失败: %v", err)
+	}
+	if progress.done != progress.total {
+		t.Fatalf("去重进度 = %d/%d", progress.done, progress.total)
+	}
+
+	var rows []dbModel.Md5
+	conn.Unscoped().Find(&rows)
+	if len(rows) != 1 {
+		t.Fatalf("去重后记录数 = %d, 期望 1", len(rows))
+	}
+	if rows[0].PlaintextDigest != dbModel.PlaintextDigest("legacy") || rows[0].SourceCount != 2 || rows[0].HitCount != 2 {
+		t.Fatalf("合并结果不正确: digest = %q, source_count = %d, hit_count = %d",
+			rows[0].PlaintextDigest, rows[0].SourceCount, rows[0].HitCount)
+	}
+	if rows[0].Source != dbModel.SourceUpload {
+		t.Fatalf("保留记录的来源 = %q, 期望最早记录的来源", rows[0].Source)
+	}
+
+	if _, err := Migrate(0); err != nil {
+		t.Fatalf("去重后创建唯一索引失败: %v", err)
+	}
+}
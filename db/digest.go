@@ -0,0 +1,211 @@
+package db
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"zmd5/db/dbModel"
+
+	"gorm.io/gorm"
+)
+
+// ErrInvalidHash 哈希值不是16位或32位十六进制字符串
+var ErrInvalidHash = errors.New("无效的MD5哈希值")
+
+// ParseHash 将32位或16位十六进制哈希解析为二进制摘要（分别为16字节和8字节）
+func ParseHash(hash string) ([]byte, error) {
+	if len(hash) != 32 && len(hash) != 16 {
+		return nil, ErrInvalidHash
+	}
+	digest, err := hex.DecodeString(hash)
+	if err != nil {
+		return nil, ErrInvalidHash
+	}
+	return digest, nil
+}
+
+// HashesToDigests 将32位十六进制哈希列表转换为二进制摘要列表，忽略无效的哈希
+func HashesToDigests(hashes []string) [][]byte {
+	digests := make([][]byte, 0, len(hashes))
+	for _, hash := range hashes {
+		if digest, err := ParseHash(hash); err == nil && len(digest) == 16 {
+			digests = append(digests, digest)
+		}
+	}
+	return digests
+}
+
+// FindMd5ByHash 按32位或16位哈希查找明文记录
+// 32位哈希按完整摘要查询，16位哈希按摘要中间8字节查询，两者均可走索引
+func FindMd5ByHash(tx *gorm.DB, hash string, record *dbModel.Md5) error {
+	digest, err := ParseHash(strings.ToLower(hash))
+	if err != nil {
+		return err
+	}
+	// 过滤器判定一定不存在时无需查询数据库
+	if !MayContainDigest(digest) {
+		return gorm.ErrRecordNotFound
+	}
+	if len(digest) == 16 {
+		return tx.Where("digest = ?", digest).First(record).Error
+	}
+	return tx.Where("digest16 = ?", digest).First(record).Error
+}
+
+// hexExpr 返回将二进制列转换为小写十六进制字符串的SQL表达式
+func hexExpr(column string) string {
+	if PG.Dialector.Name() == "postgres" {
+		return "encode(" + column + ", 'hex')"
+	}
+	return "LOWER(HEX(" + column + "))"
+}
+
+// 摘要转换时每批次处理的主键范围
+const convertBatchSize = 10000
+
+// NeedsDigestConversion 检查明文库是否仍有旧的十六进制MD5列需要转换
+func NeedsDigestConversion() bool {
+	return hasMd5Column("md5")
+}
+
+// hasMd5Column 检查明文库表是否存在指定列
+// 不使用 Migrator().HasColumn，SQLite实现按建表语句模糊匹配，会把同名的表名误判为列名
+func hasMd5Column(column string) bool {
+	return hasColumn(PG, "md5", column)
+}
+
+// hasColumn 通过读取表的列信息判断列是否存在
+func hasColumn(conn *gorm.DB, table, column string) bool {
+	columns, err := conn.Migrator().ColumnTypes(table)
+	if err != nil {
+		return false
+	}
+	for _, c := range columns {
+		if c.Name() == column {
+			return true
+		}
+	}
+	return false
+}
+
+// ConvertMd5Digests 将旧的十六进制md5列分批转换为二进制digest列，完成后删除旧列
+// 转换前已存在相同摘要的记录视为重复并删除，md5列不是合法32位哈希的记录无法转换，同样删除
+func ConvertMd5Digests(ctx context.Context, progress ProgressReporter) error {
+	if !NeedsDigestConversion() {
+		return nil
+	}
+
+	var bounds struct {
+		MinID uint
+		MaxID uint
+	}
+	if err := PG.Table("md5").Select("COALESCE(MIN(id), 0) AS min_id, COALESCE(MAX(id), 0) AS max_id").
+		Where("digest IS NULL").Scan(&bounds).Error; err != nil {
+		return err
+	}
+
+	if bounds.MaxID > 0 {
+		progress.SetTotal(int64((bounds.MaxID-bounds.MinID)/convertBatchSize + 1))
+		for start := bounds.MinID; start <= bounds.MaxID; start += convertBatchSize {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := convertDigestBatch(start, start+convertBatchSize-1); err != nil {
+				return fmt.Errorf("转换摘要失败（id %d 起）: %v", start, err)
+			}
+			progress.Add(1)
+		}
+	}
+
+	// 所有记录转换完成后删除旧列，SQLite不允许删除带索引的列，因此先删除旧索引
+	for _, index := range []string{"idx_md5_md5", "uidx_md5_md5"} {
+		if err := PG.Exec("DROP INDEX IF EXISTS " + index).Error; err != nil {
+			return err
+		}
+	}
+	for _, column := range []string{"md5", "md5_16"} {
+		if hasMd5Column(column) {
+			if err := PG.Exec("ALTER TABLE md5 DROP COLUMN " + column).Error; err != nil {
+				return fmt.Errorf("删除旧列%s失败: %v", column, err)
+			}
+		}
+	}
+	log.Printf("明文库摘要转换完成")
+
+	// 转换前构建的过滤器不包含旧记录，需要重新构建
+	digestFilterMu.RLock()
+	initialized := digestFilter != nil
+	digestFilterMu.RUnlock()
+	if !initialized {
+		return nil
+	}
+	return RebuildDigestFilter()
+}
+
+// convertDigestBatch 转换一个主键范围内的记录
+func convertDigestBatch(start, end uint) error {
+	// PostgreSQL直接在数据库中完成转换
+	if PG.Dialector.Name() == "postgres" {
+		statements := []string{
+			// 无法转换的记录
+			`DELETE FROM md5 WHERE id BETWEEN ? AND ? AND digest IS NULL AND (md5 IS NULL OR md5 !~ '^[0-9a-fA-F]{32}$')`,
+			// 已有相同摘要的重复记录
+			`DELETE FROM md5 WHERE id BETWEEN ? AND ? AND digest IS NULL
+				AND EXISTS (SELECT 1 FROM md5 b WHERE b.digest = decode(md5.md5, 'hex'))`,
+			`DELETE FROM md5 WHERE id BETWEEN ? AND ? AND digest IS NULL
+				AND EXISTS (SELECT 1 FROM md5 b WHERE lower(b.md5) = lower(md5.md5) AND b.id < md5.id AND b.digest IS NULL)`,
+			`UPDATE md5 SET digest = decode(md5, 'hex'), digest16 = substring(decode(md5, 'hex') from 5 for 8)
+				WHERE id BETWEEN ? AND ? AND digest IS NULL`,
+		}
+		return PG.Transaction(func(tx *gorm.DB) error {
+			for _, statement := range statements {
+				if err := tx.Exec(statement, start, end).Error; err != nil {
+					return err
+				}
+			}
+			return bumpMd5Generation(tx)
+		})
+	}
+
+	var rows []struct {
+		ID  uint
+		MD5 string `gorm:"column:md5"`
+	}
+	if err := PG.Table("md5").Select("id", "md5").
+		Where("id BETWEEN ? AND ? AND digest IS NULL", start, end).
+		Order("id ASC").Find(&rows).Error; err != nil {
+		return err
+	}
+
+	return PG.Transaction(func(tx *gorm.DB) error {
+		for _, row := range rows {
+			digest, err := hex.DecodeString(row.MD5)
+			if err != nil || len(digest) != 16 {
+				if err := tx.Exec("DELETE FROM md5 WHERE id = ?", row.ID).Error; err != nil {
+					return err
+				}
+				continue
+			}
+
+			var count int64
+			if err := tx.Table("md5").Where("digest = ?", digest).Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				if err := tx.Exec("DELETE FROM md5 WHERE id = ?", row.ID).Error; err != nil {
+					return err
+				}
+				continue
+			}
+
+			if err := tx.Exec("UPDATE md5 SET digest = ?, digest16 = ? WHERE id = ?", digest, digest[4:12], row.ID).Error; err != nil {
+				return err
+			}
+		}
+		// 转换出的摘要对其他进程的过滤器相当于新写入的记录
+		return bumpMd5Generation(tx)
+	})
+}
@@ -0,0 +1,401 @@
+package db
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+	"zmd5/bloom"
+	"zmd5/db/dbModel"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 明文库摘要布隆过滤器参数
+const (
+	digestFilterFPRate           = 0.001            // 目标假阳性率
+	digestFilterMinCapacity      = 1 << 20          // 最小容量
+	digestFilterScanBatch        = 50000            // 构建时每批次读取的行数
+	digestFilterCheckInterval    = time.Second      // 检查其他进程是否写入明文库的间隔
+	digestFilterCheckTTL         = 3 * time.Second  // 超过该时间未确认时不再信任过滤器的否定结果
+	digestFilterRebuildInterval  = 30 * time.Second // 因其他进程写入而重建的最小间隔
+	digestFilterSnapshotInterval = 10 * time.Minute // 快照保存间隔
+)
+
+// 明文库中所有摘要（32位和16位）的布隆过滤器，用于在查询数据库前快速排除一定不存在的哈希
+// 本进程写入的记录直接加入过滤器；其他进程（命令行导入、数据迁移、其他实例）的写入通过 md5_writers 表发现，
+// 发现后全量重建，重建完成并确认期间没有新的写入之前不做排除
+// 过滤器构建完成前以及明文库仍需转换摘要时同样不做排除
+var (
+	digestFilterMu        sync.RWMutex
+	digestFilter          *bloom.Filter
+	digestFilterBuilding  *bloom.Filter // 重建过程中的新过滤器，插入时同时写入
+	digestFilterReady     bool
+	digestFilterSynced    uint64    // 过滤器已包含的其他进程写入状态
+	digestFilterCheckedAt time.Time // 最近一次确认其他进程没有新写入的时间
+	digestFilterBuiltAt   time.Time
+	digestFilterSnapshot  string // 快照文件路径，为空时不保存快照
+
+	digestFilterChecks    atomic.Int64 // 查询次数
+	digestFilterNegatives atomic.Int64 // 被过滤器直接排除的次数
+)
+
+// md5WriterID 当前进程写入明文库时使用的标识
+var md5WriterID = randomWriterID()
+
+// randomWriterID 生成随机的写入标识
+func randomWriterID() string {
+	return rand.Text()
+}
+
+// DigestFilterStats 摘要过滤器的统计信息
+type DigestFilterStats struct {
+	Ready             bool    `json:"ready"`
+	Complete          bool    `json:"complete"`
+	Elements          uint64  `json:"elements"`
+	Bits              uint64  `json:"bits"`
+	Hashes            uint64  `json:"hashes"`
+	SizeBytes         uint64  `json:"size_bytes"`
+	FillRatio         float64 `json:"fill_ratio"`
+	FalsePositiveRate float64 `json:"false_positive_rate"`
+	Checks            int64   `json:"checks"`
+	Negatives         int64   `json:"negatives"`
+	BuiltAt           string  `json:"built_at,omitempty"`
+	Snapshot          string  `json:"snapshot,omitempty"`
+}
+
+// InitDigestFilter 在后台构建摘要过滤器，并定期检查其他进程是否写入了明文库
+// snapshotPath不为空时优先从快照恢复，并定期保存快照
+func InitDigestFilter(snapshotPath string) {
+	digestFilterSnapshot = snapshotPath
+
+	go func() {
+		loaded := false
+		if snapshotPath != "" {
+			if err := loadDigestFilterSnapshot(snapshotPath); err != nil {
+				if !os.IsNotExist(err) {
+					log.Printf("加载摘要过滤器快照失败: %v", err)
+				}
+			} else {
+				loaded = true
+			}
+		}
+		if !loaded {
+			if err := RebuildDigestFilter(); err != nil {
+				log.Printf("构建摘要过滤器失败: %v", err)
+			}
+		}
+
+		check := time.NewTicker(digestFilterCheckInterval)
+		snapshot := time.NewTicker(digestFilterSnapshotInterval)
+		for {
+			select {
+			case <-check.C:
+				if err := checkDigestFilter(); err != nil {
+					log.Printf("同步摘要过滤器失败: %v", err)
+				}
+			case <-snapshot.C:
+				if err := SaveDigestFilterSnapshot(); err != nil {
+					log.Printf("保存摘要过滤器快照失败: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// MayContainDigest 判断摘要（16字节完整摘要或8字节的16位摘要）是否可能存在于明文库
+// 返回false表示一定不存在，可以跳过数据库查询
+func MayContainDigest(digest []byte) bool {
+	digestFilterChecks.Add(1)
+
+	digestFilterMu.RLock()
+	filter, ready, checkedAt := digestFilter, digestFilterReady, digestFilterCheckedAt
+	digestFilterMu.RUnlock()
+
+	// 未能及时确认其他进程没有新写入时，过滤器可能缺少记录，否定结果不可信
+	if !ready || filter == nil || time.Since(checkedAt) > digestFilterCheckTTL || filter.Test(digest) {
+		return true
+	}
+	digestFilterNegatives.Add(1)
+	return false
+}
+
+// bumpMd5Generation 累加当前进程的写入次数，需要与写入明文库的语句在同一事务中执行
+func bumpMd5Generation(tx *gorm.DB) error {
+	now := time.Now()
+	return tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "writer"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"generation": gorm.Expr("md5_writers.generation + 1"),
+			"updated_at": now,
+		}),
+	}).Create(&dbModel.Md5Writer{Writer: md5WriterID, Generation: 1, UpdatedAt: now}).Error
+}
+
+// md5WriterState 读取明文库的写入状态，返回其他进程的写入状态和包括当前进程在内的全部写入状态
+func md5WriterState() (uint64, uint64, error) {
+	var writers []dbModel.Md5Writer
+	if err := PG.Order("writer").Find(&writers).Error; err != nil {
+		return 0, 0, err
+	}
+	others, all := fnv.New64a(), fnv.New64a()
+	for _, writer := range writers {
+		entry := fmt.Sprintf("%s:%d;", writer.Writer, writer.Generation)
+		all.Write([]byte(entry))
+		if writer.Writer != md5WriterID {
+			others.Write([]byte(entry))
+		}
+	}
+	return others.Sum64(), all.Sum64(), nil
+}
+
+// checkDigestFilter 确认其他进程没有新的写入，有新写入时重新构建过滤器
+func checkDigestFilter() error {
+	digestFilterMu.RLock()
+	filter, synced, builtAt := digestFilter, digestFilterSynced, digestFilterBuiltAt
+	digestFilterMu.RUnlock()
+	if filter == nil {
+		return nil
+	}
+
+	others, _, err := md5WriterState()
+	if err != nil {
+		return err
+	}
+	if others == synced {
+		digestFilterMu.Lock()
+		if digestFilter == filter {
+			digestFilterCheckedAt = time.Now()
+		}
+		digestFilterMu.Unlock()
+		return nil
+	}
+
+	// 发现新写入后立即停止排除
+	digestFilterMu.Lock()
+	if digestFilter == filter {
+		digestFilterCheckedAt = time.Time{}
+	}
+	digestFilterMu.Unlock()
+
+	// 其他进程写入的记录主键可能小于已扫描的最大主键（事务提交晚于其他写入），只有全量重建才能保证包含所有记录
+	// 持续写入时限制重建频率，期间过滤器不做排除
+	if time.Since(builtAt) < digestFilterRebuildInterval {
+		return nil
+	}
+	log.Printf("其他进程写入了明文库，重新构建摘要过滤器")
+	return RebuildDigestFilter()
+}
+
+// addDigestsToFilter 将新写入的记录加入过滤器
+func addDigestsToFilter(records []dbModel.Md5) {
+	digestFilterMu.RLock()
+	filters := []*bloom.Filter{digestFilter, digestFilterBuilding}
+	digestFilterMu.RUnlock()
+
+	for i := range records {
+		digest := records[i].Digest
+		if len(digest) != 16 {
+			decoded, err := hex.DecodeString(records[i].MD5)
+			if err != nil || len(decoded) != 16 {
+				continue
+			}
+			digest = decoded
+		}
+		for _, filter := range filters {
+			if filter != nil {
+				addDigest(filter, digest)
+			}
+		}
+	}
+}
+
+// addDigest 同时加入完整摘要和16位摘要
+func addDigest(filter *bloom.Filter, digest []byte) {
+	filter.Add(digest)
+	filter.Add(digest[4:12])
+}
+
+// RebuildDigestFilter 按当前明文库数据量重新构建过滤器
+func RebuildDigestFilter() error {
+	// 先读取写入状态再扫描，扫描开始后其他进程的写入会使状态变化，由下一次检查发现
+	others, _, err := md5WriterState()
+	if err != nil {
+		return err
+	}
+
+	var count int64
+	if err := PG.Model(&dbModel.Md5{}).Count(&count).Error; err != nil {
+		return err
+	}
+
+	// 每条记录占用两个元素，并预留一倍空间给后续写入
+	capacity := uint64(count) * 4
+	if capacity < digestFilterMinCapacity {
+		capacity = digestFilterMinCapacity
+	}
+	filter := bloom.New(capacity, digestFilterFPRate)
+	// 摘要转换完成前旧记录没有digest，过滤器不完整，不能用于排除
+	ready := !NeedsDigestConversion()
+
+	digestFilterMu.Lock()
+	digestFilterBuilding = filter
+	digestFilterMu.Unlock()
+
+	start := time.Now()
+	err = scanDigests(filter)
+
+	digestFilterMu.Lock()
+	digestFilterBuilding = nil
+	if err == nil {
+		digestFilter = filter
+		digestFilterReady = ready
+		digestFilterSynced = others
+		digestFilterCheckedAt = time.Time{}
+		digestFilterBuiltAt = time.Now()
+	}
+	digestFilterMu.Unlock()
+
+	if err != nil {
+		return err
+	}
+	log.Printf("摘要过滤器构建完成，共 %d 条记录，耗时 %v", count, time.Since(start))
+	return nil
+}
+
+// scanDigests 将明文库中的所有摘要加入过滤器
+func scanDigests(filter *bloom.Filter) error {
+	lastID := uint(0)
+	for {
+		var rows []struct {
+			ID     uint
+			Digest []byte
+		}
+		if err := PG.Model(&dbModel.Md5{}).Select("id", "digest").
+			Where("id > ? AND digest IS NOT NULL", lastID).
+			Order("id ASC").Limit(digestFilterScanBatch).
+			Find(&rows).Error; err != nil {
+			return err
+		}
+		for _, row := range rows {
+			if len(row.Digest) == 16 {
+				addDigest(filter, row.Digest)
+			}
+		}
+		if len(rows) < digestFilterScanBatch {
+			return nil
+		}
+		lastID = rows[len(rows)-1].ID
+	}
+}
+
+// SaveDigestFilterSnapshot 将过滤器保存到快照文件，未配置快照路径或过滤器不可用时跳过
+// 快照附带保存时数据库的写入状态，加载时状态一致才能使用
+func SaveDigestFilterSnapshot() error {
+	digestFilterMu.RLock()
+	filter, ready, synced := digestFilter, digestFilterReady, digestFilterSynced
+	digestFilterMu.RUnlock()
+	if digestFilterSnapshot == "" || filter == nil || !ready {
+		return nil
+	}
+
+	others, all, err := md5WriterState()
+	if err != nil {
+		return err
+	}
+	// 过滤器尚未包含其他进程最新写入的记录，此时保存的快照会缺少记录
+	if others != synced {
+		return nil
+	}
+
+	tmp := digestFilterSnapshot + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err := filter.WriteTo(file, all); err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, digestFilterSnapshot)
+}
+
+// loadDigestFilterSnapshot 从快照恢复过滤器
+// 数据库的写入状态与保存快照时不一致（快照来自其他数据库、数据库从备份恢复或之后有新的写入）时不使用快照
+func loadDigestFilterSnapshot(path string) error {
+	if NeedsDigestConversion() {
+		return fmt.Errorf("明文库摘要尚未转换，忽略快照")
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	filter, state, err := bloom.ReadFrom(file)
+	file.Close()
+	if err != nil {
+		return err
+	}
+
+	// 读取状态后本进程写入的记录同时写入快照中的过滤器
+	digestFilterMu.Lock()
+	digestFilterBuilding = filter
+	digestFilterMu.Unlock()
+
+	others, all, err := md5WriterState()
+	if err == nil && all != state {
+		err = fmt.Errorf("快照与数据库当前的写入状态不一致，忽略快照")
+	}
+
+	digestFilterMu.Lock()
+	digestFilterBuilding = nil
+	if err == nil {
+		digestFilter = filter
+		digestFilterReady = true
+		digestFilterSynced = others
+		digestFilterCheckedAt = time.Now()
+		digestFilterBuiltAt = time.Now()
+	}
+	digestFilterMu.Unlock()
+
+	if err == nil {
+		log.Printf("已从快照恢复摘要过滤器: %s", path)
+	}
+	return err
+}
+
+// GetDigestFilterStats 返回摘要过滤器的统计信息
+func GetDigestFilterStats() DigestFilterStats {
+	digestFilterMu.RLock()
+	filter, ready, checkedAt, builtAt := digestFilter, digestFilterReady, digestFilterCheckedAt, digestFilterBuiltAt
+	digestFilterMu.RUnlock()
+
+	stats := DigestFilterStats{
+		Ready:     ready,
+		Complete:  ready && filter != nil && time.Since(checkedAt) <= digestFilterCheckTTL,
+		Checks:    digestFilterChecks.Load(),
+		Negatives: digestFilterNegatives.Load(),
+		Snapshot:  digestFilterSnapshot,
+	}
+	if filter != nil {
+		stats.Elements = filter.Count()
+		stats.Bits = filter.Bits()
+		stats.Hashes = filter.Hashes()
+		stats.SizeBytes = filter.SizeBytes()
+		stats.FillRatio = filter.FillRatio()
+		stats.FalsePositiveRate = filter.FalsePositiveRate()
+		stats.BuiltAt = builtAt.Format("2006-01-02 15:04:05")
+	}
+	return stats
+}
@@ -0,0 +1,170 @@
+package db
+
+import (
+	"crypto/md5"
+	"path/filepath"
+	"testing"
+	"time"
+	"zmd5/config"
+	"zmd5/db/dbModel"
+)
+
+// openTestDB 使用临时SQLite数据库作为全局连接并执行所有迁移
+func openTestDB(t *testing.T) {
+	t.Helper()
+	conn, err := Open(config.DatabaseConfig{Driver: DriverSQLite, DSN: filepath.Join(t.TempDir(), "test.db")})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	PG = conn
+	if _, err := Migrate(0); err != nil {
+		t.Fatalf("执行迁移失败: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := conn.DB(); err == nil {
+			sqlDB.Close()
+		}
+		digestFilterMu.Lock()
+		digestFilter, digestFilterReady, digestFilterSynced = nil, false, 0
+		digestFilterCheckedAt, digestFilterBuiltAt = time.Time{}, time.Time{}
+		digestFilterMu.Unlock()
+	})
+}
+
+func digestOf(plaintext string) []byte {
+	sum := md5.Sum([]byte(plaintext))
+	return sum[:]
+}
+
+func insertPlaintext(t *testing.T, plaintext string) {
+	t.Helper()
+	if _, err := InsertMd5s(PG, []dbModel.Md5{{Plaintext: plaintext, Digest: digestOf(plaintext)}}, 1); err != nil {
+		t.Fatalf("写入明文失败: %v", err)
+	}
+}
+
+// insertFromOtherProcess 模拟其他进程写入：直接写入记录并累加另一个写入标识的计数
+func insertFromOtherProcess(t *testing.T, plaintext string) {
+	t.Helper()
+	record := dbModel.Md5{Plaintext: plaintext, Digest: digestOf(plaintext)}
+	if err := PG.Create(&record).Error; err != nil {
+		t.Fatalf("写入明文失败: %v", err)
+	}
+	if err := PG.Exec("INSERT INTO md5_writers (writer, generation, updated_at) VALUES ('other', 1, ?) "+
+		"ON CONFLICT (writer) DO UPDATE SET generation = md5_writers.generation + 1", time.Now()).Error; err != nil {
+		t.Fatalf("更新写入状态失败: %v", err)
+	}
+}
+
+func TestDigestFilterExcludesOnlyWhenComplete(t *testing.T) {
+	openTestDB(t)
+	insertPlaintext(t, "existing")
+
+	if !MayContainDigest(digestOf("missing")) {
+		t.Fatal("过滤器构建前不应排除")
+	}
+	if err := RebuildDigestFilter(); err != nil {
+		t.Fatalf("构建过滤器失败: %v", err)
+	}
+	if !MayContainDigest(digestOf("missing")) {
+		t.Fatal("确认其他进程没有写入之前不应排除")
+	}
+	if err := checkDigestFilter(); err != nil {
+		t.Fatalf("检查过滤器失败: %v", err)
+	}
+	if MayContainDigest(digestOf("missing")) {
+		t.Fatal("确认后不存在的摘要应被排除")
+	}
+	if !MayContainDigest(digestOf("existing")) || !MayContainDigest(digestOf("existing")[4:12]) {
+		t.Fatal("已存在的摘要被排除")
+	}
+
+	// 本进程的写入直接加入过滤器，不影响排除
+	insertPlaintext(t, "local")
+	if err := checkDigestFilter(); err != nil {
+		t.Fatalf("检查过滤器失败: %v", err)
+	}
+	if !MayContainDigest(digestOf("local")) {
+		t.Fatal("本进程写入的摘要被排除")
+	}
+	if !GetDigestFilterStats().Complete {
+		t.Fatal("本进程写入后过滤器应仍然完整")
+	}
+
+	// 其他进程的写入被发现后立即停止排除，重建完成并再次确认后恢复
+	insertFromOtherProcess(t, "foreign")
+	if err := checkDigestFilter(); err != nil {
+		t.Fatalf("检查过滤器失败: %v", err)
+	}
+	if !MayContainDigest(digestOf("foreign")) || !MayContainDigest(digestOf("missing")) {
+		t.Fatal("发现其他进程写入后不应排除")
+	}
+	digestFilterMu.Lock()
+	digestFilterBuiltAt = time.Now().Add(-digestFilterRebuildInterval)
+	digestFilterMu.Unlock()
+	if err := checkDigestFilter(); err != nil {
+		t.Fatalf("重建过滤器失败: %v", err)
+	}
+	if err := checkDigestFilter(); err != nil {
+		t.Fatalf("检查过滤器失败: %v", err)
+	}
+	if !MayContainDigest(digestOf("foreign")) {
+		t.Fatal("重建后其他进程写入的摘要被排除")
+	}
+	if MayContainDigest(digestOf("missing")) {
+		t.Fatal("重建并确认后不存在的摘要应被排除")
+	}
+}
+
+func TestDigestFilterStaleCheck(t *testing.T) {
+	openTestDB(t)
+	if err := RebuildDigestFilter(); err != nil {
+		t.Fatalf("构建过滤器失败: %v", err)
+	}
+	if err := checkDigestFilter(); err != nil {
+		t.Fatalf("检查过滤器失败: %v", err)
+	}
+
+	// 长时间未能确认时不再排除
+	digestFilterMu.Lock()
+	digestFilterCheckedAt = time.Now().Add(-2 * digestFilterCheckTTL)
+	digestFilterMu.Unlock()
+	if !MayContainDigest(digestOf("missing")) {
+		t.Fatal("确认过期后不应排除")
+	}
+}
+
+func TestDigestFilterSnapshotState(t *testing.T) {
+	openTestDB(t)
+	digestFilterSnapshot = filepath.Join(t.TempDir(), "digest.bloom")
+	t.Cleanup(func() { digestFilterSnapshot = "" })
+
+	insertPlaintext(t, "existing")
+	if err := RebuildDigestFilter(); err != nil {
+		t.Fatalf("构建过滤器失败: %v", err)
+	}
+	if err := SaveDigestFilterSnapshot(); err != nil {
+		t.Fatalf("保存快照失败: %v", err)
+	}
+
+	// 写入状态未变化时可以使用快照
+	if err := loadDigestFilterSnapshot(digestFilterSnapshot); err != nil {
+		t.Fatalf("加载快照失败: %v", err)
+	}
+	if !MayContainDigest(digestOf("existing")) || MayContainDigest(digestOf("missing")) {
+		t.Fatal("从快照恢复的过滤器结果不正确")
+	}
+
+	// 保存快照后有新的写入时不能使用快照
+	insertFromOtherProcess(t, "foreign")
+	if err := loadDigestFilterSnapshot(digestFilterSnapshot); err == nil {
+		t.Fatal("数据库写入状态变化后不应使用快照")
+	}
+
+	// 其他数据库的快照不能使用
+	openTestDB(t)
+	insertPlaintext(t, "existing")
+	if err := loadDigestFilterSnapshot(digestFilterSnapshot); err == nil {
+		t.Fatal("不应使用其他数据库的快照")
+	}
+}
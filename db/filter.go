@@ -0,0 +1,108 @@
+package db
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Md5Filter 明文库的通用过滤条件，供管理查询、导出等功能复用
+type Md5Filter struct {
+	// 模糊搜索关键字
+	Search string
+	// 搜索字段（plaintext/md5，为空时搜索所有字段）
+	SearchType string
+	// 创建时间范围 [StartDate, EndDate)
+	StartDate *time.Time
+	EndDate   *time.Time
+	// 明文长度范围，0表示不限制
+	MinLength int
+	MaxLength int
+	// 明文编码
+	Encoding string
+	// 来源类型
+	Source string
+	// 导入任务ID
+	ImportJobID uint
+	// 提交者用户ID
+	UserID uint
+}
+
+// Apply 将过滤条件应用到查询上
+func (f Md5Filter) Apply(query *gorm.DB) *gorm.DB {
+	if f.Search != "" {
+		pattern := "%" + f.Search + "%"
+		switch f.SearchType {
+		case "plaintext":
+			query = query.Where("plaintext LIKE ?", pattern)
+		case "md5":
+			query = applyHashSearch(query, f.Search, "")
+		default:
+			// 默认搜索所有字段
+			query = applyHashSearch(query, f.Search, "plaintext LIKE ?")
+		}
+	}
+
+	if f.StartDate != nil {
+		query = query.Where("created_at >= ?", *f.StartDate)
+	}
+	if f.EndDate != nil {
+		query = query.Where("created_at < ?", *f.EndDate)
+	}
+
+	if f.MinLength > 0 {
+		query = query.Where("LENGTH(plaintext) >= ?", f.MinLength)
+	}
+	if f.MaxLength > 0 {
+		query = query.Where("LENGTH(plaintext) <= ?", f.MaxLength)
+	}
+
+	if f.Encoding != "" {
+		query = query.Where("encoding = ?", f.Encoding)
+	}
+
+	if f.Source != "" {
+		query = query.Where("source = ?", f.Source)
+	}
+	if f.ImportJobID > 0 {
+		query = query.Where("import_job_id = ?", f.ImportJobID)
+	}
+	if f.UserID > 0 {
+		query = query.Where("user_id = ?", f.UserID)
+	}
+
+	return query
+}
+
+// IsEmpty 检查是否未设置任何过滤条件
+func (f Md5Filter) IsEmpty() bool {
+	return f.Search == "" && f.StartDate == nil && f.EndDate == nil &&
+		f.MinLength == 0 && f.MaxLength == 0 && f.Encoding == "" &&
+		f.Source == "" && f.ImportJobID == 0 && f.UserID == 0
+}
+
+// applyHashSearch 按哈希搜索，完整的32位或16位哈希按二进制摘要精确匹配以利用索引，
+// 其余关键字对摘要的十六进制形式做模糊匹配；extra不为空时与哈希条件以OR连接
+func applyHashSearch(query *gorm.DB, search string, extra string) *gorm.DB {
+	pattern := "%" + search + "%"
+	var condition string
+	var args []interface{}
+	if digest, err := ParseHash(strings.ToLower(search)); err == nil {
+		if len(digest) == 16 {
+			condition = "digest = ?"
+		} else {
+			condition = "digest16 = ?"
+		}
+		args = append(args, digest)
+	} else {
+		condition = hexExpr("digest") + " LIKE ?"
+		args = append(args, strings.ToLower(pattern))
+	}
+
+	if extra != "" {
+		condition = extra + " OR " + condition
+		args = append([]interface{}{pattern}, args...)
+	}
+	return query.Where(condition, args...)
+}
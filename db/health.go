@@ -0,0 +1,50 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"zmd5/metrics"
+)
+
+// Ping 检查数据库是否可以连接
+func Ping(ctx context.Context) error {
+	sqlDB, err := PG.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+// poolStats 返回全局连接的连接池状态
+func poolStats() sql.DBStats {
+	if PG == nil {
+		return sql.DBStats{}
+	}
+	sqlDB, err := PG.DB()
+	if err != nil {
+		return sql.DBStats{}
+	}
+	return sqlDB.Stats()
+}
+
+// RegisterPoolMetrics 登记数据库连接池指标，输出指标时读取连接池状态
+func RegisterPoolMetrics() {
+	metrics.NewGaugeFunc("zmd5_db_max_open_connections", "数据库连接池允许打开的最大连接数，0表示不限制", func() float64 {
+		return float64(poolStats().MaxOpenConnections)
+	})
+	metrics.NewGaugeFunc("zmd5_db_open_connections", "数据库连接池中打开的连接数", func() float64 {
+		return float64(poolStats().OpenConnections)
+	})
+	metrics.NewGaugeFunc("zmd5_db_in_use_connections", "数据库连接池中正在使用的连接数", func() float64 {
+		return float64(poolStats().InUse)
+	})
+	metrics.NewGaugeFunc("zmd5_db_idle_connections", "数据库连接池中空闲的连接数", func() float64 {
+		return float64(poolStats().Idle)
+	})
+	metrics.NewCounterFunc("zmd5_db_wait_count_total", "等待数据库连接的次数", func() float64 {
+		return float64(poolStats().WaitCount)
+	})
+	metrics.NewCounterFunc("zmd5_db_wait_duration_seconds_total", "等待数据库连接的总时间（秒）", func() float64 {
+		return poolStats().WaitDuration.Seconds()
+	})
+}
@@ -4,10 +4,13 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
 	"time"
+	"zmd5/config"
 	"zmd5/db/dbModel"
 	"zmd5/utils"
 
+	"github.com/glebarez/sqlite"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
@@ -15,9 +18,23 @@ import (
 
 var PG *gorm.DB
 
-func InitDB() {
-	dsn := "host=localhost user=zero password=012359Clown dbname=zmd5base port=5431 sslmode=disable TimeZone=Asia/Shanghai"
+// 支持的存储后端
+const (
+	DriverPostgres = "postgres" // PostgreSQL，多用户部署使用
+	DriverSQLite   = "sqlite"   // 纯Go实现的SQLite，无需数据库服务，适合测试和单用户使用
+)
 
+// InitDB 按配置连接数据库，表结构由 Setup 或 migrate 命令初始化
+func InitDB(cfg config.DatabaseConfig) {
+	db, err := Open(cfg)
+	if err != nil {
+		panic(err)
+	}
+	PG = db
+}
+
+// Open 按配置打开一个数据库连接，不修改全局连接
+func Open(cfg config.DatabaseConfig) (*gorm.DB, error) {
 	// 创建自定义日志配置，禁用SQL查询日志
 	newLogger := logger.New(
 		log.New(os.Stdout, "\r\n", log.LstdFlags), // io writer
@@ -29,37 +46,98 @@ func InitDB() {
 		},
 	)
 
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
+	dialector, err := openDialector(cfg.Driver, cfg.DSN)
+	if err != nil {
+		return nil, err
+	}
+	db, err := gorm.Open(dialector, &gorm.Config{
 		Logger: newLogger,
 	})
 	if err != nil {
-		panic("failed to connect database")
+		return nil, fmt.Errorf("failed to connect database: %v", err)
+	}
+	return db, nil
+}
+
+// Setup 准备数据库表结构并初始化管理员账户
+// autoMigrate 为 true 时自动执行未执行的迁移，否则存在未执行的迁移时报错，需先执行 `zmd5 migrate`
+// 数据库中不存在管理员时使用 admin 创建默认管理员
+func Setup(autoMigrate bool, admin config.AdminConfig) error {
+	if autoMigrate {
+		if _, err := Migrate(0); err != nil {
+			return err
+		}
+	} else {
+		pending, err := PendingMigrations()
+		if err != nil {
+			return err
+		}
+		if pending > 0 {
+			return fmt.Errorf("存在%d个未执行的数据库迁移，请先执行 `zmd5 migrate`", pending)
+		}
 	}
-	db.AutoMigrate(&dbModel.User{}, &dbModel.Md5{}, &dbModel.MD5Record{}, &dbModel.RainbowTable{}, &dbModel.TaskProgressRecord{})
-	PG = db
 
 	// 初始化管理员账户
-	initAdmin()
+	initAdmin(admin)
+	return nil
+}
+
+// openDialector 根据存储后端名称创建GORM方言
+func openDialector(driver, dsn string) (gorm.Dialector, error) {
+	switch driver {
+	case DriverPostgres:
+		return postgres.Open(dsn), nil
+	case DriverSQLite:
+		// 默认开启WAL和忙等待，写事务直接获取写锁，避免并发导入时出现 database is locked
+		if !strings.Contains(dsn, "?") {
+			dsn += "?_pragma=busy_timeout(10000)&_pragma=journal_mode(WAL)&_txlock=immediate"
+		}
+		return sqlite.Open(dsn), nil
+	default:
+		return nil, fmt.Errorf("不支持的存储后端: %s", driver)
+	}
+}
+
+// Version 返回数据库版本信息
+func Version() string {
+	var version string
+	if PG.Dialector.Name() == DriverSQLite {
+		PG.Raw("SELECT 'SQLite ' || sqlite_version()").Scan(&version)
+	} else {
+		PG.Raw("SELECT version()").Scan(&version)
+	}
+	return version
 }
 
 // initAdmin 初始化管理员账户
-func initAdmin() {
+func initAdmin(cfg config.AdminConfig) {
 	var adminCount int64
 	PG.Model(&dbModel.User{}).Where("role = ?", "admin").Count(&adminCount)
 
 	// 如果不存在管理员，则创建默认管理员账户
 	if adminCount == 0 {
-		defaultPassword := "012359Clown"
-		encryptedPassword, err := utils.EncryptPassword(defaultPassword)
+		// 未配置密码时（仅开发环境允许）生成随机密码，登录后必须修改
+		password, generated := cfg.Password, cfg.Password == ""
+		if generated {
+			var err error
+			password, err = utils.GenerateRandomPlaintext(16, utils.CharsetAlphaDigits)
+			if err != nil {
+				fmt.Println("生成管理员密码失败:", err)
+				return
+			}
+		}
+
+		encryptedPassword, err := utils.EncryptPassword(password)
 		if err != nil {
 			fmt.Println("管理员密码加密失败:", err)
 			return
 		}
 
 		admin := dbModel.User{
-			Username: "clown",
-			Password: encryptedPassword,
-			Role:     "admin",
+			Username:          cfg.Username,
+			Password:          encryptedPassword,
+			Role:              "admin",
+			MustResetPassword: generated,
 		}
 
 		result := PG.Create(&admin)
@@ -68,6 +146,10 @@ func initAdmin() {
 			return
 		}
 
-		fmt.Println("已创建默认管理员账户，用户名: clown，密码: 012359Clown")
+		if generated {
+			fmt.Printf("已创建默认管理员账户，用户名: %s，随机密码: %s，首次登录时需要修改密码\n", cfg.Username, password)
+			return
+		}
+		fmt.Printf("已创建默认管理员账户，用户名: %s，请使用配置中的密码登录后及时修改\n", cfg.Username)
 	}
 }
@@ -0,0 +1,69 @@
+package db
+
+import (
+	"encoding/hex"
+	"time"
+	"zmd5/db/dbModel"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// InsertMd5s 批量插入明文记录，与已有记录冲突（MD5或明文+编码重复）时跳过
+// 返回实际插入的行数
+func InsertMd5s(tx *gorm.DB, records []dbModel.Md5, batchSize int) (int64, error) {
+	if len(records) == 0 {
+		return 0, nil
+	}
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(records, batchSize)
+	if result.Error != nil {
+		return result.RowsAffected, result.Error
+	}
+	// 事务回滚时过滤器中多出的摘要只会造成假阳性，不影响正确性
+	addDigestsToFilter(records)
+	if result.RowsAffected > 0 {
+		// 其他进程的摘要过滤器据此发现新写入的记录
+		if err := bumpMd5Generation(tx); err != nil {
+			return 0, err
+		}
+	}
+	return result.RowsAffected, nil
+}
+
+// RecordMd5Hit 记录一次明文命中，累加命中次数并更新最后命中时间
+func RecordMd5Hit(tx *gorm.DB, id uint) error {
+	return tx.Model(&dbModel.Md5{}).Where("id = ?", id).UpdateColumns(map[string]interface{}{
+		"hit_count":   gorm.Expr("hit_count + 1"),
+		"last_hit_at": time.Now(),
+	}).Error
+}
+
+// MarkMd5Reproduced 标记已存在的MD5记录又被其他来源提交了一次
+// importJobID大于0时，同一导入任务内的重复提交不计入
+func MarkMd5Reproduced(tx *gorm.DB, md5s []string, importJobID uint) error {
+	if len(md5s) == 0 {
+		return nil
+	}
+	query := tx.Model(&dbModel.Md5{}).Where("digest IN ?", HashesToDigests(md5s))
+	if importJobID > 0 {
+		query = query.Where("import_job_id <> ?", importJobID)
+	}
+	return query.UpdateColumn("source_count", gorm.Expr("source_count + 1")).Error
+}
+
+// ExistingMd5s 返回md5s中已存在于明文库的32位哈希（十六进制小写）
+func ExistingMd5s(tx *gorm.DB, md5s []string) ([]string, error) {
+	digests := HashesToDigests(md5s)
+	if len(digests) == 0 {
+		return nil, nil
+	}
+	var existing [][]byte
+	if err := tx.Model(&dbModel.Md5{}).Where("digest IN ?", digests).Pluck("digest", &existing).Error; err != nil {
+		return nil, err
+	}
+	result := make([]string, 0, len(existing))
+	for _, digest := range existing {
+		result = append(result, hex.EncodeToString(digest))
+	}
+	return result, nil
+}
@@ -0,0 +1,255 @@
+package db
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Migration 一个版本化的表结构变更
+// Up/Down 接收的连接在事务中执行，NoTx 为 true 时直接在连接上执行（如 PostgreSQL 的 CREATE INDEX CONCURRENTLY 不能在事务中运行）
+type Migration struct {
+	Version int64
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+	NoTx    bool
+}
+
+// SchemaMigration 已执行的迁移记录
+type SchemaMigration struct {
+	Version   int64     `json:"version" gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `json:"name" gorm:"type:varchar(255)"`
+	AppliedAt time.Time `json:"applied_at"`
+}
+
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// MigrationStatus 迁移的执行状态
+type MigrationStatus struct {
+	Version   int64      `json:"version"`
+	Name      string     `json:"name"`
+	Applied   bool       `json:"applied"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+	// 数据库中已执行但当前程序中不存在的迁移（通常是由更新版本的程序执行的）
+	Unknown bool `json:"unknown,omitempty"`
+}
+
+// SQL 返回依次执行多条SQL语句的迁移函数，按方言选择语句时使用 DialectSQL
+func SQL(statements ...string) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		for _, statement := range statements {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// DialectSQL 按数据库方言选择迁移函数，未列出的方言报错
+func DialectSQL(byDialect map[string]func(tx *gorm.DB) error) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		fn, ok := byDialect[tx.Dialector.Name()]
+		if !ok {
+			return fmt.Errorf("迁移不支持数据库方言: %s", tx.Dialector.Name())
+		}
+		return fn(tx)
+	}
+}
+
+// sortedMigrations 返回按版本排序的迁移列表，并检查版本号是否重复
+func sortedMigrations() ([]Migration, error) {
+	list := make([]Migration, len(migrations))
+	copy(list, migrations)
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	for i := 1; i < len(list); i++ {
+		if list[i].Version == list[i-1].Version {
+			return nil, fmt.Errorf("迁移版本号重复: %d", list[i].Version)
+		}
+	}
+	return list, nil
+}
+
+// appliedMigrations 返回已执行的迁移，以版本号为键
+func appliedMigrations(conn *gorm.DB) (map[int64]SchemaMigration, error) {
+	if err := conn.AutoMigrate(&SchemaMigration{}); err != nil {
+		return nil, fmt.Errorf("创建迁移记录表失败: %v", err)
+	}
+
+	var rows []SchemaMigration
+	if err := conn.Order("version").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	applied := make(map[int64]SchemaMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+// Migrate 依次执行所有未执行的迁移，to 大于0时只执行到该版本，返回执行的迁移数量
+func Migrate(to int64) (int, error) {
+	return MigrateDB(PG, to)
+}
+
+// MigrateDB 对指定的数据库连接执行迁移，用于在数据迁移时准备目标数据库
+func MigrateDB(conn *gorm.DB, to int64) (int, error) {
+	list, err := sortedMigrations()
+	if err != nil {
+		return 0, err
+	}
+	applied, err := appliedMigrations(conn)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, m := range list {
+		if to > 0 && m.Version > to {
+			break
+		}
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+
+		log.Printf("执行迁移 %d_%s", m.Version, m.Name)
+		record := SchemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}
+		err := runMigration(conn, m.NoTx, func(tx *gorm.DB) error {
+			if err := m.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&record).Error
+		})
+		if err != nil {
+			return count, fmt.Errorf("迁移 %d_%s 执行失败: %v", m.Version, m.Name, err)
+		}
+		count++
+	}
+	return count, nil
+}
+
+// Rollback 按版本从新到旧回滚最近执行的 steps 个迁移，返回回滚的迁移数量
+func Rollback(steps int) (int, error) {
+	list, err := sortedMigrations()
+	if err != nil {
+		return 0, err
+	}
+	applied, err := appliedMigrations(PG)
+	if err != nil {
+		return 0, err
+	}
+
+	byVersion := make(map[int64]Migration, len(list))
+	for _, m := range list {
+		byVersion[m.Version] = m
+	}
+	versions := make([]int64, 0, len(applied))
+	for version := range applied {
+		versions = append(versions, version)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] > versions[j] })
+
+	count := 0
+	for _, version := range versions {
+		if count >= steps {
+			break
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			return count, fmt.Errorf("迁移 %d 不在当前程序中，无法回滚", version)
+		}
+		if m.Down == nil {
+			return count, fmt.Errorf("迁移 %d_%s 不支持回滚", m.Version, m.Name)
+		}
+
+		log.Printf("回滚迁移 %d_%s", m.Version, m.Name)
+		err := runMigration(PG, m.NoTx, func(tx *gorm.DB) error {
+			if err := m.Down(tx); err != nil {
+				return err
+			}
+			return tx.Delete(&SchemaMigration{}, "version = ?", m.Version).Error
+		})
+		if err != nil {
+			return count, fmt.Errorf("迁移 %d_%s 回滚失败: %v", m.Version, m.Name, err)
+		}
+		count++
+	}
+	return count, nil
+}
+
+// runMigration 在事务中执行迁移，noTx 为 true 时直接执行
+func runMigration(conn *gorm.DB, noTx bool, fn func(tx *gorm.DB) error) error {
+	if noTx {
+		return fn(conn)
+	}
+	return conn.Transaction(fn)
+}
+
+// MigrationStatuses 返回所有迁移的执行状态，按版本排序
+func MigrationStatuses() ([]MigrationStatus, error) {
+	return migrationStatuses(PG)
+}
+
+func migrationStatuses(conn *gorm.DB) ([]MigrationStatus, error) {
+	list, err := sortedMigrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(list))
+	known := make(map[int64]bool, len(list))
+	for _, m := range list {
+		known[m.Version] = true
+		status := MigrationStatus{Version: m.Version, Name: m.Name}
+		if row, ok := applied[m.Version]; ok {
+			status.Applied = true
+			appliedAt := row.AppliedAt
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	for version, row := range applied {
+		if known[version] {
+			continue
+		}
+		appliedAt := row.AppliedAt
+		statuses = append(statuses, MigrationStatus{
+			Version:   version,
+			Name:      row.Name,
+			Applied:   true,
+			AppliedAt: &appliedAt,
+			Unknown:   true,
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, nil
+}
+
+// PendingMigrations 返回未执行的迁移数量
+func PendingMigrations() (int, error) {
+	return pendingMigrations(PG)
+}
+
+func pendingMigrations(conn *gorm.DB) (int, error) {
+	statuses, err := migrationStatuses(conn)
+	if err != nil {
+		return 0, err
+	}
+	pending := 0
+	for _, status := range statuses {
+		if !status.Applied {
+			pending++
+		}
+	}
+	return pending, nil
+}
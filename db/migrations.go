@@ -0,0 +1,562 @@
+package db
+
+import (
+	"crypto/sha256"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// migrations 所有表结构迁移，新增迁移时追加到末尾并使用递增的版本号
+// 迁移一旦发布不能再修改，表结构变化需要新增迁移，而不是修改 dbModel 后依赖自动建表
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "baseline",
+		Up:      baselineUp,
+		Down:    baselineDown,
+	},
+	{
+		Version: 2,
+		Name:    "api_keys",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&v2APIKey{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&v2APIKey{})
+		},
+	},
+	{
+		Version: 3,
+		Name:    "refresh_tokens",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Migrator().AddColumn(&v3User{}, "TokenVersion"); err != nil {
+				return err
+			}
+			return tx.AutoMigrate(&v3RefreshToken{})
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropTable(&v3RefreshToken{}); err != nil {
+				return err
+			}
+			if err := tx.Migrator().DropColumn(&v3User{}, "TokenVersion"); err != nil {
+				return err
+			}
+			// SQLite 删除列时会重建表，需要补回基线的索引
+			return tx.AutoMigrate(&baselineUser{})
+		},
+	},
+	{
+		Version: 4,
+		Name:    "role_permissions",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.AutoMigrate(&v4RolePermission{}); err != nil {
+				return err
+			}
+			return tx.Create(v4DefaultRolePermissions()).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&v4RolePermission{})
+		},
+	},
+	{
+		Version: 5,
+		Name:    "user_management",
+		Up: func(tx *gorm.DB) error {
+			for _, column := range v5UserColumns {
+				if err := tx.Migrator().AddColumn(&v5User{}, column); err != nil {
+					return err
+				}
+			}
+			// 审计角色可以查看用户列表
+			return tx.Create(&v4RolePermission{Role: "auditor", Permission: "users:read"}).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Where("role = ? AND permission = ?", "auditor", "users:read").Delete(&v4RolePermission{}).Error; err != nil {
+				return err
+			}
+			for _, column := range v5UserColumns {
+				if err := tx.Migrator().DropColumn(&v5User{}, column); err != nil {
+					return err
+				}
+			}
+			// SQLite 删除列时会重建表，需要补回基线的索引
+			return tx.AutoMigrate(&baselineUser{})
+		},
+	},
+	{
+		Version: 6,
+		Name:    "login_attempts",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&v6LoginAttempt{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&v6LoginAttempt{})
+		},
+	},
+	{
+		Version: 7,
+		Name:    "two_factor",
+		Up: func(tx *gorm.DB) error {
+			for _, column := range v7UserColumns {
+				if err := tx.Migrator().AddColumn(&v7User{}, column); err != nil {
+					return err
+				}
+			}
+			return tx.AutoMigrate(&v7RecoveryCode{}, &v7RoleSetting{})
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropTable(&v7RecoveryCode{}, &v7RoleSetting{}); err != nil {
+				return err
+			}
+			for _, column := range v7UserColumns {
+				if err := tx.Migrator().DropColumn(&v7User{}, column); err != nil {
+					return err
+				}
+			}
+			// SQLite 删除列时会重建表，需要补回基线的索引
+			return tx.AutoMigrate(&baselineUser{})
+		},
+	},
+	{
+		Version: 8,
+		Name:    "registration",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Migrator().AddColumn(&v8User{}, "PendingApproval"); err != nil {
+				return err
+			}
+			return tx.AutoMigrate(&v8InviteCode{})
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropTable(&v8InviteCode{}); err != nil {
+				return err
+			}
+			if err := tx.Migrator().DropColumn(&v8User{}, "PendingApproval"); err != nil {
+				return err
+			}
+			return tx.AutoMigrate(&baselineUser{})
+		},
+	},
+	{
+		Version: 9,
+		Name:    "private_mode",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().AddColumn(&v9User{}, "PrivateMode")
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropColumn(&v9User{}, "PrivateMode"); err != nil {
+				return err
+			}
+			return tx.AutoMigrate(&baselineUser{})
+		},
+	},
+	{
+		Version: 10,
+		Name:    "audit_logs",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.AutoMigrate(&v10AuditLog{}); err != nil {
+				return err
+			}
+			// 审计角色可以查看审计日志
+			return tx.Create(&v4RolePermission{Role: "auditor", Permission: "audit:read"}).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Where("role = ? AND permission = ?", "auditor", "audit:read").Delete(&v4RolePermission{}).Error; err != nil {
+				return err
+			}
+			return tx.Migrator().DropTable(&v10AuditLog{})
+		},
+	},
+	{
+		Version: 11,
+		Name:    "task_checkpoints",
+		Up: func(tx *gorm.DB) error {
+			for _, column := range []string{"ChainID", "ChainPosition", "CurrentHash"} {
+				if err := tx.Migrator().AddColumn(&v11TaskProgressRecord{}, column); err != nil {
+					return err
+				}
+			}
+			for _, column := range []string{"FilePath", "ResumeLine"} {
+				if err := tx.Migrator().AddColumn(&v11ImportJob{}, column); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			for _, column := range []string{"ChainID", "ChainPosition", "CurrentHash"} {
+				if err := tx.Migrator().DropColumn(&v11TaskProgressRecord{}, column); err != nil {
+					return err
+				}
+			}
+			for _, column := range []string{"FilePath", "ResumeLine"} {
+				if err := tx.Migrator().DropColumn(&v11ImportJob{}, column); err != nil {
+					return err
+				}
+			}
+			// SQLite 删除列时会重建表，需要补回基线的索引
+			return tx.AutoMigrate(&baselineTaskProgressRecord{}, &baselineImportJob{})
+		},
+	},
+	{
+		// 历史数据存在重复时执行失败，需先执行 `zmd5 dedup`
+		Version: Md5UniqueIndexesVersion,
+		Name:    "md5_unique_indexes",
+		Up:      createMd5UniqueIndexes,
+		Down:    dropMd5UniqueIndexes,
+	},
+	{
+		Version: 13,
+		Name:    "md5_writers",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.AutoMigrate(&v13Md5Writer{}); err != nil {
+				return err
+			}
+			// 每个数据库写入一条随机标识，使不同数据库的写入状态不会相同，避免加载其他数据库的过滤器快照
+			return tx.Create(&v13Md5Writer{Writer: randomWriterID(), UpdatedAt: time.Now()}).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&v13Md5Writer{})
+		},
+	},
+	{
+		Version: 14,
+		Name:    "recovery_code_bcrypt",
+		Up:      bcryptRecoveryCodes,
+		Down: func(tx *gorm.DB) error {
+			// bcrypt摘要无法还原为SHA-256摘要，回滚后用户需要重新生成恢复码
+			return tx.Where("1 = 1").Delete(&v7RecoveryCode{}).Error
+		},
+	},
+}
+
+// bcryptRecoveryCodes 将迁移前保存的恢复码SHA-256摘要转换为 bcrypt(SHA-256摘要)
+// 与 utils.HashRecoveryCode 的计算方式一致，已有的恢复码无需重新生成
+func bcryptRecoveryCodes(tx *gorm.DB) error {
+	var codes []v7RecoveryCode
+	if err := tx.Where("used_at IS NULL AND LENGTH(code_hash) = ?", sha256.Size*2).Find(&codes).Error; err != nil {
+		return err
+	}
+	for _, code := range codes {
+		hash, err := bcrypt.GenerateFromPassword([]byte(code.CodeHash), bcrypt.DefaultCost)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&v7RecoveryCode{}).Where("id = ?", code.ID).Update("code_hash", string(hash)).Error; err != nil {
+			return err
+		}
+	}
+	// 已使用的恢复码不再需要摘要
+	return tx.Model(&v7RecoveryCode{}).Where("used_at IS NOT NULL").Update("code_hash", "").Error
+}
+
+// 以下为基线迁移时的表结构快照，与 dbModel 中的模型相互独立，后续修改模型不影响基线迁移
+// 已有数据库执行基线迁移时只会补齐缺少的表和列
+
+type baselineUser struct {
+	gorm.Model
+	Username string `gorm:"unique"`
+	Password string
+	Role     string `gorm:"default:user"`
+	Token    string
+}
+
+func (baselineUser) TableName() string { return "users" }
+
+type baselineMd5 struct {
+	gorm.Model
+	Plaintext       string
+	PlaintextDigest string `gorm:"type:varchar(64)"`
+	Digest          []byte
+	Digest16        []byte `gorm:"index:idx_md5_digest16"`
+	Encoding        string `gorm:"type:varchar(16);default:utf8"`
+	Source          string `gorm:"type:varchar(32);index:idx_md5_source"`
+	UserID          uint   `gorm:"index:idx_md5_user_id"`
+	ImportJobID     uint   `gorm:"index:idx_md5_import_job_id"`
+	Filename        string `gorm:"type:varchar(255)"`
+	SourceCount     int    `gorm:"default:1"`
+	HitCount        int64  `gorm:"default:0"`
+	LastHitAt       *time.Time
+}
+
+func (baselineMd5) TableName() string { return "md5" }
+
+type baselineMD5Record struct {
+	gorm.Model
+	PlainText     string `gorm:"type:text"`
+	UserID        uint   `gorm:"index:idx_md5_records_user_id"`
+	Hash          string `gorm:"type:varchar(32);index:idx_md5_records_hash"`
+	Type          int    `gorm:"type:int;default:1"`
+	Status        int    `gorm:"type:int;default:1"`
+	DecryptStatus int    `gorm:"type:int;default:0"`
+	Progress      int    `gorm:"type:int;default:0"`
+}
+
+func (baselineMD5Record) TableName() string { return "md5_records" }
+
+type baselineRainbowTable struct {
+	gorm.Model
+	ChainLength       int    `gorm:"type:int;default:1000"`
+	StartPlaintext    string `gorm:"type:text;not null"`
+	EndHash           string `gorm:"type:varchar(32);index:idx_end_hash;not null"`
+	ReductionFunction int    `gorm:"type:int"`
+	CharsetType       int    `gorm:"type:int;default:1"`
+	MinLength         int    `gorm:"type:int;default:3"`
+	MaxLength         int    `gorm:"type:int;default:8"`
+	CharsetRange      string `gorm:"type:varchar(100)"`
+}
+
+func (baselineRainbowTable) TableName() string { return "rainbow_tables" }
+
+type baselineTaskProgressRecord struct {
+	gorm.Model
+	TaskID            uint `gorm:"index:idx_task_progress_records_task_id;unique"`
+	TablesSearched    int
+	TotalTables       int
+	ChainsSearched    int
+	ReductionAttempts int
+}
+
+func (baselineTaskProgressRecord) TableName() string { return "task_progress_records" }
+
+type baselineImportJob struct {
+	gorm.Model
+	UserID    uint   `gorm:"index:idx_import_jobs_user_id"`
+	Filename  string `gorm:"type:varchar(255)"`
+	Encodings string `gorm:"type:varchar(64)"`
+	Status    int    `gorm:"type:int;default:1"`
+	Processed int64  `gorm:"default:0"`
+	Added     int64  `gorm:"default:0"`
+	Error     string `gorm:"type:text"`
+}
+
+func (baselineImportJob) TableName() string { return "import_jobs" }
+
+type baselineBackgroundJob struct {
+	gorm.Model
+	Kind      string `gorm:"type:varchar(32);index:idx_background_jobs_kind"`
+	UserID    uint   `gorm:"index:idx_background_jobs_user_id"`
+	Params    string `gorm:"type:text"`
+	Status    int    `gorm:"type:int;default:1"`
+	Total     int64  `gorm:"default:0"`
+	Processed int64  `gorm:"default:0"`
+	Result    string `gorm:"type:text"`
+	Error     string `gorm:"type:text"`
+}
+
+func (baselineBackgroundJob) TableName() string { return "background_jobs" }
+
+func baselineModels() []interface{} {
+	return []interface{}{
+		&baselineUser{}, &baselineMd5{}, &baselineMD5Record{}, &baselineRainbowTable{},
+		&baselineTaskProgressRecord{}, &baselineImportJob{}, &baselineBackgroundJob{},
+	}
+}
+
+// baselineUp 创建基线表结构
+// 明文库唯一索引可能因历史重复数据创建失败，由去重任务清理后在迁移 Md5UniqueIndexesVersion 中创建
+func baselineUp(tx *gorm.DB) error {
+	return tx.AutoMigrate(baselineModels()...)
+}
+
+// baselineDown 删除基线创建的所有表
+func baselineDown(tx *gorm.DB) error {
+	return tx.Migrator().DropTable(baselineModels()...)
+}
+
+// v2APIKey 迁移2创建的API密钥表
+type v2APIKey struct {
+	gorm.Model
+	UserID     uint   `gorm:"index:idx_api_keys_user_id"`
+	Name       string `gorm:"type:varchar(64)"`
+	Prefix     string `gorm:"type:varchar(16)"`
+	KeyHash    string `gorm:"type:varchar(64);uniqueIndex:idx_api_keys_key_hash"`
+	Scopes     string `gorm:"type:varchar(255)"`
+	LastUsedAt *time.Time
+	ExpiresAt  *time.Time
+	RevokedAt  *time.Time
+}
+
+func (v2APIKey) TableName() string { return "api_keys" }
+
+// v3User 迁移3为用户表增加的令牌版本列
+type v3User struct {
+	TokenVersion int `gorm:"not null;default:0"`
+}
+
+func (v3User) TableName() string { return "users" }
+
+// v3RefreshToken 迁移3创建的刷新令牌表
+type v3RefreshToken struct {
+	gorm.Model
+	UserID    uint      `gorm:"index:idx_refresh_tokens_user_id"`
+	FamilyID  string    `gorm:"type:varchar(32);index:idx_refresh_tokens_family_id"`
+	TokenHash string    `gorm:"type:varchar(64);uniqueIndex:idx_refresh_tokens_token_hash"`
+	ExpiresAt time.Time `gorm:"index:idx_refresh_tokens_expires_at"`
+	RevokedAt *time.Time
+	UserAgent string `gorm:"type:varchar(255)"`
+	IP        string `gorm:"type:varchar(64)"`
+}
+
+func (v3RefreshToken) TableName() string { return "refresh_tokens" }
+
+// v4RolePermission 迁移4创建的角色权限表
+type v4RolePermission struct {
+	ID         uint   `gorm:"primarykey"`
+	Role       string `gorm:"type:varchar(32);uniqueIndex:idx_role_permissions_role_permission"`
+	Permission string `gorm:"type:varchar(64);uniqueIndex:idx_role_permissions_role_permission"`
+	CreatedAt  time.Time
+}
+
+func (v4RolePermission) TableName() string { return "role_permissions" }
+
+// v4DefaultRolePermissions 内置角色的默认权限，管理员拥有全部权限不需要保存
+func v4DefaultRolePermissions() []v4RolePermission {
+	defaults := map[string][]string{
+		// 运维：导入明文、生成彩虹表，不能删除数据和管理用户
+		"operator": {"stats:read", "md5:read", "md5:import", "jobs:read", "jobs:manage",
+			"rainbow:read", "rainbow:write", "tasks:read", "tasks:manage"},
+		// 审计：只读
+		"auditor": {"stats:read", "md5:read", "jobs:read", "rainbow:read", "tasks:read", "roles:read"},
+	}
+	var rows []v4RolePermission
+	for _, role := range []string{"operator", "auditor"} {
+		for _, perm := range defaults[role] {
+			rows = append(rows, v4RolePermission{Role: role, Permission: perm})
+		}
+	}
+	return rows
+}
+
+// v5User 迁移5为用户表增加的账户状态列
+type v5User struct {
+	Disabled          bool `gorm:"not null;default:false"`
+	LockedUntil       *time.Time
+	MustResetPassword bool `gorm:"not null;default:false"`
+	LastLoginAt       *time.Time
+}
+
+func (v5User) TableName() string { return "users" }
+
+var v5UserColumns = []string{"Disabled", "LockedUntil", "MustResetPassword", "LastLoginAt"}
+
+// v6LoginAttempt 迁移6创建的登录尝试审计表
+type v6LoginAttempt struct {
+	ID        uint      `gorm:"primarykey"`
+	CreatedAt time.Time `gorm:"index:idx_login_attempts_created_at"`
+	Username  string    `gorm:"type:varchar(64);index:idx_login_attempts_username"`
+	UserID    uint
+	IP        string `gorm:"type:varchar(64);index:idx_login_attempts_ip"`
+	UserAgent string `gorm:"type:varchar(255)"`
+	Success   bool
+	Result    string `gorm:"type:varchar(32)"`
+}
+
+func (v6LoginAttempt) TableName() string { return "login_attempts" }
+
+// v7User 迁移7为用户表增加的两步验证列
+type v7User struct {
+	TOTPSecret   string `gorm:"type:varchar(64)"`
+	TOTPEnabled  bool   `gorm:"not null;default:false"`
+	TOTPLastStep int64  `gorm:"not null;default:0"`
+}
+
+func (v7User) TableName() string { return "users" }
+
+var v7UserColumns = []string{"TOTPSecret", "TOTPEnabled", "TOTPLastStep"}
+
+// v7RecoveryCode 迁移7创建的两步验证恢复码表
+type v7RecoveryCode struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UserID    uint   `gorm:"index:idx_recovery_codes_user_id"`
+	CodeHash  string `gorm:"type:varchar(64)"`
+	UsedAt    *time.Time
+}
+
+func (v7RecoveryCode) TableName() string { return "recovery_codes" }
+
+// v7RoleSetting 迁移7创建的角色安全设置表
+type v7RoleSetting struct {
+	Role             string `gorm:"type:varchar(32);primaryKey"`
+	RequireTwoFactor bool   `gorm:"not null;default:false"`
+	UpdatedAt        time.Time
+}
+
+func (v7RoleSetting) TableName() string { return "role_settings" }
+
+// v8User 迁移8为用户表增加的待审核列
+type v8User struct {
+	PendingApproval bool `gorm:"not null;default:false"`
+}
+
+func (v8User) TableName() string { return "users" }
+
+// v8InviteCode 迁移8创建的注册邀请码表
+type v8InviteCode struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	CreatedBy uint
+	Prefix    string `gorm:"type:varchar(16)"`
+	CodeHash  string `gorm:"type:varchar(64);uniqueIndex:idx_invite_codes_code_hash"`
+	Role      string `gorm:"type:varchar(32)"`
+	MaxUses   int    `gorm:"not null;default:1"`
+	Uses      int    `gorm:"not null;default:0"`
+	ExpiresAt *time.Time
+	RevokedAt *time.Time
+	Note      string `gorm:"type:varchar(255)"`
+}
+
+func (v8InviteCode) TableName() string { return "invite_codes" }
+
+// v9User 迁移9为用户表增加的隐私模式列
+type v9User struct {
+	PrivateMode bool `gorm:"not null;default:false"`
+}
+
+func (v9User) TableName() string { return "users" }
+
+// v10AuditLog 迁移10创建的审计日志表
+type v10AuditLog struct {
+	ID        uint      `gorm:"primarykey"`
+	CreatedAt time.Time `gorm:"index:idx_audit_logs_created_at"`
+	ActorID   uint      `gorm:"index:idx_audit_logs_actor_id"`
+	ActorName string    `gorm:"type:varchar(64)"`
+	APIKeyID  uint
+	Action    string `gorm:"type:varchar(64);index:idx_audit_logs_action"`
+	Target    string `gorm:"type:varchar(255)"`
+	Params    string `gorm:"type:text"`
+	IP        string `gorm:"type:varchar(64)"`
+	Status    int
+	Success   bool
+	Message   string `gorm:"type:varchar(255)"`
+}
+
+func (v10AuditLog) TableName() string { return "audit_logs" }
+
+// v11TaskProgressRecord 迁移11为任务进度表增加的检查点列
+type v11TaskProgressRecord struct {
+	ChainID       uint   `gorm:"not null;default:0"`
+	ChainPosition int    `gorm:"not null;default:0"`
+	CurrentHash   string `gorm:"type:varchar(32)"`
+}
+
+func (v11TaskProgressRecord) TableName() string { return "task_progress_records" }
+
+// v11ImportJob 迁移11为导入任务表增加的检查点列
+type v11ImportJob struct {
+	FilePath   string `gorm:"type:varchar(512)"`
+	ResumeLine int64  `gorm:"not null;default:0"`
+}
+
+func (v11ImportJob) TableName() string { return "import_jobs" }
+
+// v13Md5Writer 迁移13创建的明文库写入状态表
+type v13Md5Writer struct {
+	Writer     string `gorm:"primaryKey;type:varchar(32)"`
+	Generation int64
+	UpdatedAt  time.Time
+}
+
+func (v13Md5Writer) TableName() string { return "md5_writers" }
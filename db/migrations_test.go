@@ -0,0 +1,60 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+	"zmd5/config"
+	"zmd5/db/dbModel"
+	"zmd5/utils"
+)
+
+func TestBcryptRecoveryCodesMigration(t *testing.T) {
+	conn, err := Open(config.DatabaseConfig{Driver: DriverSQLite, DSN: filepath.Join(t.TempDir(), "test.db")})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := conn.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	PG = conn
+	if _, err := Migrate(13); err != nil {
+		t.Fatalf("执行迁移失败: %v", err)
+	}
+
+	// 迁移前恢复码只保存规范化后的SHA-256摘要
+	usedAt := time.Now()
+	legacy := []v7RecoveryCode{
+		{UserID: 1, CodeHash: utils.HashAPIKey("abcdefghjk")},
+		{UserID: 1, CodeHash: utils.HashAPIKey("mnpqrstuvw"), UsedAt: &usedAt},
+	}
+	if err := conn.Create(&legacy).Error; err != nil {
+		t.Fatalf("写入恢复码失败: %v", err)
+	}
+	if _, err := Migrate(14); err != nil {
+		t.Fatalf("执行迁移失败: %v", err)
+	}
+
+	var codes []dbModel.RecoveryCode
+	conn.Order("id").Find(&codes)
+	if len(codes) != 2 {
+		t.Fatalf("恢复码数量 = %d", len(codes))
+	}
+	if !utils.CheckRecoveryCode("ABCDE-FGHJK", codes[0].CodeHash) {
+		t.Fatal("迁移后的恢复码无法验证")
+	}
+	if codes[1].CodeHash != "" {
+		t.Fatal("已使用的恢复码摘要应被清除")
+	}
+
+	if _, err := Rollback(1); err != nil {
+		t.Fatalf("回滚迁移失败: %v", err)
+	}
+	var count int64
+	conn.Model(&dbModel.RecoveryCode{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("回滚后应删除无法验证的恢复码, 剩余 %d 个", count)
+	}
+}
@@ -0,0 +1,127 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"zmd5/db/dbModel"
+
+	"gorm.io/gorm"
+)
+
+// transferTable 数据迁移时复制的表，rows 为指向模型切片的指针，用于分批读取和写入
+type transferTable struct {
+	name string
+	rows func() interface{}
+}
+
+// transferTables 在不同存储之间迁移数据时复制的表，新增数据表时需要加入该列表
+// md5_writers 记录的是源数据库的写入状态，不复制，复制完成后在目标数据库中记录一次写入
+var transferTables = []transferTable{
+	{"users", func() interface{} { return &[]dbModel.User{} }},
+	{"md5", func() interface{} { return &[]dbModel.Md5{} }},
+	{"md5_records", func() interface{} { return &[]dbModel.MD5Record{} }},
+	{"rainbow_tables", func() interface{} { return &[]dbModel.RainbowTable{} }},
+	{"task_progress_records", func() interface{} { return &[]dbModel.TaskProgressRecord{} }},
+	{"import_jobs", func() interface{} { return &[]dbModel.ImportJob{} }},
+	{"background_jobs", func() interface{} { return &[]dbModel.BackgroundJob{} }},
+	{"api_keys", func() interface{} { return &[]dbModel.APIKey{} }},
+	{"refresh_tokens", func() interface{} { return &[]dbModel.RefreshToken{} }},
+	{"role_permissions", func() interface{} { return &[]dbModel.RolePermission{} }},
+	{"login_attempts", func() interface{} { return &[]dbModel.LoginAttempt{} }},
+	{"recovery_codes", func() interface{} { return &[]dbModel.RecoveryCode{} }},
+	{"role_settings", func() interface{} { return &[]dbModel.RoleSetting{} }},
+	{"invite_codes", func() interface{} { return &[]dbModel.InviteCode{} }},
+	{"audit_logs", func() interface{} { return &[]dbModel.AuditLog{} }},
+}
+
+// seededTables 迁移时写入默认数据的表，复制前先清空目标数据库中的默认数据
+var seededTables = map[string]bool{
+	"role_permissions": true,
+}
+
+// Transfer 将源数据库的全部数据复制到目标数据库，用于在嵌入式SQLite和PostgreSQL之间迁移数据
+// 目标数据库会先执行迁移，且所有数据表必须为空；记录保留原有ID（包括已软删除的记录）
+func Transfer(ctx context.Context, src, dst *gorm.DB, batchSize int, progress ProgressReporter) error {
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+
+	// 源数据库必须已完成迁移和摘要转换，保证两端表结构一致
+	pending, err := pendingMigrations(src)
+	if err != nil {
+		return fmt.Errorf("读取源数据库迁移状态失败: %v", err)
+	}
+	if pending > 0 {
+		return fmt.Errorf("源数据库存在%d个未执行的迁移，请先执行 `zmd5 migrate`", pending)
+	}
+	if hasColumn(src, "md5", "md5") {
+		return fmt.Errorf("源数据库仍有旧的十六进制MD5列，请先执行 `zmd5 convert-digests`")
+	}
+
+	if _, err := MigrateDB(dst, 0); err != nil {
+		return fmt.Errorf("目标数据库迁移失败: %v", err)
+	}
+
+	var total int64
+	for _, table := range transferTables {
+		var count int64
+		if err := dst.Table(table.name).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 && !seededTables[table.name] {
+			return fmt.Errorf("目标数据库的%s表不为空，只能迁移到空数据库", table.name)
+		}
+		if err := src.Table(table.name).Count(&count).Error; err != nil {
+			return err
+		}
+		total += count
+	}
+	progress.SetTotal(total)
+
+	for _, table := range transferTables {
+		log.Printf("数据迁移: 开始复制%s表", table.name)
+		rows := table.rows()
+		if seededTables[table.name] {
+			if err := dst.Exec("DELETE FROM " + table.name).Error; err != nil {
+				return fmt.Errorf("清空%s表的默认数据失败: %v", table.name, err)
+			}
+		}
+		// 保留原始数据，跳过模型的钩子
+		writer := dst.Session(&gorm.Session{SkipHooks: true})
+		err := src.Unscoped().FindInBatches(rows, batchSize, func(tx *gorm.DB, batch int) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := writer.Create(rows).Error; err != nil {
+				return err
+			}
+			progress.Add(tx.RowsAffected)
+			return nil
+		}).Error
+		if err != nil {
+			return fmt.Errorf("复制%s表失败: %v", table.name, err)
+		}
+	}
+
+	if err := bumpMd5Generation(dst); err != nil {
+		return err
+	}
+	return resetSequences(dst)
+}
+
+// resetSequences 显式写入ID后，PostgreSQL的自增序列需要调整到当前最大ID之后
+// SQLite的自增值由已有的最大ID决定，无需处理
+func resetSequences(conn *gorm.DB) error {
+	if conn.Dialector.Name() != DriverPostgres {
+		return nil
+	}
+	for _, table := range transferTables {
+		err := conn.Exec("SELECT setval(pg_get_serial_sequence(?, 'id'), (SELECT COALESCE(MAX(id), 0) + 1 FROM "+
+			table.name+"), false)", table.name).Error
+		if err != nil {
+			return fmt.Errorf("重置%s表的自增序列失败: %v", table.name, err)
+		}
+	}
+	return nil
+}
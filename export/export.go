@@ -0,0 +1,252 @@
+package export
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+	"zmd5/db"
+	"zmd5/db/dbModel"
+	"zmd5/utils"
+)
+
+// 导出格式常量定义
+const (
+	FormatWordlist = "wordlist" // 纯字典，每行一个明文
+	FormatPotfile  = "potfile"  // hashcat potfile，每行 hash:明文
+	FormatCSV      = "csv"      // CSV表格
+	FormatNDJSON   = "ndjson"   // gzip压缩的NDJSON
+)
+
+// DefaultBatchSize 每批次从数据库读取的行数
+const DefaultBatchSize = 5000
+
+// Options 导出参数
+type Options struct {
+	// 导出格式
+	Format string
+	// 过滤条件
+	Filter db.Md5Filter
+	// 每批次读取的行数，为0时使用DefaultBatchSize
+	BatchSize int
+}
+
+// Record NDJSON导出的单行结构
+type Record struct {
+	ID        uint      `json:"id"`
+	Plaintext string    `json:"plaintext"`
+	MD5       string    `json:"md5"`
+	MD5_16    string    `json:"md5_16"`
+	Encoding  string    `json:"encoding"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ValidFormat 检查导出格式是否受支持
+func ValidFormat(format string) bool {
+	switch format {
+	case FormatWordlist, FormatPotfile, FormatCSV, FormatNDJSON:
+		return true
+	}
+	return false
+}
+
+// ContentType 返回导出格式对应的MIME类型
+func ContentType(format string) string {
+	switch format {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatNDJSON:
+		return "application/gzip"
+	default:
+		return "text/plain; charset=utf-8"
+	}
+}
+
+// FileName 返回导出格式对应的默认文件名
+func FileName(format string) string {
+	date := time.Now().Format("20060102")
+	switch format {
+	case FormatPotfile:
+		return "zmd5_" + date + ".potfile"
+	case FormatCSV:
+		return "zmd5_" + date + ".csv"
+	case FormatNDJSON:
+		return "zmd5_" + date + ".ndjson.gz"
+	default:
+		return "zmd5_" + date + ".txt"
+	}
+}
+
+// rowWriter 按格式写出单行记录
+type rowWriter interface {
+	Write(record *dbModel.Md5) error
+	Close() error
+}
+
+// Export 将明文库按过滤条件流式写出到w，返回导出的行数
+// 使用基于主键的键集分页（WHERE id > ? ORDER BY id LIMIT ?），避免大偏移量导致的慢查询
+func Export(ctx context.Context, w io.Writer, opts Options) (int64, error) {
+	if !ValidFormat(opts.Format) {
+		return 0, fmt.Errorf("不支持的导出格式: %s", opts.Format)
+	}
+
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+
+	buffered := bufio.NewWriterSize(w, 256*1024)
+	writer, err := newRowWriter(buffered, opts.Format)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int64
+	var lastID uint
+	for {
+		if err := ctx.Err(); err != nil {
+			return count, err
+		}
+
+		var records []dbModel.Md5
+		query := opts.Filter.Apply(db.PG.WithContext(ctx).Model(&dbModel.Md5{}))
+		if err := query.Select("id", "plaintext", "digest", "encoding", "created_at").
+			Where("id > ?", lastID).
+			Order("id ASC").
+			Limit(batchSize).
+			Find(&records).Error; err != nil {
+			return count, fmt.Errorf("查询明文记录失败: %v", err)
+		}
+
+		for i := range records {
+			if err := writer.Write(&records[i]); err != nil {
+				return count, err
+			}
+			count++
+		}
+
+		if len(records) < batchSize {
+			break
+		}
+		lastID = records[len(records)-1].ID
+	}
+
+	if err := writer.Close(); err != nil {
+		return count, err
+	}
+	return count, buffered.Flush()
+}
+
+func newRowWriter(w io.Writer, format string) (rowWriter, error) {
+	switch format {
+	case FormatWordlist:
+		return &wordlistWriter{w: w}, nil
+	case FormatPotfile:
+		return &potfileWriter{w: w}, nil
+	case FormatCSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write([]string{"id", "plaintext", "md5", "md5_16", "encoding", "created_at"}); err != nil {
+			return nil, err
+		}
+		return &csvWriter{w: writer}, nil
+	case FormatNDJSON:
+		gz := gzip.NewWriter(w)
+		return &ndjsonWriter{gz: gz, enc: json.NewEncoder(gz)}, nil
+	}
+	return nil, fmt.Errorf("不支持的导出格式: %s", format)
+}
+
+// wordlistWriter 每行输出一个明文
+type wordlistWriter struct {
+	w io.Writer
+}
+
+func (ww *wordlistWriter) Write(record *dbModel.Md5) error {
+	_, err := io.WriteString(ww.w, hashcatPlain(record.Plaintext, record.Encoding)+"\n")
+	return err
+}
+
+func (ww *wordlistWriter) Close() error { return nil }
+
+// potfileWriter 按hashcat potfile格式输出 hash:明文
+type potfileWriter struct {
+	w io.Writer
+}
+
+func (pw *potfileWriter) Write(record *dbModel.Md5) error {
+	_, err := io.WriteString(pw.w, record.MD5+":"+hashcatPlain(record.Plaintext, record.Encoding)+"\n")
+	return err
+}
+
+func (pw *potfileWriter) Close() error { return nil }
+
+// csvWriter 输出带表头的CSV
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func (cw *csvWriter) Write(record *dbModel.Md5) error {
+	return cw.w.Write([]string{
+		strconv.FormatUint(uint64(record.ID), 10),
+		record.Plaintext,
+		record.MD5,
+		record.MD5_16,
+		record.Encoding,
+		record.CreatedAt.Format(time.RFC3339),
+	})
+}
+
+func (cw *csvWriter) Close() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+// ndjsonWriter 输出gzip压缩的NDJSON
+type ndjsonWriter struct {
+	gz  *gzip.Writer
+	enc *json.Encoder
+}
+
+func (nw *ndjsonWriter) Write(record *dbModel.Md5) error {
+	return nw.enc.Encode(Record{
+		ID:        record.ID,
+		Plaintext: record.Plaintext,
+		MD5:       record.MD5,
+		MD5_16:    record.MD5_16,
+		Encoding:  record.Encoding,
+		CreatedAt: record.CreatedAt,
+	})
+}
+
+func (nw *ndjsonWriter) Close() error {
+	return nw.gz.Close()
+}
+
+// hashcatPlain 将明文转换为hashcat可识别的形式
+// 非UTF-8编码的明文、包含冒号或不可打印字符的明文以及本身以 $HEX[ 开头的明文使用 $HEX[...] 表示其原始字节
+func hashcatPlain(plaintext string, encoding string) string {
+	if encoding != "" && encoding != utils.EncodingUTF8 {
+		if data, err := utils.EncodeText(plaintext, encoding); err == nil {
+			return "$HEX[" + hex.EncodeToString(data) + "]"
+		}
+	}
+
+	if !utf8.ValidString(plaintext) || strings.HasPrefix(plaintext, "$HEX[") {
+		return "$HEX[" + hex.EncodeToString([]byte(plaintext)) + "]"
+	}
+	for _, r := range plaintext {
+		if r == ':' || !unicode.IsPrint(r) {
+			return "$HEX[" + hex.EncodeToString([]byte(plaintext)) + "]"
+		}
+	}
+	return plaintext
+}
@@ -0,0 +1,251 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+	"zmd5/db"
+	"zmd5/db/dbModel"
+	"zmd5/metrics"
+)
+
+// 后台任务类型常量
+const (
+	KindImportRollback = "import_rollback" // 回滚导入任务
+	KindMd5BulkDelete  = "md5_bulk_delete" // 按条件批量删除明文记录
+	KindMd5Dedup       = "md5_dedup"       // 明文库去重并创建唯一索引
+	KindDigestConvert  = "digest_convert"  // 将十六进制MD5列转换为二进制摘要
+)
+
+// Func 后台任务的执行函数，应定期检查ctx以响应取消
+type Func func(ctx context.Context, progress *Progress) error
+
+// 运行中任务的取消函数，以任务ID为键
+var cancelMap = make(map[uint]context.CancelFunc)
+var cancelMutex sync.Mutex // 用于保护取消函数map的并发访问
+
+// 进度写入数据库的最小间隔
+const progressSyncInterval = time.Second
+
+// shutdownCtx 在服务关闭时取消，长时间运行的任务据此保存检查点并退出
+var shutdownCtx, shutdown = context.WithCancel(context.Background())
+
+// running 正在运行的后台任务、解密任务和导入任务，服务关闭时等待它们退出
+var running sync.WaitGroup
+
+// ErrShutdown 任务因服务关闭而中断
+var ErrShutdown = errors.New("服务关闭，任务被中断")
+
+// ShutdownContext 返回服务关闭时取消的上下文
+func ShutdownContext() context.Context {
+	return shutdownCtx
+}
+
+// ShuttingDown 服务是否正在关闭
+func ShuttingDown() bool {
+	return shutdownCtx.Err() != nil
+}
+
+// Go 在协程中执行fn，服务关闭时 Shutdown 会等待fn返回
+// fn 应定期检查 ShuttingDown，保存检查点后尽快返回
+func Go(fn func()) {
+	running.Add(1)
+	go func() {
+		defer running.Done()
+		fn()
+	}()
+}
+
+// Shutdown 通知所有任务保存检查点并退出，等待它们返回，超时返回false
+func Shutdown(timeout time.Duration) bool {
+	shutdown()
+
+	done := make(chan struct{})
+	go func() {
+		running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// Progress 用于任务执行过程中上报进度
+type Progress struct {
+	jobID     uint
+	total     int64
+	processed int64
+	result    interface{}
+
+	mu       sync.Mutex
+	lastSync time.Time
+}
+
+// SetTotal 设置需要处理的总数量
+func (p *Progress) SetTotal(total int64) {
+	atomic.StoreInt64(&p.total, total)
+	p.sync(true)
+}
+
+// Add 累加已处理数量
+func (p *Progress) Add(n int64) {
+	atomic.AddInt64(&p.processed, n)
+	p.sync(false)
+}
+
+// SetResult 设置任务结果，任务结束时以JSON形式保存
+func (p *Progress) SetResult(result interface{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.result = result
+}
+
+// sync 将进度同步到数据库，非强制时按时间间隔节流
+func (p *Progress) sync(force bool) {
+	p.mu.Lock()
+	if !force && time.Since(p.lastSync) < progressSyncInterval {
+		p.mu.Unlock()
+		return
+	}
+	p.lastSync = time.Now()
+	p.mu.Unlock()
+
+	db.PG.Model(&dbModel.BackgroundJob{}).Where("id = ?", p.jobID).UpdateColumns(map[string]interface{}{
+		"total":     atomic.LoadInt64(&p.total),
+		"processed": atomic.LoadInt64(&p.processed),
+	})
+}
+
+// Start 创建后台任务记录并在协程中执行fn，返回创建的任务记录
+func Start(kind string, userID uint, params interface{}, fn Func) (*dbModel.BackgroundJob, error) {
+	job, ctx, err := create(kind, userID, params)
+	if err != nil {
+		return nil, err
+	}
+
+	Go(func() { run(ctx, job.ID, kind, fn) })
+
+	return job, nil
+}
+
+// Run 创建后台任务记录并在当前协程中执行fn，用于命令行等需要同步等待的场景
+func Run(kind string, userID uint, params interface{}, fn Func) error {
+	job, ctx, err := create(kind, userID, params)
+	if err != nil {
+		return err
+	}
+
+	return run(ctx, job.ID, kind, fn)
+}
+
+// create 创建任务记录并登记取消函数
+func create(kind string, userID uint, params interface{}) (*dbModel.BackgroundJob, context.Context, error) {
+	paramsJSON, err := json.Marshal(params)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	job := dbModel.BackgroundJob{
+		Kind:   kind,
+		UserID: userID,
+		Params: string(paramsJSON),
+		Status: dbModel.JobRunning,
+	}
+	if err := db.PG.Create(&job).Error; err != nil {
+		return nil, nil, err
+	}
+
+	// 服务关闭时同时取消所有后台任务
+	ctx, cancel := context.WithCancel(shutdownCtx)
+	cancelMutex.Lock()
+	cancelMap[job.ID] = cancel
+	cancelMutex.Unlock()
+
+	return &job, ctx, nil
+}
+
+// run 执行任务并记录最终状态
+func run(ctx context.Context, jobID uint, kind string, fn Func) error {
+	defer func() {
+		cancelMutex.Lock()
+		if cancel, exists := cancelMap[jobID]; exists {
+			cancel()
+			delete(cancelMap, jobID)
+		}
+		cancelMutex.Unlock()
+	}()
+
+	active := metrics.ActiveTasks.With(kind)
+	active.Inc()
+	defer active.Dec()
+
+	progress := &Progress{jobID: jobID}
+	startTime := time.Now()
+	err := fn(ctx, progress)
+
+	updates := map[string]interface{}{
+		"total":     atomic.LoadInt64(&progress.total),
+		"processed": atomic.LoadInt64(&progress.processed),
+		"status":    dbModel.JobCompleted,
+	}
+	if progress.result != nil {
+		if resultJSON, err := json.Marshal(progress.result); err == nil {
+			updates["result"] = string(resultJSON)
+		}
+	}
+
+	switch {
+	case errors.Is(err, context.Canceled) && ShuttingDown():
+		// 后台任务无法从中断处继续，标记为失败，需要时由管理员重新发起
+		updates["status"] = dbModel.JobFailed
+		updates["error"] = ErrShutdown.Error()
+	case errors.Is(err, context.Canceled):
+		updates["status"] = dbModel.JobCancelled
+	case err != nil:
+		updates["status"] = dbModel.JobFailed
+		updates["error"] = err.Error()
+	}
+
+	db.PG.Model(&dbModel.BackgroundJob{}).Where("id = ?", jobID).Updates(updates)
+	log.Printf("后台任务 #%d (%s) 结束，耗时: %v，错误: %v", jobID, kind, time.Since(startTime), err)
+	return err
+}
+
+// Cancel 取消运行中的任务，任务不存在或已结束时返回false
+func Cancel(jobID uint) bool {
+	cancelMutex.Lock()
+	defer cancelMutex.Unlock()
+
+	cancel, exists := cancelMap[jobID]
+	if !exists {
+		return false
+	}
+	cancel()
+	delete(cancelMap, jobID)
+	return true
+}
+
+// IsRunning 检查某类型的任务是否正在运行
+func IsRunning(kind string) bool {
+	var count int64
+	db.PG.Model(&dbModel.BackgroundJob{}).Where("kind = ? AND status = ?", kind, dbModel.JobRunning).Count(&count)
+	return count > 0
+}
+
+// InitJobs 将上次进程退出时仍在运行的任务标记为失败
+func InitJobs() {
+	result := db.PG.Model(&dbModel.BackgroundJob{}).Where("status = ?", dbModel.JobRunning).Updates(map[string]interface{}{
+		"status": dbModel.JobFailed,
+		"error":  "服务重启，任务被中断",
+	})
+	if result.RowsAffected > 0 {
+		log.Printf("已将%d个中断的后台任务标记为失败", result.RowsAffected)
+	}
+}
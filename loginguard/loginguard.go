@@ -0,0 +1,284 @@
+package loginguard
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// 跟踪对象类型
+const (
+	KindUser = "user" // 按用户名统计失败次数
+	KindIP   = "ip"   // 按来源IP统计失败次数
+)
+
+// Policy 失败次数限制策略
+// 连续失败 BackoffAfter 次后每次失败都要等待一段时间才能再次尝试，等待时间从 BaseDelay 开始翻倍，最多 MaxDelay
+// 连续失败 LockoutAfter 次后锁定 LockoutDuration，锁定结束后重新计数
+type Policy struct {
+	BackoffAfter    int
+	LockoutAfter    int
+	BaseDelay       time.Duration
+	MaxDelay        time.Duration
+	LockoutDuration time.Duration
+	// 最后一次失败超过该时间后失败次数清零
+	Window time.Duration
+}
+
+// Entry 某个用户名或IP的失败记录
+type Entry struct {
+	Kind        string    `json:"kind"`
+	Value       string    `json:"value"`
+	Failures    int       `json:"failures"`
+	LastFailure time.Time `json:"lastFailure"`
+	// 在该时间之前拒绝登录，零值表示未限制
+	BlockedUntil time.Time `json:"blockedUntil"`
+	// 达到锁定次数（而不只是退避等待）
+	Lockout bool `json:"lockout"`
+	// 记录过期时间，过期后视为不存在
+	ExpiresAt time.Time `json:"-"`
+}
+
+// Blocked 在指定时间是否拒绝登录
+func (e *Entry) Blocked(now time.Time) bool {
+	return now.Before(e.BlockedUntil)
+}
+
+// Store 失败记录存储，实现必须支持并发访问
+// 默认使用进程内存储，多实例部署时可替换为共享存储
+type Store interface {
+	// Get 获取未过期的记录
+	Get(key string) (Entry, bool)
+	// Put 保存记录，记录在 entry.ExpiresAt 之后可以被清理
+	Put(key string, entry Entry)
+	Delete(key string)
+	// List 返回所有未过期的记录
+	List() []Entry
+}
+
+// Guard 按用户名和IP统计登录失败次数，超过限制后拒绝登录
+type Guard struct {
+	store Store
+	user  Policy
+	ip    Policy
+	// 当前时间，便于替换
+	now func() time.Time
+	mu  sync.Mutex
+}
+
+// New 创建登录保护，user 和 ip 分别为按用户名和按IP统计的策略
+func New(store Store, user, ip Policy) *Guard {
+	return &Guard{store: store, user: user, ip: ip, now: time.Now}
+}
+
+func key(kind, value string) string {
+	return kind + ":" + value
+}
+
+// Attempt 一次已预先计入失败次数的登录尝试，验证通过时调用 Pass 撤销
+type Attempt struct {
+	guard *Guard
+	keys  []string
+	// 计入前后的记录，计入前不存在时 existed 为false
+	before  []Entry
+	existed []bool
+	after   []Entry
+}
+
+// Begin 检查用户名和IP是否允许尝试登录，允许时预先计入一次失败并返回尝试，否则返回限制时间最长的记录
+// 检查和计数在同一锁内完成，并发请求无法在失败被记录之前同时通过检查；
+// 验证通过后必须调用 Attempt.Pass，验证失败时无需再记录
+func (g *Guard) Begin(username, ip string) (*Attempt, *Entry) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	attempt := &Attempt{guard: g, keys: []string{key(KindUser, username), key(KindIP, ip)}}
+	var blocked *Entry
+	for _, k := range attempt.keys {
+		entry, ok := g.store.Get(k)
+		if ok && entry.Blocked(now) && (blocked == nil || entry.BlockedUntil.After(blocked.BlockedUntil)) {
+			e := entry
+			blocked = &e
+		}
+		attempt.before = append(attempt.before, entry)
+		attempt.existed = append(attempt.existed, ok)
+	}
+	if blocked != nil {
+		return nil, blocked
+	}
+
+	attempt.after = []Entry{
+		g.fail(KindUser, username, g.user, now),
+		g.fail(KindIP, ip, g.ip, now),
+	}
+	return attempt, nil
+}
+
+// User 返回计入本次失败后用户名的记录
+func (a *Attempt) User() Entry {
+	return a.after[0]
+}
+
+// Pass 撤销本次尝试预先计入的失败
+// 记录在此期间没有被其他尝试修改时恢复为计入前的状态，否则只减少失败次数，保留其他尝试造成的限制
+func (a *Attempt) Pass() {
+	g := a.guard
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for i, k := range a.keys {
+		entry, ok := g.store.Get(k)
+		switch {
+		case !ok:
+		case sameEntry(entry, a.after[i]) && a.existed[i]:
+			g.store.Put(k, a.before[i])
+		case sameEntry(entry, a.after[i]):
+			g.store.Delete(k)
+		case entry.Failures > 0:
+			entry.Failures--
+			g.store.Put(k, entry)
+		}
+	}
+}
+
+func sameEntry(a, b Entry) bool {
+	return a.Failures == b.Failures && a.LastFailure.Equal(b.LastFailure) &&
+		a.BlockedUntil.Equal(b.BlockedUntil) && a.Lockout == b.Lockout
+}
+
+func (g *Guard) fail(kind, value string, policy Policy, now time.Time) Entry {
+	k := key(kind, value)
+	entry, ok := g.store.Get(k)
+	if !ok {
+		entry = Entry{Kind: kind, Value: value}
+	}
+	entry.Failures++
+	entry.LastFailure = now
+	entry.ExpiresAt = now.Add(policy.Window)
+
+	switch {
+	case policy.LockoutAfter > 0 && entry.Failures >= policy.LockoutAfter:
+		entry.BlockedUntil = now.Add(policy.LockoutDuration)
+		entry.Lockout = true
+		// 锁定结束后重新计数
+		entry.ExpiresAt = entry.BlockedUntil
+	case policy.BackoffAfter > 0 && entry.Failures >= policy.BackoffAfter:
+		entry.BlockedUntil = now.Add(backoff(policy, entry.Failures-policy.BackoffAfter))
+	}
+	g.store.Put(k, entry)
+	return entry
+}
+
+// backoff 第n次退避（从0开始）的等待时间
+func backoff(policy Policy, n int) time.Duration {
+	delay := policy.BaseDelay
+	for i := 0; i < n && delay < policy.MaxDelay; i++ {
+		delay *= 2
+	}
+	if policy.MaxDelay > 0 && delay > policy.MaxDelay {
+		delay = policy.MaxDelay
+	}
+	return delay
+}
+
+// Succeed 登录成功后清除用户名的失败记录
+// IP的失败记录保留，避免攻击者用自己的账户登录来重置IP计数
+func (g *Guard) Succeed(username string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.store.Delete(key(KindUser, username))
+}
+
+// Clear 清除用户名或IP的失败记录，返回记录是否存在
+func (g *Guard) Clear(kind, value string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	k := key(kind, value)
+	if _, ok := g.store.Get(k); !ok {
+		return false
+	}
+	g.store.Delete(k)
+	return true
+}
+
+// Entries 返回所有失败记录，正在限制登录的排在前面，其余按最后失败时间倒序
+func (g *Guard) Entries() []Entry {
+	now := g.now()
+	entries := g.store.List()
+	sort.Slice(entries, func(i, j int) bool {
+		bi, bj := entries[i].Blocked(now), entries[j].Blocked(now)
+		if bi != bj {
+			return bi
+		}
+		return entries[i].LastFailure.After(entries[j].LastFailure)
+	})
+	return entries
+}
+
+// 进程内存储清理过期记录的间隔
+const sweepInterval = time.Minute
+
+// MemoryStore 进程内存储，服务重启后记录丢失
+type MemoryStore struct {
+	mu        sync.Mutex
+	entries   map[string]Entry
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewMemoryStore 创建进程内存储
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]Entry), now: time.Now}
+}
+
+func (s *MemoryStore) Get(key string) (Entry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[key]
+	if !ok || !s.now().Before(entry.ExpiresAt) {
+		return Entry{}, false
+	}
+	return entry, true
+}
+
+func (s *MemoryStore) Put(key string, entry Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries[key] = entry
+	// 定期清理过期记录，避免大量随机用户名占用内存
+	now := s.now()
+	if now.Sub(s.lastSweep) >= sweepInterval {
+		for k, e := range s.entries {
+			if !now.Before(e.ExpiresAt) {
+				delete(s.entries, k)
+			}
+		}
+		s.lastSweep = now
+	}
+}
+
+func (s *MemoryStore) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+}
+
+func (s *MemoryStore) List() []Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	entries := make([]Entry, 0, len(s.entries))
+	for _, entry := range s.entries {
+		if now.Before(entry.ExpiresAt) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
@@ -0,0 +1,167 @@
+package loginguard
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+var testPolicy = Policy{
+	BackoffAfter:    3,
+	LockoutAfter:    5,
+	BaseDelay:       time.Second,
+	MaxDelay:        4 * time.Second,
+	LockoutDuration: time.Minute,
+	Window:          time.Hour,
+}
+
+// newTestGuard 创建使用可控时钟的登录保护，IP策略比用户名策略宽松
+func newTestGuard() (*Guard, *time.Time) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	store := NewMemoryStore()
+	store.now = clock
+	ip := testPolicy
+	ip.BackoffAfter, ip.LockoutAfter = 10, 20
+	g := New(store, testPolicy, ip)
+	g.now = clock
+	return g, &now
+}
+
+// fail 完成一次失败的尝试，尝试被拒绝时测试失败
+func fail(t *testing.T, g *Guard, username, ip string) Entry {
+	t.Helper()
+	attempt, blocked := g.Begin(username, ip)
+	if blocked != nil {
+		t.Fatalf("尝试被拒绝: %+v", blocked)
+	}
+	return attempt.User()
+}
+
+func TestBackoffAndLockout(t *testing.T) {
+	g, now := newTestGuard()
+
+	for i := 1; i < testPolicy.BackoffAfter; i++ {
+		if entry := fail(t, g, "alice", "1.1.1.1"); entry.Failures != i || !entry.BlockedUntil.IsZero() {
+			t.Fatalf("第%d次失败: %+v", i, entry)
+		}
+	}
+	// 达到退避次数后等待时间翻倍，最多 MaxDelay
+	for i, delay := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		entry := fail(t, g, "alice", "1.1.1.1")
+		if i == 2 {
+			if !entry.Lockout || !entry.BlockedUntil.Equal(now.Add(testPolicy.LockoutDuration)) {
+				t.Fatalf("达到锁定次数后应锁定: %+v", entry)
+			}
+			break
+		}
+		if got := entry.BlockedUntil.Sub(*now); got != delay {
+			t.Fatalf("第%d次退避等待 %v, 期望 %v", i+1, got, delay)
+		}
+		if _, blocked := g.Begin("alice", "2.2.2.2"); blocked == nil {
+			t.Fatal("退避期间应拒绝登录")
+		}
+		*now = now.Add(delay)
+	}
+
+	// 锁定期间拒绝，锁定结束后重新计数
+	if _, blocked := g.Begin("alice", "3.3.3.3"); blocked == nil || !blocked.Lockout {
+		t.Fatal("锁定期间应拒绝登录")
+	}
+	*now = now.Add(testPolicy.LockoutDuration)
+	if entry := fail(t, g, "alice", "3.3.3.3"); entry.Failures != 1 {
+		t.Fatalf("锁定结束后应重新计数: %+v", entry)
+	}
+	// 其他用户名不受影响
+	if entry := fail(t, g, "bob", "1.1.1.1"); entry.Failures != 1 {
+		t.Fatalf("其他用户名的记录: %+v", entry)
+	}
+}
+
+func TestFailuresExpireAfterWindow(t *testing.T) {
+	g, now := newTestGuard()
+	fail(t, g, "alice", "1.1.1.1")
+	fail(t, g, "alice", "1.1.1.1")
+	*now = now.Add(testPolicy.Window)
+	if entry := fail(t, g, "alice", "1.1.1.1"); entry.Failures != 1 {
+		t.Fatalf("超过统计时间后应重新计数: %+v", entry)
+	}
+}
+
+func TestPassUndoesAttempt(t *testing.T) {
+	g, now := newTestGuard()
+
+	// 没有失败记录时验证通过不留下记录
+	attempt, _ := g.Begin("alice", "1.1.1.1")
+	attempt.Pass()
+	if entries := g.Entries(); len(entries) != 0 {
+		t.Fatalf("验证通过后不应有失败记录: %+v", entries)
+	}
+
+	// 本次尝试触发的退避在验证通过后撤销，之前的失败次数保留
+	fail(t, g, "alice", "1.1.1.1")
+	fail(t, g, "alice", "1.1.1.1")
+	attempt, _ = g.Begin("alice", "1.1.1.1")
+	if entry := attempt.User(); !entry.Blocked(*now) {
+		t.Fatal("预先计入的失败应触发退避")
+	}
+	attempt.Pass()
+	if _, blocked := g.Begin("alice", "1.1.1.1"); blocked != nil {
+		t.Fatalf("验证通过后不应限制下一步验证: %+v", blocked)
+	}
+
+	// 期间有其他尝试时只减少失败次数，保留其他尝试造成的限制
+	g, now = newTestGuard()
+	fail(t, g, "alice", "1.1.1.1")
+	first, _ := g.Begin("alice", "1.1.1.1")
+	second, _ := g.Begin("alice", "2.2.2.2")
+	first.Pass()
+	_, blocked := g.Begin("alice", "3.3.3.3")
+	if blocked == nil || blocked.Failures != 2 {
+		t.Fatalf("其他尝试造成的退避应保留: %+v", blocked)
+	}
+	second.Pass()
+	*now = now.Add(time.Second)
+	if entry := fail(t, g, "alice", "1.1.1.1"); entry.Failures != 2 {
+		t.Fatalf("撤销后的失败次数: %+v", entry)
+	}
+}
+
+func TestConcurrentAttemptsCannotBypassBackoff(t *testing.T) {
+	g, _ := newTestGuard()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, blocked := g.Begin("alice", "1.1.1.1"); blocked == nil {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	// 与逐个尝试相同，达到退避次数后其余并发请求全部被拒绝
+	if allowed != testPolicy.BackoffAfter {
+		t.Fatalf("并发请求中有 %d 个通过检查, 期望 %d 个", allowed, testPolicy.BackoffAfter)
+	}
+}
+
+func TestSucceedKeepsIPFailures(t *testing.T) {
+	g, _ := newTestGuard()
+	fail(t, g, "alice", "1.1.1.1")
+	fail(t, g, "alice", "1.1.1.1")
+	g.Succeed("alice")
+
+	entries := g.Entries()
+	if len(entries) != 1 || entries[0].Kind != KindIP || entries[0].Failures != 2 {
+		t.Fatalf("登录成功后只应清除用户名的记录: %+v", entries)
+	}
+	if !g.Clear(KindIP, "1.1.1.1") || g.Clear(KindIP, "1.1.1.1") {
+		t.Fatal("清除记录结果不正确")
+	}
+}
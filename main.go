@@ -3,13 +3,13 @@ package main
 import (
 	"log"
 	"os"
-	"zmd5/api/rainbow"
-	"zmd5/db"
-	"zmd5/router"
+	"zmd5/api/admin"
+	"zmd5/api/auth"
+	"zmd5/api/system"
+	"zmd5/config"
+	"zmd5/middleware"
+	"zmd5/utils"
 
-	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/middleware/cors"
-	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/joho/godotenv"
 )
 
@@ -27,38 +27,24 @@ func main() {
 		godotenv.Load(".env")
 	}
 
-	// 初始化数据库
-	db.InitDB()
-
-	// 从数据库初始化未完成的任务
-	rainbow.InitTaskProgress()
-
-	// 创建Fiber应用
-	app := fiber.New(fiber.Config{
-		AppName:   "ZMd5解密工具",
-		BodyLimit: 1024 * 1024 * 2000, // 设置为2GB
-	})
-
-	// 中间件
-	app.Use(logger.New())
-
-	// 从环境变量获取 CORS 配置
-	allowOrigins := os.Getenv("CORS_ORIGIN")
-	if allowOrigins == "" {
-		allowOrigins = "http://localhost:5173"
+	// 加载配置：默认值 < config.yaml < 环境变量 < 命令行参数
+	cfg, args, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+	utils.SetJWTConfig(cfg.JWT.Secret, cfg.JWT.Expiration, cfg.JWT.RefreshExpiration)
+	admin.SetUploadConfig(cfg.Upload)
+	auth.SetLoginConfig(cfg.Login)
+	auth.SetPasswordConfig(cfg.Password)
+	auth.SetRegistrationConfig(cfg.Registration)
+	middleware.SetRateLimitConfig(cfg.RateLimit)
+	system.SetMetricsConfig(cfg.Metrics)
+
+	// 不带子命令时启动服务
+	if len(args) == 0 {
+		args = []string{"serve"}
+	}
+	if err := runCommand(cfg, args); err != nil {
+		log.Fatal(err)
 	}
-
-	app.Use(cors.New(cors.Config{
-		AllowOrigins:     allowOrigins,
-		AllowCredentials: true,
-		AllowHeaders:     "Origin, Content-Type, Accept, Authorization, x-csrf-token, x-requested-with",
-		AllowMethods:     "GET, POST, PUT, DELETE, OPTIONS",
-	}))
-
-	// 设置路由
-	router.SetupRoutes(app)
-
-	// 启动服务器
-	log.Printf("服务器启动在 http://localhost:9700 (环境: %s)", env)
-	log.Fatal(app.Listen(":9700"))
 }
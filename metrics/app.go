@@ -0,0 +1,37 @@
+package metrics
+
+// 任务类型，后台任务使用 jobs 中的任务类型
+const (
+	TaskRainbowDecrypt = "rainbow_decrypt" // 彩虹表解密任务
+	TaskImport         = "import"          // 文件上传导入
+)
+
+// 查询接口的指标
+var (
+	lookups = NewCounterVec("zmd5_lookups_total", "哈希查询次数，按是否在明文库中命中区分", "result")
+	// LookupHits 命中明文库的查询次数
+	LookupHits = lookups.With("hit")
+	// LookupMisses 未命中明文库的查询次数
+	LookupMisses = lookups.With("miss")
+	// LookupDuration 查询明文库的耗时
+	LookupDuration = NewHistogram("zmd5_lookup_duration_seconds", "查询明文库的耗时（秒）",
+		[]float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5})
+)
+
+// 任务的指标
+var (
+	// ActiveTasks 正在运行的任务数量，按任务类型区分
+	ActiveTasks = NewGaugeVec("zmd5_active_tasks", "正在运行的任务数量，按任务类型区分", "type")
+	// RainbowDecryptTasks 正在运行的彩虹表解密任务数量
+	RainbowDecryptTasks = ActiveTasks.With(TaskRainbowDecrypt)
+	// ImportTasks 正在运行的导入任务数量
+	ImportTasks = ActiveTasks.With(TaskImport)
+
+	// ImportedRecords 导入任务已处理的记录数量，按 rate() 计算导入速度
+	ImportedRecords = NewCounter("zmd5_import_records_total", "导入任务已处理的记录数量（每种编码各计一条）")
+	// ImportAddedRecords 导入任务新增到明文库的记录数量
+	ImportAddedRecords = NewCounter("zmd5_import_added_records_total", "导入任务新增到明文库的记录数量")
+
+	// ReductionSteps 彩虹表解密任务应用规约函数的次数，按 rate() 计算每秒规约步数
+	ReductionSteps = NewCounter("zmd5_rainbow_reduction_steps_total", "彩虹表解密任务应用规约函数的次数")
+)
@@ -0,0 +1,311 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ContentType Prometheus 文本格式的 Content-Type
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// collector 一个指标，输出时写入 HELP、TYPE 和所有样本
+type collector interface {
+	write(w *bufio.Writer)
+}
+
+var (
+	registry   []collector
+	registryMu sync.Mutex
+)
+
+// register 登记指标，输出时按登记顺序输出
+func register(c collector) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry = append(registry, c)
+}
+
+// Write 以 Prometheus 文本格式输出所有已登记的指标
+func Write(w io.Writer) error {
+	registryMu.Lock()
+	collectors := append([]collector(nil), registry...)
+	registryMu.Unlock()
+
+	buf := bufio.NewWriter(w)
+	for _, c := range collectors {
+		c.write(buf)
+	}
+	return buf.Flush()
+}
+
+// desc 指标名称、说明和类型
+type desc struct {
+	name string
+	help string
+	kind string
+}
+
+func (d desc) writeHeader(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.name, escapeHelp(d.help), d.name, d.kind)
+}
+
+// Counter 只增不减的计数器
+type Counter struct {
+	value atomic.Uint64
+}
+
+// Inc 加1
+func (c *Counter) Inc() {
+	c.value.Add(1)
+}
+
+// Add 加n
+func (c *Counter) Add(n uint64) {
+	c.value.Add(n)
+}
+
+// Gauge 可增可减的当前值
+type Gauge struct {
+	value atomic.Int64
+}
+
+// Inc 加1
+func (g *Gauge) Inc() {
+	g.value.Add(1)
+}
+
+// Dec 减1
+func (g *Gauge) Dec() {
+	g.value.Add(-1)
+}
+
+// single 没有标签的计数器或当前值
+type single struct {
+	desc
+	value func() float64
+}
+
+func (s *single) write(w *bufio.Writer) {
+	s.writeHeader(w)
+	writeSample(w, s.name, nil, nil, s.value())
+}
+
+// NewCounter 创建并登记计数器
+func NewCounter(name, help string) *Counter {
+	c := &Counter{}
+	register(&single{desc{name, help, "counter"}, func() float64 { return float64(c.value.Load()) }})
+	return c
+}
+
+// NewGaugeFunc 登记输出时调用fn取值的当前值，用于连接池状态等由其他组件维护的数据
+func NewGaugeFunc(name, help string, fn func() float64) {
+	register(&single{desc{name, help, "gauge"}, fn})
+}
+
+// NewCounterFunc 登记输出时调用fn取值的计数器，fn 的返回值应只增不减
+func NewCounterFunc(name, help string, fn func() float64) {
+	register(&single{desc{name, help, "counter"}, fn})
+}
+
+// vec 按标签值区分的一组样本
+type vec[T any] struct {
+	desc
+	labels   []string
+	value    func(*T) float64
+	mu       sync.RWMutex
+	children map[string]*T
+	values   map[string][]string
+}
+
+// with 返回标签值对应的样本，不存在时创建
+func (v *vec[T]) with(values []string) *T {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("指标 %s 需要%d个标签值，实际为%d个", v.name, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+
+	v.mu.RLock()
+	child, exists := v.children[key]
+	v.mu.RUnlock()
+	if exists {
+		return child
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if child, exists := v.children[key]; exists {
+		return child
+	}
+	child = new(T)
+	v.children[key] = child
+	v.values[key] = append([]string(nil), values...)
+	return child
+}
+
+func (v *vec[T]) write(w *bufio.Writer) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	v.writeHeader(w)
+	keys := make([]string, 0, len(v.children))
+	for key := range v.children {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		writeSample(w, v.name, v.labels, v.values[key], v.value(v.children[key]))
+	}
+}
+
+func newVec[T any](d desc, labels []string, value func(*T) float64) *vec[T] {
+	v := &vec[T]{
+		desc:     d,
+		labels:   labels,
+		value:    value,
+		children: make(map[string]*T),
+		values:   make(map[string][]string),
+	}
+	register(v)
+	return v
+}
+
+// CounterVec 按标签值区分的一组计数器
+type CounterVec struct {
+	v *vec[Counter]
+}
+
+// NewCounterVec 创建并登记一组计数器
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{newVec(desc{name, help, "counter"}, labels, func(c *Counter) float64 {
+		return float64(c.value.Load())
+	})}
+}
+
+// With 返回标签值对应的计数器，标签值的顺序与创建时的标签名一致
+func (c *CounterVec) With(values ...string) *Counter {
+	return c.v.with(values)
+}
+
+// GaugeVec 按标签值区分的一组当前值
+type GaugeVec struct {
+	v *vec[Gauge]
+}
+
+// NewGaugeVec 创建并登记一组当前值
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{newVec(desc{name, help, "gauge"}, labels, func(g *Gauge) float64 {
+		return float64(g.value.Load())
+	})}
+}
+
+// With 返回标签值对应的当前值，标签值的顺序与创建时的标签名一致
+func (g *GaugeVec) With(values ...string) *Gauge {
+	return g.v.with(values)
+}
+
+// Histogram 按上界统计观测值分布的直方图
+type Histogram struct {
+	desc
+	buckets []float64 // 升序排列的桶上界，不含 +Inf
+	mu      sync.Mutex
+	counts  []uint64 // 各桶的观测次数（非累计），最后一个为 +Inf 桶
+	sum     float64
+	count   uint64
+}
+
+// NewHistogram 创建并登记直方图，buckets 为升序排列的桶上界
+func NewHistogram(name, help string, buckets []float64) *Histogram {
+	h := &Histogram{
+		desc:    desc{name, help, "histogram"},
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)+1),
+	}
+	register(h)
+	return h
+}
+
+// Observe 记录一个观测值
+func (h *Histogram) Observe(v float64) {
+	// 第一个不小于v的上界所在的桶
+	i := sort.SearchFloat64s(h.buckets, v)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.counts[i]++
+	h.sum += v
+	h.count++
+}
+
+// ObserveSince 记录从start到现在经过的秒数
+func (h *Histogram) ObserveSince(start time.Time) {
+	h.Observe(time.Since(start).Seconds())
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.mu.Lock()
+	counts := append([]uint64(nil), h.counts...)
+	sum, count := h.sum, h.count
+	h.mu.Unlock()
+
+	h.writeHeader(w)
+	le := []string{"le"}
+	var cumulative uint64
+	for i, upper := range h.buckets {
+		cumulative += counts[i]
+		writeSample(w, h.name+"_bucket", le, []string{formatFloat(upper)}, float64(cumulative))
+	}
+	writeSample(w, h.name+"_bucket", le, []string{"+Inf"}, float64(count))
+	writeSample(w, h.name+"_sum", nil, nil, sum)
+	writeSample(w, h.name+"_count", nil, nil, float64(count))
+}
+
+// writeSample 输出一个样本，如 name{label="value"} 1
+func writeSample(w *bufio.Writer, name string, labels, values []string, value float64) {
+	w.WriteString(name)
+	if len(labels) > 0 {
+		w.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", label, escapeLabel(values[i]))
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(value))
+	w.WriteByte('\n')
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
@@ -0,0 +1,182 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"unicode/utf8"
+	"zmd5/db/dbModel"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// 审计日志中请求参数的最大长度，超出部分截断
+const maxAuditParams = 4096
+
+// 审计日志中隐藏取值的请求参数（不区分大小写）
+var sensitiveParams = map[string]bool{
+	"password":     true,
+	"newpassword":  true,
+	"code":         true,
+	"token":        true,
+	"refreshtoken": true,
+	"preauthtoken": true,
+	"invitecode":   true,
+	"secret":       true,
+}
+
+// Audit 是审计日志中间件，处理器执行完成后记录操作者、操作、操作对象、请求参数、来源IP和结果
+// 应放在认证中间件之后、权限检查之前，这样因缺少权限被拒绝的操作也会被记录
+func Audit(action string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		err := c.Next()
+
+		status := c.Response().StatusCode()
+		if err != nil {
+			status = fiber.StatusInternalServerError
+			if ferr, ok := err.(*fiber.Error); ok {
+				status = ferr.Code
+			}
+		}
+
+		body := auditBody(c)
+		entry := dbModel.AuditLog{
+			Action:  action,
+			Target:  truncate(auditTarget(c), 255),
+			Params:  auditParams(c, body),
+			IP:      c.IP(),
+			Status:  status,
+			Success: status < fiber.StatusBadRequest,
+			Message: truncate(responseMessage(c), 255),
+		}
+		entry.ActorID, _ = c.Locals("userID").(uint)
+		if entry.ActorID == 0 {
+			entry.ActorID, _ = c.Locals("user_id").(uint)
+		}
+		entry.ActorName, _ = c.Locals("username").(string)
+		if entry.ActorName == "" {
+			// 登录、注册等请求没有认证信息，使用请求中的用户名
+			entry.ActorName, _ = body["username"].(string)
+		}
+		entry.ActorName = truncate(entry.ActorName, 64)
+		entry.APIKeyID, _ = c.Locals("apiKeyID").(uint)
+
+		if createErr := store.AuditLogs.Create(&entry); createErr != nil {
+			log.Printf("写入审计日志失败（%s）: %v", action, createErr)
+		}
+		return err
+	}
+}
+
+// auditTarget 由路径参数组成操作对象，如 id=12
+func auditTarget(c *fiber.Ctx) string {
+	var parts []string
+	for _, name := range c.Route().Params {
+		parts = append(parts, name+"="+c.Params(name))
+	}
+	return strings.Join(parts, ",")
+}
+
+// auditBody 解析请求体中的参数：JSON请求体解析全部字段，表单只记录字段值和上传文件的名称、大小
+func auditBody(c *fiber.Ctx) map[string]interface{} {
+	contentType := string(c.Request().Header.ContentType())
+	switch {
+	case strings.HasPrefix(contentType, fiber.MIMEApplicationJSON):
+		var body map[string]interface{}
+		if json.Unmarshal(c.Body(), &body) == nil {
+			return body
+		}
+	case strings.HasPrefix(contentType, fiber.MIMEMultipartForm):
+		form, err := c.MultipartForm()
+		if err != nil {
+			return nil
+		}
+		body := make(map[string]interface{})
+		for name, values := range form.Value {
+			if len(values) > 0 {
+				body[name] = values[0]
+			}
+		}
+		for name, files := range form.File {
+			if len(files) > 0 {
+				body[name] = fmt.Sprintf("%s (%d bytes)", files[0].Filename, files[0].Size)
+			}
+		}
+		return body
+	}
+	return nil
+}
+
+// auditParams 将查询参数和请求体序列化为JSON，隐藏敏感字段
+func auditParams(c *fiber.Ctx, body map[string]interface{}) string {
+	params := make(map[string]interface{})
+	if query := c.Context().QueryArgs().String(); query != "" {
+		params["query"] = query
+	}
+	if len(body) > 0 {
+		params["body"] = redact(body)
+	}
+	if len(params) == 0 {
+		return ""
+	}
+	data, err := json.Marshal(params)
+	if err != nil {
+		return ""
+	}
+	return truncate(string(data), maxAuditParams)
+}
+
+// redact 返回隐藏了敏感字段取值的副本
+func redact(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			if sensitiveParams[strings.ToLower(key)] {
+				result[key] = "***"
+			} else {
+				result[key] = redact(item)
+			}
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			result[i] = redact(item)
+		}
+		return result
+	default:
+		return value
+	}
+}
+
+// responseMessage 读取JSON响应中的提示信息，流式响应（如导出）不读取，以免消耗响应体
+func responseMessage(c *fiber.Ctx) string {
+	resp := c.Response()
+	if resp.IsBodyStream() || !strings.HasPrefix(string(resp.Header.ContentType()), fiber.MIMEApplicationJSON) {
+		return ""
+	}
+	var body struct {
+		Message string `json:"message"`
+		Msg     string `json:"msg"`
+	}
+	if json.Unmarshal(resp.Body(), &body) != nil {
+		return ""
+	}
+	if body.Message != "" {
+		return body.Message
+	}
+	return body.Msg
+}
+
+// truncate 按字节截断字符串，不截断多字节字符
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
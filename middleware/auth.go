@@ -1,87 +1,177 @@
 package middleware
 
 import (
+	"errors"
 	"fmt"
 	"strings"
+	"time"
+	"zmd5/api/auth"
+	"zmd5/repository"
 	"zmd5/utils"
 
 	"github.com/gofiber/fiber/v2"
 )
 
+// store 中间件使用的存储（验证API密钥），由 Init 注入
+var store *repository.Store
+
+// Init 注入中间件使用的存储
+func Init(s *repository.Store) {
+	store = s
+}
+
+// API密钥最后使用时间的更新间隔，避免每次请求都写数据库
+const apiKeyTouchInterval = time.Minute
+
+// authError 认证失败的状态码和提示信息
+type authError struct {
+	status  int
+	message string
+}
+
+func (e *authError) respond(c *fiber.Ctx) error {
+	return c.Status(e.status).JSON(fiber.Map{
+		"status":  e.status,
+		"message": e.message,
+	})
+}
+
+// principal 认证通过的用户信息
+type principal struct {
+	userID   uint
+	username string
+	role     string
+	// 通过API密钥认证时为密钥ID
+	apiKeyID uint
+	// 用户在设置中开启了隐私模式，认证时已读取用户，避免处理器再次查询
+	privateMode bool
+}
+
+// credential 从请求中提取认证凭据，支持 Authorization 头（可带 Bearer 前缀）和 X-API-Key 头
+func credential(c *fiber.Ctx) string {
+	authHeader := c.Get("Authorization")
+	if authHeader == "" {
+		return c.Get("X-API-Key")
+	}
+	if strings.HasPrefix(authHeader, "Bearer ") {
+		return authHeader[7:]
+	}
+	return authHeader // 兼容直接传入token的情况
+}
+
+// authenticate 验证JWT令牌或API密钥
+// scopes 为该接口允许的API密钥授权范围，为空时不允许使用API密钥访问
+func authenticate(token string, scopes []string) (*principal, *authError) {
+	if utils.IsAPIKey(token) {
+		return authenticateAPIKey(token, scopes)
+	}
+
+	user, err := auth.VerifyAccessToken(token)
+	if errors.Is(err, auth.ErrSessionRevoked) || errors.Is(err, auth.ErrAccountDisabled) || errors.Is(err, auth.ErrAccountLocked) || errors.Is(err, auth.ErrAccountPending) {
+		return nil, &authError{fiber.StatusUnauthorized, err.Error()}
+	}
+	if err != nil {
+		return nil, &authError{fiber.StatusUnauthorized, "无效的认证令牌或令牌已过期"}
+	}
+	return &principal{userID: user.ID, username: user.Username, role: user.Role, privateMode: user.PrivateMode}, nil
+}
+
+// authenticateAPIKey 验证API密钥及其授权范围，并记录最后使用时间
+func authenticateAPIKey(token string, scopes []string) (*principal, *authError) {
+	key, err := store.APIKeys.FindByHash(utils.HashAPIKey(token))
+	now := time.Now()
+	if err != nil || !key.Active(now) {
+		return nil, &authError{fiber.StatusUnauthorized, "无效的API密钥或密钥已撤销、过期"}
+	}
+
+	if len(scopes) == 0 {
+		return nil, &authError{fiber.StatusForbidden, "该接口不支持使用API密钥访问"}
+	}
+	allowed := false
+	for _, scope := range scopes {
+		if key.HasScope(scope) {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return nil, &authError{fiber.StatusForbidden, fmt.Sprintf("API密钥缺少访问该接口的授权范围: %s", strings.Join(scopes, "/"))}
+	}
+
+	// 使用用户当前的角色，而不是创建密钥时的角色
+	user, err := store.Users.FindByID(key.UserID)
+	if err != nil {
+		return nil, &authError{fiber.StatusUnauthorized, "API密钥所属的用户不存在"}
+	}
+	if !user.Active(now) {
+		return nil, &authError{fiber.StatusUnauthorized, "API密钥所属的账户已被禁用或锁定"}
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= apiKeyTouchInterval {
+		store.APIKeys.Touch(key.ID, now)
+	}
+
+	return &principal{userID: user.ID, username: user.Username, role: user.Role, apiKeyID: key.ID, privateMode: user.PrivateMode}, nil
+}
+
 // JWTAuth 是JWT认证中间件
-func JWTAuth() fiber.Handler {
+// scopes 为允许访问的API密钥授权范围，为空时只接受登录令牌
+func JWTAuth(scopes ...string) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		// 获取认证头
-		authHeader := c.Get("Authorization")
+		// 获取认证凭据
+		token := credential(c)
 
 		// 检查是否存在认证头
-		if authHeader == "" {
+		if token == "" {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 				"status":  fiber.StatusUnauthorized,
 				"message": "未提供认证令牌",
 			})
 		}
 
-		// 提取token
-		tokenString := ""
-		if strings.HasPrefix(authHeader, "Bearer ") {
-			tokenString = authHeader[7:]
-		} else {
-			tokenString = authHeader // 兼容直接传入token的情况
-		}
-
-		// 验证token
-		userID, username, role, err := utils.ValidateToken(tokenString)
-		if err != nil {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"status":  fiber.StatusUnauthorized,
-				"message": "无效的认证令牌或令牌已过期",
-			})
+		// 验证令牌或API密钥
+		user, authErr := authenticate(token, scopes)
+		if authErr != nil {
+			return authErr.respond(c)
 		}
 
 		// 将用户信息存储在上下文中，以便后续使用
-		c.Locals("userID", userID)
-		c.Locals("username", username)
-		c.Locals("role", role)
+		c.Locals("userID", user.userID)
+		c.Locals("username", user.username)
+		c.Locals("role", user.role)
+		c.Locals("privateMode", user.privateMode)
+		if user.apiKeyID != 0 {
+			c.Locals("apiKeyID", user.apiKeyID)
+		}
 
 		// 继续处理请求
 		return c.Next()
 	}
 }
 
-// AdminAuth 是管理员认证中间件
-func AdminAuth() fiber.Handler {
+// AdminAuth 是管理后台认证中间件，要求用户角色至少拥有一项管理权限，具体接口的权限由 RequirePermission 检查
+// scopes 为允许访问的API密钥授权范围，为空时只接受登录令牌；使用API密钥时按密钥所属用户的角色检查
+func AdminAuth(scopes ...string) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		// 获取认证头
-		authHeader := c.Get("Authorization")
+		// 获取认证凭据
+		token := credential(c)
 
 		// 检查是否存在认证头
-		if authHeader == "" {
+		if token == "" {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 				"status":  fiber.StatusUnauthorized,
 				"message": "未提供认证令牌",
 			})
 		}
 
-		// 提取token
-		tokenString := ""
-		if strings.HasPrefix(authHeader, "Bearer ") {
-			tokenString = authHeader[7:]
-		} else {
-			tokenString = authHeader // 兼容直接传入token的情况
-		}
-
-		// 验证token
-		userID, username, role, err := utils.ValidateToken(tokenString)
-		if err != nil {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"status":  fiber.StatusUnauthorized,
-				"message": "无效的认证令牌或令牌已过期",
-			})
+		// 验证令牌或API密钥
+		user, authErr := authenticate(token, scopes)
+		if authErr != nil {
+			return authErr.respond(c)
 		}
 
-		// 检查用户角色是否为管理员
-		if role != "admin" {
+		// 检查用户角色是否拥有管理权限
+		if !auth.HasAnyPermission(user.role) {
 			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
 				"status":  fiber.StatusForbidden,
 				"message": "需要管理员权限",
@@ -89,9 +179,13 @@ func AdminAuth() fiber.Handler {
 		}
 
 		// 将用户信息存储在上下文中，以便后续使用
-		c.Locals("userID", userID)
-		c.Locals("username", username)
-		c.Locals("role", role)
+		c.Locals("userID", user.userID)
+		c.Locals("username", user.username)
+		c.Locals("role", user.role)
+		c.Locals("privateMode", user.privateMode)
+		if user.apiKeyID != 0 {
+			c.Locals("apiKeyID", user.apiKeyID)
+		}
 
 		// 继续处理请求
 		return c.Next()
@@ -100,38 +194,54 @@ func AdminAuth() fiber.Handler {
 
 // OptionalJWTAuth 是可选的JWT认证中间件
 // 不强制要求用户登录，但如果提供了有效的token则会解析用户信息
-func OptionalJWTAuth() fiber.Handler {
+// scopes 为允许访问的API密钥授权范围；与登录令牌不同，提供了无效的API密钥时直接拒绝请求，便于脚本发现配置错误
+func OptionalJWTAuth(scopes ...string) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		// 获取认证头
-		authHeader := c.Get("Authorization")
+		// 获取认证凭据
+		token := credential(c)
 
 		// 如果没有认证头，继续处理请求
-		if authHeader == "" {
-			fmt.Println("OptionalJWTAuth 没有认证头")
+		if token == "" {
 			return c.Next()
 		}
 
-		// 提取token
-		tokenString := ""
-		if strings.HasPrefix(authHeader, "Bearer ") {
-			tokenString = authHeader[7:]
-		} else {
-			tokenString = authHeader // 兼容直接传入token的情况
-		}
-
-		// 验证token
-		userID, username, role, err := utils.ValidateToken(tokenString)
-		if err != nil {
-			fmt.Println("OptionalJWTAuth token无效:", err)
+		// 验证令牌或API密钥
+		user, authErr := authenticate(token, scopes)
+		if authErr != nil {
+			if utils.IsAPIKey(token) {
+				return authErr.respond(c)
+			}
 			// 如果token无效，继续处理请求但不设置用户信息
 			return c.Next()
 		}
+
 		// 将用户信息存储在上下文中，以便后续使用
-		c.Locals("user_id", userID)
-		c.Locals("username", username)
-		c.Locals("role", role)
+		c.Locals("user_id", user.userID)
+		c.Locals("username", user.username)
+		c.Locals("role", user.role)
+		c.Locals("privateMode", user.privateMode)
+		if user.apiKeyID != 0 {
+			c.Locals("apiKeyID", user.apiKeyID)
+		}
 
 		// 继续处理请求
 		return c.Next()
 	}
 }
+
+// RequirePermission 是权限检查中间件，要求当前用户的角色拥有全部指定权限
+// 必须在 JWTAuth 或 AdminAuth 之后使用
+func RequirePermission(permissions ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		role, _ := c.Locals("role").(string)
+		for _, permission := range permissions {
+			if !auth.HasPermission(role, permission) {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+					"status":  fiber.StatusForbidden,
+					"message": fmt.Sprintf("缺少权限: %s", permission),
+				})
+			}
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"zmd5/api/auth"
+	"zmd5/config"
+	"zmd5/ratelimit"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var (
+	// rateLimits 限流配置，默认值与 config.Default 一致
+	rateLimits = config.Default().RateLimit
+	// limiter 限流器，默认的进程内实现只创建一次
+	limiter ratelimit.Limiter = ratelimit.NewMemoryLimiter()
+)
+
+// SetRateLimitConfig 设置限流配置，只更新限制，不替换限流器，已有的计数按新的限制继续生效
+func SetRateLimitConfig(cfg config.RateLimitConfig) {
+	rateLimits = cfg
+}
+
+// SetRateLimiter 替换限流器实现，多实例部署时可使用基于共享存储的实现
+func SetRateLimiter(l ratelimit.Limiter) {
+	limiter = l
+}
+
+// rateLimitKey 返回限流的计数对象和适用的限制：API密钥按密钥计数，登录用户按用户计数，匿名用户按IP计数
+func rateLimitKey(c *fiber.Ctx) (string, config.RateLimitTier) {
+	role, _ := c.Locals("role").(string)
+	tier := rateLimits.User
+	if role == auth.RoleAdmin {
+		tier = rateLimits.Admin
+	}
+
+	if keyID, ok := c.Locals("apiKeyID").(uint); ok {
+		return fmt.Sprintf("key:%d", keyID), tier
+	}
+	// JWTAuth 和 OptionalJWTAuth 使用不同的键保存用户ID
+	userID, ok := c.Locals("userID").(uint)
+	if !ok {
+		userID, ok = c.Locals("user_id").(uint)
+	}
+	if ok {
+		return fmt.Sprintf("user:%d", userID), tier
+	}
+	return "ip:" + c.IP(), rateLimits.Anonymous
+}
+
+// RateLimit 是限流中间件，令牌不足时返回429
+// 响应中包含 RateLimit-Limit、RateLimit-Remaining、RateLimit-Reset 和 RateLimit-Policy 头
+// 必须在 JWTAuth 或 OptionalJWTAuth 之后使用，以便按用户和API密钥计数
+func RateLimit() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !rateLimits.Enabled {
+			return c.Next()
+		}
+		key, tier := rateLimitKey(c)
+		limit := ratelimit.PerMinute(tier.PerMinute, tier.Burst)
+		if limit.Unlimited() {
+			return c.Next()
+		}
+
+		result := limiter.Allow(key, limit)
+		c.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+		c.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset.Seconds())))
+		c.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", result.Limit, ceilSeconds(limit.Window().Seconds())))
+		if !result.Allowed {
+			retryAfter := ceilSeconds(result.RetryAfter.Seconds())
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(retryAfter))
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+				"status":  fiber.StatusTooManyRequests,
+				"message": fmt.Sprintf("请求过于频繁，请在%d秒后重试", retryAfter),
+			})
+		}
+		return c.Next()
+	}
+}
+
+// ceilSeconds 将秒数向上取整，响应头中的秒数为整数
+func ceilSeconds(s float64) int {
+	return int(math.Ceil(s))
+}
@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+	"zmd5/config"
+	"zmd5/ratelimit"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// countingLimiter 记录调用次数的限流器
+type countingLimiter struct {
+	calls int
+}
+
+func (l *countingLimiter) Allow(key string, limit ratelimit.Limit) ratelimit.Result {
+	l.calls++
+	return ratelimit.Result{Allowed: true, Limit: limit.Burst}
+}
+
+func TestSetRateLimitConfigKeepsLimiter(t *testing.T) {
+	previous, previousLimits := limiter, rateLimits
+	t.Cleanup(func() { limiter, rateLimits = previous, previousLimits })
+
+	custom := &countingLimiter{}
+	SetRateLimiter(custom)
+	cfg := config.Default().RateLimit
+	cfg.Anonymous = config.RateLimitTier{PerMinute: 1, Burst: 1}
+	SetRateLimitConfig(cfg)
+
+	app := fiber.New()
+	app.Get("/", RateLimit(), func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+	for i := 0; i < 3; i++ {
+		resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+		if err != nil {
+			t.Fatalf("请求失败: %v", err)
+		}
+		if resp.StatusCode != fiber.StatusOK || resp.Header.Get("RateLimit-Limit") != "1" {
+			t.Fatalf("状态码 = %d, RateLimit-Limit = %s", resp.StatusCode, resp.Header.Get("RateLimit-Limit"))
+		}
+	}
+	if custom.calls != 3 {
+		t.Fatalf("设置限流配置后替换了限流器, 自定义限流器被调用 %d 次", custom.calls)
+	}
+}
+
+func TestRateLimitAnonymousByIP(t *testing.T) {
+	previous, previousLimits := limiter, rateLimits
+	t.Cleanup(func() { limiter, rateLimits = previous, previousLimits })
+
+	limiter = ratelimit.NewMemoryLimiter()
+	cfg := config.Default().RateLimit
+	cfg.Anonymous = config.RateLimitTier{PerMinute: 1, Burst: 2}
+	SetRateLimitConfig(cfg)
+
+	app := fiber.New()
+	app.Get("/", RateLimit(), func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+	var statuses []int
+	for i := 0; i < 3; i++ {
+		resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+		if err != nil {
+			t.Fatalf("请求失败: %v", err)
+		}
+		statuses = append(statuses, resp.StatusCode)
+	}
+	if statuses[0] != fiber.StatusOK || statuses[1] != fiber.StatusOK || statuses[2] != fiber.StatusTooManyRequests {
+		t.Fatalf("状态码 = %v, 期望前两个请求通过、第三个被拒绝", statuses)
+	}
+}
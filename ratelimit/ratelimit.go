@@ -0,0 +1,120 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Limit 令牌桶参数：桶容量为 Burst，每秒补充 Rate 个令牌
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// PerMinute 每分钟补充n个令牌、容量为burst的限制，n不大于0时不限制
+func PerMinute(n, burst int) Limit {
+	return Limit{Rate: float64(n) / 60, Burst: burst}
+}
+
+// Unlimited 是否不限制
+func (l Limit) Unlimited() bool {
+	return l.Rate <= 0 || l.Burst <= 0
+}
+
+// Window 令牌桶从空到满所需的时间
+func (l Limit) Window() time.Duration {
+	if l.Unlimited() {
+		return 0
+	}
+	return time.Duration(float64(l.Burst) / l.Rate * float64(time.Second))
+}
+
+// Result 一次取令牌的结果
+type Result struct {
+	Allowed bool
+	// 令牌桶容量
+	Limit int
+	// 剩余的令牌数
+	Remaining int
+	// 令牌桶重新装满所需的时间
+	Reset time.Duration
+	// 被拒绝时距离下一个令牌补充的时间
+	RetryAfter time.Duration
+}
+
+// Limiter 限流器，实现必须支持并发访问
+// 默认使用进程内实现，多实例部署时可替换为基于共享存储的实现
+type Limiter interface {
+	// Allow 从key对应的令牌桶取出一个令牌，令牌不足时拒绝
+	Allow(key string, limit Limit) Result
+}
+
+// 进程内限流器清理已装满的令牌桶的间隔
+const sweepInterval = time.Minute
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	// 令牌桶装满的时间，装满后的桶与不存在的桶等价，可以清理
+	fullAt time.Time
+}
+
+// MemoryLimiter 进程内令牌桶限流器，服务重启后重新计数
+type MemoryLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewMemoryLimiter 创建进程内限流器
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{buckets: make(map[string]*bucket), now: time.Now}
+}
+
+func (m *MemoryLimiter) Allow(key string, limit Limit) Result {
+	if limit.Unlimited() {
+		return Result{Allowed: true}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	burst := float64(limit.Burst)
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst}
+		m.buckets[key] = b
+	} else {
+		b.tokens = math.Min(burst, b.tokens+now.Sub(b.updated).Seconds()*limit.Rate)
+	}
+	b.updated = now
+
+	result := Result{Limit: limit.Burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = seconds((1 - b.tokens) / limit.Rate)
+	}
+	result.Remaining = int(b.tokens)
+	result.Reset = seconds((burst - b.tokens) / limit.Rate)
+	b.fullAt = now.Add(result.Reset)
+
+	// 定期清理已装满的令牌桶，避免大量不同IP占用内存
+	if now.Sub(m.lastSweep) >= sweepInterval {
+		for k, old := range m.buckets {
+			if !now.Before(old.fullAt) {
+				delete(m.buckets, k)
+			}
+		}
+		m.lastSweep = now
+	}
+	return result
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
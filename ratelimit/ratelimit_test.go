@@ -0,0 +1,112 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+// newTestLimiter 创建使用可控时钟的进程内限流器
+func newTestLimiter() (*MemoryLimiter, *time.Time) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	m := NewMemoryLimiter()
+	m.now = func() time.Time { return now }
+	return m, &now
+}
+
+func TestPerMinute(t *testing.T) {
+	limit := PerMinute(60, 10)
+	if limit.Rate != 1 || limit.Burst != 10 || limit.Unlimited() {
+		t.Fatalf("PerMinute(60, 10) = %+v", limit)
+	}
+	if limit.Window() != 10*time.Second {
+		t.Fatalf("Window() = %v, 期望 10s", limit.Window())
+	}
+	for _, l := range []Limit{PerMinute(0, 10), PerMinute(60, 0), PerMinute(-1, 10)} {
+		if !l.Unlimited() || l.Window() != 0 {
+			t.Fatalf("%+v 应为不限制", l)
+		}
+	}
+}
+
+func TestBurstAndRefill(t *testing.T) {
+	m, now := newTestLimiter()
+	limit := PerMinute(60, 3)
+
+	for i := 2; i >= 0; i-- {
+		result := m.Allow("a", limit)
+		if !result.Allowed || result.Remaining != i || result.Limit != 3 {
+			t.Fatalf("突发请求: %+v", result)
+		}
+	}
+	if result := m.Allow("a", limit); result.Allowed || result.RetryAfter != time.Second || result.Reset != 3*time.Second {
+		t.Fatalf("令牌用完后应拒绝并返回等待时间: %+v", result)
+	}
+	// 其他计数对象不受影响
+	if !m.Allow("b", limit).Allowed {
+		t.Fatal("其他计数对象被限制")
+	}
+
+	// 每秒补充一个令牌
+	*now = now.Add(500 * time.Millisecond)
+	if result := m.Allow("a", limit); result.Allowed || result.RetryAfter != 500*time.Millisecond {
+		t.Fatalf("令牌补充前应拒绝: %+v", result)
+	}
+	*now = now.Add(500 * time.Millisecond)
+	if !m.Allow("a", limit).Allowed {
+		t.Fatal("补充令牌后应允许")
+	}
+
+	// 令牌数不超过桶容量
+	*now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		if !m.Allow("a", limit).Allowed {
+			t.Fatal("装满后应允许突发请求")
+		}
+	}
+	if m.Allow("a", limit).Allowed {
+		t.Fatal("令牌数不应超过桶容量")
+	}
+}
+
+func TestLimitChange(t *testing.T) {
+	m, _ := newTestLimiter()
+	m.Allow("a", PerMinute(60, 10))
+
+	// 缩小桶容量后剩余令牌数不超过新的容量
+	result := m.Allow("a", PerMinute(60, 2))
+	if !result.Allowed || result.Remaining != 1 || result.Limit != 2 {
+		t.Fatalf("缩小容量后: %+v", result)
+	}
+}
+
+func TestSweepFullBuckets(t *testing.T) {
+	m, now := newTestLimiter()
+	limit := PerMinute(60, 3)
+	m.Allow("a", limit)
+	m.Allow("b", limit)
+	m.Allow("b", limit)
+
+	// 清理时只删除已经装满的令牌桶
+	*now = now.Add(sweepInterval).Add(-time.Second)
+	m.Allow("c", limit)
+	*now = now.Add(time.Second)
+	m.Allow("c", limit)
+	if _, ok := m.buckets["a"]; ok {
+		t.Fatal("已装满的令牌桶应被清理")
+	}
+	if _, ok := m.buckets["c"]; !ok {
+		t.Fatal("未装满的令牌桶不应被清理")
+	}
+}
+
+func TestUnlimited(t *testing.T) {
+	m, _ := newTestLimiter()
+	for i := 0; i < 100; i++ {
+		if !m.Allow("a", PerMinute(0, 0)).Allowed {
+			t.Fatal("不限制时应始终允许")
+		}
+	}
+	if len(m.buckets) != 0 {
+		t.Fatal("不限制时不应创建令牌桶")
+	}
+}
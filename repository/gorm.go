@@ -0,0 +1,795 @@
+package repository
+
+import (
+	"time"
+	"zmd5/db"
+	"zmd5/db/dbModel"
+
+	"gorm.io/gorm"
+)
+
+// New 基于GORM连接创建存储，PostgreSQL和SQLite共用同一套实现，
+// 方言相关的SQL（如二进制摘要的十六进制转换）由db包按连接的方言处理
+func New(conn *gorm.DB) *Store {
+	return &Store{
+		Users:         &gormUserRepository{db: conn},
+		Plaintexts:    &gormPlaintextRepository{db: conn},
+		Records:       &gormRecordRepository{db: conn},
+		RainbowChains: &gormRainbowChainRepository{db: conn},
+		Tasks:         &gormTaskRepository{db: conn},
+		APIKeys:       &gormAPIKeyRepository{db: conn},
+		RefreshTokens: &gormRefreshTokenRepository{db: conn},
+		Roles:         &gormRoleRepository{db: conn},
+		LoginAttempts: &gormLoginAttemptRepository{db: conn},
+		RecoveryCodes: &gormRecoveryCodeRepository{db: conn},
+		InviteCodes:   &gormInviteCodeRepository{db: conn},
+		AuditLogs:     &gormAuditLogRepository{db: conn},
+	}
+}
+
+type gormUserRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormUserRepository) FindByID(id uint) (*dbModel.User, error) {
+	var user dbModel.User
+	if err := r.db.First(&user, id).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *gormUserRepository) FindByUsername(username string) (*dbModel.User, error) {
+	var user dbModel.User
+	if err := r.db.Where("username = ?", username).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *gormUserRepository) Create(user *dbModel.User) error {
+	return r.db.Create(user).Error
+}
+
+func (r *gormUserRepository) Save(user *dbModel.User) error {
+	return r.db.Save(user).Error
+}
+
+func (r *gormUserRepository) Count(since time.Time) (int64, error) {
+	var count int64
+	query := r.db.Model(&dbModel.User{})
+	if !since.IsZero() {
+		query = query.Where("updated_at > ?", since)
+	}
+	err := query.Count(&count).Error
+	return count, err
+}
+
+func (r *gormUserRepository) CountByRole(role string) (int64, error) {
+	var count int64
+	err := r.db.Model(&dbModel.User{}).Where("role = ?", role).Count(&count).Error
+	return count, err
+}
+
+func (r *gormUserRepository) Update(id uint, fields map[string]interface{}) error {
+	return r.db.Model(&dbModel.User{}).Where("id = ?", id).Updates(fields).Error
+}
+
+func (r *gormUserRepository) List(filter UserFilter, offset, limit int) ([]dbModel.User, int64, error) {
+	query := r.db.Model(&dbModel.User{})
+	if filter.Search != "" {
+		query = query.Where("username LIKE ?", "%"+filter.Search+"%")
+	}
+	if filter.Role != "" {
+		query = query.Where("role = ?", filter.Role)
+	}
+	now := time.Now()
+	switch filter.Status {
+	case UserStatusActive:
+		query = query.Where("pending_approval = ? AND disabled = ? AND (locked_until IS NULL OR locked_until <= ?)", false, false, now)
+	case UserStatusDisabled:
+		query = query.Where("disabled = ?", true)
+	case UserStatusLocked:
+		query = query.Where("locked_until > ?", now)
+	case UserStatusResetRequired:
+		query = query.Where("must_reset_password = ?", true)
+	case UserStatusPending:
+		query = query.Where("pending_approval = ?", true)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var users []dbModel.User
+	err := query.Order("id").Offset(offset).Limit(limit).Find(&users).Error
+	return users, total, err
+}
+
+func (r *gormUserRepository) Delete(id uint) error {
+	return r.db.Unscoped().Delete(&dbModel.User{}, id).Error
+}
+
+func (r *gormUserRepository) UseTOTPStep(id uint, step int64) (bool, error) {
+	// 条件更新保证并发请求中同一验证码只有一个能成功
+	result := r.db.Model(&dbModel.User{}).Where("id = ? AND totp_last_step < ?", id, step).
+		UpdateColumn("totp_last_step", step)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *gormUserRepository) IncrementTokenVersion(id uint) error {
+	return r.db.Model(&dbModel.User{}).Where("id = ?", id).
+		UpdateColumn("token_version", gorm.Expr("token_version + 1")).Error
+}
+
+type gormPlaintextRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormPlaintextRepository) FindByHash(hash string) (*dbModel.Md5, error) {
+	var record dbModel.Md5
+	if err := db.FindMd5ByHash(r.db, hash, &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+func (r *gormPlaintextRepository) Insert(records []dbModel.Md5, batchSize int) (int64, error) {
+	return db.InsertMd5s(r.db, records, batchSize)
+}
+
+func (r *gormPlaintextRepository) Existing(md5s []string) ([]string, error) {
+	return db.ExistingMd5s(r.db, md5s)
+}
+
+func (r *gormPlaintextRepository) MarkReproduced(md5s []string, importJobID uint) error {
+	return db.MarkMd5Reproduced(r.db, md5s, importJobID)
+}
+
+func (r *gormPlaintextRepository) RecordHit(id uint) error {
+	return db.RecordMd5Hit(r.db, id)
+}
+
+func (r *gormPlaintextRepository) List(filter db.Md5Filter, offset, limit int) ([]dbModel.Md5, int64, error) {
+	var total int64
+	if err := filter.Apply(r.db.Model(&dbModel.Md5{})).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var records []dbModel.Md5
+	err := filter.Apply(r.db.Model(&dbModel.Md5{})).
+		Order("id DESC").
+		Offset(offset).
+		Limit(limit).
+		Find(&records).Error
+	return records, total, err
+}
+
+func (r *gormPlaintextRepository) Count(filter db.Md5Filter) (int64, error) {
+	var count int64
+	err := filter.Apply(r.db.Model(&dbModel.Md5{})).Count(&count).Error
+	return count, err
+}
+
+func (r *gormPlaintextRepository) DeleteByIDs(ids []uint) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	result := r.db.Unscoped().Where("id IN ?", ids).Delete(&dbModel.Md5{})
+	return result.RowsAffected, result.Error
+}
+
+func (r *gormPlaintextRepository) DeleteByFilter(filter db.Md5Filter, limit int) (int64, error) {
+	if limit <= 0 {
+		result := filter.Apply(r.db.Unscoped()).Delete(&dbModel.Md5{})
+		return result.RowsAffected, result.Error
+	}
+
+	var ids []uint
+	if err := filter.Apply(r.db.Model(&dbModel.Md5{})).
+		Order("id ASC").
+		Limit(limit).
+		Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+	return r.DeleteByIDs(ids)
+}
+
+func (r *gormPlaintextRepository) Transaction(fn func(tx PlaintextRepository) error) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return fn(&gormPlaintextRepository{db: tx})
+	})
+}
+
+type gormRecordRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormRecordRepository) Create(record *dbModel.MD5Record) error {
+	return r.db.Create(record).Error
+}
+
+func (r *gormRecordRepository) FindByID(id uint) (*dbModel.MD5Record, error) {
+	var record dbModel.MD5Record
+	if err := r.db.First(&record, id).Error; err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+func (r *gormRecordRepository) Update(id uint, fields map[string]interface{}) error {
+	return r.db.Model(&dbModel.MD5Record{}).Where("id = ?", id).Updates(fields).Error
+}
+
+func (r *gormRecordRepository) ListByUser(userID uint, offset, limit int) ([]dbModel.MD5Record, int64, error) {
+	var total int64
+	if err := r.db.Model(&dbModel.MD5Record{}).Where("user_id = ?", userID).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var records []dbModel.MD5Record
+	err := r.db.Model(&dbModel.MD5Record{}).
+		Where("user_id = ?", userID).
+		Order("created_at DESC").
+		Offset(offset).
+		Limit(limit).
+		Find(&records).Error
+	return records, total, err
+}
+
+func (r *gormRecordRepository) ListTasks(decryptStatus int, offset, limit int) ([]dbModel.MD5Record, int64, error) {
+	query := r.db.Model(&dbModel.MD5Record{})
+	if decryptStatus > 0 {
+		query = query.Where("decrypt_status = ?", decryptStatus)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var records []dbModel.MD5Record
+	err := query.Order("created_at DESC").
+		Offset(offset).
+		Limit(limit).
+		Find(&records).Error
+	return records, total, err
+}
+
+func (r *gormRecordRepository) FindInProgress() ([]dbModel.MD5Record, error) {
+	var records []dbModel.MD5Record
+	err := r.db.Where("decrypt_status = ?", dbModel.DecryptInProgress).Find(&records).Error
+	return records, err
+}
+
+func (r *gormRecordRepository) CountInProgress(userID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&dbModel.MD5Record{}).
+		Where("user_id = ? AND decrypt_status = ? AND type = 2", userID, dbModel.DecryptInProgress).
+		Count(&count).Error
+	return count, err
+}
+
+func (r *gormRecordRepository) ActivitySummaries(userIDs []uint) (map[uint]ActivitySummary, error) {
+	result := make(map[uint]ActivitySummary)
+	if len(userIDs) == 0 {
+		return result, nil
+	}
+
+	var rows []struct {
+		UserID uint
+		Total  int64
+		LastID uint
+	}
+	err := r.db.Model(&dbModel.MD5Record{}).
+		Select("user_id, COUNT(*) AS total, MAX(id) AS last_id").
+		Where("user_id IN ?", userIDs).
+		Group("user_id").
+		Scan(&rows).Error
+	if err != nil || len(rows) == 0 {
+		return result, err
+	}
+
+	// 最后一条记录的创建时间即最后活动时间，按ID查询避免对时间列聚合时的方言差异
+	lastIDs := make([]uint, len(rows))
+	for i, row := range rows {
+		lastIDs[i] = row.LastID
+	}
+	var last []dbModel.MD5Record
+	if err := r.db.Select("id, user_id, created_at").Where("id IN ?", lastIDs).Find(&last).Error; err != nil {
+		return nil, err
+	}
+	lastAt := make(map[uint]time.Time, len(last))
+	for _, record := range last {
+		lastAt[record.ID] = record.CreatedAt
+	}
+	for _, row := range rows {
+		result[row.UserID] = ActivitySummary{Total: row.Total, LastActivityAt: lastAt[row.LastID]}
+	}
+	return result, nil
+}
+
+func (r *gormRecordRepository) Activity(userID uint, since time.Time) (*UserActivity, error) {
+	activity := &UserActivity{DecryptsByStatus: make(map[int]int64)}
+
+	var rows []struct {
+		Type          int
+		DecryptStatus int
+		Count         int64
+	}
+	err := r.db.Model(&dbModel.MD5Record{}).
+		Select("type, decrypt_status, COUNT(*) AS count").
+		Where("user_id = ?", userID).
+		Group("type, decrypt_status").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		activity.Total += row.Count
+		switch row.Type {
+		case 1:
+			activity.Encrypts += row.Count
+		case 2:
+			activity.Decrypts += row.Count
+			activity.DecryptsByStatus[row.DecryptStatus] += row.Count
+		}
+	}
+	if activity.Total == 0 {
+		return activity, nil
+	}
+
+	var first, last dbModel.MD5Record
+	if err := r.db.Select("id, created_at").Where("user_id = ?", userID).Order("id").First(&first).Error; err != nil {
+		return nil, err
+	}
+	if err := r.db.Select("id, created_at").Where("user_id = ?", userID).Order("id DESC").First(&last).Error; err != nil {
+		return nil, err
+	}
+	activity.FirstActivityAt = &first.CreatedAt
+	activity.LastActivityAt = &last.CreatedAt
+
+	day := "to_char(created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD')"
+	if r.db.Dialector.Name() == db.DriverSQLite {
+		day = "strftime('%Y-%m-%d', created_at)"
+	}
+	var daily []struct {
+		Day   string
+		Count int64
+	}
+	err = r.db.Model(&dbModel.MD5Record{}).
+		Select(day+" AS day, COUNT(*) AS count").
+		Where("user_id = ? AND created_at >= ?", userID, since).
+		Group("day").
+		Order("day").
+		Scan(&daily).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range daily {
+		activity.Daily = append(activity.Daily, DailyCount{Date: row.Day, Count: row.Count})
+	}
+	return activity, nil
+}
+
+func (r *gormRecordRepository) ClearPlaintexts(before time.Time) (int64, error) {
+	result := r.db.Model(&dbModel.MD5Record{}).
+		Where("created_at < ? AND plain_text <> '' AND decrypt_status <> ?", before, dbModel.DecryptInProgress).
+		UpdateColumn("plain_text", "")
+	return result.RowsAffected, result.Error
+}
+
+type gormRainbowChainRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormRainbowChainRepository) Create(chain *dbModel.RainbowTable) error {
+	return r.db.Create(chain).Error
+}
+
+func (r *gormRainbowChainRepository) FindByEndHash(endHash string) ([]dbModel.RainbowTable, error) {
+	var chains []dbModel.RainbowTable
+	err := r.db.Where("end_hash = ?", endHash).Find(&chains).Error
+	return chains, err
+}
+
+func (r *gormRainbowChainRepository) All() ([]dbModel.RainbowTable, error) {
+	var chains []dbModel.RainbowTable
+	err := r.db.Order("id").Find(&chains).Error
+	return chains, err
+}
+
+func (r *gormRainbowChainRepository) List(offset, limit int) ([]dbModel.RainbowTable, int64, error) {
+	var total int64
+	if err := r.db.Model(&dbModel.RainbowTable{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var chains []dbModel.RainbowTable
+	err := r.db.Offset(offset).Limit(limit).Order("id DESC").Find(&chains).Error
+	return chains, total, err
+}
+
+func (r *gormRainbowChainRepository) Count() (int64, error) {
+	var count int64
+	err := r.db.Model(&dbModel.RainbowTable{}).Count(&count).Error
+	return count, err
+}
+
+func (r *gormRainbowChainRepository) Stats() (RainbowStats, error) {
+	var stats RainbowStats
+	if err := r.db.Model(&dbModel.RainbowTable{}).Count(&stats.TotalChains).Error; err != nil {
+		return stats, err
+	}
+	if stats.TotalChains == 0 {
+		return stats, nil
+	}
+	if err := r.db.Model(&dbModel.RainbowTable{}).Distinct("charset_type").Count(&stats.TotalCharsets).Error; err != nil {
+		return stats, err
+	}
+	err := r.db.Model(&dbModel.RainbowTable{}).Select("AVG(chain_length) as average_chain_length").
+		Scan(&stats.AverageChainLength).Error
+	return stats, err
+}
+
+func (r *gormRainbowChainRepository) Delete(id uint) (bool, error) {
+	result := r.db.Delete(&dbModel.RainbowTable{}, id)
+	return result.RowsAffected > 0, result.Error
+}
+
+type gormTaskRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormTaskRepository) FindProgress(taskID uint) (*dbModel.TaskProgressRecord, error) {
+	var progress dbModel.TaskProgressRecord
+	if err := r.db.Where("task_id = ?", taskID).First(&progress).Error; err != nil {
+		return nil, err
+	}
+	return &progress, nil
+}
+
+func (r *gormTaskRepository) SaveProgress(progress *dbModel.TaskProgressRecord) error {
+	var existing dbModel.TaskProgressRecord
+	if err := r.db.Where("task_id = ?", progress.TaskID).First(&existing).Error; err != nil {
+		return r.db.Create(progress).Error
+	}
+	progress.ID = existing.ID
+	return r.db.Model(&existing).Updates(map[string]interface{}{
+		"tables_searched":    progress.TablesSearched,
+		"total_tables":       progress.TotalTables,
+		"chains_searched":    progress.ChainsSearched,
+		"reduction_attempts": progress.ReductionAttempts,
+		"chain_id":           progress.ChainID,
+		"chain_position":     progress.ChainPosition,
+		"current_hash":       progress.CurrentHash,
+	}).Error
+}
+
+type gormAPIKeyRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormAPIKeyRepository) Create(key *dbModel.APIKey) error {
+	return r.db.Create(key).Error
+}
+
+func (r *gormAPIKeyRepository) FindByHash(keyHash string) (*dbModel.APIKey, error) {
+	var key dbModel.APIKey
+	if err := r.db.Where("key_hash = ?", keyHash).First(&key).Error; err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (r *gormAPIKeyRepository) ListByUser(userID uint) ([]dbModel.APIKey, error) {
+	var keys []dbModel.APIKey
+	err := r.db.Where("user_id = ?", userID).Order("id DESC").Find(&keys).Error
+	return keys, err
+}
+
+func (r *gormAPIKeyRepository) Revoke(id, userID uint, at time.Time) (bool, error) {
+	result := r.db.Model(&dbModel.APIKey{}).Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		UpdateColumn("revoked_at", at)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *gormAPIKeyRepository) Touch(id uint, at time.Time) error {
+	return r.db.Model(&dbModel.APIKey{}).Where("id = ?", id).UpdateColumn("last_used_at", at).Error
+}
+
+type gormRefreshTokenRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormRefreshTokenRepository) Create(token *dbModel.RefreshToken) error {
+	return r.db.Create(token).Error
+}
+
+func (r *gormRefreshTokenRepository) FindByHash(tokenHash string) (*dbModel.RefreshToken, error) {
+	var token dbModel.RefreshToken
+	if err := r.db.Where("token_hash = ?", tokenHash).First(&token).Error; err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (r *gormRefreshTokenRepository) Rotate(old *dbModel.RefreshToken, next *dbModel.RefreshToken, at time.Time) (bool, error) {
+	rotated := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		// 以撤销旧令牌的影响行数判断是否被并发刷新抢先
+		result := tx.Model(&dbModel.RefreshToken{}).Where("id = ? AND revoked_at IS NULL", old.ID).
+			UpdateColumn("revoked_at", at)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		if err := tx.Create(next).Error; err != nil {
+			return err
+		}
+		rotated = true
+		return nil
+	})
+	return rotated, err
+}
+
+func (r *gormRefreshTokenRepository) RevokeFamily(familyID string, at time.Time) error {
+	return r.db.Model(&dbModel.RefreshToken{}).Where("family_id = ? AND revoked_at IS NULL", familyID).
+		UpdateColumn("revoked_at", at).Error
+}
+
+func (r *gormRefreshTokenRepository) RevokeUser(userID uint, at time.Time) error {
+	return r.db.Model(&dbModel.RefreshToken{}).Where("user_id = ? AND revoked_at IS NULL", userID).
+		UpdateColumn("revoked_at", at).Error
+}
+
+func (r *gormRefreshTokenRepository) FamilyActive(familyID string, now time.Time) (bool, error) {
+	var count int64
+	err := r.db.Model(&dbModel.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL AND expires_at > ?", familyID, now).
+		Limit(1).Count(&count).Error
+	return count > 0, err
+}
+
+func (r *gormRefreshTokenRepository) DeleteExpired(before time.Time) (int64, error) {
+	result := r.db.Unscoped().Where("expires_at < ?", before).Delete(&dbModel.RefreshToken{})
+	return result.RowsAffected, result.Error
+}
+
+type gormRoleRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormRoleRepository) All() ([]dbModel.RolePermission, error) {
+	var rows []dbModel.RolePermission
+	err := r.db.Order("role, permission").Find(&rows).Error
+	return rows, err
+}
+
+func (r *gormRoleRepository) Replace(role string, permissions []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("role = ?", role).Delete(&dbModel.RolePermission{}).Error; err != nil {
+			return err
+		}
+		if len(permissions) == 0 {
+			return nil
+		}
+		rows := make([]dbModel.RolePermission, len(permissions))
+		for i, perm := range permissions {
+			rows[i] = dbModel.RolePermission{Role: role, Permission: perm}
+		}
+		return tx.Create(&rows).Error
+	})
+}
+
+func (r *gormRoleRepository) Settings() ([]dbModel.RoleSetting, error) {
+	var rows []dbModel.RoleSetting
+	err := r.db.Order("role").Find(&rows).Error
+	return rows, err
+}
+
+func (r *gormRoleRepository) SetRequireTwoFactor(role string, required bool) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("role = ?", role).Delete(&dbModel.RoleSetting{}).Error; err != nil {
+			return err
+		}
+		// 默认设置不需要保存
+		if !required {
+			return nil
+		}
+		return tx.Create(&dbModel.RoleSetting{Role: role, RequireTwoFactor: true}).Error
+	})
+}
+
+type gormLoginAttemptRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormLoginAttemptRepository) Create(attempt *dbModel.LoginAttempt) error {
+	return r.db.Create(attempt).Error
+}
+
+func (r *gormLoginAttemptRepository) List(filter LoginAttemptFilter, offset, limit int) ([]dbModel.LoginAttempt, int64, error) {
+	query := r.db.Model(&dbModel.LoginAttempt{})
+	if filter.Username != "" {
+		query = query.Where("username = ?", filter.Username)
+	}
+	if filter.IP != "" {
+		query = query.Where("ip = ?", filter.IP)
+	}
+	if filter.Result != "" {
+		query = query.Where("result = ?", filter.Result)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var attempts []dbModel.LoginAttempt
+	if err := query.Order("id DESC").Offset(offset).Limit(limit).Find(&attempts).Error; err != nil {
+		return nil, 0, err
+	}
+	return attempts, total, nil
+}
+
+func (r *gormLoginAttemptRepository) DeleteBefore(before time.Time) (int64, error) {
+	result := r.db.Where("created_at < ?", before).Delete(&dbModel.LoginAttempt{})
+	return result.RowsAffected, result.Error
+}
+
+type gormRecoveryCodeRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormRecoveryCodeRepository) Replace(userID uint, codeHashes []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&dbModel.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		if len(codeHashes) == 0 {
+			return nil
+		}
+		rows := make([]dbModel.RecoveryCode, len(codeHashes))
+		for i, hash := range codeHashes {
+			rows[i] = dbModel.RecoveryCode{UserID: userID, CodeHash: hash}
+		}
+		return tx.Create(&rows).Error
+	})
+}
+
+func (r *gormRecoveryCodeRepository) Unused(userID uint) ([]dbModel.RecoveryCode, error) {
+	var codes []dbModel.RecoveryCode
+	err := r.db.Where("user_id = ? AND used_at IS NULL", userID).Order("id").Find(&codes).Error
+	return codes, err
+}
+
+func (r *gormRecoveryCodeRepository) MarkUsed(id uint, at time.Time) (bool, error) {
+	// 条件更新保证并发请求中同一恢复码只有一个能成功
+	result := r.db.Model(&dbModel.RecoveryCode{}).
+		Where("id = ? AND used_at IS NULL", id).
+		UpdateColumn("used_at", at)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *gormRecoveryCodeRepository) CountUnused(userID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&dbModel.RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&count).Error
+	return count, err
+}
+
+func (r *gormRecoveryCodeRepository) DeleteByUser(userID uint) error {
+	return r.db.Where("user_id = ?", userID).Delete(&dbModel.RecoveryCode{}).Error
+}
+
+type gormInviteCodeRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormInviteCodeRepository) Create(invite *dbModel.InviteCode) error {
+	return r.db.Create(invite).Error
+}
+
+func (r *gormInviteCodeRepository) FindByID(id uint) (*dbModel.InviteCode, error) {
+	var invite dbModel.InviteCode
+	if err := r.db.First(&invite, id).Error; err != nil {
+		return nil, err
+	}
+	return &invite, nil
+}
+
+func (r *gormInviteCodeRepository) List(offset, limit int) ([]dbModel.InviteCode, int64, error) {
+	var total int64
+	if err := r.db.Model(&dbModel.InviteCode{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var invites []dbModel.InviteCode
+	if err := r.db.Order("id DESC").Offset(offset).Limit(limit).Find(&invites).Error; err != nil {
+		return nil, 0, err
+	}
+	return invites, total, nil
+}
+
+func (r *gormInviteCodeRepository) Consume(codeHash string, now time.Time) (*dbModel.InviteCode, bool, error) {
+	result := r.db.Model(&dbModel.InviteCode{}).
+		Where("code_hash = ? AND revoked_at IS NULL AND uses < max_uses AND (expires_at IS NULL OR expires_at > ?)", codeHash, now).
+		UpdateColumn("uses", gorm.Expr("uses + 1"))
+	if result.Error != nil || result.RowsAffected == 0 {
+		return nil, false, result.Error
+	}
+	var invite dbModel.InviteCode
+	if err := r.db.Where("code_hash = ?", codeHash).First(&invite).Error; err != nil {
+		return nil, false, err
+	}
+	return &invite, true, nil
+}
+
+func (r *gormInviteCodeRepository) Release(id uint) error {
+	return r.db.Model(&dbModel.InviteCode{}).Where("id = ? AND uses > 0", id).
+		UpdateColumn("uses", gorm.Expr("uses - 1")).Error
+}
+
+func (r *gormInviteCodeRepository) Revoke(id uint, at time.Time) (bool, error) {
+	result := r.db.Model(&dbModel.InviteCode{}).Where("id = ? AND revoked_at IS NULL", id).
+		UpdateColumn("revoked_at", at)
+	return result.RowsAffected > 0, result.Error
+}
+
+type gormAuditLogRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormAuditLogRepository) Create(log *dbModel.AuditLog) error {
+	return r.db.Create(log).Error
+}
+
+func (r *gormAuditLogRepository) query(filter AuditLogFilter) *gorm.DB {
+	query := r.db.Model(&dbModel.AuditLog{})
+	if filter.ActorName != "" {
+		query = query.Where("actor_name = ?", filter.ActorName)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ? OR action LIKE ?", filter.Action, filter.Action+".%")
+	}
+	if filter.Target != "" {
+		query = query.Where("target LIKE ?", "%"+filter.Target+"%")
+	}
+	if filter.Success != nil {
+		query = query.Where("success = ?", *filter.Success)
+	}
+	if filter.Since != nil {
+		query = query.Where("created_at >= ?", *filter.Since)
+	}
+	if filter.Until != nil {
+		query = query.Where("created_at < ?", *filter.Until)
+	}
+	return query
+}
+
+func (r *gormAuditLogRepository) List(filter AuditLogFilter, offset, limit int) ([]dbModel.AuditLog, int64, error) {
+	var total int64
+	if err := r.query(filter).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var logs []dbModel.AuditLog
+	if err := r.query(filter).Order("id DESC").Offset(offset).Limit(limit).Find(&logs).Error; err != nil {
+		return nil, 0, err
+	}
+	return logs, total, nil
+}
+
+func (r *gormAuditLogRepository) Each(filter AuditLogFilter, batchSize int, fn func([]dbModel.AuditLog) error) error {
+	var lastID uint
+	for {
+		var logs []dbModel.AuditLog
+		err := r.query(filter).Where("id > ?", lastID).Order("id").Limit(batchSize).Find(&logs).Error
+		if err != nil {
+			return err
+		}
+		if len(logs) == 0 {
+			return nil
+		}
+		if err := fn(logs); err != nil {
+			return err
+		}
+		lastID = logs[len(logs)-1].ID
+	}
+}
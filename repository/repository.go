@@ -0,0 +1,278 @@
+package repository
+
+import (
+	"time"
+	"zmd5/db"
+	"zmd5/db/dbModel"
+)
+
+// Store 汇总各个存储接口，由main根据配置的存储后端创建后注入到各个处理器
+type Store struct {
+	Users         UserRepository
+	Plaintexts    PlaintextRepository
+	Records       RecordRepository
+	RainbowChains RainbowChainRepository
+	Tasks         TaskRepository
+	APIKeys       APIKeyRepository
+	RefreshTokens RefreshTokenRepository
+	Roles         RoleRepository
+	LoginAttempts LoginAttemptRepository
+	RecoveryCodes RecoveryCodeRepository
+	InviteCodes   InviteCodeRepository
+	AuditLogs     AuditLogRepository
+}
+
+// UserRepository 用户存储
+type UserRepository interface {
+	// FindByID 按ID查找用户，不存在时返回 gorm.ErrRecordNotFound
+	FindByID(id uint) (*dbModel.User, error)
+	// FindByUsername 按用户名查找用户，不存在时返回 gorm.ErrRecordNotFound
+	FindByUsername(username string) (*dbModel.User, error)
+	Create(user *dbModel.User) error
+	Save(user *dbModel.User) error
+	// Count 统计用户数量，since不为零时只统计该时间之后有更新的用户
+	Count(since time.Time) (int64, error)
+	// CountByRole 统计指定角色的用户数量
+	CountByRole(role string) (int64, error)
+	// IncrementTokenVersion 递增用户的令牌版本，使已签发的访问令牌全部失效
+	IncrementTokenVersion(id uint) error
+	// Update 按字段名更新用户
+	Update(id uint, fields map[string]interface{}) error
+	// List 按过滤条件分页查询用户，按ID排序，返回当前页和总数
+	List(filter UserFilter, offset, limit int) ([]dbModel.User, int64, error)
+	// Delete 永久删除用户（用于拒绝待审核的注册），删除后用户名可以重新注册
+	Delete(id uint) error
+	// UseTOTPStep 记录已使用的两步验证时间步，step不大于已记录的时间步（验证码重复使用）时返回false
+	UseTOTPStep(id uint, step int64) (bool, error)
+}
+
+// 用户列表的状态过滤条件
+const (
+	UserStatusActive        = "active"         // 已审核、未禁用且未锁定
+	UserStatusDisabled      = "disabled"       // 已禁用
+	UserStatusLocked        = "locked"         // 锁定中
+	UserStatusResetRequired = "reset_required" // 需要修改密码
+	UserStatusPending       = "pending"        // 等待管理员审核注册
+)
+
+// UserFilter 用户列表过滤条件，字段为空时不过滤
+type UserFilter struct {
+	// 用户名包含的关键字
+	Search string
+	Role   string
+	// 账户状态，见 UserStatus* 常量
+	Status string
+}
+
+// PlaintextRepository 明文库存储
+type PlaintextRepository interface {
+	// FindByHash 按32位或16位哈希查找明文，不存在时返回 gorm.ErrRecordNotFound
+	FindByHash(hash string) (*dbModel.Md5, error)
+	// Insert 批量插入明文记录，跳过已存在的记录，返回实际插入的行数
+	Insert(records []dbModel.Md5, batchSize int) (int64, error)
+	// Existing 返回md5s中已存在的32位哈希
+	Existing(md5s []string) ([]string, error)
+	// MarkReproduced 标记已存在的记录又被其他来源提交了一次，importJobID大于0时同一导入任务内的重复不计入
+	MarkReproduced(md5s []string, importJobID uint) error
+	// RecordHit 记录一次命中
+	RecordHit(id uint) error
+	// List 按过滤条件分页查询，返回当前页和总数
+	List(filter db.Md5Filter, offset, limit int) ([]dbModel.Md5, int64, error)
+	// Count 统计符合过滤条件的记录数
+	Count(filter db.Md5Filter) (int64, error)
+	// DeleteByIDs 按ID永久删除记录，返回删除的行数
+	DeleteByIDs(ids []uint) (int64, error)
+	// DeleteByFilter 永久删除符合过滤条件的记录，limit大于0时最多删除limit条（按ID顺序），返回删除的行数
+	DeleteByFilter(filter db.Md5Filter, limit int) (int64, error)
+	// Transaction 在同一事务中执行fn，fn返回错误时回滚
+	Transaction(fn func(tx PlaintextRepository) error) error
+}
+
+// RecordRepository 用户加解密记录（同时也是彩虹表解密任务）存储
+type RecordRepository interface {
+	Create(record *dbModel.MD5Record) error
+	// FindByID 按ID查找记录，不存在时返回 gorm.ErrRecordNotFound
+	FindByID(id uint) (*dbModel.MD5Record, error)
+	// Update 按字段名更新记录
+	Update(id uint, fields map[string]interface{}) error
+	// ListByUser 分页查询用户的记录，按创建时间倒序
+	ListByUser(userID uint, offset, limit int) ([]dbModel.MD5Record, int64, error)
+	// ListTasks 分页查询所有记录，decryptStatus大于0时按解密状态过滤
+	ListTasks(decryptStatus int, offset, limit int) ([]dbModel.MD5Record, int64, error)
+	// FindInProgress 查询所有解密进行中的记录
+	FindInProgress() ([]dbModel.MD5Record, error)
+	// CountInProgress 统计用户解密进行中的任务数量
+	CountInProgress(userID uint) (int64, error)
+	// ActivitySummaries 统计多个用户的记录总数和最后活动时间，没有记录的用户不在结果中
+	ActivitySummaries(userIDs []uint) (map[uint]ActivitySummary, error)
+	// Activity 统计用户的活动详情，按日统计从since开始
+	Activity(userID uint, since time.Time) (*UserActivity, error)
+	// ClearPlaintexts 清除在before之前创建的记录中的明文，只保留哈希，解密进行中的记录除外，返回更新的行数
+	ClearPlaintexts(before time.Time) (int64, error)
+}
+
+// ActivitySummary 用户活动概要
+type ActivitySummary struct {
+	Total          int64
+	LastActivityAt time.Time
+}
+
+// UserActivity 用户活动详情
+type UserActivity struct {
+	Total    int64
+	Encrypts int64
+	Decrypts int64
+	// 解密记录按解密状态（dbModel.Decrypt*）统计
+	DecryptsByStatus map[int]int64
+	// 没有记录时为空
+	FirstActivityAt *time.Time
+	LastActivityAt  *time.Time
+	// 每日记录数（UTC日期，YYYY-MM-DD），没有记录的日期不在结果中
+	Daily []DailyCount
+}
+
+// DailyCount 某一天的记录数
+type DailyCount struct {
+	Date  string
+	Count int64
+}
+
+// RainbowStats 彩虹表统计信息
+type RainbowStats struct {
+	TotalChains        int64
+	TotalCharsets      int64
+	AverageChainLength float64
+}
+
+// RainbowChainRepository 彩虹表链存储
+type RainbowChainRepository interface {
+	Create(chain *dbModel.RainbowTable) error
+	// FindByEndHash 查找终止哈希匹配的链
+	FindByEndHash(endHash string) ([]dbModel.RainbowTable, error)
+	// All 按ID顺序返回所有链，解密任务按ID记录检查点
+	All() ([]dbModel.RainbowTable, error)
+	// List 分页查询链，按ID倒序
+	List(offset, limit int) ([]dbModel.RainbowTable, int64, error)
+	Count() (int64, error)
+	Stats() (RainbowStats, error)
+	// Delete 删除链，不存在时返回false
+	Delete(id uint) (bool, error)
+}
+
+// TaskRepository 彩虹表解密任务详细进度存储
+type TaskRepository interface {
+	// FindProgress 查找任务的详细进度，不存在时返回 gorm.ErrRecordNotFound
+	FindProgress(taskID uint) (*dbModel.TaskProgressRecord, error)
+	// SaveProgress 按任务ID保存详细进度，不存在时创建
+	SaveProgress(progress *dbModel.TaskProgressRecord) error
+}
+
+// APIKeyRepository API密钥存储
+type APIKeyRepository interface {
+	Create(key *dbModel.APIKey) error
+	// FindByHash 按密钥摘要查找，不存在时返回 gorm.ErrRecordNotFound
+	FindByHash(keyHash string) (*dbModel.APIKey, error)
+	// ListByUser 返回用户的所有密钥（包括已撤销的），按ID倒序
+	ListByUser(userID uint) ([]dbModel.APIKey, error)
+	// Revoke 撤销用户的密钥，密钥不存在、不属于该用户或已撤销时返回false
+	Revoke(id, userID uint, at time.Time) (bool, error)
+	// Touch 更新密钥的最后使用时间
+	Touch(id uint, at time.Time) error
+}
+
+// RefreshTokenRepository 刷新令牌存储
+type RefreshTokenRepository interface {
+	Create(token *dbModel.RefreshToken) error
+	// FindByHash 按令牌摘要查找，不存在时返回 gorm.ErrRecordNotFound
+	FindByHash(tokenHash string) (*dbModel.RefreshToken, error)
+	// Rotate 在同一事务中撤销旧令牌并创建新令牌，旧令牌已被撤销（并发刷新）时返回false且不创建新令牌
+	Rotate(old *dbModel.RefreshToken, next *dbModel.RefreshToken, at time.Time) (bool, error)
+	// RevokeFamily 撤销会话的所有刷新令牌
+	RevokeFamily(familyID string, at time.Time) error
+	// RevokeUser 撤销用户所有会话的刷新令牌
+	RevokeUser(userID uint, at time.Time) error
+	// FamilyActive 会话是否仍有未撤销且未过期的刷新令牌
+	FamilyActive(familyID string, now time.Time) (bool, error)
+	// DeleteExpired 永久删除在before之前过期的令牌，返回删除的行数
+	DeleteExpired(before time.Time) (int64, error)
+}
+
+// RoleRepository 角色权限存储
+type RoleRepository interface {
+	// All 返回所有角色的权限
+	All() ([]dbModel.RolePermission, error)
+	// Replace 在同一事务中替换角色的全部权限，permissions为空时删除该角色的所有权限
+	Replace(role string, permissions []string) error
+	// Settings 返回所有角色的安全设置
+	Settings() ([]dbModel.RoleSetting, error)
+	// SetRequireTwoFactor 设置角色是否必须开启两步验证
+	SetRequireTwoFactor(role string, required bool) error
+}
+
+// LoginAttemptRepository 登录尝试审计记录存储
+type LoginAttemptRepository interface {
+	Create(attempt *dbModel.LoginAttempt) error
+	// List 按过滤条件分页查询，按ID倒序，返回当前页和总数
+	List(filter LoginAttemptFilter, offset, limit int) ([]dbModel.LoginAttempt, int64, error)
+	// DeleteBefore 永久删除在before之前的记录，返回删除的行数
+	DeleteBefore(before time.Time) (int64, error)
+}
+
+// LoginAttemptFilter 登录尝试过滤条件，字段为空时不过滤
+type LoginAttemptFilter struct {
+	Username string
+	IP       string
+	// 结果，见 dbModel.Login* 常量
+	Result string
+}
+
+// RecoveryCodeRepository 两步验证恢复码存储
+type RecoveryCodeRepository interface {
+	// Replace 在同一事务中删除用户的全部恢复码并保存新的恢复码摘要
+	Replace(userID uint, codeHashes []string) error
+	// Unused 返回用户未使用的恢复码
+	Unused(userID uint) ([]dbModel.RecoveryCode, error)
+	// MarkUsed 将未使用的恢复码标记为已使用，恢复码已被使用时返回false
+	MarkUsed(id uint, at time.Time) (bool, error)
+	// CountUnused 统计用户未使用的恢复码数量
+	CountUnused(userID uint) (int64, error)
+	// DeleteByUser 删除用户的全部恢复码
+	DeleteByUser(userID uint) error
+}
+
+// InviteCodeRepository 注册邀请码存储
+type InviteCodeRepository interface {
+	Create(invite *dbModel.InviteCode) error
+	// FindByID 按ID查找邀请码，不存在时返回 gorm.ErrRecordNotFound
+	FindByID(id uint) (*dbModel.InviteCode, error)
+	// List 分页查询邀请码，按ID倒序，返回当前页和总数
+	List(offset, limit int) ([]dbModel.InviteCode, int64, error)
+	// Consume 使用一次邀请码，邀请码不存在、已撤销、已过期或已用完时返回false
+	// 使用次数通过条件更新递增，并发注册不会超过最大使用次数
+	Consume(codeHash string, now time.Time) (*dbModel.InviteCode, bool, error)
+	// Release 归还一次使用次数（使用邀请码后创建用户失败时调用）
+	Release(id uint) error
+	// Revoke 撤销邀请码，邀请码不存在或已撤销时返回false
+	Revoke(id uint, at time.Time) (bool, error)
+}
+
+// AuditLogRepository 审计日志存储，只追加，不提供修改和删除
+type AuditLogRepository interface {
+	Create(log *dbModel.AuditLog) error
+	// List 按过滤条件分页查询，按ID倒序，返回当前页和总数
+	List(filter AuditLogFilter, offset, limit int) ([]dbModel.AuditLog, int64, error)
+	// Each 按ID顺序分批读取符合过滤条件的记录，fn返回错误时停止
+	Each(filter AuditLogFilter, batchSize int, fn func([]dbModel.AuditLog) error) error
+}
+
+// AuditLogFilter 审计日志过滤条件，字段为空时不过滤
+type AuditLogFilter struct {
+	ActorName string
+	// 操作名称，同时匹配以其为前缀的操作，如 user 匹配 user.disable
+	Action string
+	// 操作对象包含的关键字
+	Target  string
+	Success *bool
+	Since   *time.Time
+	Until   *time.Time
+}
@@ -5,65 +5,159 @@ import (
 	"zmd5/api/auth"
 	"zmd5/api/md5"
 	"zmd5/api/rainbow"
+	"zmd5/api/system"
 	"zmd5/api/user"
+	"zmd5/db/dbModel"
 	"zmd5/middleware"
+	"zmd5/repository"
 
 	"github.com/gofiber/fiber/v2"
 )
 
-// SetupRoutes 配置所有路由
-func SetupRoutes(app *fiber.App) {
+// SetupRoutes 将存储注入各处理器并配置所有路由
+func SetupRoutes(app *fiber.App, store *repository.Store) {
+	admin.Init(store)
+	auth.Init(store)
+	md5.Init(store)
+	rainbow.Init(store)
+	user.Init(store)
+	middleware.Init(store)
+
+	// 存活检查、就绪检查和 Prometheus 指标，供负载均衡和监控系统访问
+	app.Get("/healthz", system.Healthz)
+	app.Get("/readyz", system.Readyz)
+	app.Get("/metrics", system.Metrics)
+
 	// API 路由组
 	api := app.Group("/api")
 
-	// 配置管理员路由（需要管理员权限）
+	// 配置管理后台路由（需要管理权限，各接口所需的权限见 auth.Permissions）
 	adminRoutes := api.Group("/admin")
-	adminRoutes.Use(middleware.AdminAuth())
-	adminRoutes.Get("/stats", admin.Stats)
+	perm := middleware.RequirePermission
+	// 修改数据和导出数据的接口记录审计日志
+	audit := middleware.Audit
+	// 导入相关接口允许使用带 admin:import 授权范围的API密钥访问
+	// 必须在 adminRoutes.Use 之前注册：fiber 按注册顺序匹配，这些路由处理完成后不会再经过下面只接受登录令牌的中间件
+	importAuth := middleware.AdminAuth(dbModel.ScopeAdminImport)
 	// 管理员根据明文生成md5值
-	adminRoutes.Post("/md5/encrypt", admin.Encrypt)
+	adminRoutes.Post("/md5/encrypt", importAuth, audit("md5.encrypt"), perm(auth.PermMd5Import), admin.Encrypt)
 	// 文件上传生成md5值
-	adminRoutes.Post("/md5/upload", admin.Upload)
+	adminRoutes.Post("/md5/upload", importAuth, audit("md5.import"), perm(auth.PermMd5Import), admin.Upload)
+	// 文件导入任务列表
+	adminRoutes.Get("/import/jobs", importAuth, perm(auth.PermMd5Import), admin.ImportJobs)
+	adminRoutes.Get("/import/jobs/:id", importAuth, perm(auth.PermMd5Import), admin.ImportJobStatus)
+
+	adminRoutes.Use(middleware.AdminAuth())
+	adminRoutes.Get("/stats", perm(auth.PermStatsRead), admin.Stats)
+	// 回滚导入任务（后台分批删除该任务新增的记录）
+	adminRoutes.Post("/import/jobs/:id/rollback", audit("import.rollback"), perm(auth.PermMd5Delete), admin.RollbackImportJob)
+	// 后台任务列表、进度查询和取消
+	adminRoutes.Get("/jobs", perm(auth.PermJobsRead), admin.BackgroundJobs)
+	adminRoutes.Get("/jobs/:id", perm(auth.PermJobsRead), admin.BackgroundJobStatus)
+	adminRoutes.Post("/jobs/:id/cancel", audit("job.cancel"), perm(auth.PermJobsManage), admin.CancelBackgroundJob)
 	// 管理员md5管理
-	adminRoutes.Get("/md5/management", admin.MD5Management)
+	adminRoutes.Get("/md5/management", perm(auth.PermMd5Read), admin.MD5Management)
 	// 管理员删除MD5记录
-	adminRoutes.Delete("/md5/records/:id", admin.DeleteMD5Record)
-	// 彩虹表生成（仅管理员）
-	adminRoutes.Post("/rainbow/generate", rainbow.Generate)
+	adminRoutes.Delete("/md5/records/:id", audit("md5.delete"), perm(auth.PermMd5Delete), admin.DeleteMD5Record)
+	// 按ID列表批量删除MD5记录
+	adminRoutes.Post("/md5/records/batch-delete", audit("md5.batch_delete"), perm(auth.PermMd5Delete), admin.BatchDeleteMD5Records)
+	// 按过滤条件删除MD5记录（支持dryRun预览匹配数量）
+	adminRoutes.Post("/md5/records/delete-by-filter", audit("md5.delete_by_filter"), perm(auth.PermMd5Delete), admin.DeleteMD5RecordsByFilter)
+	// 明文库去重并创建唯一索引（一次性迁移任务）
+	adminRoutes.Post("/md5/dedup", audit("md5.dedup"), perm(auth.PermMd5Delete), admin.DedupMD5Records)
+	// 导出明文库（wordlist/potfile/csv/ndjson）
+	adminRoutes.Get("/md5/export", audit("md5.export"), perm(auth.PermMd5Read), admin.Export)
+	// 彩虹表生成
+	adminRoutes.Post("/rainbow/generate", audit("rainbow.generate"), perm(auth.PermRainbowWrite), rainbow.Generate)
+	// 重新计算彩虹链，校验终止哈希
+	adminRoutes.Post("/rainbow/verify", audit("rainbow.verify"), perm(auth.PermRainbowWrite), rainbow.Verify)
 	// 彩虹表管理
-	adminRoutes.Get("/rainbow/management", rainbow.RainbowManagement)
+	adminRoutes.Get("/rainbow/management", perm(auth.PermRainbowRead), rainbow.RainbowManagement)
 	// 添加彩虹表条目
-	adminRoutes.Post("/rainbow/entry", rainbow.AddRainbowTableEntry)
+	adminRoutes.Post("/rainbow/entry", audit("rainbow.add_entry"), perm(auth.PermRainbowWrite), rainbow.AddRainbowTableEntry)
 	// 删除彩虹表条目
-	adminRoutes.Delete("/rainbow/entry/:id", rainbow.DeleteRainbowTableEntry)
+	adminRoutes.Delete("/rainbow/entry/:id", audit("rainbow.delete_entry"), perm(auth.PermRainbowDelete), rainbow.DeleteRainbowTableEntry)
 	// 任务管理
-	adminRoutes.Get("/task/management", rainbow.TaskManagement)
+	adminRoutes.Get("/task/management", perm(auth.PermTasksRead), rainbow.TaskManagement)
 	// 取消任务
-	adminRoutes.Post("/task/cancel/:id", rainbow.CancelTask)
+	adminRoutes.Post("/task/cancel/:id", audit("task.cancel"), perm(auth.PermTasksManage), rainbow.CancelTask)
+	// 创建用户
+	adminRoutes.Get("/users", perm(auth.PermUsersRead), admin.ListUsers)
+	adminRoutes.Get("/users/:id", perm(auth.PermUsersRead), admin.GetUser)
+	adminRoutes.Post("/users", audit("user.create"), perm(auth.PermUsersManage), admin.CreateUser)
+	adminRoutes.Patch("/users/:id", audit("user.update"), perm(auth.PermUsersManage), admin.UpdateUser)
+	adminRoutes.Post("/users/:id/disable", audit("user.disable"), perm(auth.PermUsersManage), admin.DisableUser)
+	adminRoutes.Post("/users/:id/enable", audit("user.enable"), perm(auth.PermUsersManage), admin.EnableUser)
+	adminRoutes.Post("/users/:id/lock", audit("user.lock"), perm(auth.PermUsersManage), admin.LockUser)
+	adminRoutes.Post("/users/:id/unlock", audit("user.unlock"), perm(auth.PermUsersManage), admin.UnlockUser)
+	adminRoutes.Post("/users/:id/reset-password", audit("user.reset_password"), perm(auth.PermUsersManage), admin.ResetUserPassword)
+	adminRoutes.Post("/users/:id/two-factor/reset", audit("user.reset_two_factor"), perm(auth.PermUsersManage), admin.ResetUserTwoFactor)
+	// 注册审核和邀请码
+	adminRoutes.Post("/users/:id/approve", audit("user.approve"), perm(auth.PermUsersManage), admin.ApproveUser)
+	adminRoutes.Post("/users/:id/reject", audit("user.reject"), perm(auth.PermUsersManage), admin.RejectUser)
+	adminRoutes.Get("/invites", perm(auth.PermUsersRead), admin.ListInvites)
+	adminRoutes.Post("/invites", audit("invite.create"), perm(auth.PermUsersManage), admin.CreateInvite)
+	adminRoutes.Delete("/invites/:id", audit("invite.revoke"), perm(auth.PermUsersManage), admin.RevokeInvite)
+	// 登录尝试审计记录和登录失败限制
+	adminRoutes.Get("/login-attempts", perm(auth.PermUsersRead), admin.LoginAttempts)
+	adminRoutes.Get("/login-locks", perm(auth.PermUsersRead), admin.LoginLocks)
+	adminRoutes.Post("/login-locks/clear", audit("login_lock.clear"), perm(auth.PermUsersManage), admin.ClearLoginLock)
+	// 角色权限管理
+	adminRoutes.Get("/permissions", perm(auth.PermRolesRead), admin.ListPermissions)
+	adminRoutes.Get("/roles", perm(auth.PermRolesRead), admin.ListRoles)
+	adminRoutes.Put("/roles/:role", audit("role.update"), perm(auth.PermRolesManage), admin.SetRolePermissions)
+	adminRoutes.Delete("/roles/:role", audit("role.delete"), perm(auth.PermRolesManage), admin.DeleteRole)
+	adminRoutes.Put("/roles/:role/two-factor", audit("role.two_factor"), perm(auth.PermRolesManage), admin.SetRoleTwoFactor)
+	// 审计日志查询和导出（JSON Lines）
+	adminRoutes.Get("/audit-logs", perm(auth.PermAuditRead), admin.AuditLogs)
+	adminRoutes.Get("/audit-logs/export", audit("audit.export"), perm(auth.PermAuditRead), admin.ExportAuditLogs)
 
 	// 配置用户相关路由（需要JWT认证）
 	userRoutes := api.Group("/user")
 	userRoutes.Use(middleware.JWTAuth())
 	// 获取用户解密历史信息
 	userRoutes.Get("/md5/history", user.GetHistory)
+	// API密钥管理（只能使用登录令牌访问）
+	userRoutes.Get("/api-keys", user.ListAPIKeys)
+	userRoutes.Post("/api-keys", user.CreateAPIKey)
+	userRoutes.Delete("/api-keys/:id", user.RevokeAPIKey)
+	// 个人设置（隐私模式）
+	userRoutes.Get("/settings", user.GetSettings)
+	userRoutes.Put("/settings", user.UpdateSettings)
 
-	// 不需要鉴权的路由
+	// 不需要鉴权的路由，登录、注册和会话相关操作记录审计日志
 	authRoutes := api.Group("/auth")
-	authRoutes.Post("/login", auth.Login)
-	authRoutes.Post("/register", auth.Register)
+	authRoutes.Post("/login", middleware.Audit("auth.login"), auth.Login)
+	authRoutes.Post("/register", middleware.Audit("auth.register"), auth.Register)
+	// 注册方式和密码要求
+	authRoutes.Get("/registration", auth.RegistrationInfo)
 	authRoutes.Get("/status", auth.Status)
+	// 使用刷新令牌换取新的访问令牌
+	authRoutes.Post("/refresh", auth.Refresh)
+	// 使用旧密码修改密码（管理员重置密码后也通过该接口设置新密码）
+	authRoutes.Post("/password", middleware.Audit("auth.change_password"), auth.ChangePassword)
 	// 退出登录
-	authRoutes.Post("/logout", auth.Logout)
+	authRoutes.Post("/logout", middleware.Audit("auth.logout"), auth.Logout)
+	// 退出所有会话
+	authRoutes.Post("/logout-all", middleware.JWTAuth(), middleware.Audit("auth.logout_all"), auth.LogoutAll)
+	// 两步验证：登录时使用预认证令牌完成验证；设置和开启既可以使用预认证令牌，也可以使用访问令牌
+	authRoutes.Post("/2fa/verify", middleware.Audit("auth.2fa_verify"), auth.VerifyTwoFactor)
+	authRoutes.Post("/2fa/setup", auth.SetupTwoFactor)
+	authRoutes.Post("/2fa/enable", middleware.Audit("auth.2fa_enable"), auth.EnableTwoFactor)
+	authRoutes.Post("/2fa/disable", middleware.JWTAuth(), middleware.Audit("auth.2fa_disable"), auth.DisableTwoFactor)
+	authRoutes.Post("/2fa/recovery-codes", middleware.JWTAuth(), middleware.Audit("auth.2fa_recovery_codes"), auth.RegenerateRecoveryCodes)
 
 	// md5路由组（可选认证）
 	md5Routes := api.Group("/md5")
-	md5Routes.Use(middleware.OptionalJWTAuth())
+	md5Routes.Use(middleware.OptionalJWTAuth(dbModel.ScopeLookup))
+	// 按API密钥、用户或IP限流，避免匿名调用批量写入或枚举明文库
+	md5Routes.Use(middleware.RateLimit())
 	md5Routes.Post("/encrypt", md5.Encrypt)
 	md5Routes.Post("/decrypt", md5.Decrypt)
 
 	// 彩虹表路由组
 	rainbowRoutes := api.Group("/rainbow")
-	rainbowRoutes.Use(middleware.JWTAuth())
+	rainbowRoutes.Use(middleware.JWTAuth(dbModel.ScopeSubmitTask))
 	rainbowRoutes.Post("/search", rainbow.Search)
 	rainbowRoutes.Get("/stats", rainbow.GetStats)
 	// 查询解密任务状态
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+	"zmd5/api/admin"
+	"zmd5/api/rainbow"
+	"zmd5/api/user"
+	"zmd5/config"
+	"zmd5/db"
+	"zmd5/jobs"
+	"zmd5/repository"
+	"zmd5/router"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/cors"
+	"github.com/gofiber/fiber/v2/middleware/logger"
+)
+
+// serveCommand 启动HTTP服务，ctx 取消（收到 Ctrl+C 或 SIGTERM）时停止服务
+// 停止时先等待处理中的请求完成，再通知解密任务、文件导入和后台任务保存检查点并退出
+func serveCommand(ctx context.Context, cfg *config.Config) error {
+	// 生产环境拒绝使用默认密钥启动服务，在连接数据库前检查以免以默认密码创建管理员
+	if err := cfg.CheckProductionSecrets(); err != nil {
+		return err
+	}
+
+	// 连接数据库，执行迁移并初始化管理员账户
+	if err := openStorage(cfg, true); err != nil {
+		return err
+	}
+	db.RegisterPoolMetrics()
+
+	// 创建Fiber应用
+	// 只信任配置的反向代理传递的客户端地址，c.IP() 用于登录失败限制、限流和审计
+	app := fiber.New(fiber.Config{
+		AppName:                 "ZMd5解密工具",
+		BodyLimit:               1024 * 1024 * 2000, // 设置为2GB
+		ProxyHeader:             cfg.Server.ProxyHeader,
+		EnableTrustedProxyCheck: true,
+		TrustedProxies:          cfg.Server.TrustedProxies,
+		EnableIPValidation:      true,
+	})
+
+	// 中间件，健康检查和指标采集请求频繁，不记录访问日志
+	app.Use(logger.New(logger.Config{
+		Next: func(c *fiber.Ctx) bool {
+			switch c.Path() {
+			case "/healthz", "/readyz", "/metrics":
+				return true
+			}
+			return false
+		},
+	}))
+
+	app.Use(cors.New(cors.Config{
+		AllowOrigins:     cfg.Server.CORSOrigin,
+		AllowCredentials: true,
+		AllowHeaders:     "Origin, Content-Type, Accept, Authorization, x-csrf-token, x-requested-with",
+		AllowMethods:     "GET, POST, PUT, DELETE, OPTIONS",
+	}))
+
+	// 设置路由，同时将存储注入各处理器
+	router.SetupRoutes(app, repository.New(db.PG))
+
+	// 从数据库初始化未完成的任务，上次关闭时保存了检查点的解密任务和文件导入从检查点继续
+	rainbow.InitTaskProgress()
+	admin.ResumeImports()
+	jobs.InitJobs()
+	// 按保留时间定期清除历史记录中的明文
+	user.StartHistoryRetention(ctx, cfg.Privacy.HistoryPlaintextRetention)
+
+	// 构建明文库摘要过滤器，配置了快照路径时会定期保存快照以加快启动
+	db.InitDigestFilter(cfg.DigestFilter.Snapshot)
+
+	// 旧版本的十六进制MD5列需要转换为二进制摘要，转换在后台分批进行，完成前旧记录无法被查询到
+	if db.NeedsDigestConversion() {
+		if _, err := jobs.Start(jobs.KindDigestConvert, 0, nil, func(ctx context.Context, progress *jobs.Progress) error {
+			return db.ConvertMd5Digests(ctx, progress)
+		}); err != nil {
+			log.Printf("启动摘要转换任务失败: %v", err)
+		}
+	}
+
+	// 启动服务器
+	host := cfg.Server.Host
+	if host == "" {
+		host = "localhost"
+	}
+	mode := ""
+	if cfg.Offline {
+		mode = "，离线模式: " + cfg.Database.DSN
+	}
+	log.Printf("服务器启动在 http://%s:%d (环境: %s%s)", host, cfg.Server.Port, cfg.Env, mode)
+	var deadline time.Time
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		<-ctx.Done()
+		log.Println("收到退出信号，正在停止服务")
+		deadline = time.Now().Add(cfg.Server.ShutdownTimeout)
+		// 停止接受新请求，等待处理中的请求完成
+		if err := app.ShutdownWithTimeout(cfg.Server.ShutdownTimeout); err != nil {
+			log.Printf("等待请求处理完成超时: %v", err)
+		}
+	}()
+	if err := app.Listen(fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port)); err != nil {
+		return err
+	}
+	<-stopped
+
+	shutdownTasks(time.Until(deadline))
+	return nil
+}
+
+// shutdownTasks 通知所有任务保存检查点并等待退出，然后将内存中的任务进度和摘要过滤器写入存储
+func shutdownTasks(timeout time.Duration) {
+	log.Println("正在等待任务保存检查点")
+	if !jobs.Shutdown(timeout) {
+		log.Println("等待任务退出超时，未保存检查点的任务下次启动时从上一次同步的进度继续")
+	}
+
+	// 写入所有未完成解密任务的最新进度
+	rainbow.FlushTaskProgress()
+
+	if err := db.SaveDigestFilterSnapshot(); err != nil {
+		log.Printf("保存摘要过滤器快照失败: %v", err)
+	}
+	log.Println("服务已停止")
+}
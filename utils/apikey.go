@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// APIKeyPrefix API密钥的固定前缀，用于区分API密钥和JWT令牌
+const APIKeyPrefix = "zmd5_"
+
+// apiKeyDisplayLength 展示用的密钥前缀长度（包括固定前缀）
+const apiKeyDisplayLength = 13
+
+// GenerateAPIKey 生成随机API密钥，返回完整密钥和展示用的前缀
+func GenerateAPIKey() (string, string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	key := APIKeyPrefix + hex.EncodeToString(buf)
+	return key, key[:apiKeyDisplayLength], nil
+}
+
+// HashAPIKey 计算API密钥的摘要，数据库中只保存摘要
+// 密钥本身是高熵随机值，使用SHA-256即可，无需bcrypt等慢哈希
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsAPIKey 判断凭据是否为API密钥
+func IsAPIKey(credential string) bool {
+	return strings.HasPrefix(credential, APIKeyPrefix)
+}
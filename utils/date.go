@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"fmt"
+	"time"
+)
+
+// ParseDateRange 解析日期范围参数，支持 "2006-01-02" 和 RFC3339 两种格式
+// 仅提供日期时，结束时间包含当天（即返回次日零点作为开区间上界）
+// 参数为空时对应的返回值为nil
+func ParseDateRange(start, end string) (*time.Time, *time.Time, error) {
+	var startTime, endTime *time.Time
+
+	if start != "" {
+		t, _, err := parseDate(start)
+		if err != nil {
+			return nil, nil, fmt.Errorf("无效的开始日期: %s", start)
+		}
+		startTime = &t
+	}
+
+	if end != "" {
+		t, dateOnly, err := parseDate(end)
+		if err != nil {
+			return nil, nil, fmt.Errorf("无效的结束日期: %s", end)
+		}
+		if dateOnly {
+			t = t.AddDate(0, 0, 1)
+		}
+		endTime = &t
+	}
+
+	return startTime, endTime, nil
+}
+
+// parseDate 解析单个日期，返回是否只包含日期部分
+func parseDate(value string) (time.Time, bool, error) {
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	return t, false, err
+}
@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// 明文编码常量定义
+const (
+	EncodingUTF8    = "utf8"    // UTF-8（默认）
+	EncodingGBK     = "gbk"     // GBK，常见于中文系统
+	EncodingUTF16LE = "utf16le" // UTF-16LE，常见于Windows系统（如NTLM前置处理）
+)
+
+// SupportedEncodings 支持的明文编码列表
+var SupportedEncodings = []string{EncodingUTF8, EncodingGBK, EncodingUTF16LE}
+
+// NormalizeEncoding 将编码名称规范化为内部使用的名称
+// 支持常见的别名写法，例如 "UTF-8"、"utf_16le"、"cp936"
+func NormalizeEncoding(name string) (string, error) {
+	key := strings.ToLower(strings.TrimSpace(name))
+	key = strings.NewReplacer("-", "", "_", "", " ", "").Replace(key)
+
+	switch key {
+	case "", "utf8":
+		return EncodingUTF8, nil
+	case "gbk", "cp936", "gb2312":
+		return EncodingGBK, nil
+	case "utf16le", "utf16", "ucs2", "unicode":
+		return EncodingUTF16LE, nil
+	default:
+		return "", fmt.Errorf("不支持的编码: %s", name)
+	}
+}
+
+// NormalizeEncodings 规范化并去重编码列表，为空时返回默认的UTF-8
+func NormalizeEncodings(names []string) ([]string, error) {
+	result := make([]string, 0, len(names))
+	seen := make(map[string]bool)
+
+	for _, name := range names {
+		encoding, err := NormalizeEncoding(name)
+		if err != nil {
+			return nil, err
+		}
+		if seen[encoding] {
+			continue
+		}
+		seen[encoding] = true
+		result = append(result, encoding)
+	}
+
+	if len(result) == 0 {
+		result = append(result, EncodingUTF8)
+	}
+
+	return result, nil
+}
+
+// EncodeText 按指定编码将明文转换为字节序列
+// 明文中包含目标编码无法表示的字符时返回错误
+func EncodeText(text string, encoding string) ([]byte, error) {
+	switch encoding {
+	case "", EncodingUTF8:
+		return []byte(text), nil
+	case EncodingGBK:
+		return simplifiedchinese.GBK.NewEncoder().Bytes([]byte(text))
+	case EncodingUTF16LE:
+		return unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM).NewEncoder().Bytes([]byte(text))
+	default:
+		return nil, fmt.Errorf("不支持的编码: %s", encoding)
+	}
+}
+
+// CalculateMD5WithEncoding 按指定编码计算明文的MD5哈希值
+func CalculateMD5WithEncoding(text string, encoding string) (string, error) {
+	data, err := EncodeText(text, encoding)
+	if err != nil {
+		return "", err
+	}
+	hash := md5.Sum(data)
+	return hex.EncodeToString(hash[:]), nil
+}
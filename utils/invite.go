@@ -0,0 +1,27 @@
+package utils
+
+import "strings"
+
+// inviteCodeDisplayLength 展示用的邀请码前缀长度
+const inviteCodeDisplayLength = 5
+
+// GenerateInviteCode 生成注册邀请码，格式为 xxxxx-xxxxx-xxxxx，返回邀请码和展示用的前缀
+// 邀请码使用与恢复码相同的字符集，摘要使用 HashInviteCode 计算
+func GenerateInviteCode() (string, string, error) {
+	groups := make([]string, 3)
+	for i := range groups {
+		group, err := GenerateRandomPlaintext(5, recoveryCodeCharset)
+		if err != nil {
+			return "", "", err
+		}
+		groups[i] = group
+	}
+	code := strings.Join(groups, "-")
+	return code, code[:inviteCodeDisplayLength], nil
+}
+
+// HashInviteCode 计算邀请码的摘要，忽略大小写、空格和连字符
+// 邀请码需要按摘要查找，且有效期短、只能使用一次，使用SHA-256即可
+func HashInviteCode(code string) string {
+	return HashAPIKey(normalizeCode(code))
+}
@@ -1,33 +1,67 @@
 package utils
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
-// 定义密钥 - 在实际应用中应使用环境变量
-var jwtSecret = []byte("zmd5_secret_key")
+// 签名密钥和令牌有效期，启动时由 SetJWTConfig 根据配置设置
+var (
+	jwtSecret         = []byte("zmd5_secret_key")
+	jwtExpiration     = 15 * time.Minute
+	refreshExpiration = 30 * 24 * time.Hour
+)
+
+// SetJWTConfig 设置签名密钥、访问令牌和刷新令牌的有效期
+func SetJWTConfig(secret string, expiration, refresh time.Duration) {
+	jwtSecret = []byte(secret)
+	jwtExpiration = expiration
+	refreshExpiration = refresh
+}
+
+// TokenExpiration 返回访问令牌有效期
+func TokenExpiration() time.Duration {
+	return jwtExpiration
+}
+
+// RefreshTokenExpiration 返回刷新令牌有效期
+func RefreshTokenExpiration() time.Duration {
+	return refreshExpiration
+}
 
 // JWTClaims 自定义JWT声明结构
 type JWTClaims struct {
 	UserID   uint   `json:"user_id"`
 	Username string `json:"username"`
 	Role     string `json:"role"`
+	// 登录会话ID（刷新令牌的family），退出登录后该会话的访问令牌失效
+	SessionID string `json:"sid"`
+	// 签发时用户的令牌版本，退出所有会话时版本号递增，旧令牌全部失效
+	TokenVersion int `json:"ver"`
+	// 令牌用途，访问令牌为空，预认证令牌为 PurposeTwoFactor
+	Purpose string `json:"pur,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// GenerateToken 生成JWT令牌
-func GenerateToken(userID uint, username string, role string) (string, error) {
-	// 设置过期时间为24小时
-	expirationTime := time.Now().Add(24 * time.Hour)
+// PurposeTwoFactor 两步验证预认证令牌的用途，只能用于完成两步验证，不能访问其他接口
+const PurposeTwoFactor = "2fa"
+
+// GenerateToken 生成JWT访问令牌
+func GenerateToken(userID uint, username string, role string, sessionID string, tokenVersion int) (string, error) {
+	// 设置过期时间
+	expirationTime := time.Now().Add(jwtExpiration)
 
 	// 创建JWT声明
 	claims := JWTClaims{
-		UserID:   userID,
-		Username: username,
-		Role:     role,
+		UserID:       userID,
+		Username:     username,
+		Role:         role,
+		SessionID:    sessionID,
+		TokenVersion: tokenVersion,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -47,6 +81,35 @@ func GenerateToken(userID uint, username string, role string) (string, error) {
 	return tokenString, nil
 }
 
+// GeneratePreAuthToken 生成密码验证通过后、两步验证完成前使用的短期预认证令牌
+func GeneratePreAuthToken(userID uint, username string, tokenVersion int, expiration time.Duration) (string, error) {
+	now := time.Now()
+	claims := JWTClaims{
+		UserID:       userID,
+		Username:     username,
+		TokenVersion: tokenVersion,
+		Purpose:      PurposeTwoFactor,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiration)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			Subject:   username,
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(jwtSecret)
+}
+
+// ParsePreAuthToken 解析预认证令牌，其他用途的令牌返回错误
+func ParsePreAuthToken(tokenString string) (*JWTClaims, error) {
+	claims, err := ParseToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Purpose != PurposeTwoFactor {
+		return nil, errors.New("无效的预认证令牌")
+	}
+	return claims, nil
+}
+
 // ParseToken 解析JWT令牌
 func ParseToken(tokenString string) (*JWTClaims, error) {
 	// 解析token
@@ -76,12 +139,25 @@ func ParseToken(tokenString string) (*JWTClaims, error) {
 	return claims, nil
 }
 
-// ValidateToken 验证token并返回用户信息
-func ValidateToken(tokenString string) (uint, string, string, error) {
-	claims, err := ParseToken(tokenString)
-	if err != nil {
-		return 0, "", "", err
+// GenerateRefreshToken 生成随机刷新令牌，数据库中只保存 HashRefreshToken 计算的摘要
+func GenerateRefreshToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
 	}
+	return hex.EncodeToString(buf), nil
+}
 
-	return claims.UserID, claims.Username, claims.Role, nil
+// HashRefreshToken 计算刷新令牌的摘要，与API密钥相同，高熵随机值使用SHA-256即可
+func HashRefreshToken(token string) string {
+	return HashAPIKey(token)
+}
+
+// GenerateSessionID 生成随机登录会话ID
+func GenerateSessionID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
 }
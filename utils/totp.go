@@ -0,0 +1,135 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// TOTP参数（RFC 6238），与常见的验证器应用默认值一致
+const (
+	TOTPPeriod = 30 // 时间步长（秒）
+	TOTPDigits = 6  // 验证码位数
+	// 允许前后各一个时间步的时钟偏差
+	totpSkew = 1
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret 生成160位随机TOTP密钥，返回Base32编码（无填充）
+func GenerateTOTPSecret() (string, error) {
+	buf := make([]byte, 20)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(buf), nil
+}
+
+// TOTPStep 返回指定时间所在的时间步
+func TOTPStep(t time.Time) int64 {
+	return t.Unix() / TOTPPeriod
+}
+
+// TOTPCode 计算指定时间步的验证码（RFC 4226 HOTP，计数器为时间步）
+func TOTPCode(secret string, step int64) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(strings.TrimSpace(secret)))
+	if err != nil {
+		return "", fmt.Errorf("无效的TOTP密钥: %v", err)
+	}
+
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	// 动态截断：取最后一个字节的低4位作为偏移，读取31位整数
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < TOTPDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", TOTPDigits, value%mod), nil
+}
+
+// VerifyTOTP 校验验证码，允许前后各一个时间步的偏差，成功时返回匹配的时间步
+// 调用方需要记录返回的时间步，拒绝不大于已使用时间步的验证码，防止重放
+func VerifyTOTP(secret, code string, now time.Time) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != TOTPDigits {
+		return 0, false
+	}
+	current := TOTPStep(now)
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		expected, err := TOTPCode(secret, step)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// TOTPURI 生成验证器应用扫码使用的 otpauth:// 地址
+func TOTPURI(issuer, account, secret string) string {
+	label := url.PathEscape(issuer + ":" + account)
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(TOTPDigits))
+	params.Set("period", fmt.Sprint(TOTPPeriod))
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+// 恢复码字符集，去掉了容易混淆的字符
+const recoveryCodeCharset = "abcdefghjkmnpqrstuvwxyz23456789"
+
+// GenerateRecoveryCodes 生成n个一次性恢复码，格式为 xxxxx-xxxxx
+func GenerateRecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, n)
+	for i := range codes {
+		first, err := GenerateRandomPlaintext(5, recoveryCodeCharset)
+		if err != nil {
+			return nil, err
+		}
+		second, err := GenerateRandomPlaintext(5, recoveryCodeCharset)
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = first + "-" + second
+	}
+	return codes, nil
+}
+
+// normalizeCode 忽略恢复码和邀请码中的大小写、空格和连字符
+func normalizeCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// HashRecoveryCode 使用bcrypt计算恢复码的摘要，忽略大小写、空格和连字符
+// 恢复码只有约50位熵，不能像API密钥一样只保存SHA-256摘要；
+// bcrypt的输入为规范化恢复码的SHA-256摘要，使迁移前保存的摘要可以直接转换
+func HashRecoveryCode(code string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(HashAPIKey(normalizeCode(code))), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+// CheckRecoveryCode 验证恢复码与 HashRecoveryCode 计算的摘要是否匹配
+func CheckRecoveryCode(code, hash string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(HashAPIKey(normalizeCode(code)))) == nil
+}
@@ -0,0 +1,96 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret RFC 6238 附录B的SHA1测试密钥 "12345678901234567890" 的Base32编码
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	// RFC 6238 附录B的8位验证码取后6位
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, v := range vectors {
+		code, err := TOTPCode(rfc6238Secret, TOTPStep(time.Unix(v.unix, 0)))
+		if err != nil {
+			t.Fatalf("TOTPCode: %v", err)
+		}
+		if code != v.code {
+			t.Errorf("时间 %d 的验证码 = %s, 期望 %s", v.unix, code, v.code)
+		}
+	}
+
+	// 密钥忽略大小写和首尾空白
+	code, err := TOTPCode(" "+strings.ToLower(rfc6238Secret)+" ", TOTPStep(time.Unix(59, 0)))
+	if err != nil || code != "287082" {
+		t.Fatalf("规范化密钥后的验证码 = %s, %v", code, err)
+	}
+	if _, err := TOTPCode("not base32!", 1); err == nil {
+		t.Fatal("无效的密钥应返回错误")
+	}
+}
+
+func TestVerifyTOTPSkew(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := TOTPStep(now)
+
+	for offset := int64(-totpSkew); offset <= totpSkew; offset++ {
+		code, _ := TOTPCode(rfc6238Secret, current+offset)
+		step, ok := VerifyTOTP(rfc6238Secret, code, now)
+		if !ok || step != current+offset {
+			t.Errorf("偏差 %d 个时间步的验证码应通过并返回对应时间步, 实际 ok=%v step=%d", offset, ok, step)
+		}
+	}
+	for _, offset := range []int64{-totpSkew - 1, totpSkew + 1} {
+		code, _ := TOTPCode(rfc6238Secret, current+offset)
+		if _, ok := VerifyTOTP(rfc6238Secret, code, now); ok {
+			t.Errorf("偏差 %d 个时间步的验证码不应通过", offset)
+		}
+	}
+
+	code, _ := TOTPCode(rfc6238Secret, current)
+	for _, bad := range []string{"", code[:5], code + "0", "abcdef"} {
+		if _, ok := VerifyTOTP(rfc6238Secret, bad, now); ok {
+			t.Errorf("验证码 %q 不应通过", bad)
+		}
+	}
+	if _, ok := VerifyTOTP(rfc6238Secret, " "+code+" ", now); !ok {
+		t.Error("验证码首尾的空白应被忽略")
+	}
+}
+
+func TestRecoveryCodeHash(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(2)
+	if err != nil {
+		t.Fatalf("GenerateRecoveryCodes: %v", err)
+	}
+	hash, err := HashRecoveryCode(codes[0])
+	if err != nil {
+		t.Fatalf("HashRecoveryCode: %v", err)
+	}
+	again, _ := HashRecoveryCode(codes[0])
+	if hash == again {
+		t.Fatal("同一恢复码的摘要应使用不同的盐")
+	}
+	if !CheckRecoveryCode(codes[0], hash) || !CheckRecoveryCode(codes[0], again) {
+		t.Fatal("恢复码与摘要不匹配")
+	}
+	if !CheckRecoveryCode(" "+strings.ToUpper(strings.ReplaceAll(codes[0], "-", ""))+" ", hash) {
+		t.Fatal("恢复码应忽略大小写、空格和连字符")
+	}
+	if CheckRecoveryCode(codes[1], hash) {
+		t.Fatal("其他恢复码不应匹配")
+	}
+}
@@ -1,7 +1,7 @@
 import { useEffect, useState } from 'react'
 import { useLocation, useNavigate } from 'react-router-dom'
 import { Toaster } from 'sonner'
-import { checkAuthStatus, login, logout, register } from './api/auth'
+import { checkAuthStatus, login, logout, register, verifyTwoFactor } from './api/auth'
 import { getHistory } from './api/md5'
 import './App.css'
 import Footer from './components/Footer'
@@ -19,6 +19,7 @@ function App() {
   const [currentUser, setCurrentUser] = useState<User | null>(null)
   const [loading, setLoading] = useState(false) // 加载状态
   const [errorMessage, setErrorMessage] = useState<string | null>(null) // 错误消息
+  const [preAuthToken, setPreAuthToken] = useState<string | null>(null) // 等待两步验证的预认证令牌
 
   // 解密历史记录
   const [decryptHistory, setDecryptHistory] = useState<DecryptRecord[]>([])
@@ -103,7 +104,10 @@ function App() {
     try {
       const result = await login({ username, password });
 
-      if (result.code === 200 && result.user) {
+      if (result.code === 200 && result.twoFactorRequired && result.preAuthToken) {
+        // 密码正确，继续输入两步验证码
+        setPreAuthToken(result.preAuthToken);
+      } else if (result.code === 200 && result.user) {
         setIsLoggedIn(true);
         setShowLoginModal(false);
         setCurrentUser(result.user);
@@ -119,8 +123,37 @@ function App() {
     }
   };
 
+  // 处理两步验证
+  const handleVerifyCode = async (code: string) => {
+    if (!preAuthToken || !code) {
+      return;
+    }
+
+    setLoading(true);
+    setErrorMessage(null);
+
+    try {
+      const result = await verifyTwoFactor(preAuthToken, code);
+      if (result.code === 200 && result.user) {
+        setPreAuthToken(null);
+        setIsLoggedIn(true);
+        setShowLoginModal(false);
+        setCurrentUser(result.user);
+        fetchHistory(1);
+      } else {
+        // 预认证令牌过期时需要关闭窗口重新输入密码
+        setErrorMessage(result.message || '验证失败');
+      }
+    } catch (error) {
+      console.error('两步验证错误:', error);
+      setErrorMessage('网络错误，请稍后再试');
+    } finally {
+      setLoading(false);
+    }
+  };
+
   // 处理注册
-  const handleRegister = async (username: string, password: string) => {
+  const handleRegister = async (username: string, password: string, inviteCode?: string) => {
     if (!username || !password) {
       setErrorMessage('用户名和密码不能为空');
       return;
@@ -130,7 +163,7 @@ function App() {
     setErrorMessage(null);
 
     try {
-      const result = await register({ username, password });
+      const result = await register({ username, password, inviteCode });
       if (result.success && result.data) {
         // 注册成功，自动登录
         setIsLoggedIn(true);
@@ -239,8 +272,13 @@ function App() {
       {/* 登录弹窗 */}
       {showLoginModal && (
         <LoginModal
-          onClose={() => setShowLoginModal(false)}
+          onClose={() => {
+            setShowLoginModal(false)
+            setPreAuthToken(null)
+          }}
           onLogin={handleLogin}
+          twoFactorPending={preAuthToken !== null}
+          onVerifyCode={handleVerifyCode}
           onRegister={handleRegister}
           loading={loading}
           error={errorMessage}
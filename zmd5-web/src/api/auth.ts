@@ -32,12 +32,54 @@ export const getAuthHeaders = (): Record<string, string> => {
   };
 };
 
+// 自动刷新访问令牌的定时器
+let refreshTimer: ReturnType<typeof setTimeout> | null = null;
+
+/**
+ * 在访问令牌过期前自动刷新
+ * @param token 访问令牌（JWT）
+ */
+const scheduleRefresh = (token: string): void => {
+  if (refreshTimer) {
+    clearTimeout(refreshTimer);
+    refreshTimer = null;
+  }
+
+  try {
+    // 从JWT中读取过期时间
+    const payload = JSON.parse(atob(token.split('.')[1].replace(/-/g, '+').replace(/_/g, '/')));
+    // 提前1分钟刷新
+    const delay = payload.exp * 1000 - Date.now() - 60 * 1000;
+    refreshTimer = setTimeout(() => {
+      refreshAuthToken();
+    }, Math.max(delay, 0));
+  } catch (error) {
+    console.error('解析token过期时间失败:', error);
+  }
+};
+
+/**
+ * 用户能否进入管理后台（管理员或拥有任意管理权限的角色）
+ * @param user 用户信息
+ */
+export const canAccessAdmin = (user: User | null | undefined): boolean => {
+  if (!user) {
+    return false;
+  }
+  return user.role === 'admin' || (user.permissions?.length ?? 0) > 0;
+};
+
 /**
  * 设置认证Token
- * @param token 认证Token
+ * @param token 访问令牌
+ * @param refreshToken 刷新令牌
  */
-export const setAuthToken = (token: string): void => {
+export const setAuthToken = (token: string, refreshToken?: string): void => {
   localStorage.setItem('auth_token', token);
+  if (refreshToken) {
+    localStorage.setItem('refresh_token', refreshToken);
+  }
+  scheduleRefresh(token);
 };
 
 /**
@@ -45,8 +87,49 @@ export const setAuthToken = (token: string): void => {
  */
 export const clearAuthToken = (): void => {
   localStorage.removeItem('auth_token');
+  localStorage.removeItem('refresh_token');
+  if (refreshTimer) {
+    clearTimeout(refreshTimer);
+    refreshTimer = null;
+  }
 };
 
+/**
+ * 使用刷新令牌换取新的访问令牌，刷新令牌每次使用后都会更换
+ * @returns 是否刷新成功
+ */
+export async function refreshAuthToken(): Promise<boolean> {
+  const refreshToken = localStorage.getItem('refresh_token');
+  if (!refreshToken) {
+    return false;
+  }
+
+  try {
+    const response = await fetch(`${API_URL}/api/auth/refresh`, {
+      method: 'POST',
+      headers: {
+        'Content-Type': 'application/json',
+      },
+      body: JSON.stringify({ refreshToken }),
+    });
+
+    const data = await response.json();
+    if (data.code === 200 && data.token) {
+      setAuthToken(data.token, data.refreshToken);
+      return true;
+    }
+
+    // 刷新令牌已失效（过期、退出登录或在其他地方被撤销）
+    if (response.status === 401) {
+      clearAuthToken();
+    }
+    return false;
+  } catch (error) {
+    console.error('刷新token错误:', error);
+    return false;
+  }
+}
+
 /**
  * 用户登录
  * @param credentials 登录凭据
@@ -67,7 +150,7 @@ export async function login(credentials: LoginRequest): Promise<ApiResponse<User
     
     // 如果登录成功并返回了token，保存token到localStorage
     if (data.code === 200 && data.token) {
-      setAuthToken(data.token);
+      setAuthToken(data.token, data.refreshToken);
     }
     
     // 直接返回后端的响应格式
@@ -83,6 +166,38 @@ export async function login(credentials: LoginRequest): Promise<ApiResponse<User
   }
 }
 
+/**
+ * 提交两步验证码（或恢复码）完成登录
+ * @param preAuthToken 登录返回的预认证令牌
+ * @param code 验证器应用中的验证码或恢复码
+ * @returns 登录结果和用户信息
+ */
+export async function verifyTwoFactor(preAuthToken: string, code: string): Promise<ApiResponse<User>> {
+  try {
+    const response = await fetch(`${API_URL}/api/auth/2fa/verify`, {
+      method: 'POST',
+      headers: {
+        'Content-Type': 'application/json',
+      },
+      body: JSON.stringify({ preAuthToken, code }),
+    });
+
+    const data = await response.json();
+    if (data.code === 200 && data.token) {
+      setAuthToken(data.token, data.refreshToken);
+    }
+    return data;
+  } catch (error) {
+    console.error('两步验证错误:', error);
+    return {
+      status: 500,
+      message: '网络错误，请稍后再试',
+      isAuth: false,
+      user: null,
+    };
+  }
+}
+
 /**
  * 用户注册
  * @param credentials 注册信息
@@ -144,9 +259,18 @@ export async function register(credentials: RegisterRequest): Promise<ApiRespons
       };
     }
     
+    // 注册成功但需要等待管理员审核，不会返回token
+    if (data && data.approvalPending) {
+      return {
+        success: false,
+        message: data.message || '注册成功，请等待管理员审核后登录',
+        data: null,
+      };
+    }
+    
     // 保存token
     if (data && data.token) {
-      setAuthToken(data.token);
+      setAuthToken(data.token, data.refreshToken);
     }
     
     // 处理后端返回数据，将其转换为前端期望的格式
@@ -186,13 +310,26 @@ export async function register(credentials: RegisterRequest): Promise<ApiRespons
  */
 export async function checkAuthStatus(): Promise<ApiResponse<User>> {
   try {
-    const response = await fetch(`${API_URL}/api/auth/status`, {
-      method: 'GET',
-      headers: getAuthHeaders(),
-      credentials: 'include', // 包含 cookies，用于 session 认证
-    });
+    const fetchStatus = async () => {
+      const response = await fetch(`${API_URL}/api/auth/status`, {
+        method: 'GET',
+        headers: getAuthHeaders(),
+        credentials: 'include', // 包含 cookies，用于 session 认证
+      });
+      return response.json();
+    };
 
-    const data = await response.json();
+    let data = await fetchStatus();
+
+    // 访问令牌过期时使用刷新令牌换取新的令牌后重试
+    if (!data.isAuth && (await refreshAuthToken())) {
+      data = await fetchStatus();
+    } else if (data.isAuth) {
+      const token = localStorage.getItem('auth_token');
+      if (token && !refreshTimer) {
+        scheduleRefresh(token);
+      }
+    }
     
     // 直接返回后端的响应格式
     return data;
@@ -235,6 +372,8 @@ export async function logout(): Promise<ApiResponse<null>> {
       method: 'POST',
       headers: getAuthHeaders(),
       credentials: 'include', // 包含 cookies，用于 session 认证
+      // 访问令牌过期时服务端根据刷新令牌确定要退出的会话
+      body: JSON.stringify({ refreshToken: localStorage.getItem('refresh_token') || '' }),
     });
 
     // 无论服务器响应如何，清除本地认证信息
@@ -27,13 +27,13 @@ export interface DecryptResult {
   hash128: string
 }
 
-// 加密API接口
-export const encrypt = async (text: string): Promise<ApiResponse<EncryptResult>> => {
+// 加密API接口，private 为 true 时明文不会写入明文库，历史记录只保存哈希
+export const encrypt = async (text: string, private_ = false): Promise<ApiResponse<EncryptResult>> => {
   try {
     const response = await fetch(`${API_URL}/api/md5/encrypt`, {
       method: 'POST',
       headers: getAuthHeaders(),
-      body: JSON.stringify({ text })
+      body: JSON.stringify({ text, private: private_ })
     })
 
     return await response.json()
@@ -3,6 +3,8 @@ import { encrypt } from '../api/md5'
 
 const EncryptSection = () => {
   const [inputText, setInputText] = useState('')
+  // 隐私模式：不保存明文
+  const [privateMode, setPrivateMode] = useState(false)
   const [md5Results, setMd5Results] = useState({
     hash32: '',
     hash32Upper: '',
@@ -37,7 +39,7 @@ const EncryptSection = () => {
     })
     
     try {
-      const result = await encrypt(inputText)
+      const result = await encrypt(inputText, privateMode)
       if (result.success && result.data) {
         setMd5Results({
           hash32: result.data.hash32,
@@ -111,6 +113,14 @@ const EncryptSection = () => {
           {loading ? '加密中...' : '加密'}
         </button>
       </div>
+      <label className="private-mode-option">
+        <input
+          type="checkbox"
+          checked={privateMode}
+          onChange={(e) => setPrivateMode(e.target.checked)}
+        />
+        隐私模式（不保存明文）
+      </label>
       
       {hasCalculated && (
         <div className="result-container">
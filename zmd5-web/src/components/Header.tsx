@@ -1,4 +1,5 @@
 import { User } from '../types/index'
+import { canAccessAdmin } from '../api/auth'
 
 interface HeaderProps {
   isLoggedIn: boolean
@@ -29,7 +30,7 @@ const Header = ({ isLoggedIn, currentUser, onLoginClick, onProfileClick }: Heade
             </div>
             
             {/* 管理员入口 */}
-            {currentUser.role === 'admin' && (
+            {canAccessAdmin(currentUser) && (
               <a href="/admin" className="admin-link" onClick={handleAdminClick}>
                 管理后台
               </a>
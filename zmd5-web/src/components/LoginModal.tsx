@@ -4,7 +4,10 @@ import './LoginModal.css'
 interface LoginModalProps {
   onClose: () => void
   onLogin: (username: string, password: string) => void
-  onRegister?: (username: string, password: string) => void
+  onRegister?: (username: string, password: string, inviteCode?: string) => void
+  // 密码验证通过，等待输入两步验证码
+  twoFactorPending?: boolean
+  onVerifyCode?: (code: string) => void
   loading?: boolean
   error?: string | null
   onClearError?: () => void
@@ -14,6 +17,8 @@ const LoginModal = ({
   onClose, 
   onLogin, 
   onRegister,
+  twoFactorPending = false,
+  onVerifyCode,
   loading = false, 
   error = null, 
   onClearError 
@@ -21,18 +26,26 @@ const LoginModal = ({
   const [username, setUsername] = useState('')
   const [password, setPassword] = useState('')
   const [isRegisterMode, setIsRegisterMode] = useState(false)
+  const [code, setCode] = useState('')
+  const [inviteCode, setInviteCode] = useState('')
 
   // 当输入变化时清除错误
   useEffect(() => {
     if (error && onClearError) {
       onClearError();
     }
-  }, [username, password]);
+  }, [username, password, code]);
 
   const handleSubmit = () => {
+    if (twoFactorPending) {
+      if (code && onVerifyCode) {
+        onVerifyCode(code)
+      }
+      return
+    }
     if (username && password) {
       if (isRegisterMode && onRegister) {
-        onRegister(username, password)
+        onRegister(username, password, inviteCode || undefined)
       } else {
         onLogin(username, password)
       }
@@ -60,6 +73,21 @@ const LoginModal = ({
             </div>
           )}
           
+          {twoFactorPending ? (
+          <div className="form-group">
+            <label>两步验证码</label>
+            <input 
+              type="text" 
+              className="hacker-input" 
+              value={code}
+              onChange={(e) => setCode(e.target.value)}
+              placeholder="输入验证器中的6位验证码或恢复码"
+              autoComplete="one-time-code"
+              disabled={loading}
+            />
+          </div>
+          ) : (
+          <>
           <div className="form-group">
             <label>用户名</label>
             <input 
@@ -82,12 +110,27 @@ const LoginModal = ({
               disabled={loading}
             />
           </div>
+          {isRegisterMode && (
+          <div className="form-group">
+            <label>邀请码</label>
+            <input 
+              type="text" 
+              className="hacker-input"
+              value={inviteCode}
+              onChange={(e) => setInviteCode(e.target.value)} 
+              placeholder="开放注册时无需填写"
+              disabled={loading}
+            />
+          </div>
+          )}
+          </>
+          )}
           <button 
             className={`hacker-button login-submit ${loading ? 'loading' : ''}`} 
             onClick={handleSubmit}
             disabled={loading}
           >
-            {loading ? '正在处理...' : (isRegisterMode ? '注册账号' : '进入系统')}
+            {loading ? '正在处理...' : (twoFactorPending ? '验证' : (isRegisterMode ? '注册账号' : '进入系统'))}
           </button>
         </div>
         
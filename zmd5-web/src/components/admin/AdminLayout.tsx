@@ -1,7 +1,7 @@
 import { Outlet, Link, useNavigate, useLocation } from 'react-router-dom';
 import { useEffect, useState } from 'react';
 import { User } from '../../types/index';
-import { checkAuthStatus } from '../../api/auth';
+import { canAccessAdmin, checkAuthStatus } from '../../api/auth';
 import { FiHome, FiDatabase, FiHash, FiList, FiArrowLeft, FiUser, FiActivity } from 'react-icons/fi';
 
 const AdminLayout = () => {
@@ -16,8 +16,8 @@ const AdminLayout = () => {
       const result = await checkAuthStatus();
 
       if (result.status === 200 && result.isAuth && result.user) {
-        if (result.user.role !== 'admin') {
-          // 非管理员用户，重定向到首页
+        if (!canAccessAdmin(result.user)) {
+          // 没有管理权限的用户，重定向到首页
           navigate('/', { replace: true });
           return;
         }
@@ -7,6 +7,7 @@ import GenerateMD5 from '../components/admin/GenerateMD5';
 import MD5Management from '../components/admin/MD5Management';
 import TaskManagement from '../pages/admin/TaskManagement';
 import { User } from '../types/index';
+import { canAccessAdmin } from '../api/auth';
 
 // 错误边界组件
 const ErrorBoundary = () => {
@@ -27,7 +28,7 @@ const AdminRoute = ({
   children: React.ReactNode;
   currentUser: User | null;
 }) => {
-  if (!currentUser || currentUser.role !== 'admin') {
+  if (!canAccessAdmin(currentUser)) {
     return <Navigate to="/" replace />;
   }
   return <>{children}</>;
@@ -14,6 +14,9 @@ export interface User {
   id?: number
   username: string
   role?: string
+  // 角色拥有的管理权限
+  permissions?: string[]
+  twoFactorEnabled?: boolean
   avatar?: string
   created_at?: number
   token?: string
@@ -30,6 +33,10 @@ export interface ApiResponse<T> {
   msg?: string
   data?: T | null
   token?: string
+  // 两步验证：需要使用预认证令牌提交验证码
+  twoFactorRequired?: boolean
+  twoFactorSetupRequired?: boolean
+  preAuthToken?: string
   // MD5生成特有的字段
   added?: number
   skipped?: number
@@ -47,6 +54,8 @@ export interface LoginRequest {
 export interface RegisterRequest {
   username: string
   password: string
+  // 邀请码，注册方式为邀请注册时必填
+  inviteCode?: string
 }
 
 // MD5彩虹表条目类型